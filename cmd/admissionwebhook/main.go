@@ -0,0 +1,37 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/EdgeNet-project/edgenet/pkg/admission"
+)
+
+func main() {
+	var address, certFile, keyFile string
+	flag.StringVar(&address, "address", ":8443", "address the webhook server listens on")
+	flag.StringVar(&certFile, "tls-cert-file", "../../assets/certs/webhook.crt", "path to the TLS certificate served to the API server")
+	flag.StringVar(&keyFile, "tls-private-key-file", "../../assets/certs/webhook.key", "path to the private key of the TLS certificate")
+	flag.Parse()
+	// Start the server to validate the objects submitted to the API server
+	if err := admission.Serve(address, certFile, keyFile); err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
+}
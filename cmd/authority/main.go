@@ -5,11 +5,14 @@ import (
 
 	"github.com/EdgeNet-project/edgenet/pkg/bootstrap"
 	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/authority"
+	"github.com/EdgeNet-project/edgenet/pkg/metrics"
 )
 
 func main() {
 	// Set kubeconfig to be used to create clientsets
 	bootstrap.SetKubeConfig()
+	// Expose the metrics of the controller for Prometheus to scrape
+	metrics.Serve()
 	clientset, err := bootstrap.CreateClientSet()
 	if err != nil {
 		log.Println(err.Error())
@@ -0,0 +1,89 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/EdgeNet-project/edgenet/pkg/bootstrap"
+	"github.com/EdgeNet-project/edgenet/pkg/controllermanager"
+	"github.com/EdgeNet-project/edgenet/pkg/metrics"
+	"github.com/EdgeNet-project/edgenet/pkg/node"
+)
+
+func main() {
+	var options controllermanager.Options
+	flag.StringVar(&options.Controllers, "controllers", "*", fmt.Sprintf("comma-separated list of the controllers to run, * for all and -name to turn one off, among %s",
+		strings.Join(controllermanager.Names(), ", ")))
+	flag.BoolVar(&options.LeaderElect, "leader-elect", true, "run the controllers only while holding the lease, for running several replicas")
+	flag.StringVar(&options.LeaseNamespace, "leader-election-namespace", "kube-system", "namespace of the lease used for the leader election")
+	flag.StringVar(&options.LeaseName, "leader-election-id", "edgenet-controller-manager", "name of the lease used for the leader election")
+	flag.StringVar(&options.HealthAddress, "health-address", ":8081", "address that serves the liveness and readiness probes")
+	// The geolocation databases of the nodelabeler and the selectivedeployment controllers
+	flag.String("geolite-path", "../../assets/database/GeoLite2-City/GeoLite2-City.mmdb", "path to the MaxMind City database that locates the IP addresses")
+	flag.String("ip2location-path", "", "path to an IP2Location database in CSV format, consulted when the MaxMind database doesn't know an IP address")
+	flag.String("geo-subnets-path", "", "path to a CSV or YAML file that maps known subnets to their locations, consulted first")
+	flag.String("geolite-asn-path", "../../assets/database/GeoLite2-ASN/GeoLite2-ASN.mmdb", "path to the MaxMind ASN database that finds the autonomous systems of the nodes")
+	// The classes of the nodes by their number of CPUs and their memory in GiB
+	flag.String("cpu-classes", node.DefaultCPUClasses, "classes of the nodes by their number of CPUs, each class takes up to its maximum, and the last one the rest")
+	flag.String("memory-classes", node.DefaultMemoryClasses, "classes of the nodes by their memory in GiB, each class takes up to its maximum, and the last one the rest")
+	// Set kubeconfig to be used to create clientsets, which parses the flags above as well
+	bootstrap.SetKubeConfig()
+	names, err := controllermanager.ParseControllers(options.Controllers)
+	if err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
+	// Expose the metrics of the controllers for Prometheus to scrape
+	metrics.Serve()
+	clientset, err := bootstrap.CreateClientSet()
+	if err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
+	edgenetClientset, err := bootstrap.CreateEdgeNetClientSet()
+	if err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
+	dynamicClientset, err := bootstrap.CreateDynamicClientSet()
+	if err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
+	// Cancel the context on termination so that the leader releases the lease right away
+	ctx, cancel := context.WithCancel(context.Background())
+	sigTerm := make(chan os.Signal, 1)
+	signal.Notify(sigTerm, syscall.SIGTERM)
+	signal.Notify(sigTerm, syscall.SIGINT)
+	go func() {
+		<-sigTerm
+		cancel()
+	}()
+	clients := controllermanager.Clients{Kubernetes: clientset, EdgeNet: edgenetClientset, Dynamic: dynamicClientset}
+	if err := controllermanager.Run(ctx, clients, names, options); err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"github.com/EdgeNet-project/edgenet/pkg/bootstrap"
 	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/nodecontribution"
+	"github.com/EdgeNet-project/edgenet/pkg/metrics"
 	"log"
 )
 
 func main() {
 	// Set kubeconfig to be used to create clientsets
 	bootstrap.SetKubeConfig()
+	// Expose the metrics of the controller for Prometheus to scrape
+	metrics.Serve()
 	clientset, err := bootstrap.CreateClientSet()
 	if err != nil {
 		log.Println(err.Error())
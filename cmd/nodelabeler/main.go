@@ -20,15 +20,28 @@ limitations under the License.
 package main
 
 import (
+	"flag"
 	"log"
 
 	"github.com/EdgeNet-project/edgenet/pkg/bootstrap"
 	"github.com/EdgeNet-project/edgenet/pkg/controller/v1/nodelabeler"
+	"github.com/EdgeNet-project/edgenet/pkg/metrics"
+	"github.com/EdgeNet-project/edgenet/pkg/node"
 )
 
 func main() {
-	// Set kubeconfig to be used to create clientsets
+	// The geolocation databases, which are opened once and reloaded when their files change
+	flag.String("geolite-path", "../../assets/database/GeoLite2-City/GeoLite2-City.mmdb", "path to the MaxMind City database that locates the IP addresses")
+	flag.String("ip2location-path", "", "path to an IP2Location database in CSV format, consulted when the MaxMind database doesn't know an IP address")
+	flag.String("geo-subnets-path", "", "path to a CSV or YAML file that maps known subnets to their locations, consulted first")
+	flag.String("geolite-asn-path", "../../assets/database/GeoLite2-ASN/GeoLite2-ASN.mmdb", "path to the MaxMind ASN database that finds the autonomous systems of the nodes")
+	// The classes of the nodes by their number of CPUs and their memory in GiB
+	flag.String("cpu-classes", node.DefaultCPUClasses, "classes of the nodes by their number of CPUs, each class takes up to its maximum, and the last one the rest")
+	flag.String("memory-classes", node.DefaultMemoryClasses, "classes of the nodes by their memory in GiB, each class takes up to its maximum, and the last one the rest")
+	// Set kubeconfig to be used to create clientsets, which parses the flags above as well
 	bootstrap.SetKubeConfig()
+	// Expose the metrics of the controller for Prometheus to scrape
+	metrics.Serve()
 	clientset, err := bootstrap.CreateClientSet()
 	if err != nil {
 		log.Println(err.Error())
@@ -17,14 +17,23 @@ limitations under the License.
 package main
 
 import (
+	"flag"
+	"log"
+
 	"github.com/EdgeNet-project/edgenet/pkg/bootstrap"
 	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/selectivedeployment"
-	"log"
+	"github.com/EdgeNet-project/edgenet/pkg/metrics"
 )
 
 func main() {
-	// Set kubeconfig to be used to create clientsets
+	// The geolocation databases, which are opened once and reloaded when their files change
+	flag.String("geolite-path", "../../assets/database/GeoLite2-City/GeoLite2-City.mmdb", "path to the MaxMind City database that locates the IP addresses")
+	flag.String("ip2location-path", "", "path to an IP2Location database in CSV format, consulted when the MaxMind database doesn't know an IP address")
+	flag.String("geo-subnets-path", "", "path to a CSV or YAML file that maps known subnets to their locations, consulted first")
+	// Set kubeconfig to be used to create clientsets, which parses the flags above as well
 	bootstrap.SetKubeConfig()
+	// Expose the metrics of the controller for Prometheus to scrape
+	metrics.Serve()
 	clientset, err := bootstrap.CreateClientSet()
 	if err != nil {
 		log.Println(err.Error())
@@ -35,6 +44,11 @@ func main() {
 		log.Println(err.Error())
 		panic(err.Error())
 	}
+	dynamicClientset, err := bootstrap.CreateDynamicClientSet()
+	if err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
 	// Start the controller to provide the functionalities of selectivedeployment resource
-	selectivedeployment.Start(clientset, edgenetClientset)
+	selectivedeployment.Start(clientset, edgenetClientset, dynamicClientset)
 }
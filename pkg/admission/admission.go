@@ -0,0 +1,99 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// validateFunc takes the raw object of an admission request and returns the list of errors found
+type validateFunc func(raw []byte) field.ErrorList
+
+// Serve registers the validating webhooks and listens on the address given with TLS
+func Serve(address string, certFile string, keyFile string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/validate-selectivedeployment", handle(validateSelectiveDeploymentRaw))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	server := &http.Server{
+		Addr:    address,
+		Handler: mux,
+	}
+	log.Infof("Admission webhook server listening on %s", address)
+	return server.ListenAndServeTLS(certFile, keyFile)
+}
+
+// handle decodes the AdmissionReview sent by the API server, runs the validation, and writes the review back
+func handle(validate validateFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		review := admissionv1.AdmissionReview{}
+		if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+			http.Error(w, fmt.Sprintf("malformed admission review: %v", err), http.StatusBadRequest)
+			return
+		}
+		review.Response = respond(review.Request, validate)
+		review.Request = nil
+		response, err := json.Marshal(review)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response)
+	}
+}
+
+// respond builds the admission response which allows or refuses the object in the request
+func respond(request *admissionv1.AdmissionRequest, validate validateFunc) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{
+		UID:     request.UID,
+		Allowed: true,
+	}
+	// Nothing to check when the object is going away
+	if request.Operation == admissionv1.Delete {
+		return response
+	}
+	if errs := validate(request.Object.Raw); len(errs) > 0 {
+		log.Infof("Admission refused %s/%s: %s", request.Namespace, request.Name, errs.ToAggregate().Error())
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+			Message: errs.ToAggregate().Error(),
+		}
+	}
+	return response
+}
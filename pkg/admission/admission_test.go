@@ -0,0 +1,305 @@
+package admission
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
+	"github.com/EdgeNet-project/edgenet/pkg/util"
+	"github.com/sirupsen/logrus"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+	logrus.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+func getSelectiveDeployment() apps_v1alpha.SelectiveDeployment {
+	sdObj := apps_v1alpha.SelectiveDeployment{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "SelectiveDeployment",
+			APIVersion: "apps.edgenet.io/v1alpha",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "default",
+		},
+		Spec: apps_v1alpha.SelectiveDeploymentSpec{
+			Workloads: apps_v1alpha.Workloads{
+				Deployment: []appsv1.Deployment{
+					appsv1.Deployment{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "default",
+						},
+					},
+				},
+			},
+			Selector: []apps_v1alpha.Selector{
+				apps_v1alpha.Selector{
+					Name:     "City",
+					Value:    []string{"Paris"},
+					Operator: "In",
+					Quantity: 1,
+				},
+				apps_v1alpha.Selector{
+					Name:     "Polygon",
+					Value:    []string{"[ [2.2150567, 48.8947616], [2.2040704, 48.8084639], [2.3393396, 48.7835862], [2.4519494, 48.8416903], [2.3932412, 48.9171024] ]"},
+					Operator: "NotIn",
+				},
+			},
+		},
+	}
+	return sdObj
+}
+
+func TestValidateSelectiveDeployment(t *testing.T) {
+	valid := getSelectiveDeployment()
+	unknownName := getSelectiveDeployment()
+	unknownName.Spec.Selector[0].Name = "Street"
+	unsupportedOperator := getSelectiveDeployment()
+	unsupportedOperator.Spec.Selector[0].Operator = "Exists"
+	negativeQuantity := getSelectiveDeployment()
+	negativeQuantity.Spec.Selector[0].Quantity = -1
+	emptyValue := getSelectiveDeployment()
+	emptyValue.Spec.Selector[0].Value = []string{}
+	malformedPolygon := getSelectiveDeployment()
+	malformedPolygon.Spec.Selector[1].Value = []string{"[ [2.2150567, 48.8947616], [2.2040704 ]"}
+	shortPolygon := getSelectiveDeployment()
+	shortPolygon.Spec.Selector[1].Value = []string{"[ [2.2150567, 48.8947616], [2.2040704, 48.8084639] ]"}
+	outOfRangePolygon := getSelectiveDeployment()
+	outOfRangePolygon.Spec.Selector[1].Value = []string{"[ [2.2150567, 98.8947616], [2.2040704, 48.8084639], [2.3393396, 48.7835862] ]"}
+	featureCollection := getSelectiveDeployment()
+	featureCollection.Spec.Selector[1].Value = []string{`{"type": "FeatureCollection", "features": [{"type": "Feature", "properties": {}, "geometry": {"type": "MultiPolygon", "coordinates": [[[[2.2, 48.8], [2.4, 48.8], [2.4, 48.9], [2.2, 48.9], [2.2, 48.8]]]]}}]}`}
+	unsupportedGeometry := getSelectiveDeployment()
+	unsupportedGeometry.Spec.Selector[1].Value = []string{`{"type": "Point", "coordinates": [2.2, 48.8]}`}
+	radius := getSelectiveDeployment()
+	radius.Spec.Selector[1] = apps_v1alpha.Selector{Name: "Radius", Value: []string{"48.8566, 2.3522, 50km"}, Operator: "In"}
+	negativeRadius := getSelectiveDeployment()
+	negativeRadius.Spec.Selector[1] = apps_v1alpha.Selector{Name: "Radius", Value: []string{"48.8566, 2.3522, -50"}, Operator: "In"}
+	malformedRadius := getSelectiveDeployment()
+	malformedRadius.Spec.Selector[1] = apps_v1alpha.Selector{Name: "Radius", Value: []string{"48.8566, 50"}, Operator: "In"}
+	nearest := getSelectiveDeployment()
+	nearest.Spec.Selector[1] = apps_v1alpha.Selector{Name: "Nearest", Value: []string{"48.8566, 2.3522", "132.227.123.12"}, Operator: "In", Quantity: 5}
+	nearestNotIn := getSelectiveDeployment()
+	nearestNotIn.Spec.Selector[1] = apps_v1alpha.Selector{Name: "Nearest", Value: []string{"48.8566, 2.3522"}, Operator: "NotIn", Quantity: 5}
+	malformedNearest := getSelectiveDeployment()
+	malformedNearest.Spec.Selector[1] = apps_v1alpha.Selector{Name: "Nearest", Value: []string{"paris"}, Operator: "In", Quantity: 5}
+	asn := getSelectiveDeployment()
+	asn.Spec.Selector[1] = apps_v1alpha.Selector{Name: "ASN", Value: []string{"2200", "7922"}, Operator: "In", Quantity: 2}
+	malformedASN := getSelectiveDeployment()
+	malformedASN.Spec.Selector[1] = apps_v1alpha.Selector{Name: "ASN", Value: []string{"AS2200"}, Operator: "In"}
+	asOrg := getSelectiveDeployment()
+	asOrg.Spec.Selector[1] = apps_v1alpha.Selector{Name: "ASOrg", Value: []string{"Comcast Cable Communications, LLC"}, Operator: "NotIn"}
+	nat := getSelectiveDeployment()
+	nat.Spec.Selector[1] = apps_v1alpha.Selector{Name: "NAT", Value: []string{"false"}, Operator: "In"}
+	malformedNAT := getSelectiveDeployment()
+	malformedNAT.Spec.Selector[1] = apps_v1alpha.Selector{Name: "NAT", Value: []string{"yes"}, Operator: "In"}
+	label := getSelectiveDeployment()
+	label.Spec.Selector[1] = apps_v1alpha.Selector{Name: "Label", Key: "kubernetes.io/arch", Value: []string{"arm64"}, Operator: "In"}
+	labelExists := getSelectiveDeployment()
+	labelExists.Spec.Selector[1] = apps_v1alpha.Selector{Name: "Label", Key: "edge-net.io/gpu", Operator: "Exists"}
+	labelNoKey := getSelectiveDeployment()
+	labelNoKey.Spec.Selector[1] = apps_v1alpha.Selector{Name: "Label", Value: []string{"arm64"}, Operator: "In"}
+	labelExistsValue := getSelectiveDeployment()
+	labelExistsValue.Spec.Selector[1] = apps_v1alpha.Selector{Name: "Label", Key: "edge-net.io/gpu", Value: []string{"true"}, Operator: "Exists"}
+	labelGtNaN := getSelectiveDeployment()
+	labelGtNaN.Spec.Selector[1] = apps_v1alpha.Selector{Name: "Label", Key: "edge-net.io/cpu", Value: []string{"many"}, Operator: "Gt"}
+	group := getSelectiveDeployment()
+	group.Spec.Selector = nil
+	group.Spec.SelectorGroups = []apps_v1alpha.SelectorGroup{{Selector: []apps_v1alpha.Selector{{Name: "Country", Value: []string{"FR"}, Operator: "In"}, {Name: "City", Value: []string{"Paris"}, Operator: "NotIn"}}, Quantity: 2}}
+	groupSelectorQuantity := getSelectiveDeployment()
+	groupSelectorQuantity.Spec.SelectorGroups = []apps_v1alpha.SelectorGroup{{Selector: []apps_v1alpha.Selector{{Name: "Country", Value: []string{"FR"}, Operator: "In", Quantity: 1}}}}
+	groupEmpty := getSelectiveDeployment()
+	groupEmpty.Spec.SelectorGroups = []apps_v1alpha.SelectorGroup{{Quantity: 2}}
+	preferred := getSelectiveDeployment()
+	preferred.Spec.Selector[0].Mode = "Preferred"
+	preferred.Spec.Selector[0].Weight = 50
+	unknownMode := getSelectiveDeployment()
+	unknownMode.Spec.Selector[0].Mode = "Soft"
+	requiredWeight := getSelectiveDeployment()
+	requiredWeight.Spec.Selector[0].Weight = 50
+	heavyWeight := getSelectiveDeployment()
+	heavyWeight.Spec.Selector[0].Mode = "Preferred"
+	heavyWeight.Spec.Selector[0].Weight = 500
+	labelPreferred := getSelectiveDeployment()
+	labelPreferred.Spec.Selector[1] = apps_v1alpha.Selector{Name: "Label", Key: "kubernetes.io/arch", Value: []string{"arm64"}, Operator: "In", Mode: "Preferred"}
+	groupPreferred := getSelectiveDeployment()
+	groupPreferred.Spec.SelectorGroups = []apps_v1alpha.SelectorGroup{{Selector: []apps_v1alpha.Selector{{Name: "Country", Value: []string{"FR"}, Operator: "In"}}, Mode: "Preferred", Weight: 10}}
+	groupSelectorMode := getSelectiveDeployment()
+	groupSelectorMode.Spec.SelectorGroups = []apps_v1alpha.SelectorGroup{{Selector: []apps_v1alpha.Selector{{Name: "Country", Value: []string{"FR"}, Operator: "In", Mode: "Preferred"}}}}
+	percentage := getSelectiveDeployment()
+	percentage.Spec.Selector[1].Percentage = 30
+	percentage.Spec.Selector[1].MinQuantity = 3
+	percentage.Spec.Selector[1].MaxQuantity = 10
+	overPercentage := getSelectiveDeployment()
+	overPercentage.Spec.Selector[1].Percentage = 130
+	invertedRange := getSelectiveDeployment()
+	invertedRange.Spec.Selector[1].MinQuantity = 10
+	invertedRange.Spec.Selector[1].MaxQuantity = 3
+	quantityRange := getSelectiveDeployment()
+	quantityRange.Spec.Selector[0].Quantity = 2
+	quantityRange.Spec.Selector[0].MaxQuantity = 3
+	groupRange := getSelectiveDeployment()
+	groupRange.Spec.SelectorGroups = []apps_v1alpha.SelectorGroup{{Selector: []apps_v1alpha.Selector{{Name: "Country", Value: []string{"FR"}, Operator: "In", Percentage: 50}}}}
+	scheduled := getSelectiveDeployment()
+	scheduled.Spec.Schedule = &apps_v1alpha.Schedule{Windows: []apps_v1alpha.ScheduleWindow{{Cron: "0 8 * * 1-5", Duration: "10h"}},
+		LocalTime: &apps_v1alpha.LocalTimeRange{From: "22:00", To: "06:00"}}
+	malformedCron := getSelectiveDeployment()
+	malformedCron.Spec.Schedule = &apps_v1alpha.Schedule{Windows: []apps_v1alpha.ScheduleWindow{{Cron: "0 8 * *", Duration: "10h"}}}
+	longWindow := getSelectiveDeployment()
+	longWindow.Spec.Schedule = &apps_v1alpha.Schedule{Windows: []apps_v1alpha.ScheduleWindow{{Cron: "0 8 * * *", Duration: "1000h"}}}
+	malformedLocalTime := getSelectiveDeployment()
+	malformedLocalTime.Spec.Schedule = &apps_v1alpha.Schedule{LocalTime: &apps_v1alpha.LocalTimeRange{From: "8am", To: "20:00"}}
+	noSelector := getSelectiveDeployment()
+	noSelector.Spec.Selector = nil
+	orphan := getSelectiveDeployment()
+	orphan.Spec.DeletionPolicy = "Orphan"
+	unknownPolicy := getSelectiveDeployment()
+	unknownPolicy.Spec.DeletionPolicy = "Retain"
+	emptyWorkloads := getSelectiveDeployment()
+	emptyWorkloads.Spec.Workloads = apps_v1alpha.Workloads{}
+	unnamedWorkload := getSelectiveDeployment()
+	unnamedWorkload.Spec.Workloads.Deployment[0].SetName("")
+	generic := getSelectiveDeployment()
+	generic.Spec.Workloads = apps_v1alpha.Workloads{Generic: []apps_v1alpha.GenericWorkload{{APIVersion: "apps/v1", Kind: "ReplicaSet", TemplatePath: "spec.template",
+		Object: runtime.RawExtension{Raw: []byte(`{"metadata": {"name": "nginx"}, "spec": {"template": {"spec": {}}}}`)}}}}
+	genericNoTemplate := generic.DeepCopy()
+	genericNoTemplate.Spec.Workloads.Generic[0].TemplatePath = "spec.podTemplate"
+	genericUnnamed := generic.DeepCopy()
+	genericUnnamed.Spec.Workloads.Generic[0].Object.Raw = []byte(`{"spec": {"template": {"spec": {}}}}`)
+	genericNoKind := generic.DeepCopy()
+	genericNoKind.Spec.Workloads.Generic[0].Kind = ""
+
+	cases := map[string]struct {
+		input    apps_v1alpha.SelectiveDeployment
+		expected int
+		field    string
+	}{
+		"valid":                 {valid, 0, ""},
+		"selector/name":         {unknownName, 1, "spec.selector[0].name"},
+		"selector/operator":     {unsupportedOperator, 1, "spec.selector[0].operator"},
+		"selector/quantity":     {negativeQuantity, 1, "spec.selector[0].quantity"},
+		"selector/value":        {emptyValue, 1, "spec.selector[0].value"},
+		"polygon/malformed":     {malformedPolygon, 1, "spec.selector[1].value[0]"},
+		"polygon/short":         {shortPolygon, 1, "spec.selector[1].value[0]"},
+		"polygon/out-of-range":  {outOfRangePolygon, 1, "spec.selector[1].value[0]"},
+		"polygon/geojson":       {featureCollection, 0, ""},
+		"polygon/point":         {unsupportedGeometry, 1, "spec.selector[1].value[0]"},
+		"radius/valid":          {radius, 0, ""},
+		"radius/negative":       {negativeRadius, 1, "spec.selector[1].value[0]"},
+		"radius/malformed":      {malformedRadius, 1, "spec.selector[1].value[0]"},
+		"nearest/valid":         {nearest, 0, ""},
+		"nearest/operator":      {nearestNotIn, 1, "spec.selector[1].operator"},
+		"nearest/malformed":     {malformedNearest, 1, "spec.selector[1].value[0]"},
+		"asn/valid":             {asn, 0, ""},
+		"asn/malformed":         {malformedASN, 1, "spec.selector[1].value[0]"},
+		"asorg/valid":           {asOrg, 0, ""},
+		"nat/valid":             {nat, 0, ""},
+		"nat/malformed":         {malformedNAT, 1, "spec.selector[1].value[0]"},
+		"label/valid":           {label, 0, ""},
+		"label/exists":          {labelExists, 0, ""},
+		"label/key":             {labelNoKey, 1, "spec.selector[1].key"},
+		"label/exists/value":    {labelExistsValue, 1, "spec.selector[1].value"},
+		"label/gt/nan":          {labelGtNaN, 1, "spec.selector[1].value[0]"},
+		"group/valid":           {group, 0, ""},
+		"group/quantity":        {groupSelectorQuantity, 1, "spec.selectorgroups[0].selector[0].quantity"},
+		"group/empty":           {groupEmpty, 1, "spec.selectorgroups[0].selector"},
+		"selector/none":         {noSelector, 1, "spec.selector"},
+		"range/valid":           {percentage, 0, ""},
+		"range/percentage":      {overPercentage, 1, "spec.selector[1].percentage"},
+		"range/inverted":        {invertedRange, 1, "spec.selector[1].maxquantity"},
+		"range/quantity":        {quantityRange, 1, "spec.selector[0].quantity"},
+		"range/group/selector":  {groupRange, 1, "spec.selectorgroups[0].selector[0]"},
+		"schedule/valid":        {scheduled, 0, ""},
+		"schedule/cron":         {malformedCron, 1, "spec.schedule.windows[0].cron"},
+		"schedule/duration":     {longWindow, 1, "spec.schedule.windows[0].duration"},
+		"schedule/localtime":    {malformedLocalTime, 1, "spec.schedule.localtime.from"},
+		"mode/preferred":        {preferred, 0, ""},
+		"mode/unknown":          {unknownMode, 1, "spec.selector[0].mode"},
+		"mode/weight/required":  {requiredWeight, 1, "spec.selector[0].weight"},
+		"mode/weight/range":     {heavyWeight, 1, "spec.selector[0].weight"},
+		"mode/label":            {labelPreferred, 1, "spec.selector[1].mode"},
+		"mode/group":            {groupPreferred, 0, ""},
+		"mode/group/selector":   {groupSelectorMode, 1, "spec.selectorgroups[0].selector[0].mode"},
+		"deletionpolicy/orphan": {orphan, 0, ""},
+		"deletionpolicy/retain": {unknownPolicy, 1, "spec.deletionpolicy"},
+		"workloads/empty":       {emptyWorkloads, 1, "spec.workloads"},
+		"workloads/unnamed":     {unnamedWorkload, 1, "spec.workloads.deployment[0].metadata.name"},
+		"generic/valid":         {generic, 0, ""},
+		"generic/template":      {*genericNoTemplate, 1, "spec.workloads.generic[0].templatepath"},
+		"generic/unnamed":       {*genericUnnamed, 1, "spec.workloads.generic[0].object.metadata.name"},
+		"generic/kind":          {*genericNoKind, 1, "spec.workloads.generic[0].kind"},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			errs := ValidateSelectiveDeployment(&tc.input)
+			util.Equals(t, tc.expected, len(errs))
+			if tc.expected > 0 {
+				util.Equals(t, tc.field, errs[0].Field)
+			}
+		})
+	}
+}
+
+func TestHandle(t *testing.T) {
+	server := httptest.NewServer(handle(validateSelectiveDeploymentRaw))
+	defer server.Close()
+
+	valid := getSelectiveDeployment()
+	invalid := getSelectiveDeployment()
+	invalid.Spec.Selector[0].Name = "Street"
+	cases := map[string]struct {
+		input    apps_v1alpha.SelectiveDeployment
+		expected bool
+	}{
+		"allowed": {valid, true},
+		"refused": {invalid, false},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			raw, err := json.Marshal(tc.input)
+			util.OK(t, err)
+			review := admissionv1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "AdmissionReview",
+					APIVersion: "admission.k8s.io/v1",
+				},
+				Request: &admissionv1.AdmissionRequest{
+					UID:       "8c4f1f7e-03b4-4f5b-9b1f-9f0a6b2b3c4d",
+					Operation: admissionv1.Create,
+					Object:    runtime.RawExtension{Raw: raw},
+				},
+			}
+			body, err := json.Marshal(review)
+			util.OK(t, err)
+			resp, err := http.Post(server.URL, "application/json", bytes.NewReader(body))
+			util.OK(t, err)
+			defer resp.Body.Close()
+			util.Equals(t, http.StatusOK, resp.StatusCode)
+			result := admissionv1.AdmissionReview{}
+			err = json.NewDecoder(resp.Body).Decode(&result)
+			util.OK(t, err)
+			util.Equals(t, review.Request.UID, result.Response.UID)
+			util.Equals(t, tc.expected, result.Response.Allowed)
+			if !tc.expected {
+				util.Equals(t, int32(http.StatusUnprocessableEntity), result.Response.Result.Code)
+			}
+		})
+	}
+	t.Run("malformed", func(t *testing.T) {
+		resp, err := http.Post(server.URL, "application/json", bytes.NewReader([]byte("{")))
+		util.OK(t, err)
+		util.Equals(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
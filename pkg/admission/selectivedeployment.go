@@ -0,0 +1,340 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
+	"github.com/EdgeNet-project/edgenet/pkg/node"
+	"github.com/EdgeNet-project/edgenet/pkg/schedule"
+	"github.com/EdgeNet-project/edgenet/pkg/util"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// The selector names and operators that the selectivedeployment controller knows how to handle
+var selectorNames = []string{"city", "state", "country", "continent", "asn", "asorg", "nat", "polygon", "radius", "nearest", "label"}
+var selectorOperators = []string{string(corev1.NodeSelectorOpIn), string(corev1.NodeSelectorOpNotIn)}
+var labelSelectorOperators = []string{string(corev1.NodeSelectorOpIn), string(corev1.NodeSelectorOpNotIn), string(corev1.NodeSelectorOpExists),
+	string(corev1.NodeSelectorOpDoesNotExist), string(corev1.NodeSelectorOpGt), string(corev1.NodeSelectorOpLt)}
+var deletionPolicies = []string{"Delete", "Orphan"}
+var placementModes = []string{"Required", "Preferred"}
+
+// validateSelectiveDeploymentRaw decodes the selectivedeployment in the admission request before validating it
+func validateSelectiveDeploymentRaw(raw []byte) field.ErrorList {
+	sdObj := apps_v1alpha.SelectiveDeployment{}
+	if err := json.Unmarshal(raw, &sdObj); err != nil {
+		return field.ErrorList{field.Invalid(field.NewPath("spec"), "", fmt.Sprintf("cannot be decoded: %s", err))}
+	}
+	return ValidateSelectiveDeployment(&sdObj)
+}
+
+// ValidateSelectiveDeployment checks whether the spec of a selectivedeployment can be handled by the controller
+func ValidateSelectiveDeployment(sdObj *apps_v1alpha.SelectiveDeployment) field.ErrorList {
+	errs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+	errs = append(errs, validateWorkloads(sdObj.Spec.Workloads, specPath.Child("workloads"))...)
+	for i, selectorRow := range sdObj.Spec.Selector {
+		selectorPath := specPath.Child("selector").Index(i)
+		errs = append(errs, validateSelector(selectorRow, selectorPath)...)
+		if strings.ToLower(selectorRow.Name) == "label" {
+			errs = append(errs, forbidPlacement(selectorRow, selectorPath, "the label selectors are added to the terms of the other selectors")...)
+		} else {
+			errs = append(errs, validatePlacement(selectorRow.Mode, selectorRow.Weight, selectorPath)...)
+		}
+	}
+	for i, groupRow := range sdObj.Spec.SelectorGroups {
+		errs = append(errs, validateSelectorGroup(groupRow, specPath.Child("selectorgroups").Index(i))...)
+	}
+	if sdObj.Spec.Schedule != nil {
+		errs = append(errs, validateSchedule(sdObj.Spec.Schedule, specPath.Child("schedule"))...)
+	}
+	if sdObj.Spec.DeletionPolicy != "" && !util.Contains(deletionPolicies, sdObj.Spec.DeletionPolicy) {
+		errs = append(errs, field.NotSupported(specPath.Child("deletionpolicy"), sdObj.Spec.DeletionPolicy, deletionPolicies))
+	}
+	if len(sdObj.Spec.Selector) == 0 && len(sdObj.Spec.SelectorGroups) == 0 {
+		errs = append(errs, field.Required(specPath.Child("selector"), "either a selector or a selector group must be defined"))
+	}
+	return errs
+}
+
+// validateSchedule checks the cron expressions and the durations of the windows, and the hours of the local time range
+func validateSchedule(sdSchedule *apps_v1alpha.Schedule, schedulePath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	for i, windowRow := range sdSchedule.Windows {
+		windowPath := schedulePath.Child("windows").Index(i)
+		if _, err := schedule.ParseCron(windowRow.Cron); err != nil {
+			errs = append(errs, field.Invalid(windowPath.Child("cron"), windowRow.Cron, err.Error()))
+		}
+		if duration, err := time.ParseDuration(windowRow.Duration); err != nil {
+			errs = append(errs, field.Invalid(windowPath.Child("duration"), windowRow.Duration, err.Error()))
+		} else if duration <= 0 || duration > schedule.MaxWindowDuration {
+			errs = append(errs, field.Invalid(windowPath.Child("duration"), windowRow.Duration, fmt.Sprintf("must be greater than 0 and at most %s", schedule.MaxWindowDuration)))
+		}
+	}
+	if sdSchedule.LocalTime != nil {
+		if _, err := schedule.ParseClock(sdSchedule.LocalTime.From); err != nil {
+			errs = append(errs, field.Invalid(schedulePath.Child("localtime", "from"), sdSchedule.LocalTime.From, err.Error()))
+		}
+		if _, err := schedule.ParseClock(sdSchedule.LocalTime.To); err != nil {
+			errs = append(errs, field.Invalid(schedulePath.Child("localtime", "to"), sdSchedule.LocalTime.To, err.Error()))
+		}
+	}
+	return errs
+}
+
+// validateSelectorGroup checks the selectors of a group, whose quantity replaces the quantities of the selectors
+func validateSelectorGroup(groupRow apps_v1alpha.SelectorGroup, groupPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if groupRow.Quantity < 0 {
+		errs = append(errs, field.Invalid(groupPath.Child("quantity"), groupRow.Quantity, "must be greater than or equal to 0"))
+	}
+	errs = append(errs, validateNodeCount(groupRow.Quantity, groupRow.Percentage, groupRow.MinQuantity, groupRow.MaxQuantity, groupPath)...)
+	if len(groupRow.Selector) == 0 {
+		errs = append(errs, field.Required(groupPath.Child("selector"), ""))
+	}
+	errs = append(errs, validatePlacement(groupRow.Mode, groupRow.Weight, groupPath)...)
+	for i, selectorRow := range groupRow.Selector {
+		selectorPath := groupPath.Child("selector").Index(i)
+		errs = append(errs, validateSelector(selectorRow, selectorPath)...)
+		if selectorRow.Quantity > 0 && strings.ToLower(selectorRow.Name) != "label" {
+			errs = append(errs, field.Forbidden(selectorPath.Child("quantity"), "the quantity of the group applies to the selectors in it"))
+		}
+		if (selectorRow.Percentage != 0 || selectorRow.MinQuantity != 0 || selectorRow.MaxQuantity != 0) && strings.ToLower(selectorRow.Name) != "label" {
+			errs = append(errs, field.Forbidden(selectorPath, "the percentage and the range of the group apply to the selectors in it"))
+		}
+		errs = append(errs, forbidPlacement(selectorRow, selectorPath, "the mode of the group applies to the selectors in it")...)
+	}
+	return errs
+}
+
+// validateNodeCount checks the percentage and the range of nodes, which replace the exact quantity
+func validateNodeCount(quantity int, percentage int, min int, max int, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if percentage < 0 || percentage > 100 {
+		errs = append(errs, field.Invalid(path.Child("percentage"), percentage, "must be in the range 1-100"))
+	}
+	if min < 0 {
+		errs = append(errs, field.Invalid(path.Child("minquantity"), min, "must be greater than or equal to 0"))
+	}
+	if max < 0 {
+		errs = append(errs, field.Invalid(path.Child("maxquantity"), max, "must be greater than or equal to 0"))
+	} else if max != 0 && min > max {
+		errs = append(errs, field.Invalid(path.Child("maxquantity"), max, "must be greater than or equal to minquantity"))
+	}
+	if quantity != 0 && (percentage != 0 || min != 0 || max != 0) {
+		errs = append(errs, field.Forbidden(path.Child("quantity"), "cannot be combined with percentage, minquantity, or maxquantity"))
+	}
+	return errs
+}
+
+// validatePlacement checks the mode and the weight, which is only meaningful for the preferred scheduling terms
+func validatePlacement(mode string, weight int32, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if mode != "" && !util.Contains(placementModes, mode) {
+		errs = append(errs, field.NotSupported(path.Child("mode"), mode, placementModes))
+	}
+	if weight != 0 && mode != "Preferred" {
+		errs = append(errs, field.Forbidden(path.Child("weight"), "must not be set unless mode is Preferred"))
+	} else if weight < 0 || weight > 100 {
+		errs = append(errs, field.Invalid(path.Child("weight"), weight, "must be in the range 1-100"))
+	}
+	return errs
+}
+
+// forbidPlacement refuses the mode and the weight of a selector that doesn't form a term by itself
+func forbidPlacement(selectorRow apps_v1alpha.Selector, selectorPath *field.Path, detail string) field.ErrorList {
+	errs := field.ErrorList{}
+	if selectorRow.Mode != "" {
+		errs = append(errs, field.Forbidden(selectorPath.Child("mode"), detail))
+	}
+	if selectorRow.Weight != 0 {
+		errs = append(errs, field.Forbidden(selectorPath.Child("weight"), detail))
+	}
+	return errs
+}
+
+// validateWorkloads refuses an empty workload list and the workloads without a name
+func validateWorkloads(workloads apps_v1alpha.Workloads, workloadsPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	workloadCounter := 0
+	checkName := func(kind string, index int, name string) {
+		workloadCounter++
+		if name == "" {
+			errs = append(errs, field.Required(workloadsPath.Child(kind).Index(index).Child("metadata", "name"), ""))
+		}
+	}
+	for i, workloadRow := range workloads.Deployment {
+		checkName("deployment", i, workloadRow.GetName())
+	}
+	for i, workloadRow := range workloads.DaemonSet {
+		checkName("daemonset", i, workloadRow.GetName())
+	}
+	for i, workloadRow := range workloads.StatefulSet {
+		checkName("statefulset", i, workloadRow.GetName())
+	}
+	for i, workloadRow := range workloads.Job {
+		checkName("job", i, workloadRow.GetName())
+	}
+	for i, workloadRow := range workloads.CronJob {
+		checkName("cronjob", i, workloadRow.GetName())
+	}
+	for i, genericRow := range workloads.Generic {
+		workloadCounter++
+		errs = append(errs, validateGenericWorkload(genericRow, workloadsPath.Child("generic").Index(i))...)
+	}
+	if workloadCounter == 0 {
+		errs = append(errs, field.Required(workloadsPath, "at least one workload must be defined"))
+	}
+	return errs
+}
+
+// validateGenericWorkload checks that the object of a generic workload has a name and a pod template at the path given
+func validateGenericWorkload(genericRow apps_v1alpha.GenericWorkload, genericPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if genericRow.APIVersion == "" {
+		errs = append(errs, field.Required(genericPath.Child("apiversion"), ""))
+	}
+	if genericRow.Kind == "" {
+		errs = append(errs, field.Required(genericPath.Child("kind"), ""))
+	}
+	object := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	if len(genericRow.Object.Raw) == 0 {
+		return append(errs, field.Required(genericPath.Child("object"), ""))
+	} else if err := json.Unmarshal(genericRow.Object.Raw, &object.Object); err != nil {
+		return append(errs, field.Invalid(genericPath.Child("object"), "", fmt.Sprintf("cannot be decoded: %s", err)))
+	}
+	if object.GetName() == "" {
+		errs = append(errs, field.Required(genericPath.Child("object", "metadata", "name"), ""))
+	}
+	if genericRow.TemplatePath != "" {
+		if _, found, err := unstructured.NestedMap(object.Object, strings.Split(genericRow.TemplatePath, ".")...); !found || err != nil {
+			errs = append(errs, field.Invalid(genericPath.Child("templatepath"), genericRow.TemplatePath, "no pod template found at the path in the object"))
+		}
+	}
+	return errs
+}
+
+// validateSelector checks the name, the operator, the quantity, and the values of a selector
+func validateSelector(selectorRow apps_v1alpha.Selector, selectorPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	selectorName := strings.ToLower(selectorRow.Name)
+	if !util.Contains(selectorNames, selectorName) {
+		errs = append(errs, field.NotSupported(selectorPath.Child("name"), selectorRow.Name, selectorNames))
+	}
+	if selectorName == "label" {
+		// The label selectors have their own rules as they follow the node selector requirements of Kubernetes
+		return append(errs, validateLabelSelector(selectorRow, selectorPath)...)
+	}
+	if !util.Contains(selectorOperators, string(selectorRow.Operator)) {
+		errs = append(errs, field.NotSupported(selectorPath.Child("operator"), selectorRow.Operator, selectorOperators))
+	}
+	if selectorRow.Quantity < 0 {
+		errs = append(errs, field.Invalid(selectorPath.Child("quantity"), selectorRow.Quantity, "must be greater than or equal to 0"))
+	}
+	errs = append(errs, validateNodeCount(selectorRow.Quantity, selectorRow.Percentage, selectorRow.MinQuantity, selectorRow.MaxQuantity, selectorPath)...)
+	if len(selectorRow.Value) == 0 {
+		errs = append(errs, field.Required(selectorPath.Child("value"), ""))
+	}
+	switch selectorName {
+	case "polygon":
+		for i, selectorValue := range selectorRow.Value {
+			if _, err := node.ParseGeoJSON(selectorValue); err != nil {
+				errs = append(errs, field.Invalid(selectorPath.Child("value").Index(i), selectorValue, fmt.Sprintf("has a GeoJSON format error: %s", err)))
+			}
+		}
+	case "radius":
+		for i, selectorValue := range selectorRow.Value {
+			if _, err := node.ParseCircle(selectorValue); err != nil {
+				errs = append(errs, field.Invalid(selectorPath.Child("value").Index(i), selectorValue, fmt.Sprintf("has a radius format error: %s", err)))
+			}
+		}
+	case "asn":
+		for i, selectorValue := range selectorRow.Value {
+			if _, err := strconv.ParseUint(selectorValue, 10, 32); err != nil {
+				errs = append(errs, field.Invalid(selectorPath.Child("value").Index(i), selectorValue, "must be the number of an autonomous system"))
+			}
+		}
+	case "nat":
+		for i, selectorValue := range selectorRow.Value {
+			if selectorValue != "true" && selectorValue != "false" {
+				errs = append(errs, field.NotSupported(selectorPath.Child("value").Index(i), selectorValue, []string{"true", "false"}))
+			}
+		}
+	case "nearest":
+		// Picking the nodes that are not among the nearest ones has no use
+		if selectorRow.Operator != corev1.NodeSelectorOpIn {
+			errs = append(errs, field.NotSupported(selectorPath.Child("operator"), selectorRow.Operator, []string{string(corev1.NodeSelectorOpIn)}))
+		}
+		for i, selectorValue := range selectorRow.Value {
+			// The IP addresses are located by the controller as the webhook doesn't hold the GeoLite database
+			if net.ParseIP(strings.TrimSpace(selectorValue)) != nil {
+				continue
+			}
+			if _, _, err := node.ParseReferencePoint(selectorValue); err != nil {
+				errs = append(errs, field.Invalid(selectorPath.Child("value").Index(i), selectorValue, fmt.Sprintf("has a reference point format error: %s", err)))
+			}
+		}
+	}
+	return errs
+}
+
+// validateLabelSelector checks the key, the operator, and the values of a label selector
+func validateLabelSelector(selectorRow apps_v1alpha.Selector, selectorPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if selectorRow.Key == "" {
+		errs = append(errs, field.Required(selectorPath.Child("key"), ""))
+	} else {
+		for _, msg := range validation.IsQualifiedName(selectorRow.Key) {
+			errs = append(errs, field.Invalid(selectorPath.Child("key"), selectorRow.Key, msg))
+		}
+	}
+	if selectorRow.Quantity != 0 {
+		errs = append(errs, field.Invalid(selectorPath.Child("quantity"), selectorRow.Quantity, "must not be set for label selectors"))
+	}
+	if selectorRow.Percentage != 0 || selectorRow.MinQuantity != 0 || selectorRow.MaxQuantity != 0 {
+		errs = append(errs, field.Forbidden(selectorPath, "percentage, minquantity, and maxquantity must not be set for label selectors"))
+	}
+	switch selectorRow.Operator {
+	case corev1.NodeSelectorOpIn, corev1.NodeSelectorOpNotIn:
+		if len(selectorRow.Value) == 0 {
+			errs = append(errs, field.Required(selectorPath.Child("value"), ""))
+		}
+	case corev1.NodeSelectorOpExists, corev1.NodeSelectorOpDoesNotExist:
+		if len(selectorRow.Value) != 0 {
+			errs = append(errs, field.Forbidden(selectorPath.Child("value"), fmt.Sprintf("must be empty when operator is %s", selectorRow.Operator)))
+		}
+	case corev1.NodeSelectorOpGt, corev1.NodeSelectorOpLt:
+		if len(selectorRow.Value) != 1 {
+			errs = append(errs, field.Invalid(selectorPath.Child("value"), selectorRow.Value, fmt.Sprintf("must have a single element when operator is %s", selectorRow.Operator)))
+		} else if _, err := strconv.ParseInt(selectorRow.Value[0], 10, 64); err != nil {
+			errs = append(errs, field.Invalid(selectorPath.Child("value").Index(0), selectorRow.Value[0], "must be an integer"))
+		}
+	default:
+		errs = append(errs, field.NotSupported(selectorPath.Child("operator"), selectorRow.Operator, labelSelectorOperators))
+	}
+	return errs
+}
@@ -22,6 +22,7 @@ import (
 	batchv1beta "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // +genclient
@@ -43,30 +44,108 @@ type SelectiveDeployment struct {
 // SelectiveDeploymentSpec is the spec for a SelectiveDeployment resource
 type SelectiveDeploymentSpec struct {
 	// The controller indicates the name and type of controller desired to configure
-	// Workloads: deployment, daemonset, and statefulsets
+	// Workloads: deployment, daemonset, statefulset, job, cronjob, and generic for any other kind embedding a pod template
 	// The type is for defining which kind of selectivedeployment it is, you could find the list of active types below.
-	// Types of selector: city, state, country, continent, and polygon
+	// Types of selector: city, state, country, continent, polygon, radius, nearest, and label
+	// The polygon values are either a ring of [lon, lat] points or a GeoJSON Polygon, MultiPolygon, Feature, or FeatureCollection
+	// The radius values are in the form of "lat, lon, radius" where the radius is the great-circle distance in kilometers
+	// The nearest values are either "lat, lon" or an IP address, the closest nodes to them are picked up to the quantity
+	// The label selectors match any node label by key with the In, NotIn, Exists, DoesNotExist, Gt, and Lt operators,
+	// they narrow down the nodes that the other selectors pick
 	// The value represents the desired filter and it must be compatible with the type of selectivedeployment
-	Workloads Workloads  `json:"workloads"`
-	Selector  []Selector `json:"selector"`
-	Recovery  bool       `json:"recovery"`
-}
-
-// Workloads indicates deployments, daemonsets or statefulsets
+	// Each selector picks its nodes independently, the selectors are ORed
+	// The selector groups are ORed as well, but the selectors in a group are ANDed and the quantity of the group applies to their combined result
+	Workloads      Workloads       `json:"workloads"`
+	Selector       []Selector      `json:"selector"`
+	SelectorGroups []SelectorGroup `json:"selectorgroups,omitempty"`
+	Recovery       bool            `json:"recovery"`
+	// The deletion policy decides what happens to the workloads when the selectivedeployment is deleted,
+	// Delete removes them, and Orphan leaves them in place without the node affinity that EdgeNet injected
+	// The default policy is Delete
+	DeletionPolicy string `json:"deletionpolicy,omitempty"`
+	// In the fan-out mode, each value of a selector and each selector group gets its own copy of each workload,
+	// the copies are named with a location suffix and keep the replica count of the workload
+	FanOut bool `json:"fanout,omitempty"`
+	// The replica count of each copy in the fan-out mode, which overrides the replica count of the workloads that
+	// have one, zero keeps it
+	FanOutReplicas int32 `json:"fanoutreplicas,omitempty"`
+	// The schedule activates the selectivedeployment during time windows, the workloads are deleted while
+	// the windows are closed, and it can also keep the nodes whose local time is within a range of hours
+	Schedule *Schedule `json:"schedule,omitempty"`
+}
+
+// Schedule to define when and where, following the time of day, the workloads run
+type Schedule struct {
+	// The selectivedeployment is active while one of the windows is open, or always if no window is defined
+	Windows []ScheduleWindow `json:"windows,omitempty"`
+	// LocalTime keeps the nodes whose local time, derived from their longitude, is within the range
+	LocalTime *LocalTimeRange `json:"localtime,omitempty"`
+}
+
+// ScheduleWindow opens at the times matching the cron expression in UTC and closes after the duration, such as "90m" or "8h"
+type ScheduleWindow struct {
+	Cron     string `json:"cron"`
+	Duration string `json:"duration"`
+}
+
+// LocalTimeRange is a range of hours in the form of HH:MM, which goes past midnight when To comes before From
+type LocalTimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Workloads indicates deployments, daemonsets, statefulsets, jobs, cronjobs, or any other kind embedding a pod template
 type Workloads struct {
 	Deployment  []appsv1.Deployment   `json:"deployment"`
 	DaemonSet   []appsv1.DaemonSet    `json:"daemonset"`
 	StatefulSet []appsv1.StatefulSet  `json:"statefulset"`
 	Job         []batchv1.Job         `json:"job"`
 	CronJob     []batchv1beta.CronJob `json:"cronjob"`
+	Generic     []GenericWorkload     `json:"generic,omitempty"`
+}
+
+// GenericWorkload is a workload of any kind whose pods are made from a pod template, such as a replicaset, a pod,
+// or a custom resource
+type GenericWorkload struct {
+	APIVersion string `json:"apiversion"`
+	Kind       string `json:"kind"`
+	// Resource is the plural name of the kind in the API, which is guessed from the kind when empty
+	Resource string `json:"resource,omitempty"`
+	// TemplatePath is the dotted path to the pod template in the object, such as spec.template,
+	// the object itself is the pod template when empty, which is the case of a pod
+	TemplatePath string `json:"templatepath,omitempty"`
+	// Object is the manifest of the workload, whose apiVersion and kind are the ones above
+	Object runtime.RawExtension `json:"object"`
 }
 
 // Selector to define desired node filtering parameters
 type Selector struct {
-	Name     string                      `json:"name"`
+	Name string `json:"name"`
+	// Key is the node label that the label selector matches, the other selectors don't use it
+	Key      string                      `json:"key,omitempty"`
 	Value    []string                    `json:"value"`
 	Operator corev1.NodeSelectorOperator `json:"operator"`
 	Quantity int                         `json:"quantity"`
+	// Percentage of the nodes matched to pick, MinQuantity and MaxQuantity bound the count of nodes picked,
+	// the selector succeeds once the minimum is met. They cannot be combined with Quantity.
+	Percentage  int `json:"percentage,omitempty"`
+	MinQuantity int `json:"minquantity,omitempty"`
+	MaxQuantity int `json:"maxquantity,omitempty"`
+	// Mode is either Required, the default, or Preferred to let the pods run elsewhere when the nodes picked have no capacity
+	Mode string `json:"mode,omitempty"`
+	// Weight of the preferred scheduling term, from 1 to 100, that is 1 by default
+	Weight int32 `json:"weight,omitempty"`
+}
+
+// SelectorGroup to define the selectors that a node must satisfy together
+type SelectorGroup struct {
+	Selector    []Selector `json:"selector"`
+	Quantity    int        `json:"quantity"`
+	Percentage  int        `json:"percentage,omitempty"`
+	MinQuantity int        `json:"minquantity,omitempty"`
+	MaxQuantity int        `json:"maxquantity,omitempty"`
+	Mode        string     `json:"mode,omitempty"`
+	Weight      int32      `json:"weight,omitempty"`
 }
 
 // SelectiveDeploymentStatus is the status for a SelectiveDeployment resource
@@ -74,6 +153,49 @@ type SelectiveDeploymentStatus struct {
 	Ready   string   `json:"ready"`
 	State   string   `json:"state"`
 	Message []string `json:"message"`
+	// The conditions are Applied, Scheduled, and Ready
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	Workloads  []WorkloadStatus   `json:"workloads,omitempty"`
+	Selectors  []SelectorStatus   `json:"selectors,omitempty"`
+	// The node affinity that would be written into the workloads, only in dry-run mode
+	Preview []AffinityPreview `json:"preview,omitempty"`
+}
+
+// AffinityPreview shows the node selector terms that a dry run computed, the location is the suffix
+// of the workload copies in the fan-out mode
+type AffinityPreview struct {
+	Location                 string                           `json:"location,omitempty"`
+	NodeSelectorTerms        []corev1.NodeSelectorTerm        `json:"nodeselectorterms"`
+	PreferredSchedulingTerms []corev1.PreferredSchedulingTerm `json:"preferredschedulingterms,omitempty"`
+}
+
+// WorkloadStatus shows the pods of a workload that the selectivedeployment manages
+// For jobs, the succeeded pods count as ready, and for cronjobs, the replicas are the active jobs
+type WorkloadStatus struct {
+	Kind          string `json:"kind"`
+	Name          string `json:"name"`
+	Replicas      int32  `json:"replicas"`
+	ReadyReplicas int32  `json:"readyreplicas"`
+}
+
+// SelectorStatus shows the nodes that a selector or a selector group picked, the quantity is the count of nodes needed at least
+type SelectorStatus struct {
+	Name     string         `json:"name"`
+	Value    []string       `json:"value,omitempty"`
+	Quantity int            `json:"quantity"`
+	Nodes    []SelectedNode `json:"nodes"`
+	Message  string         `json:"message,omitempty"`
+}
+
+// SelectedNode is a node picked by a selector with its geolabels
+type SelectedNode struct {
+	Hostname  string `json:"hostname"`
+	City      string `json:"city,omitempty"`
+	State     string `json:"state,omitempty"`
+	Country   string `json:"country,omitempty"`
+	Continent string `json:"continent,omitempty"`
+	Lat       string `json:"lat,omitempty"`
+	Lon       string `json:"lon,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -135,6 +257,7 @@ type Address struct {
 type AuthorityStatus struct {
 	State   string   `json:"state"`
 	Message []string `json:"message"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -180,6 +303,7 @@ type AuthorityRequestStatus struct {
 	Expires       *metav1.Time `json:"expires"`
 	State         string       `json:"state"`
 	Message       []string     `json:"message"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -224,6 +348,7 @@ type TeamUsers struct {
 type TeamStatus struct {
 	State   string   `json:"state"`
 	Message []string `json:"message"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -271,6 +396,7 @@ type SliceStatus struct {
 	Expires *metav1.Time `json:"expires"`
 	State   string       `json:"state"`
 	Message []string     `json:"message"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -315,6 +441,7 @@ type UserStatus struct {
 	AUP     bool     `json:"aup"`
 	State   string   `json:"state"`
 	Message []string `json:"message"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -359,6 +486,7 @@ type UserRegistrationRequestStatus struct {
 	Expires       *metav1.Time `json:"expires"`
 	State         string       `json:"state"`
 	Message       []string     `json:"message"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -398,6 +526,7 @@ type AcceptableUsePolicyStatus struct {
 	Expires *metav1.Time `json:"expires"`
 	State   string       `json:"state"`
 	Message []string     `json:"message"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -438,6 +567,7 @@ type EmailVerificationStatus struct {
 	Expires *metav1.Time `json:"expires"`
 	State   string       `json:"state"`
 	Message []string     `json:"message"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -474,6 +604,20 @@ type NodeContributionSpec struct {
 	Password    string        `json:"password"`
 	Enabled     bool          `json:"enabled"`
 	Limitations []Limitations `json:"limitations"`
+	// Location is where the node is when the contributor knows better than the geolocation of its IP address
+	Location *NodeLocation `json:"location,omitempty"`
+}
+
+// NodeLocation is the location of a node given by its contributor, the country is an ISO 3166 code
+// and the state the ISO code of the subdivision. Accuracy is the radius in kilometres of the area the node is in.
+type NodeLocation struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+	Continent string  `json:"continent,omitempty"`
+	Country   string  `json:"country"`
+	State     string  `json:"state,omitempty"`
+	City      string  `json:"city,omitempty"`
+	Accuracy  int     `json:"accuracy,omitempty"`
 }
 
 type Limitations struct {
@@ -486,6 +630,7 @@ type Limitations struct {
 type NodeContributionStatus struct {
 	State   string   `json:"state"`
 	Message []string `json:"message"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -536,6 +681,7 @@ type TotalResourceQuotaStatus struct {
 	Used     TotalResourceUsed `json:"used"`
 	State    string            `json:"state"`
 	Message  []string          `json:"message"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // TotalResourceUsed presents the usage of total resource quota
@@ -29,6 +29,7 @@ import (
 	"github.com/EdgeNet-project/edgenet/pkg/util"
 
 	namecheap "github.com/billputer/go-namecheap"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -88,6 +89,24 @@ func CreateClientSet() (*kubernetes.Clientset, error) {
 	return clientset, err
 }
 
+// CreateDynamicClientSet generates the dynamic client to interact with the resources of any kind
+func CreateDynamicClientSet() (dynamic.Interface, error) {
+	// Use the current context in kubeconfig
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
+
+	// Create the dynamic client
+	clientset, err := dynamic.NewForConfig(config)
+	if err != nil {
+		log.Println(err.Error())
+		panic(err.Error())
+	}
+	return clientset, err
+}
+
 // CreateNamecheapClient generates the client to interact with Namecheap API
 func CreateNamecheapClient() (*namecheap.Client, error) {
 	apiuser, apitoken, username, err := util.GetNamecheapCredentials()
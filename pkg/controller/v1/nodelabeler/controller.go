@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/EdgeNet-project/edgenet/pkg/keyqueue"
+	"github.com/EdgeNet-project/edgenet/pkg/metrics"
 	"github.com/EdgeNet-project/edgenet/pkg/node"
 
 	log "github.com/sirupsen/logrus"
@@ -15,24 +18,42 @@ import (
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
 
+// The count of retries before giving up on a node
+const maxRetries = 15
+
 // The main structure of controller
 type controller struct {
 	logger    *log.Entry
 	clientset kubernetes.Interface
-	queue     workqueue.RateLimitingInterface
+	queue     *keyqueue.Queue
 	informer  cache.SharedIndexInformer
 	handler   HandlerInterface
+	// failedLock guards the steps that failed, by the keys of the nodes waiting for a retry
+	failedLock sync.Mutex
+	failed     map[string]step
 }
 
 // Start function is entry point of the controller
 func Start(kubernetes kubernetes.Interface) {
+	// A channel to terminate elegantly
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go Run(kubernetes, stopCh)
+	// A channel to observe OS signals for smooth shut down
+	sigTerm := make(chan os.Signal, 1)
+	signal.Notify(sigTerm, syscall.SIGTERM)
+	signal.Notify(sigTerm, syscall.SIGINT)
+	<-sigTerm
+}
+
+// Run sets the controller up and runs it until the stop channel is closed
+func Run(kubernetes kubernetes.Interface, stopCh <-chan struct{}) {
 	clientset := kubernetes
 
 	// Create the shared informer to list and watch node resources
@@ -51,8 +72,8 @@ func Start(kubernetes kubernetes.Interface) {
 		0,
 		cache.Indexers{},
 	)
-	// Create a work queue which contains a key of the resource to be handled by the handler
-	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	// Create a work queue per worker, the events of a resource always go to the same worker to be handled in order
+	queue := keyqueue.New("nodelabeler", func(item interface{}) string { return item.(string) })
 	// Event handlers deal with events of resources. In here, we take into consideration of adding and updating nodes.
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -66,7 +87,12 @@ func Start(kubernetes kubernetes.Interface) {
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			updated := node.CompareIPAddresses(oldObj.(*core_v1.Node), newObj.(*core_v1.Node))
-			if updated {
+			// The contributor may set, change, or remove the location of the node at any time
+			oldLocation := oldObj.(*core_v1.Node).GetAnnotations()[node.LocationAnnotation]
+			newLocation := newObj.(*core_v1.Node).GetAnnotations()[node.LocationAnnotation]
+			// The status of the node tells its capabilities, which change with an upgrade or a device plugin
+			outdated := node.CapabilitiesOutdated(newObj.(*core_v1.Node))
+			if updated || oldLocation != newLocation || outdated {
 				key, err := cache.MetaNamespaceKeyFunc(newObj)
 				log.Infof("Update node detected: %s", key)
 				if err == nil {
@@ -81,18 +107,12 @@ func Start(kubernetes kubernetes.Interface) {
 		informer:  informer,
 		queue:     queue,
 		handler:   &Handler{},
+		failed:    make(map[string]step),
 	}
 
-	// A channel to terminate elegantly
-	stopCh := make(chan struct{})
-	defer close(stopCh)
 	// Run the controller loop as a background task to start processing resources
 	go controller.run(stopCh, clientset)
-	// A channel to observe OS signals for smooth shut down
-	sigTerm := make(chan os.Signal, 1)
-	signal.Notify(sigTerm, syscall.SIGTERM)
-	signal.Notify(sigTerm, syscall.SIGINT)
-	<-sigTerm
+	<-stopCh
 }
 
 // Run starts the controller loop
@@ -112,8 +132,9 @@ func (c *controller) run(stopCh <-chan struct{}, clientset kubernetes.Interface)
 		return
 	}
 	c.logger.Info("run: cache sync complete")
-	// Operate the runWorker
-	wait.Until(c.runWorker, time.Second, stopCh)
+	// Operate the runWorker of each worker
+	c.queue.StartWorkers(c.runWorker, stopCh)
+	<-stopCh
 }
 
 // To link the informer's HasSynced method to the Controller interface
@@ -122,10 +143,10 @@ func (c *controller) hasSynced() bool {
 }
 
 // To process new objects added to the queue
-func (c *controller) runWorker() {
+func (c *controller) runWorker(queue workqueue.RateLimitingInterface) {
 	log.Info("runWorker: starting")
 	// Run processNextItem for all the changes
-	for c.processNextItem() {
+	for c.processNextItem(queue) {
 		log.Info("runWorker: processing next item")
 	}
 
@@ -133,33 +154,98 @@ func (c *controller) runWorker() {
 }
 
 // This function deals with the queue and sends each item in it to the specified handler to be processed.
-func (c *controller) processNextItem() bool {
+func (c *controller) processNextItem(queue workqueue.RateLimitingInterface) bool {
 	log.Info("processNextItem: start")
 	// Fetch the next item of the queue
-	key, quit := c.queue.Get()
+	key, quit := queue.Get()
 	if quit {
 		return false
 	}
-	defer c.queue.Done(key)
+	defer queue.Done(key)
 	// Get the key string
 	keyRaw := key.(string)
 	// Use the string key to get the object from the indexer
+	start := time.Now()
 	item, exists, err := c.informer.GetIndexer().GetByKey(keyRaw)
 	if err != nil {
-		if c.queue.NumRequeues(key) < 3 {
-			c.logger.Errorf("processNextItem: Failed fetching item with key %s, error is %v, retrying...", key, err)
-			c.queue.AddRateLimited(key)
-		} else {
-			c.logger.Errorf("processNextItem: Failed fetching item with key %s, error is %v, no more retries", key, err)
-			c.queue.Forget(key)
-			utilruntime.HandleError(err)
-		}
+		metrics.ObserveReconcile("nodelabeler", "GetByKey", start, err)
+		c.handleErr(queue, err, key, nil)
+		return true
 	}
 
 	if exists {
 		c.logger.Infof("processNextItem: object created/updated detected: %s", keyRaw)
-		c.handler.SetNodeGeolocation(item)
-		c.queue.Forget(key)
+		err = c.label(item, c.steps(keyRaw, queue.NumRequeues(key)))
 	}
+	c.handleErr(queue, err, key, item)
 	return true
 }
+
+// steps returns the steps to run for the node, a retry only runs the ones that failed. The later events
+// of the node wait for the retries to end in the queue, so an item that comes up with requeues is a retry.
+func (c *controller) steps(key string, requeues int) step {
+	c.failedLock.Lock()
+	defer c.failedLock.Unlock()
+	if failed, exists := c.failed[key]; exists && requeues > 0 {
+		return failed
+	}
+	return allSteps
+}
+
+// label runs the steps given, the labels of each step don't depend on the others, so a failed step doesn't hold
+// the next ones back. It returns the errors of the steps that failed, if any.
+func (c *controller) label(item interface{}, steps step) error {
+	labelers := []struct {
+		step    step
+		name    string
+		labeler func(obj interface{}) error
+	}{
+		{geolocationStep, "SetNodeGeolocation", c.handler.SetNodeGeolocation},
+		{networkStep, "SetNodeNetwork", c.handler.SetNodeNetwork},
+		{capabilitiesStep, "SetNodeCapabilities", c.handler.SetNodeCapabilities},
+	}
+	var errs stepErrors
+	for _, labeler := range labelers {
+		if steps&labeler.step == 0 {
+			continue
+		}
+		start := time.Now()
+		err := labeler.labeler(item)
+		metrics.ObserveReconcile("nodelabeler", labeler.name, start, err)
+		if err != nil {
+			errs = append(errs, stepError{step: labeler.step, err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// handleErr requeues the key with the rate limiter until it fails maxRetries times in a row, and then gives up on it.
+// The steps that failed are kept for the retry to run only them.
+func (c *controller) handleErr(queue workqueue.RateLimitingInterface, err error, key interface{}, item interface{}) {
+	retries := queue.NumRequeues(key)
+	c.failedLock.Lock()
+	if stepErrs, ok := err.(stepErrors); ok && retries < maxRetries {
+		c.failed[key.(string)] = stepErrs.steps()
+	} else {
+		delete(c.failed, key.(string))
+	}
+	c.failedLock.Unlock()
+	if err == nil {
+		queue.Forget(key)
+		return
+	}
+	if retries < maxRetries {
+		c.logger.Errorf("processNextItem: Failed processing item with key %s, error is %v, retry %d/%d", key, err, retries+1, maxRetries)
+		queue.AddRateLimited(key)
+		return
+	}
+	c.logger.Errorf("processNextItem: Failed processing item with key %s, error is %v, no more retries", key, err)
+	queue.Forget(key)
+	utilruntime.HandleError(err)
+	if item != nil {
+		c.handler.ObjectFailed(item, err)
+	}
+}
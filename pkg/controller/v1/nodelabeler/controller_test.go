@@ -2,14 +2,19 @@ package nodelabeler
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/EdgeNet-project/edgenet/pkg/util"
 
+	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 )
 
 func TestStartingController(t *testing.T) {
@@ -99,3 +104,65 @@ func TestStartingController(t *testing.T) {
 		})
 	}
 }
+
+// stepHandler counts the runs of each step, and fails the steps given until it is told otherwise
+type stepHandler struct {
+	runs   map[step]int
+	failed step
+	gaveUp error
+}
+
+func (h *stepHandler) Init(kubernetes kubernetes.Interface) {}
+
+func (h *stepHandler) run(s step) error {
+	h.runs[s]++
+	if h.failed&s != 0 {
+		return fmt.Errorf("step %d failed", s)
+	}
+	return nil
+}
+
+func (h *stepHandler) SetNodeGeolocation(obj interface{}) error  { return h.run(geolocationStep) }
+func (h *stepHandler) SetNodeNetwork(obj interface{}) error      { return h.run(networkStep) }
+func (h *stepHandler) SetNodeCapabilities(obj interface{}) error { return h.run(capabilitiesStep) }
+func (h *stepHandler) ObjectFailed(obj interface{}, err error)   { h.gaveUp = err }
+
+func TestRetryFailedSteps(t *testing.T) {
+	handler := &stepHandler{runs: make(map[step]int), failed: networkStep}
+	c := controller{
+		logger:   log.NewEntry(log.New()),
+		informer: cache.NewSharedIndexInformer(&cache.ListWatch{}, &corev1.Node{}, 0, cache.Indexers{}),
+		handler:  handler,
+		failed:   make(map[string]step),
+	}
+	c.informer.GetIndexer().Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "fr.edge-net.io"}})
+	queue := workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond))
+	defer queue.ShutDown()
+
+	// The first run goes through all the steps, and the retries only through the network that fails
+	queue.Add("fr.edge-net.io")
+	c.processNextItem(queue)
+	util.Equals(t, map[step]int{geolocationStep: 1, networkStep: 1, capabilitiesStep: 1}, handler.runs)
+	c.processNextItem(queue)
+	util.Equals(t, map[step]int{geolocationStep: 1, networkStep: 2, capabilitiesStep: 1}, handler.runs)
+
+	// A new event of the node runs all the steps again once the retry succeeds
+	handler.failed = 0
+	c.processNextItem(queue)
+	util.Equals(t, map[step]int{geolocationStep: 1, networkStep: 3, capabilitiesStep: 1}, handler.runs)
+	util.Equals(t, 0, queue.NumRequeues("fr.edge-net.io"))
+	queue.Add("fr.edge-net.io")
+	c.processNextItem(queue)
+	util.Equals(t, map[step]int{geolocationStep: 2, networkStep: 4, capabilitiesStep: 2}, handler.runs)
+
+	// The controller gives up with the step that kept failing
+	handler.failed = capabilitiesStep
+	queue.Add("fr.edge-net.io")
+	for i := 0; i <= maxRetries; i++ {
+		c.processNextItem(queue)
+	}
+	util.Equals(t, 3, handler.runs[geolocationStep])
+	util.Equals(t, maxRetries+3, handler.runs[capabilitiesStep])
+	util.Equals(t, capabilitiesStep, handler.gaveUp.(stepErrors).steps())
+	util.Equals(t, 0, queue.Len())
+}
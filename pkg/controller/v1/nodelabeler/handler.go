@@ -1,46 +1,163 @@
 package nodelabeler
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/EdgeNet-project/edgenet/pkg/node"
+	"github.com/EdgeNet-project/edgenet/pkg/recorder"
 
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
 	Init(kubernetes kubernetes.Interface)
-	SetNodeGeolocation(obj interface{})
+	SetNodeGeolocation(obj interface{}) error
+	SetNodeNetwork(obj interface{}) error
+	SetNodeCapabilities(obj interface{}) error
+	ObjectFailed(obj interface{}, err error)
 }
 
 // Handler is a sample implementation of Handler
 type Handler struct {
 	clientset kubernetes.Interface
+	recorder  record.EventRecorder
 }
 
 // Init handles any handler initialization
 func (t *Handler) Init(kubernetes kubernetes.Interface) {
 	log.Info("Handler.Init")
 	t.clientset = kubernetes
+	t.recorder = recorder.New(kubernetes, "nodelabeler-controller")
 	node.Clientset = t.clientset
 }
 
-// SetNodeGeolocation is called when an object is created or updated
-func (t *Handler) SetNodeGeolocation(obj interface{}) {
+// SetNodeGeolocation is called when an object is created or updated, it returns the error of the lookup
+// or the patch so that the controller tries again later. The location given by the contributor
+// through the location annotation wins over the IP addresses, which don't locate nodes behind a NAT well.
+func (t *Handler) SetNodeGeolocation(obj interface{}) error {
 	log.Info("Handler.ObjectCreated")
+	nodeObj := obj.(*corev1.Node)
+	if location, exists, err := node.GetManualLocation(nodeObj); exists {
+		// An invalid location stays as it is until the contributor fixes it, the IP addresses never override it
+		if err != nil {
+			t.recorder.Eventf(nodeObj, corev1.EventTypeWarning, "InvalidLocation", "Location given by the contributor is invalid: %s", err)
+			return nil
+		}
+		if err := node.SetGeolocation(nodeObj.GetName(), location); err != nil {
+			return err
+		}
+		t.recorder.Event(nodeObj, corev1.EventTypeNormal, "Geolocated", "Geolocation labels set from the location given by the contributor")
+		return nil
+	}
 	// Get internal and external IP addresses of the node
-	internalIP, externalIP := node.GetNodeIPAddresses(obj.(*corev1.Node))
+	internalIP, externalIP := node.GetNodeIPAddresses(nodeObj)
 	result := false
+	var err error
 	// Check if the external IP exists to use it in the first place
 	if externalIP != "" {
 		log.Infof("External IP: %s", externalIP)
-		result = node.GetGeolocationByIP(obj.(*corev1.Node).Name, externalIP)
+		if result, err = node.GetGeolocationByIP(nodeObj.Name, externalIP); err != nil {
+			return err
+		}
 	}
 	// Check if the internal IP exists and
 	// the result of detecting geolocation by external IP is false
 	if internalIP != "" && result == false {
 		log.Infof("Internal IP: %s", internalIP)
-		node.GetGeolocationByIP(obj.(*corev1.Node).Name, internalIP)
+		if result, err = node.GetGeolocationByIP(nodeObj.Name, internalIP); err != nil {
+			return err
+		} else if result {
+			t.recorder.Eventf(nodeObj, corev1.EventTypeNormal, "Geolocated", "Geolocation labels set from the internal IP %s", internalIP)
+		}
+	} else if result {
+		t.recorder.Eventf(nodeObj, corev1.EventTypeNormal, "Geolocated", "Geolocation labels set from the external IP %s", externalIP)
+	}
+	if !result {
+		t.recorder.Eventf(nodeObj, corev1.EventTypeWarning, "GeolocationFailed", "Node couldn't be located by its IP addresses, internal %q and external %q", internalIP, externalIP)
+	}
+	return nil
+}
+
+// SetNodeNetwork is called when an object is created or updated, it labels the node with its autonomous system and
+// whether it is behind a NAT, from its IP addresses whatever the location given by the contributor
+func (t *Handler) SetNodeNetwork(obj interface{}) error {
+	nodeObj := obj.(*corev1.Node)
+	internalIP, externalIP := node.GetNodeIPAddresses(nodeObj)
+	if internalIP == "" && externalIP == "" {
+		return nil
+	}
+	return node.SetNetwork(nodeObj.GetName(), internalIP, externalIP)
+}
+
+// SetNodeCapabilities is called when an object is created or its status changes, it labels the node with
+// the classes of its hardware, its software versions, and its extended resources
+func (t *Handler) SetNodeCapabilities(obj interface{}) error {
+	return node.SetCapabilities(obj.(*corev1.Node))
+}
+
+// step is one of the labelings of a node, each one is retried on its own when it fails
+type step int
+
+const (
+	geolocationStep step = 1 << iota
+	networkStep
+	capabilitiesStep
+	allSteps = geolocationStep | networkStep | capabilitiesStep
+)
+
+// The reasons and the messages of the events that tell which step the controller gave up on
+var stepEvents = map[step]struct{ reason, message string }{
+	geolocationStep:  {"GeolocationFailed", "Node couldn't be geolocated, gave up after %d attempts, the last with %s"},
+	networkStep:      {"NetworkFailed", "Network labels of the node couldn't be set, gave up after %d attempts, the last with %s"},
+	capabilitiesStep: {"CapabilitiesFailed", "Capability labels of the node couldn't be set, gave up after %d attempts, the last with %s"},
+}
+
+// stepError is the error of a step that failed
+type stepError struct {
+	step step
+	err  error
+}
+
+func (e stepError) Error() string {
+	return e.err.Error()
+}
+
+// stepErrors gathers the errors of the steps that failed while labeling a node
+type stepErrors []stepError
+
+func (e stepErrors) Error() string {
+	messages := []string{}
+	for _, stepErr := range e {
+		messages = append(messages, stepErr.Error())
+	}
+	return strings.Join(messages, ", ")
+}
+
+// steps returns the steps that failed
+func (e stepErrors) steps() step {
+	var failed step
+	for _, stepErr := range e {
+		failed |= stepErr.step
+	}
+	return failed
+}
+
+// ObjectFailed is called when the controller gives up on the node after several failures in a row,
+// it records an event for each step that kept failing
+func (t *Handler) ObjectFailed(obj interface{}, err error) {
+	log.Info("Handler.ObjectFailed")
+	var stepErrs stepErrors
+	if !errors.As(err, &stepErrs) {
+		t.recorder.Eventf(obj.(*corev1.Node), corev1.EventTypeWarning, "LabelingFailed", "Node couldn't be labeled, gave up after %d attempts, the last with %s", maxRetries+1, err)
+		return
+	}
+	for _, stepErr := range stepErrs {
+		event := stepEvents[stepErr.step]
+		t.recorder.Eventf(obj.(*corev1.Node), corev1.EventTypeWarning, event.reason, event.message, maxRetries+1, stepErr.err)
 	}
 }
@@ -10,6 +10,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/EdgeNet-project/edgenet/pkg/node"
 	"github.com/EdgeNet-project/edgenet/pkg/util"
 
 	"github.com/sirupsen/logrus"
@@ -18,6 +19,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	testclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 )
 
 // The main structure of test group
@@ -124,22 +126,67 @@ func TestAssigningGeoLabels(t *testing.T) {
 		"edge-net.io/lat":         "n38.989600",
 		"edge-net.io/lon":         "w-76.945700",
 	}
+	// The location given by the contributor wins over the one of the IP address
+	nodeManual := g.nodeObj
+	nodeManual.ObjectMeta = metav1.ObjectMeta{
+		Name: "manual.edge-net.io",
+		Labels: map[string]string{
+			"kubernetes.io/hostname": "manual.edge-net.io",
+		},
+		Annotations: map[string]string{
+			node.LocationAnnotation: `{"lat":48.8467,"lon":2.3574,"continent":"Europe","country":"FR","state":"IDF","city":"Paris","accuracy":1}`,
+		},
+	}
+	nodeManual.Status.Addresses = nodeUS.Status.Addresses
+	geolabelsManual := map[string]string{
+		"kubernetes.io/hostname":           "manual.edge-net.io",
+		"edge-net.io/continent":            "Europe",
+		"edge-net.io/state-iso":            "IDF",
+		"edge-net.io/country-iso":          "FR",
+		"edge-net.io/city":                 "Paris",
+		"edge-net.io/lat":                  "n48.846700",
+		"edge-net.io/lon":                  "e2.357400",
+		"edge-net.io/location-source":      "manual",
+		"edge-net.io/location-accuracy-km": "1",
+		"topology.kubernetes.io/region":    "europe-fr",
+		"topology.kubernetes.io/zone":      "europe-fr-paris",
+	}
+	// An invalid location leaves the node without geolabels rather than falling back on the IP address
+	nodeInvalid := g.nodeObj
+	nodeInvalid.ObjectMeta = metav1.ObjectMeta{
+		Name: "invalid.edge-net.io",
+		Labels: map[string]string{
+			"kubernetes.io/hostname": "invalid.edge-net.io",
+		},
+		Annotations: map[string]string{
+			node.LocationAnnotation: `{"lat":148.8467,"lon":2.3574,"country":"FR"}`,
+		},
+	}
+	nodeInvalid.Status.Addresses = nodeUS.Status.Addresses
+	geolabelsInvalid := map[string]string{
+		"kubernetes.io/hostname": "invalid.edge-net.io",
+	}
 
 	cases := map[string]struct {
 		Node     corev1.Node
 		Expected map[string]string
 	}{
-		"fr": {nodeFR, geolabelsFR},
-		"us": {nodeUS, geolabelsUS},
+		"fr":      {nodeFR, geolabelsFR},
+		"us":      {nodeUS, geolabelsUS},
+		"manual":  {nodeManual, geolabelsManual},
+		"invalid": {nodeInvalid, geolabelsInvalid},
 	}
 
 	for k, tc := range cases {
 		t.Run(fmt.Sprintf("%s", k), func(t *testing.T) {
 			g.client.CoreV1().Nodes().Create(context.TODO(), tc.Node.DeepCopy(), metav1.CreateOptions{})
-			g.handler.SetNodeGeolocation(tc.Node.DeepCopy())
-			node, _ := g.client.CoreV1().Nodes().Get(context.TODO(), tc.Node.GetName(), metav1.GetOptions{})
-			if !reflect.DeepEqual(node.Labels, tc.Expected) {
-				for actualKey, actualValue := range node.Labels {
+			err := g.handler.SetNodeGeolocation(tc.Node.DeepCopy())
+			nodeObj, _ := g.client.CoreV1().Nodes().Get(context.TODO(), tc.Node.GetName(), metav1.GetOptions{})
+			if _, exists := tc.Node.GetAnnotations()[node.LocationAnnotation]; exists {
+				util.OK(t, err)
+				util.Equals(t, tc.Expected, nodeObj.Labels)
+			} else if !reflect.DeepEqual(nodeObj.Labels, tc.Expected) {
+				for actualKey, actualValue := range nodeObj.Labels {
 					for expectedKey, expectedValue := range tc.Expected {
 						if actualKey == expectedKey {
 							util.Equals(t, expectedValue, actualValue)
@@ -150,3 +197,16 @@ func TestAssigningGeoLabels(t *testing.T) {
 		})
 	}
 }
+
+func TestObjectFailed(t *testing.T) {
+	g := testGroup{}
+	g.Init()
+	g.handler.Init(g.client)
+	eventRecorder := record.NewFakeRecorder(2)
+	g.handler.recorder = eventRecorder
+	nodeObj := g.nodeObj.DeepCopy()
+	nodeObj.SetName("fr.edge-net.io")
+	g.handler.ObjectFailed(nodeObj, stepErrors{{networkStep, fmt.Errorf("no ASN database")}, {capabilitiesStep, fmt.Errorf("patch refused")}})
+	util.Equals(t, fmt.Sprintf("Warning NetworkFailed Network labels of the node couldn't be set, gave up after %d attempts, the last with no ASN database", maxRetries+1), <-eventRecorder.Events)
+	util.Equals(t, fmt.Sprintf("Warning CapabilitiesFailed Capability labels of the node couldn't be set, gave up after %d attempts, the last with patch refused", maxRetries+1), <-eventRecorder.Events)
+}
@@ -24,24 +24,29 @@ import (
 	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
 	"github.com/EdgeNet-project/edgenet/pkg/generated/clientset/versioned"
 	"github.com/EdgeNet-project/edgenet/pkg/mailer"
+	"github.com/EdgeNet-project/edgenet/pkg/recorder"
 
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
 	Init(kubernetes kubernetes.Interface, edgenet versioned.Interface)
-	ObjectCreated(obj interface{})
-	ObjectUpdated(obj, updated interface{})
-	ObjectDeleted(obj interface{})
+	ObjectCreated(obj interface{}) error
+	ObjectUpdated(obj, updated interface{}) error
+	ObjectDeleted(obj interface{}) error
+	ObjectFailed(obj interface{}, err error)
 }
 
 // Handler implementation
 type Handler struct {
 	clientset        kubernetes.Interface
 	edgenetClientset versioned.Interface
+	recorder         record.EventRecorder
 }
 
 // Init handles any handler initialization
@@ -49,16 +54,23 @@ func (t *Handler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interf
 	log.Info("AUPHandler.Init")
 	t.clientset = kubernetes
 	t.edgenetClientset = edgenet
+	t.recorder = recorder.New(kubernetes, "acceptableusepolicy-controller")
 }
 
-// ObjectCreated is called when an object is created
-func (t *Handler) ObjectCreated(obj interface{}) {
+// ObjectCreated is called when an object is created, the event is retried if it returns an error
+func (t *Handler) ObjectCreated(obj interface{}) error {
 	log.Info("AUPHandler.ObjectCreated")
 	// Create a copy of the acceptable use policy object to make changes on it
 	AUPCopy := obj.(*apps_v1alpha.AcceptableUsePolicy).DeepCopy()
 	// Find the authority from the namespace in which the object is
-	AUPOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), AUPCopy.GetNamespace(), metav1.GetOptions{})
-	AUPOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), AUPOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	AUPOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(context.TODO(), AUPCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	AUPOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), AUPOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	// Check if the authority is active
 	if AUPOwnerAuthority.Spec.Enabled {
 		// If the service restarts, it creates all objects again
@@ -77,21 +89,19 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 				AUPCopy.Status.State = failure
 				AUPCopy.Status.Message = []string{statusDict["aup-ok"], statusDict["aup-set-fail"]}
 				t.edgenetClientset.AppsV1alpha().AcceptableUsePolicies(AUPCopy.GetNamespace()).UpdateStatus(context.TODO(), AUPCopy, metav1.UpdateOptions{})
+				t.recorder.Event(AUPCopy, corev1.EventTypeWarning, "ExpirySetFailed", statusDict["aup-set-fail"])
 			} else {
-				user, _ := t.edgenetClientset.AppsV1alpha().Users(AUPCopy.GetNamespace()).Get(context.TODO(), AUPCopy.GetName(), metav1.GetOptions{})
-				if !user.Status.AUP {
-					user.Status.AUP = true
-					t.edgenetClientset.AppsV1alpha().Users(user.GetNamespace()).Update(context.TODO(), user, metav1.UpdateOptions{})
+				t.recorder.Eventf(AUPCopy, corev1.EventTypeNormal, "Accepted", "%s, it expires at %s", statusDict["aup-ok"], AUPCopy.Status.Expires.Format(time.RFC3339))
+				if err := t.setUserAUP(AUPCopy, true); err != nil {
+					return err
 				}
 			}
 		} else if AUPCopy.Spec.Accepted && AUPCopy.Status.Expires != nil {
 			// Check if the 6 months cycle expired
 			if AUPCopy.Status.Expires.Time.Sub(time.Now()) >= 0 {
 				go t.runApprovalTimeout(AUPCopy)
-				user, _ := t.edgenetClientset.AppsV1alpha().Users(AUPCopy.GetNamespace()).Get(context.TODO(), AUPCopy.GetName(), metav1.GetOptions{})
-				if !user.Status.AUP {
-					user.Status.AUP = true
-					t.edgenetClientset.AppsV1alpha().Users(user.GetNamespace()).Update(context.TODO(), user, metav1.UpdateOptions{})
+				if err := t.setUserAUP(AUPCopy, true); err != nil {
+					return err
 				}
 			} else {
 				AUPCopy.Spec.Accepted = false
@@ -102,32 +112,36 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 				AUPCopy.Status.State = failure
 				AUPCopy.Status.Message = []string{statusDict["aup-expired"]}
 				t.edgenetClientset.AppsV1alpha().AcceptableUsePolicies(AUPCopy.GetNamespace()).UpdateStatus(context.TODO(), AUPCopy, metav1.UpdateOptions{})
-				user, _ := t.edgenetClientset.AppsV1alpha().Users(AUPCopy.GetNamespace()).Get(context.TODO(), AUPCopy.GetName(), metav1.GetOptions{})
-				if user.Status.AUP {
-					user.Status.AUP = false
-					t.edgenetClientset.AppsV1alpha().Users(user.GetNamespace()).Update(context.TODO(), user, metav1.UpdateOptions{})
+				t.recorder.Event(AUPCopy, corev1.EventTypeWarning, "Expired", statusDict["aup-expired"])
+				if err := t.setUserAUP(AUPCopy, false); err != nil {
+					return err
 				}
 			}
 		} else if !AUPCopy.Spec.Accepted && AUPCopy.Status.Expires == nil {
 			AUPCopy.Status.State = success
 			AUPCopy.Status.Message = []string{statusDict["aup-ok"]}
 			t.edgenetClientset.AppsV1alpha().AcceptableUsePolicies(AUPCopy.GetNamespace()).UpdateStatus(context.TODO(), AUPCopy, metav1.UpdateOptions{})
-			user, _ := t.edgenetClientset.AppsV1alpha().Users(AUPCopy.GetNamespace()).Get(context.TODO(), AUPCopy.GetName(), metav1.GetOptions{})
-			if user.Status.AUP {
-				user.Status.AUP = false
-				t.edgenetClientset.AppsV1alpha().Users(user.GetNamespace()).Update(context.TODO(), user, metav1.UpdateOptions{})
+			if err := t.setUserAUP(AUPCopy, false); err != nil {
+				return err
 			}
 		}
 	}
+	return nil
 }
 
-// ObjectUpdated is called when an object is updated
-func (t *Handler) ObjectUpdated(obj, updated interface{}) {
+// ObjectUpdated is called when an object is updated, the event is retried if it returns an error
+func (t *Handler) ObjectUpdated(obj, updated interface{}) error {
 	log.Info("AUPHandler.ObjectUpdated")
 	// Create a copy of the acceptable use policy object to make changes on it
 	AUPCopy := obj.(*apps_v1alpha.AcceptableUsePolicy).DeepCopy()
-	AUPOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), AUPCopy.GetNamespace(), metav1.GetOptions{})
-	AUPOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), AUPOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	AUPOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(context.TODO(), AUPCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	AUPOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), AUPOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	fieldUpdated := updated.(fields)
 
 	if AUPOwnerAuthority.Spec.Enabled {
@@ -140,7 +154,10 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 				}
 			}()
 			// Get the user who owns this acceptable use policy object
-			AUPUser, _ := t.edgenetClientset.AppsV1alpha().Users(AUPCopy.GetNamespace()).Get(context.TODO(), AUPCopy.GetName(), metav1.GetOptions{})
+			AUPUser, err := t.edgenetClientset.AppsV1alpha().Users(AUPCopy.GetNamespace()).Get(context.TODO(), AUPCopy.GetName(), metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
 			if AUPCopy.Spec.Accepted {
 				AUPUser.Status.AUP = true
 				go t.runApprovalTimeout(AUPCopy)
@@ -155,8 +172,10 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 				contentData.CommonData.Name = fmt.Sprintf("%s %s", AUPUser.Spec.FirstName, AUPUser.Spec.LastName)
 				contentData.CommonData.Email = []string{AUPUser.Spec.Email}
 				mailer.Send("acceptable-use-policy-accepted", contentData)
+				t.recorder.Eventf(AUPCopy, corev1.EventTypeNormal, "Accepted", "%s, it expires at %s", statusDict["aup-agreed"], AUPCopy.Status.Expires.Format(time.RFC3339))
 			} else {
 				AUPUser.Status.AUP = false
+				t.recorder.Event(AUPCopy, corev1.EventTypeNormal, "Withdrawn", "Acceptable use policy withdrawn, the user is no longer allowed to use the cluster")
 			}
 			go t.edgenetClientset.AppsV1alpha().Users(AUPUser.GetNamespace()).UpdateStatus(context.TODO(), AUPUser, metav1.UpdateOptions{})
 		}
@@ -169,13 +188,41 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 		AUPCopy.Status.State = failure
 		AUPCopy.Status.Message = []string{statusDict["authority-disabled"]}
 		t.edgenetClientset.AppsV1alpha().AcceptableUsePolicies(AUPCopy.GetNamespace()).UpdateStatus(context.TODO(), AUPCopy, metav1.UpdateOptions{})
+		t.recorder.Event(AUPCopy, corev1.EventTypeWarning, "AuthorityDisabled", statusDict["authority-disabled"])
 	}
+	return nil
 }
 
 // ObjectDeleted is called when an object is deleted
-func (t *Handler) ObjectDeleted(obj interface{}) {
+func (t *Handler) ObjectDeleted(obj interface{}) error {
 	log.Info("AUPHandler.ObjectDeleted")
 	// Mail notification, TBD
+	return nil
+}
+
+// ObjectFailed is called when the controller gives up on an object after its retries
+func (t *Handler) ObjectFailed(obj interface{}, err error) {
+	log.Info("AUPHandler.ObjectFailed")
+	AUPCopy := obj.(*apps_v1alpha.AcceptableUsePolicy).DeepCopy()
+	AUPCopy.Status.State = failure
+	message := fmt.Sprintf(statusDict["reconcile-failure"], err)
+	recorder.ReconcileFailed(t.recorder, AUPCopy, &AUPCopy.Status.Message, &AUPCopy.Status.Conditions, "Reconciled", message)
+	if _, err := t.edgenetClientset.AppsV1alpha().AcceptableUsePolicies(AUPCopy.GetNamespace()).UpdateStatus(context.TODO(), AUPCopy, metav1.UpdateOptions{}); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// setUserAUP reflects the acceptable use policy on the user who owns it
+func (t *Handler) setUserAUP(AUPCopy *apps_v1alpha.AcceptableUsePolicy, accepted bool) error {
+	user, err := t.edgenetClientset.AppsV1alpha().Users(AUPCopy.GetNamespace()).Get(context.TODO(), AUPCopy.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if user.Status.AUP != accepted {
+		user.Status.AUP = accepted
+		_, err = t.edgenetClientset.AppsV1alpha().Users(user.GetNamespace()).Update(context.TODO(), user, metav1.UpdateOptions{})
+	}
+	return err
 }
 
 // runApprovalTimeout puts a procedure in place to remove requests by approval or timeout
@@ -250,6 +297,7 @@ timeoutLoop:
 			contentData.CommonData.Name = fmt.Sprintf("%s %s", AUPUser.Spec.FirstName, AUPUser.Spec.LastName)
 			contentData.CommonData.Email = []string{AUPUser.Spec.Email}
 			mailer.Send("acceptable-use-policy-expired", contentData)
+			t.recorder.Event(AUPCopy, corev1.EventTypeWarning, "Expired", statusDict["aup-expired"])
 			AUPUser.Status.AUP = false
 			t.edgenetClientset.AppsV1alpha().Users(AUPUser.GetNamespace()).Update(context.TODO(), AUPUser, metav1.UpdateOptions{})
 			AUPCopy.Spec.Accepted = false
@@ -25,11 +25,12 @@ import (
 
 	"github.com/EdgeNet-project/edgenet/pkg/generated/clientset/versioned"
 	appsinformer_v1 "github.com/EdgeNet-project/edgenet/pkg/generated/informers/externalversions/apps/v1alpha"
+	"github.com/EdgeNet-project/edgenet/pkg/keyqueue"
+	"github.com/EdgeNet-project/edgenet/pkg/metrics"
 	"github.com/EdgeNet-project/edgenet/pkg/permission"
 
 	log "github.com/sirupsen/logrus"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
@@ -38,7 +39,7 @@ import (
 // The main structure of controller
 type controller struct {
 	logger   *log.Entry
-	queue    workqueue.RateLimitingInterface
+	queue    *keyqueue.Queue
 	informer cache.SharedIndexInformer
 	handler  HandlerInterface
 }
@@ -63,11 +64,27 @@ var statusDict = map[string]string{
 	"namespace-failure": "Authority namespace cannot be created",
 	"user-failed":       "User creation failed",
 	"email-exist":       "Email address, %s, already exists for another user account",
+	"reconcile-failure": "The authority could not be reconciled, %s",
 }
 
+// The count of retries before giving up on an authority
+const maxRetries = 15
+
 // Start function is entry point of the controller
 func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
-	var err error
+	// A channel to terminate elegantly
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go Run(kubernetes, edgenet, stopCh)
+	// A channel to observe OS signals for smooth shut down
+	sigTerm := make(chan os.Signal, 1)
+	signal.Notify(sigTerm, syscall.SIGTERM)
+	signal.Notify(sigTerm, syscall.SIGINT)
+	<-sigTerm
+}
+
+// Run sets the controller up and runs it until the stop channel is closed
+func Run(kubernetes kubernetes.Interface, edgenet versioned.Interface, stopCh <-chan struct{}) {
 	clientset := kubernetes
 	edgenetClientset := edgenet
 
@@ -78,15 +95,14 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 		0,
 		cache.Indexers{},
 	)
-	// Create a work queue which contains a key of the resource to be handled by the handler
-	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
-	var event informerevent
+	// Create a work queue per worker, the events of a resource always go to the same worker to be handled in order
+	queue := keyqueue.New("authority", func(item interface{}) string { return item.(informerevent).key })
 	// Event handlers deal with events of resources. Here, there are three types of events as Add, Update, and Delete
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			// Put the resource object into a key
-			event.key, err = cache.MetaNamespaceKeyFunc(obj)
-			event.function = create
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			event := informerevent{key: key, function: create}
 			log.Infof("Add authority: %s", event.key)
 			if err == nil {
 				// Add the key to the queue
@@ -94,8 +110,8 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 			}
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
-			event.key, err = cache.MetaNamespaceKeyFunc(newObj)
-			event.function = update
+			key, err := cache.MetaNamespaceKeyFunc(newObj)
+			event := informerevent{key: key, function: update}
 			log.Infof("Update authority: %s", event.key)
 			if err == nil {
 				queue.Add(event)
@@ -104,8 +120,8 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 		DeleteFunc: func(obj interface{}) {
 			// DeletionHandlingMetaNamsespaceKeyFunc helps to check the existence of the object while it is still contained in the index.
 			// Put the resource object into a key
-			event.key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
-			event.function = delete
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			event := informerevent{key: key, function: delete}
 			log.Infof("Delete authority: %s", event.key)
 			if err == nil {
 				queue.Add(event)
@@ -124,16 +140,9 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 	permission.CreateAuthorityAdminRole()
 	permission.CreateAuthorityUserRole()
 
-	// A channel to terminate elegantly
-	stopCh := make(chan struct{})
-	defer close(stopCh)
 	// Run the controller loop as a background task to start processing resources
 	go controller.run(stopCh, clientset, edgenetClientset)
-	// A channel to observe OS signals for smooth shut down
-	sigTerm := make(chan os.Signal, 1)
-	signal.Notify(sigTerm, syscall.SIGTERM)
-	signal.Notify(sigTerm, syscall.SIGINT)
-	<-sigTerm
+	<-stopCh
 }
 
 // Run starts the controller loop
@@ -153,17 +162,17 @@ func (c *controller) run(stopCh <-chan struct{}, clientset kubernetes.Interface,
 		return
 	}
 	c.logger.Info("run: cache sync complete")
-	// Operate the runWorker
-	go wait.Until(c.runWorker, time.Second, stopCh)
+	// Operate the runWorker of each worker
+	c.queue.StartWorkers(c.runWorker, stopCh)
 
 	<-stopCh
 }
 
 // To process new objects added to the queue
-func (c *controller) runWorker() {
+func (c *controller) runWorker(queue workqueue.RateLimitingInterface) {
 	log.Info("runWorker: starting")
 	// Run processNextItem for all the changes
-	for c.processNextItem() {
+	for c.processNextItem(queue) {
 		log.Info("runWorker: processing next item")
 	}
 
@@ -171,45 +180,71 @@ func (c *controller) runWorker() {
 }
 
 // This function deals with the queue and sends each item in it to the specified handler to be processed.
-func (c *controller) processNextItem() bool {
+func (c *controller) processNextItem(queue workqueue.RateLimitingInterface) bool {
 	log.Info("processNextItem: start")
 	// Fetch the next item of the queue
-	event, quit := c.queue.Get()
+	event, quit := queue.Get()
 	if quit {
 		return false
 	}
-	defer c.queue.Done(event)
+	defer queue.Done(event)
+	c.processEvent(queue, event)
+	return true
+}
+
+// processEvent sends the event to the handler
+func (c *controller) processEvent(queue workqueue.RateLimitingInterface, event interface{}) {
 	// Get the key string
 	keyRaw := event.(informerevent).key
 	// Use the string key to get the object from the indexer
+	start := time.Now()
 	item, exists, err := c.informer.GetIndexer().GetByKey(keyRaw)
 	if err != nil {
-		if c.queue.NumRequeues(event.(informerevent).key) < 5 {
-			c.logger.Errorf("Controller.processNextItem: Failed processing item with key %s with error %v, retrying", event.(informerevent).key, err)
-			c.queue.AddRateLimited(event.(informerevent).key)
-		} else {
-			c.logger.Errorf("Controller.processNextItem: Failed processing item with key %s with error %v, no more retries", event.(informerevent).key, err)
-			c.queue.Forget(event.(informerevent).key)
-			utilruntime.HandleError(err)
-		}
+		metrics.ObserveReconcile("authority", "GetByKey", start, err)
+		c.handleErr(queue, err, event, nil)
+		return
 	}
 
 	if !exists {
 		if event.(informerevent).function == delete {
 			c.logger.Infof("Controller.processNextItem: object deleted detected: %s", keyRaw)
-			c.handler.ObjectDeleted(item)
+			err = c.handler.ObjectDeleted(item)
+			metrics.ObserveReconcile("authority", "ObjectDeleted", start, err)
 		}
 	} else {
 		if event.(informerevent).function == create {
 			c.logger.Infof("Controller.processNextItem: object created detected: %s", keyRaw)
-			c.handler.ObjectCreated(item)
+			err = c.handler.ObjectCreated(item)
+			metrics.ObserveReconcile("authority", "ObjectCreated", start, err)
 		} else if event.(informerevent).function == update {
 			log.Println(event.(informerevent).key)
 			c.logger.Infof("Controller.processNextItem: object updated detected: %s", keyRaw)
-			c.handler.ObjectUpdated(item)
+			err = c.handler.ObjectUpdated(item)
+			metrics.ObserveReconcile("authority", "ObjectUpdated", start, err)
 		}
 	}
-	c.queue.Forget(event.(informerevent).key)
+	if !exists {
+		item = nil
+	}
+	c.handleErr(queue, err, event, item)
+}
 
-	return true
+// handleErr requeues the event with the rate limiter until it fails maxRetries times in a row, and then gives up on it
+// by setting the status of the authority
+func (c *controller) handleErr(queue workqueue.RateLimitingInterface, err error, event interface{}, item interface{}) {
+	if err == nil {
+		queue.Forget(event)
+		return
+	}
+	if retries := queue.NumRequeues(event); retries < maxRetries {
+		c.logger.Errorf("Controller.processNextItem: Failed processing item with key %s with error %v, retry %d/%d", event.(informerevent).key, err, retries+1, maxRetries)
+		queue.AddRateLimited(event)
+		return
+	}
+	c.logger.Errorf("Controller.processNextItem: Failed processing item with key %s with error %v, no more retries", event.(informerevent).key, err)
+	queue.Forget(event)
+	utilruntime.HandleError(err)
+	if item != nil {
+		c.handler.ObjectFailed(item, fmt.Errorf("%d attempts failed, the last with %s", maxRetries+1, err))
+	}
 }
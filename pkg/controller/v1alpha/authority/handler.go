@@ -28,6 +28,7 @@ import (
 	"github.com/EdgeNet-project/edgenet/pkg/mailer"
 	ns "github.com/EdgeNet-project/edgenet/pkg/namespace"
 	"github.com/EdgeNet-project/edgenet/pkg/permission"
+	"github.com/EdgeNet-project/edgenet/pkg/recorder"
 
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
@@ -35,14 +36,16 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
 	Init(kubernetes kubernetes.Interface, edgenet versioned.Interface)
-	ObjectCreated(obj interface{})
-	ObjectUpdated(obj interface{})
-	ObjectDeleted(obj interface{})
+	ObjectCreated(obj interface{}) error
+	ObjectUpdated(obj interface{}) error
+	ObjectDeleted(obj interface{}) error
+	ObjectFailed(obj interface{}, err error)
 }
 
 // Handler implementation
@@ -50,6 +53,7 @@ type Handler struct {
 	clientset        kubernetes.Interface
 	edgenetClientset versioned.Interface
 	resourceQuota    *corev1.ResourceQuota
+	recorder         record.EventRecorder
 }
 
 // Init handles any handler initialization
@@ -57,6 +61,7 @@ func (t *Handler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interf
 	log.Info("AuthorityHandler.Init")
 	t.clientset = kubernetes
 	t.edgenetClientset = edgenet
+	t.recorder = recorder.New(kubernetes, "authority-controller")
 	t.resourceQuota = &corev1.ResourceQuota{}
 	t.resourceQuota.Name = "authority-quota"
 	t.resourceQuota.Spec = corev1.ResourceQuotaSpec{
@@ -82,8 +87,8 @@ func (t *Handler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interf
 	permission.Clientset = t.clientset
 }
 
-// ObjectCreated is called when an object is created
-func (t *Handler) ObjectCreated(obj interface{}) {
+// ObjectCreated is called when an object is created, the event is retried if it returns an error
+func (t *Handler) ObjectCreated(obj interface{}) error {
 	log.Info("AuthorityHandler.ObjectCreated")
 	// Create a copy of the authority object to make changes on it
 	authorityCopy := obj.(*apps_v1alpha.Authority).DeepCopy()
@@ -93,14 +98,18 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 		authorityCopy.Status.State = failure
 		authorityCopy.Status.Message = []string{message}
 		authorityCopy.Spec.Enabled = false
-		t.edgenetClientset.AppsV1alpha().Authorities().UpdateStatus(context.TODO(), authorityCopy, metav1.UpdateOptions{})
-		return
+		if _, err := t.edgenetClientset.AppsV1alpha().Authorities().UpdateStatus(context.TODO(), authorityCopy, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		t.recorder.Event(authorityCopy, corev1.EventTypeWarning, "Duplicate", message)
+		return nil
 	}
 	authorityCopy = t.authorityPreparation(authorityCopy)
+	return nil
 }
 
-// ObjectUpdated is called when an object is updated
-func (t *Handler) ObjectUpdated(obj interface{}) {
+// ObjectUpdated is called when an object is updated, the event is retried if it returns an error
+func (t *Handler) ObjectUpdated(obj interface{}) error {
 	log.Info("AuthorityHandler.ObjectUpdated")
 	// Create a copy of the authority object to make changes on it
 	authorityCopy := obj.(*apps_v1alpha.Authority).DeepCopy()
@@ -114,30 +123,59 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 		if err == nil {
 			authorityCopy = authorityCopyUpdated
 		}
+		t.recorder.Event(authorityCopy, corev1.EventTypeWarning, "Duplicate", message)
 	} else if !authorityCopy.Spec.Enabled && authorityCopy.Status.State == failure {
 		authorityCopy = t.authorityPreparation(authorityCopy)
 	}
 	// Check whether the authority disabled
 	if authorityCopy.Spec.Enabled == false {
 		// Delete all RoleBindings, Teams, and Slices in the namespace of authority
-		t.edgenetClientset.AppsV1alpha().Slices(fmt.Sprintf("authority-%s", authorityCopy.GetName())).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{})
-		t.edgenetClientset.AppsV1alpha().Teams(fmt.Sprintf("authority-%s", authorityCopy.GetName())).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{})
-		t.clientset.RbacV1().RoleBindings(fmt.Sprintf("authority-%s", authorityCopy.GetName())).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{})
+		if err := t.edgenetClientset.AppsV1alpha().Slices(fmt.Sprintf("authority-%s", authorityCopy.GetName())).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{}); err != nil {
+			return err
+		}
+		if err := t.edgenetClientset.AppsV1alpha().Teams(fmt.Sprintf("authority-%s", authorityCopy.GetName())).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{}); err != nil {
+			return err
+		}
+		if err := t.clientset.RbacV1().RoleBindings(fmt.Sprintf("authority-%s", authorityCopy.GetName())).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{}); err != nil {
+			return err
+		}
 		// List all authority users to deactivate and to remove their cluster role binding to get the authority
-		usersRaw, _ := t.edgenetClientset.AppsV1alpha().Users(fmt.Sprintf("authority-%s", authorityCopy.GetName())).List(context.TODO(), metav1.ListOptions{})
+		usersRaw, err := t.edgenetClientset.AppsV1alpha().Users(fmt.Sprintf("authority-%s", authorityCopy.GetName())).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
 		for _, user := range usersRaw.Items {
 			userCopy := user.DeepCopy()
 			userCopy.Spec.Active = false
-			t.edgenetClientset.AppsV1alpha().Users(userCopy.GetNamespace()).Update(context.TODO(), userCopy, metav1.UpdateOptions{})
-			t.clientset.RbacV1().ClusterRoleBindings().Delete(context.TODO(), fmt.Sprintf("%s-%s-for-authority", userCopy.GetNamespace(), userCopy.GetName()), metav1.DeleteOptions{})
+			if _, err := t.edgenetClientset.AppsV1alpha().Users(userCopy.GetNamespace()).Update(context.TODO(), userCopy, metav1.UpdateOptions{}); err != nil {
+				return err
+			}
+			if err := t.clientset.RbacV1().ClusterRoleBindings().Delete(context.TODO(), fmt.Sprintf("%s-%s-for-authority", userCopy.GetNamespace(), userCopy.GetName()), metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
 		}
+		t.recorder.Eventf(authorityCopy, corev1.EventTypeNormal, "Disabled", "Authority disabled, its slices and teams are deleted and its %d user(s) deactivated", len(usersRaw.Items))
 	}
+	return nil
 }
 
 // ObjectDeleted is called when an object is deleted
-func (t *Handler) ObjectDeleted(obj interface{}) {
+func (t *Handler) ObjectDeleted(obj interface{}) error {
 	log.Info("AuthorityHandler.ObjectDeleted")
 	// Delete or disable nodes added by authority, TBD.
+	return nil
+}
+
+// ObjectFailed is called when the controller gives up on an object after its retries
+func (t *Handler) ObjectFailed(obj interface{}, err error) {
+	log.Info("AuthorityHandler.ObjectFailed")
+	authorityCopy := obj.(*apps_v1alpha.Authority).DeepCopy()
+	authorityCopy.Status.State = failure
+	message := fmt.Sprintf(statusDict["reconcile-failure"], err)
+	recorder.ReconcileFailed(t.recorder, authorityCopy, &authorityCopy.Status.Message, &authorityCopy.Status.Conditions, "Reconciled", message)
+	if _, err := t.edgenetClientset.AppsV1alpha().Authorities().UpdateStatus(context.TODO(), authorityCopy, metav1.UpdateOptions{}); err != nil {
+		log.Println(err.Error())
+	}
 }
 
 // Create function is for being used by other resources to create an authority
@@ -185,6 +223,7 @@ func (t *Handler) authorityPreparation(authorityCopy *apps_v1alpha.Authority) *a
 			log.Infof("Couldn't create namespace for %s: %s", authorityCopy.GetName(), err)
 			authorityCopy.Status.State = failure
 			authorityCopy.Status.Message = []string{statusDict["namespace-failure"]}
+			t.recorder.Eventf(authorityCopy, corev1.EventTypeWarning, "NamespaceFailed", "%s, %s", statusDict["namespace-failure"], err)
 		}
 		// Create the resource quota to ban users from using this namespace for their applications
 		_, err = t.clientset.CoreV1().ResourceQuotas(authorityChildNamespaceCreated.GetName()).Create(context.TODO(), t.resourceQuota, metav1.CreateOptions{})
@@ -215,6 +254,7 @@ func (t *Handler) authorityPreparation(authorityCopy *apps_v1alpha.Authority) *a
 				t.sendEmail(authorityCopy, "user-creation-failure")
 				authorityCopy.Status.State = failure
 				authorityCopy.Status.Message = append(authorityCopy.Status.Message, []string{statusDict["user-failed"], err.Error()}...)
+				t.recorder.Eventf(authorityCopy, corev1.EventTypeWarning, "UserFailed", "%s, %s", statusDict["user-failed"], err)
 			}
 		}
 		defer enableAuthorityAdmin()
@@ -223,6 +263,7 @@ func (t *Handler) authorityPreparation(authorityCopy *apps_v1alpha.Authority) *a
 			authorityCopy.Status.State = established
 			authorityCopy.Status.Message = []string{statusDict["authority-ok"]}
 			t.sendEmail(authorityCopy, "authority-creation-successful")
+			t.recorder.Event(authorityCopy, corev1.EventTypeNormal, "Established", statusDict["authority-ok"])
 		}
 	} else if err == nil {
 		permission.CreateClusterRoles(authorityCopy)
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
@@ -27,25 +28,30 @@ import (
 	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/emailverification"
 	"github.com/EdgeNet-project/edgenet/pkg/generated/clientset/versioned"
 	"github.com/EdgeNet-project/edgenet/pkg/mailer"
+	"github.com/EdgeNet-project/edgenet/pkg/recorder"
 
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
 	Init(kubernetes kubernetes.Interface, edgenet versioned.Interface)
-	ObjectCreated(obj interface{})
-	ObjectUpdated(obj interface{})
-	ObjectDeleted(obj interface{})
+	ObjectCreated(obj interface{}) error
+	ObjectUpdated(obj interface{}) error
+	ObjectDeleted(obj interface{}) error
+	ObjectFailed(obj interface{}, err error)
 }
 
 // Handler implementation
 type Handler struct {
 	clientset        kubernetes.Interface
 	edgenetClientset versioned.Interface
+	recorder         record.EventRecorder
 }
 
 // Init handles any handler initialization
@@ -53,45 +59,56 @@ func (t *Handler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interf
 	log.Info("authorityRequestHandler.Init")
 	t.clientset = kubernetes
 	t.edgenetClientset = edgenet
+	t.recorder = recorder.New(kubernetes, "authorityrequest-controller")
 }
 
-// ObjectCreated is called when an object is created
-func (t *Handler) ObjectCreated(obj interface{}) {
+// ObjectCreated is called when an object is created, the event is retried if it returns an error
+func (t *Handler) ObjectCreated(obj interface{}) (err error) {
 	log.Info("authorityRequestHandler.ObjectCreated")
 	// Create a copy of the authority request object to make changes on it
 	authorityRequestCopy := obj.(*apps_v1alpha.AuthorityRequest).DeepCopy()
-	defer t.edgenetClientset.AppsV1alpha().AuthorityRequests().UpdateStatus(context.TODO(), authorityRequestCopy, metav1.UpdateOptions{})
+	// The approval timeout runs once the status is recorded so that a retry doesn't run it twice
+	runTimeout := true
+	defer func() {
+		_, err = t.edgenetClientset.AppsV1alpha().AuthorityRequests().UpdateStatus(context.TODO(), authorityRequestCopy, metav1.UpdateOptions{})
+		if err == nil && runTimeout {
+			go t.runApprovalTimeout(authorityRequestCopy)
+		} else if errors.IsNotFound(err) {
+			// The request is removed once the authority is created
+			err = nil
+		}
+	}()
 	// Check if the email address of user or authority name is already taken
 	exists, message := t.checkDuplicateObject(authorityRequestCopy)
 	if exists {
 		authorityRequestCopy.Status.State = failure
 		authorityRequestCopy.Status.Message = message
-		// Run timeout goroutine
-		go t.runApprovalTimeout(authorityRequestCopy)
+		t.recorder.Event(authorityRequestCopy, corev1.EventTypeWarning, "Duplicate", strings.Join(message, ", "))
 		// Set the approval timeout which is 24 hours
 		authorityRequestCopy.Status.Expires = &metav1.Time{
 			Time: time.Now().Add(24 * time.Hour),
 		}
-		return
+		return nil
 	}
 	if authorityRequestCopy.Spec.Approved {
 		authorityHandler := authority.Handler{}
 		authorityHandler.Init(t.clientset, t.edgenetClientset)
 		created := !authorityHandler.Create(authorityRequestCopy)
 		if created {
-			return
+			t.recorder.Event(authorityRequestCopy, corev1.EventTypeNormal, "Approved", "Authority request approved, the authority is created")
+			runTimeout = false
+			return nil
 		} else {
 			t.sendEmail("authority-creation-failure", authorityRequestCopy)
 			authorityRequestCopy.Status.State = failure
 			authorityRequestCopy.Status.Message = []string{statusDict["authority-failed"]}
+			t.recorder.Event(authorityRequestCopy, corev1.EventTypeWarning, "AuthorityFailed", statusDict["authority-failed"])
 		}
 
 	}
 	// If the service restarts, it creates all objects again
 	// Because of that, this section covers a variety of possibilities
 	if authorityRequestCopy.Status.Expires == nil {
-		// Run timeout goroutine
-		go t.runApprovalTimeout(authorityRequestCopy)
 		// Set the approval timeout which is 72 hours
 		authorityRequestCopy.Status.Expires = &metav1.Time{
 			Time: time.Now().Add(72 * time.Hour),
@@ -103,18 +120,18 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 			// Update the status as successful
 			authorityRequestCopy.Status.State = success
 			authorityRequestCopy.Status.Message = []string{statusDict["email-ok"]}
+			t.recorder.Event(authorityRequestCopy, corev1.EventTypeNormal, "VerificationSent", statusDict["email-ok"])
 		} else {
 			authorityRequestCopy.Status.State = issue
 			authorityRequestCopy.Status.Message = []string{statusDict["email-fail"]}
+			t.recorder.Event(authorityRequestCopy, corev1.EventTypeWarning, "VerificationFailed", statusDict["email-fail"])
 		}
-
-	} else {
-		go t.runApprovalTimeout(authorityRequestCopy)
 	}
+	return nil
 }
 
-// ObjectUpdated is called when an object is updated
-func (t *Handler) ObjectUpdated(obj interface{}) {
+// ObjectUpdated is called when an object is updated, the event is retried if it returns an error
+func (t *Handler) ObjectUpdated(obj interface{}) error {
 	log.Info("authorityRequestHandler.ObjectUpdated")
 	// Create a copy of the authority request object to make changes on it
 	authorityRequestCopy := obj.(*apps_v1alpha.AuthorityRequest).DeepCopy()
@@ -131,6 +148,9 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 				t.sendEmail("authority-creation-failure", authorityRequestCopy)
 				authorityRequestCopy.Status.State = failure
 				authorityRequestCopy.Status.Message = []string{statusDict["authority-failed"]}
+				t.recorder.Event(authorityRequestCopy, corev1.EventTypeWarning, "AuthorityFailed", statusDict["authority-failed"])
+			} else {
+				t.recorder.Event(authorityRequestCopy, corev1.EventTypeNormal, "Approved", "Authority request approved, the authority is created")
 			}
 		} else if !authorityRequestCopy.Spec.Approved && authorityRequestCopy.Status.State == failure {
 			emailVerificationHandler := emailverification.Handler{}
@@ -140,9 +160,11 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 				// Update the status as successful
 				authorityRequestCopy.Status.State = success
 				authorityRequestCopy.Status.Message = []string{statusDict["email-ok"]}
+				t.recorder.Event(authorityRequestCopy, corev1.EventTypeNormal, "VerificationSent", statusDict["email-ok"])
 			} else {
 				authorityRequestCopy.Status.State = issue
 				authorityRequestCopy.Status.Message = []string{statusDict["email-fail"]}
+				t.recorder.Event(authorityRequestCopy, corev1.EventTypeWarning, "VerificationFailed", statusDict["email-fail"])
 			}
 			changeStatus = true
 		}
@@ -150,16 +172,33 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 		authorityRequestCopy.Status.State = failure
 		authorityRequestCopy.Status.Message = message
 		changeStatus = true
+		t.recorder.Event(authorityRequestCopy, corev1.EventTypeWarning, "Duplicate", strings.Join(message, ", "))
 	}
 	if changeStatus {
-		t.edgenetClientset.AppsV1alpha().AuthorityRequests().UpdateStatus(context.TODO(), authorityRequestCopy, metav1.UpdateOptions{})
+		if _, err := t.edgenetClientset.AppsV1alpha().AuthorityRequests().UpdateStatus(context.TODO(), authorityRequestCopy, metav1.UpdateOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
 	}
+	return nil
 }
 
 // ObjectDeleted is called when an object is deleted
-func (t *Handler) ObjectDeleted(obj interface{}) {
+func (t *Handler) ObjectDeleted(obj interface{}) error {
 	log.Info("authorityRequestHandler.ObjectDeleted")
 	// Mail notification, TBD
+	return nil
+}
+
+// ObjectFailed is called when the controller gives up on an object after its retries
+func (t *Handler) ObjectFailed(obj interface{}, err error) {
+	log.Info("authorityRequestHandler.ObjectFailed")
+	authorityRequestCopy := obj.(*apps_v1alpha.AuthorityRequest).DeepCopy()
+	authorityRequestCopy.Status.State = failure
+	message := fmt.Sprintf(statusDict["reconcile-failure"], err)
+	recorder.ReconcileFailed(t.recorder, authorityRequestCopy, &authorityRequestCopy.Status.Message, &authorityRequestCopy.Status.Conditions, "Reconciled", message)
+	if _, err := t.edgenetClientset.AppsV1alpha().AuthorityRequests().UpdateStatus(context.TODO(), authorityRequestCopy, metav1.UpdateOptions{}); err != nil {
+		log.Println(err.Error())
+	}
 }
 
 // sendEmail to send notification to participants
@@ -289,6 +328,7 @@ timeoutLoop:
 			watchAuthorityRequest.Stop()
 			closeChannels()
 			t.edgenetClientset.AppsV1alpha().AuthorityRequests().Delete(context.TODO(), authorityRequestCopy.GetName(), metav1.DeleteOptions{})
+			t.recorder.Event(authorityRequestCopy, corev1.EventTypeNormal, "Expired", "Authority request not approved in time, it is removed")
 			break timeoutLoop
 		case <-terminated:
 			watchAuthorityRequest.Stop()
@@ -25,25 +25,31 @@ import (
 	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
 	"github.com/EdgeNet-project/edgenet/pkg/generated/clientset/versioned"
 	"github.com/EdgeNet-project/edgenet/pkg/mailer"
+	"github.com/EdgeNet-project/edgenet/pkg/recorder"
 	"github.com/EdgeNet-project/edgenet/pkg/util"
 
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
 	Init(kubernetes kubernetes.Interface, edgenet versioned.Interface)
-	ObjectCreated(obj interface{})
-	ObjectUpdated(obj, updated interface{})
-	ObjectDeleted(obj interface{})
+	ObjectCreated(obj interface{}) error
+	ObjectUpdated(obj, updated interface{}) error
+	ObjectDeleted(obj interface{}) error
+	ObjectFailed(obj interface{}, err error)
 }
 
 // Handler implementation
 type Handler struct {
 	clientset        kubernetes.Interface
 	edgenetClientset versioned.Interface
+	recorder         record.EventRecorder
 }
 
 // Init handles any handler initialization
@@ -51,90 +57,133 @@ func (t *Handler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interf
 	log.Info("EVHandler.Init")
 	t.clientset = kubernetes
 	t.edgenetClientset = edgenet
+	t.recorder = recorder.New(kubernetes, "emailverification-controller")
 }
 
-// ObjectCreated is called when an object is created
-func (t *Handler) ObjectCreated(obj interface{}) {
+// ObjectCreated is called when an object is created, the event is retried if it returns an error
+func (t *Handler) ObjectCreated(obj interface{}) error {
 	log.Info("EVHandler.ObjectCreated")
 	// Create a copy of the email verification object to make changes on it
 	EVCopy := obj.(*apps_v1alpha.EmailVerification).DeepCopy()
 	// Find the authority from the namespace in which the object is
-	EVOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), EVCopy.GetNamespace(), metav1.GetOptions{})
-	// If the object's kind is AuthorityRequest, `registration` namespace hosts the email verification object.
-	// Otherwise, the object belongs to the namespace that the authority created.
-	var authorityEnabled bool
-	if EVOwnerNamespace.GetName() == "registration" {
-		authorityEnabled = true
-	} else {
-		EVOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), EVOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
-		authorityEnabled = EVOwnerAuthority.Spec.Enabled
+	EVOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(context.TODO(), EVCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	authorityEnabled, err := t.authorityEnabled(EVOwnerNamespace)
+	if err != nil {
+		return err
 	}
 	// Check if the authority is active
 	if authorityEnabled {
 		// If the service restarts, it creates all objects again
 		// Because of that, this section covers a variety of possibilities
 		if EVCopy.Spec.Verified {
-			t.objectConfiguration(EVCopy, EVOwnerNamespace.Labels["authority-name"])
+			return t.objectConfiguration(EVCopy, EVOwnerNamespace.Labels["authority-name"])
 		} else if !EVCopy.Spec.Verified && EVCopy.Status.Expires == nil {
-			// Run timeout goroutine
-			go t.runVerificationTimeout(EVCopy)
-			defer t.edgenetClientset.AppsV1alpha().EmailVerifications(EVCopy.GetNamespace()).UpdateStatus(context.TODO(), EVCopy, metav1.UpdateOptions{})
 			// Set the email verification timeout which is 24 hours
 			EVCopy.Status.Expires = &metav1.Time{
 				Time: time.Now().Add(24 * time.Hour),
 			}
+			// The timeout runs once the expiry date is recorded so that a retry doesn't run it twice
+			EVUpdated, err := t.edgenetClientset.AppsV1alpha().EmailVerifications(EVCopy.GetNamespace()).UpdateStatus(context.TODO(), EVCopy, metav1.UpdateOptions{})
+			if err != nil {
+				return err
+			}
+			// Run timeout goroutine
+			go t.runVerificationTimeout(EVUpdated)
 		} else if !EVCopy.Spec.Verified && EVCopy.Status.Expires != nil {
 			// Check if the email verification expired
 			if EVCopy.Status.Expires.Time.Sub(time.Now()) >= 0 {
 				go t.runVerificationTimeout(EVCopy)
 			} else {
-				t.edgenetClientset.AppsV1alpha().EmailVerifications(EVCopy.GetNamespace()).Delete(context.TODO(), EVCopy.GetName(), metav1.DeleteOptions{})
+				return t.delete(EVCopy)
 			}
 		}
 	} else {
-		t.edgenetClientset.AppsV1alpha().EmailVerifications(EVCopy.GetNamespace()).Delete(context.TODO(), EVCopy.GetName(), metav1.DeleteOptions{})
+		return t.delete(EVCopy)
 	}
+	return nil
 }
 
-// ObjectUpdated is called when an object is updated
-func (t *Handler) ObjectUpdated(obj, updated interface{}) {
+// ObjectUpdated is called when an object is updated, the event is retried if it returns an error
+func (t *Handler) ObjectUpdated(obj, updated interface{}) error {
 	log.Info("EVHandler.ObjectUpdated")
 	// Create a copy of the email verification object to make changes on it
 	EVCopy := obj.(*apps_v1alpha.EmailVerification).DeepCopy()
-	EVOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), EVCopy.GetNamespace(), metav1.GetOptions{})
+	EVOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(context.TODO(), EVCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	// Security check to prevent any kind of manipulation on the email verification
 	fieldUpdated := updated.(fields)
 	if fieldUpdated.kind || fieldUpdated.identifier {
-		t.edgenetClientset.AppsV1alpha().EmailVerifications(EVCopy.GetNamespace()).Delete(context.TODO(), EVCopy.GetName(), metav1.DeleteOptions{})
+		if err := t.delete(EVCopy); err != nil {
+			return err
+		}
+		t.recorder.Event(EVCopy, corev1.EventTypeWarning, "Dubious", "Kind or identifier of the email verification modified, it is removed")
 		if strings.ToLower(EVCopy.Spec.Kind) == "authority" {
 			t.sendEmail("authority-email-verification-dubious", EVCopy.Spec.Identifier, EVCopy.GetNamespace(), "", "", "", "")
 		} else if strings.ToLower(EVCopy.Spec.Kind) == "user" || strings.ToLower(EVCopy.Spec.Kind) == "email" {
 			t.sendEmail("user-email-verification-dubious", EVOwnerNamespace.Labels["authority-name"], EVCopy.GetNamespace(), EVCopy.Spec.Identifier, "", "", "")
 		}
-		return
+		return nil
 	}
-	var authorityEnabled bool
-	if EVOwnerNamespace.GetName() == "registration" {
-		authorityEnabled = true
-	} else {
-		EVOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), EVOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
-		authorityEnabled = EVOwnerAuthority.Spec.Enabled
+	authorityEnabled, err := t.authorityEnabled(EVOwnerNamespace)
+	if err != nil {
+		return err
 	}
 	// Check whether the authority enabled
 	if authorityEnabled {
 		// Check whether the email verification is done
 		if EVCopy.Spec.Verified {
-			t.objectConfiguration(EVCopy, EVOwnerNamespace.Labels["authority-name"])
+			return t.objectConfiguration(EVCopy, EVOwnerNamespace.Labels["authority-name"])
 		}
 	} else {
-		t.edgenetClientset.AppsV1alpha().EmailVerifications(EVCopy.GetNamespace()).Delete(context.TODO(), EVCopy.GetName(), metav1.DeleteOptions{})
+		return t.delete(EVCopy)
 	}
+	return nil
 }
 
 // ObjectDeleted is called when an object is deleted
-func (t *Handler) ObjectDeleted(obj interface{}) {
+func (t *Handler) ObjectDeleted(obj interface{}) error {
 	log.Info("EVHandler.ObjectDeleted")
 	// Mail notification, TBD
+	return nil
+}
+
+// ObjectFailed is called when the controller gives up on an object after its retries
+func (t *Handler) ObjectFailed(obj interface{}, err error) {
+	log.Info("EVHandler.ObjectFailed")
+	EVCopy := obj.(*apps_v1alpha.EmailVerification).DeepCopy()
+	EVCopy.Status.State = failure
+	message := fmt.Sprintf(statusDict["reconcile-failure"], err)
+	recorder.ReconcileFailed(t.recorder, EVCopy, &EVCopy.Status.Message, &EVCopy.Status.Conditions, "Reconciled", message)
+	if _, err := t.edgenetClientset.AppsV1alpha().EmailVerifications(EVCopy.GetNamespace()).UpdateStatus(context.TODO(), EVCopy, metav1.UpdateOptions{}); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// authorityEnabled tells whether the authority that the namespace belongs to is enabled. If the object's kind is AuthorityRequest,
+// `registration` namespace hosts the email verification object. Otherwise, the object belongs to the namespace that the authority created.
+func (t *Handler) authorityEnabled(EVOwnerNamespace *corev1.Namespace) (bool, error) {
+	if EVOwnerNamespace.GetName() == "registration" {
+		return true, nil
+	}
+	EVOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), EVOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	return EVOwnerAuthority.Spec.Enabled, nil
+}
+
+// delete removes the email verification, which may be gone already
+func (t *Handler) delete(EVCopy *apps_v1alpha.EmailVerification) error {
+	err := t.edgenetClientset.AppsV1alpha().EmailVerifications(EVCopy.GetNamespace()).Delete(context.TODO(), EVCopy.GetName(), metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
 }
 
 // Create to provide one-time code for verification
@@ -235,31 +284,54 @@ func (t *Handler) sendEmail(subject, authority, namespace, username, fullname, e
 }
 
 // objectConfiguration to update the objects that are relevant the request and send email
-func (t *Handler) objectConfiguration(EVCopy *apps_v1alpha.EmailVerification, authorityName string) {
+func (t *Handler) objectConfiguration(EVCopy *apps_v1alpha.EmailVerification, authorityName string) error {
 	// Update the status of request related to email verification
 	if strings.ToLower(EVCopy.Spec.Kind) == "authority" {
-		ARObj, _ := t.edgenetClientset.AppsV1alpha().AuthorityRequests().Get(context.TODO(), EVCopy.Spec.Identifier, metav1.GetOptions{})
+		ARObj, err := t.edgenetClientset.AppsV1alpha().AuthorityRequests().Get(context.TODO(), EVCopy.Spec.Identifier, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
 		ARObj.Status.EmailVerified = true
-		t.edgenetClientset.AppsV1alpha().AuthorityRequests().UpdateStatus(context.TODO(), ARObj, metav1.UpdateOptions{})
+		if _, err := t.edgenetClientset.AppsV1alpha().AuthorityRequests().UpdateStatus(context.TODO(), ARObj, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		t.recorder.Event(ARObj, corev1.EventTypeNormal, "EmailVerified", "Email address of the contact verified")
 		// Send email to inform admins of the cluster
 		t.sendEmail("authority-email-verified-alert", EVCopy.Spec.Identifier, EVCopy.GetNamespace(), ARObj.Spec.Contact.Username,
 			fmt.Sprintf("%s %s", ARObj.Spec.Contact.FirstName, ARObj.Spec.Contact.LastName), "", "")
 	} else if strings.ToLower(EVCopy.Spec.Kind) == "user" {
-		URRObj, _ := t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(EVCopy.GetNamespace()).Get(context.TODO(), EVCopy.Spec.Identifier, metav1.GetOptions{})
+		URRObj, err := t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(EVCopy.GetNamespace()).Get(context.TODO(), EVCopy.Spec.Identifier, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
 		URRObj.Status.EmailVerified = true
-		t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRObj.GetNamespace()).UpdateStatus(context.TODO(), URRObj, metav1.UpdateOptions{})
+		if _, err := t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRObj.GetNamespace()).UpdateStatus(context.TODO(), URRObj, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		t.recorder.Event(URRObj, corev1.EventTypeNormal, "EmailVerified", "Email address of the user verified")
 		// Send email to inform authority-admins and authorized users
 		t.sendEmail("user-email-verified-alert", authorityName, EVCopy.GetNamespace(), EVCopy.Spec.Identifier,
 			fmt.Sprintf("%s %s", URRObj.Spec.FirstName, URRObj.Spec.LastName), "", "")
 	} else if strings.ToLower(EVCopy.Spec.Kind) == "email" {
-		userObj, _ := t.edgenetClientset.AppsV1alpha().Users(EVCopy.GetNamespace()).Get(context.TODO(), EVCopy.Spec.Identifier, metav1.GetOptions{})
+		userObj, err := t.edgenetClientset.AppsV1alpha().Users(EVCopy.GetNamespace()).Get(context.TODO(), EVCopy.Spec.Identifier, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
 		userObj.Spec.Active = true
-		t.edgenetClientset.AppsV1alpha().Users(userObj.GetNamespace()).UpdateStatus(context.TODO(), userObj, metav1.UpdateOptions{})
+		if _, err := t.edgenetClientset.AppsV1alpha().Users(userObj.GetNamespace()).UpdateStatus(context.TODO(), userObj, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		t.recorder.Event(userObj, corev1.EventTypeNormal, "EmailVerified", "Email address verified, the user is activated")
 		if userObj.Status.Type == "admin" {
-			authorityObj, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), authorityName, metav1.GetOptions{})
+			authorityObj, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), authorityName, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
 			if authorityObj.Spec.Contact.Username == userObj.GetName() {
 				authorityObj.Spec.Contact.Email = userObj.Spec.Email
-				t.edgenetClientset.AppsV1alpha().Authorities().Update(context.TODO(), authorityObj, metav1.UpdateOptions{})
+				if _, err := t.edgenetClientset.AppsV1alpha().Authorities().Update(context.TODO(), authorityObj, metav1.UpdateOptions{}); err != nil {
+					return err
+				}
 			}
 		}
 		// Send email to inform user
@@ -267,7 +339,7 @@ func (t *Handler) objectConfiguration(EVCopy *apps_v1alpha.EmailVerification, au
 			fmt.Sprintf("%s %s", userObj.Spec.FirstName, userObj.Spec.LastName), userObj.Spec.Email, "")
 	}
 	// Delete the unique email verification object as it gets verified
-	t.edgenetClientset.AppsV1alpha().EmailVerifications(EVCopy.GetNamespace()).Delete(context.TODO(), EVCopy.GetName(), metav1.DeleteOptions{})
+	return t.delete(EVCopy)
 }
 
 // runVerificationTimeout puts a procedure in place to remove requests by verification or timeout
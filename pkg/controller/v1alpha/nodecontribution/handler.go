@@ -18,6 +18,7 @@ package nodecontribution
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -30,8 +31,10 @@ import (
 	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/authority"
 	"github.com/EdgeNet-project/edgenet/pkg/generated/clientset/versioned"
 	"github.com/EdgeNet-project/edgenet/pkg/mailer"
+	"github.com/EdgeNet-project/edgenet/pkg/metrics"
 	ns "github.com/EdgeNet-project/edgenet/pkg/namespace"
 	"github.com/EdgeNet-project/edgenet/pkg/node"
+	"github.com/EdgeNet-project/edgenet/pkg/recorder"
 	"github.com/EdgeNet-project/edgenet/pkg/remoteip"
 
 	namecheap "github.com/billputer/go-namecheap"
@@ -39,14 +42,16 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
 	Init(kubernetes kubernetes.Interface, edgenet versioned.Interface) error
-	ObjectCreated(obj interface{})
-	ObjectUpdated(obj interface{})
-	ObjectDeleted(obj interface{})
+	ObjectCreated(obj interface{}) error
+	ObjectUpdated(obj interface{}) error
+	ObjectDeleted(obj interface{}) error
+	ObjectFailed(obj interface{}, err error)
 }
 
 // Handler implementation
@@ -54,6 +59,7 @@ type Handler struct {
 	clientset        kubernetes.Interface
 	edgenetClientset versioned.Interface
 	publicKey        ssh.Signer
+	recorder         record.EventRecorder
 }
 
 // Init handles any handler initialization
@@ -61,37 +67,44 @@ func (t *Handler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interf
 	log.Info("NCHandler.Init")
 	t.clientset = kubernetes
 	t.edgenetClientset = edgenet
+	t.recorder = recorder.New(kubernetes, "nodecontribution-controller")
+	node.Clientset = t.clientset
 
 	// Get the SSH Public Key of the headnode
 	key, err := ioutil.ReadFile("../../.ssh/id_rsa")
 	if err != nil {
 		log.Println(err.Error())
-		panic(err.Error())
+		return err
 	}
 
 	t.publicKey, err = ssh.ParsePrivateKey(key)
 	if err != nil {
 		log.Println(err.Error())
-		panic(err.Error())
+		return err
 	}
-	node.Clientset = t.clientset
-	return err
+	return nil
 }
 
-// ObjectCreated is called when an object is created
-func (t *Handler) ObjectCreated(obj interface{}) {
+// ObjectCreated is called when an object is created, the event is retried if it returns an error
+func (t *Handler) ObjectCreated(obj interface{}) error {
 	log.Info("NCHandler.ObjectCreated")
 	// Create a copy of the node contribution object to make changes on it
 	ncCopy := obj.(*apps_v1alpha.NodeContribution).DeepCopy()
 	ncCopy.Status.Message = []string{}
 	// Find the authority from the namespace in which the object is
-	NCOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), ncCopy.GetNamespace(), metav1.GetOptions{})
+	NCOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(context.TODO(), ncCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	nodeName := fmt.Sprintf("%s.%s.edge-net.io", NCOwnerNamespace.Labels["authority-name"], ncCopy.GetName())
 	// Don't use the authority name if the node belongs to EdgeNet
 	if NCOwnerNamespace.GetName() == "authority-edgenet" {
 		nodeName = fmt.Sprintf("%s.edge-net.io", ncCopy.GetName())
 	}
-	NCOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), NCOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	NCOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), NCOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	authorityEnabled := NCOwnerAuthority.Spec.Enabled
 	log.Println("AUTHORITY CHECK")
 	// Check if the authority is active
@@ -104,9 +117,12 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 		if recordType == "" {
 			ncCopy.Status.State = failure
 			ncCopy.Status.Message = append(ncCopy.Status.Message, statusDict["invalid-host"])
-			t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
+			t.recorder.Event(ncCopy, corev1.EventTypeWarning, "InvalidHost", statusDict["invalid-host"])
+			if _, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{}); err != nil {
+				return err
+			}
 			t.sendEmail(ncCopy)
-			return
+			return nil
 		}
 		// Set the client config according to the node contribution,
 		// with the maximum time of 15 seconds to establist the connection.
@@ -121,13 +137,19 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 		if err == nil {
 			// The node corresponding to the contributed node exists in the cluster
 			log.Println("NODE FOUND")
+			if err := t.setLocation(ncCopy, nodeName, contributedNode.GetAnnotations()); err != nil {
+				t.recorder.Eventf(ncCopy, corev1.EventTypeWarning, "LocationFailed", "Setting location failed: %s", err)
+			}
 			if node.GetConditionReadyStatus(contributedNode.DeepCopy()) != trueStr {
 				t.balanceMultiThreading(5)
 				go t.runRecoveryProcedure(addr, config, nodeName, ncCopy, contributedNode)
 			} else {
 				ncCopy.Status.State = success
 				ncCopy.Status.Message = append(ncCopy.Status.Message, statusDict["node-ok"])
-				t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
+				t.recorder.Event(ncCopy, corev1.EventTypeNormal, "NodeReady", statusDict["node-ok"])
+				if _, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{}); err != nil {
+					return err
+				}
 			}
 		} else {
 			// There isn't any node corresponding to the node contribution
@@ -140,27 +162,38 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 		// Disable scheduling on the node if the authority is disabled
 		ncCopy.Spec.Enabled = false
 		ncCopyUpdated, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).Update(context.TODO(), ncCopy, metav1.UpdateOptions{})
-		if err == nil {
-			ncCopy = ncCopyUpdated
-			ncCopy.Status.State = failure
-			ncCopy.Status.Message = append(ncCopy.Status.Message, statusDict["authority-disabled"])
-			t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		ncCopy = ncCopyUpdated
+		ncCopy.Status.State = failure
+		ncCopy.Status.Message = append(ncCopy.Status.Message, statusDict["authority-disabled"])
+		t.recorder.Event(ncCopy, corev1.EventTypeWarning, "AuthorityDisabled", statusDict["authority-disabled"])
+		if _, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{}); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
-// ObjectUpdated is called when an object is updated
-func (t *Handler) ObjectUpdated(obj interface{}) {
+// ObjectUpdated is called when an object is updated, the event is retried if it returns an error
+func (t *Handler) ObjectUpdated(obj interface{}) error {
 	log.Info("NCHandler.ObjectUpdated")
 	// Create a copy of the node contribution object to make changes on it
 	ncCopy := obj.(*apps_v1alpha.NodeContribution).DeepCopy()
 	ncCopy.Status.Message = []string{}
-	NCOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), ncCopy.GetNamespace(), metav1.GetOptions{})
+	NCOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(context.TODO(), ncCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	nodeName := fmt.Sprintf("%s.%s.edge-net.io", NCOwnerNamespace.Labels["authority-name"], ncCopy.GetName())
 	if NCOwnerNamespace.GetName() == "authority-edgenet" {
 		nodeName = fmt.Sprintf("%s.edge-net.io", ncCopy.GetName())
 	}
-	NCOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), NCOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	NCOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), NCOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	authorityEnabled := NCOwnerAuthority.Spec.Enabled
 	log.Println("AUTHORITY CHECK")
 	// Check if the authority is active
@@ -170,9 +203,12 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 		if recordType == "" {
 			ncCopy.Status.State = failure
 			ncCopy.Status.Message = append(ncCopy.Status.Message, statusDict["invalid-host"])
-			t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
+			t.recorder.Event(ncCopy, corev1.EventTypeWarning, "InvalidHost", statusDict["invalid-host"])
+			if _, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{}); err != nil {
+				return err
+			}
 			t.sendEmail(ncCopy)
-			return
+			return nil
 		}
 		config := &ssh.ClientConfig{
 			User:            ncCopy.Spec.User,
@@ -187,13 +223,19 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 			if contributedNode.Spec.Unschedulable != !ncCopy.Spec.Enabled {
 				node.SetNodeScheduling(nodeName, !ncCopy.Spec.Enabled)
 			}
+			if err := t.setLocation(ncCopy, nodeName, contributedNode.GetAnnotations()); err != nil {
+				t.recorder.Eventf(ncCopy, corev1.EventTypeWarning, "LocationFailed", "Setting location failed: %s", err)
+			}
 			if node.GetConditionReadyStatus(contributedNode.DeepCopy()) != trueStr {
 				t.balanceMultiThreading(5)
 				go t.runRecoveryProcedure(addr, config, nodeName, ncCopy, contributedNode)
 			} else {
 				ncCopy.Status.State = success
 				ncCopy.Status.Message = append(ncCopy.Status.Message, statusDict["node-ok"])
-				t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
+				t.recorder.Event(ncCopy, corev1.EventTypeNormal, "NodeReady", statusDict["node-ok"])
+				if _, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{}); err != nil {
+					return err
+				}
 			}
 		} else {
 			log.Println("NODE NOT FOUND")
@@ -204,19 +246,37 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 		log.Println("AUTHORITY NOT ENABLED")
 		ncCopy.Spec.Enabled = false
 		ncCopyUpdated, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).Update(context.TODO(), ncCopy, metav1.UpdateOptions{})
-		if err == nil {
-			ncCopy = ncCopyUpdated
-			ncCopy.Status.State = failure
-			ncCopy.Status.Message = append(ncCopy.Status.Message, "Authority disabled")
-			t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		ncCopy = ncCopyUpdated
+		ncCopy.Status.State = failure
+		ncCopy.Status.Message = append(ncCopy.Status.Message, "Authority disabled")
+		t.recorder.Event(ncCopy, corev1.EventTypeWarning, "AuthorityDisabled", "Authority disabled")
+		if _, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{}); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 // ObjectDeleted is called when an object is deleted
-func (t *Handler) ObjectDeleted(obj interface{}) {
+func (t *Handler) ObjectDeleted(obj interface{}) error {
 	log.Info("NCHandler.ObjectDeleted")
 	// Mail notification, TBD
+	return nil
+}
+
+// ObjectFailed is called when the controller gives up on an object after its retries
+func (t *Handler) ObjectFailed(obj interface{}, err error) {
+	log.Info("NCHandler.ObjectFailed")
+	ncCopy := obj.(*apps_v1alpha.NodeContribution).DeepCopy()
+	ncCopy.Status.State = failure
+	message := fmt.Sprintf(statusDict["reconcile-failure"], err)
+	recorder.ReconcileFailed(t.recorder, ncCopy, &ncCopy.Status.Message, &ncCopy.Status.Conditions, "Reconciled", message)
+	if _, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{}); err != nil {
+		log.Println(err.Error())
+	}
 }
 
 // sendEmail to send notification to participants
@@ -283,6 +343,7 @@ func (t *Handler) runSetupProcedure(authorityName, addr, nodeName, recordType st
 	// Set the status as recovering
 	ncCopy.Status.State = inprogress
 	ncCopy.Status.Message = append(ncCopy.Status.Message, "Installation procedure has started")
+	t.recorder.Event(ncCopy, corev1.EventTypeNormal, "InstallationStarted", "Installation procedure has started")
 	ncCopyUpdated, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 	if err == nil {
 		ncCopy = ncCopyUpdated
@@ -295,6 +356,7 @@ nodeInstallLoop:
 		select {
 		case <-dnsConfiguration:
 			log.Println("***************DNS Configuration***************")
+			t.recorder.Eventf(ncCopy, corev1.EventTypeNormal, "ConfiguringDNS", "Registering the hostname %s", nodeName)
 			// Use Namecheap API for registration
 			hostRecord := namecheap.DomainDNSHost{
 				Name:    strings.TrimSuffix(nodeName, ".edge-net.io"),
@@ -313,6 +375,7 @@ nodeInstallLoop:
 				}
 				ncCopy.Status.State = incomplete
 				ncCopy.Status.Message = append(ncCopy.Status.Message, hostnameError)
+				t.recorder.Event(ncCopy, corev1.EventTypeWarning, "DNSFailed", hostnameError)
 				ncCopyUpdated, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 				if err == nil {
 					ncCopy = ncCopyUpdated
@@ -322,6 +385,7 @@ nodeInstallLoop:
 			installation <- true
 		case <-installation:
 			log.Println("***************Installation***************")
+			t.recorder.Event(ncCopy, corev1.EventTypeNormal, "Installing", "Installing the packages on the node to join the cluster")
 			// To prevent hanging forever during establishing a connection
 			go func() {
 				// SSH into the node
@@ -330,6 +394,8 @@ nodeInstallLoop:
 					log.Println(err)
 					ncCopy.Status.State = failure
 					ncCopy.Status.Message = append(ncCopy.Status.Message, "SSH handshake failed")
+					t.recorder.Event(ncCopy, corev1.EventTypeWarning, "SSHFailed", "SSH handshake failed")
+					metrics.NodeProcedures.WithLabelValues("installation", "ssh-failure").Inc()
 					ncCopyUpdated, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 					log.Println(err)
 					if err == nil {
@@ -344,6 +410,8 @@ nodeInstallLoop:
 				if err != nil {
 					ncCopy.Status.State = failure
 					ncCopy.Status.Message = append(ncCopy.Status.Message, "Node installation failed")
+					t.recorder.Event(ncCopy, corev1.EventTypeWarning, "InstallationFailed", "Node installation failed")
+					metrics.NodeProcedures.WithLabelValues("installation", "failure").Inc()
 					ncCopyUpdated, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 					log.Println(err)
 					if err == nil {
@@ -359,12 +427,14 @@ nodeInstallLoop:
 			}()
 		case <-nodePatch:
 			log.Println("***************Node Patch***************")
+			t.recorder.Event(ncCopy, corev1.EventTypeNormal, "Patching", "Node joined the cluster, configuring its scheduling and owner references")
 			// Set the node as schedulable or unschedulable according to the node contribution
 			patchStatus := true
 			err := node.SetNodeScheduling(nodeName, !ncCopy.Spec.Enabled)
 			if err != nil {
 				ncCopy.Status.State = incomplete
 				ncCopy.Status.Message = append(ncCopy.Status.Message, "Scheduling configuration failed")
+				t.recorder.Event(ncCopy, corev1.EventTypeWarning, "SchedulingFailed", "Scheduling configuration failed")
 				t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 				t.sendEmail(ncCopy)
 				patchStatus = false
@@ -382,15 +452,28 @@ nodeInstallLoop:
 			if err != nil {
 				ncCopy.Status.State = incomplete
 				ncCopy.Status.Message = append(ncCopy.Status.Message, "Setting owner reference failed")
+				t.recorder.Event(ncCopy, corev1.EventTypeWarning, "OwnerReferenceFailed", "Setting owner reference failed")
+				t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
+				t.sendEmail(ncCopy)
+				patchStatus = false
+			}
+			if err := t.setLocation(ncCopy, nodeName, nil); err != nil {
+				ncCopy.Status.State = incomplete
+				ncCopy.Status.Message = append(ncCopy.Status.Message, "Setting location failed")
+				t.recorder.Event(ncCopy, corev1.EventTypeWarning, "LocationFailed", "Setting location failed")
 				t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 				t.sendEmail(ncCopy)
 				patchStatus = false
 			}
-			if patchStatus {
+			// A failed patch has already set the status and sent the email, so the installation ends incomplete
+			if !patchStatus {
+				metrics.NodeProcedures.WithLabelValues("installation", "incomplete").Inc()
 				break nodeInstallLoop
 			}
+			metrics.NodeProcedures.WithLabelValues("installation", "success").Inc()
 			ncCopy.Status.State = success
 			ncCopy.Status.Message = append(ncCopy.Status.Message, "Node installation successful")
+			t.recorder.Event(ncCopy, corev1.EventTypeNormal, "Installed", "Node installation successful")
 			t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 			endProcedure <- true
 		case <-endProcedure:
@@ -402,6 +485,8 @@ nodeInstallLoop:
 			// Terminate the procedure after 25 minutes
 			ncCopy.Status.State = failure
 			ncCopy.Status.Message = append(ncCopy.Status.Message, "Node installation failed: timeout")
+			t.recorder.Event(ncCopy, corev1.EventTypeWarning, "InstallationTimeout", "Node installation failed: timeout")
+			metrics.NodeProcedures.WithLabelValues("installation", "timeout").Inc()
 			ncCopyUpdated, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 			log.Println(err)
 			if err == nil {
@@ -414,6 +499,23 @@ nodeInstallLoop:
 	return err
 }
 
+// setLocation puts the location given by the contributor on the node unless the annotations of the node already have it,
+// the nodelabeler then derives the geolabels from it. The node keeps its location when the contributor drops it from the spec.
+func (t *Handler) setLocation(ncCopy *apps_v1alpha.NodeContribution, nodeName string, annotations map[string]string) error {
+	if ncCopy.Spec.Location == nil {
+		return nil
+	}
+	value, err := json.Marshal(ncCopy.Spec.Location)
+	if err == nil && annotations[node.LocationAnnotation] == string(value) {
+		return nil
+	}
+	if err := node.SetLocationAnnotation(nodeName, *ncCopy.Spec.Location); err != nil {
+		return err
+	}
+	t.recorder.Event(ncCopy, corev1.EventTypeNormal, "LocationSet", "Location given by the contributor set on the node")
+	return nil
+}
+
 // runRecoveryProcedure applies predefined methods to recover the node
 func (t *Handler) runRecoveryProcedure(addr string, config *ssh.ClientConfig,
 	nodeName string, ncCopy *apps_v1alpha.NodeContribution, contributedNode *corev1.Node) {
@@ -425,6 +527,7 @@ func (t *Handler) runRecoveryProcedure(addr string, config *ssh.ClientConfig,
 	// Set the status as recovering
 	ncCopy.Status.State = recover
 	ncCopy.Status.Message = append(ncCopy.Status.Message, "Node recovering")
+	t.recorder.Event(ncCopy, corev1.EventTypeNormal, "RecoveryStarted", "Node recovering")
 	ncCopyUpdated, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 	if err == nil {
 		ncCopy = ncCopyUpdated
@@ -444,6 +547,8 @@ func (t *Handler) runRecoveryProcedure(addr string, config *ssh.ClientConfig,
 					if node.GetConditionReadyStatus(updatedNode) == trueStr {
 						ncCopy.Status.State = success
 						ncCopy.Status.Message = append([]string{}, "Node recovery successful")
+						t.recorder.Event(ncCopy, corev1.EventTypeNormal, "Recovered", "Node recovery successful")
+						metrics.NodeProcedures.WithLabelValues("recovery", "success").Inc()
 						ncCopyUpdated, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 						log.Println(err)
 						if err == nil {
@@ -467,6 +572,8 @@ func (t *Handler) runRecoveryProcedure(addr string, config *ssh.ClientConfig,
 			log.Println(err)
 			ncCopy.Status.State = failure
 			ncCopy.Status.Message = append(ncCopy.Status.Message, "Node recovery failed: SSH handshake failed")
+			t.recorder.Event(ncCopy, corev1.EventTypeWarning, "RecoveryFailed", "Node recovery failed: SSH handshake failed")
+			metrics.NodeProcedures.WithLabelValues("recovery", "ssh-failure").Inc()
 			ncCopyUpdated, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 			log.Println(err)
 			if err == nil {
@@ -499,6 +606,8 @@ nodeRecoveryLoop:
 				} else if err != nil && connCounter >= 3 {
 					ncCopy.Status.State = failure
 					ncCopy.Status.Message = append(ncCopy.Status.Message, "Node recovery failed: SSH handshake failed")
+					t.recorder.Event(ncCopy, corev1.EventTypeWarning, "RecoveryFailed", "Node recovery failed: SSH handshake failed")
+					metrics.NodeProcedures.WithLabelValues("recovery", "ssh-failure").Inc()
 					ncCopyUpdated, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 					log.Println(err)
 					if err == nil {
@@ -516,6 +625,8 @@ nodeRecoveryLoop:
 			if err != nil {
 				ncCopy.Status.State = failure
 				ncCopy.Status.Message = append(ncCopy.Status.Message, "Node recovery failed: installation step")
+				t.recorder.Event(ncCopy, corev1.EventTypeWarning, "RecoveryFailed", "Node recovery failed: installation step")
+				metrics.NodeProcedures.WithLabelValues("recovery", "failure").Inc()
 				ncCopyUpdated, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 				log.Println(err)
 				if err == nil {
@@ -527,10 +638,12 @@ nodeRecoveryLoop:
 			}
 		case <-reboot:
 			log.Println("***************Reboot***************")
+			t.recorder.Event(ncCopy, corev1.EventTypeNormal, "Rebooting", "Rebooting the node to recover it")
 			// Reboot the node in a minute
 			err = rebootNode(conn)
 			if err != nil {
 				ncCopy.Status.Message = append(ncCopy.Status.Message, "Node recovery failed: reboot step")
+				t.recorder.Event(ncCopy, corev1.EventTypeWarning, "RecoveryFailed", "Node recovery failed: reboot step")
 				ncCopyUpdated, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 				log.Println(err)
 				if err == nil {
@@ -550,6 +663,8 @@ nodeRecoveryLoop:
 			// Terminate the procedure after 25 minutes
 			ncCopy.Status.State = failure
 			ncCopy.Status.Message = append(ncCopy.Status.Message, "Node recovery failed: timeout")
+			t.recorder.Event(ncCopy, corev1.EventTypeWarning, "RecoveryTimeout", "Node recovery failed: timeout")
+			metrics.NodeProcedures.WithLabelValues("recovery", "timeout").Inc()
 			ncCopyUpdated, err := t.edgenetClientset.AppsV1alpha().NodeContributions(ncCopy.GetNamespace()).UpdateStatus(context.TODO(), ncCopy, metav1.UpdateOptions{})
 			log.Println(err)
 			if err == nil {
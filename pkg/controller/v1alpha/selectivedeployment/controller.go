@@ -30,6 +30,8 @@ import (
 	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
 	"github.com/EdgeNet-project/edgenet/pkg/generated/clientset/versioned"
 	appsinformer_v1alpha "github.com/EdgeNet-project/edgenet/pkg/generated/informers/externalversions/apps/v1alpha"
+	"github.com/EdgeNet-project/edgenet/pkg/keyqueue"
+	"github.com/EdgeNet-project/edgenet/pkg/metrics"
 	"github.com/EdgeNet-project/edgenet/pkg/node"
 
 	log "github.com/sirupsen/logrus"
@@ -37,11 +39,13 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	batchv1beta "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
@@ -50,7 +54,7 @@ import (
 // The main structure of controller
 type controller struct {
 	logger              *log.Entry
-	queue               workqueue.RateLimitingInterface
+	queue               *keyqueue.Queue
 	informer            cache.SharedIndexInformer
 	nodeInformer        cache.SharedIndexInformer
 	deploymentInformer  cache.SharedIndexInformer
@@ -60,6 +64,9 @@ type controller struct {
 	cronJobInformer     cache.SharedIndexInformer
 	handler             HandlerInterface
 	wg                  map[string]*sync.WaitGroup
+	// The effect of the schedules when they were last evaluated, by the key of the selectivedeployments
+	scheduleSignatures map[string]string
+	scheduleLock       sync.Mutex
 }
 
 // The main structure of informerevent
@@ -72,6 +79,9 @@ type informerevent struct {
 const failure = "Failure"
 const partial = "Running Partially"
 const success = "Running"
+const terminating = "Terminating"
+const dryRun = "Dry Run"
+const inactive = "Inactive"
 const noSchedule = "NoSchedule"
 const create = "create"
 const update = "update"
@@ -80,28 +90,70 @@ const trueStr = "True"
 const falseStr = "False"
 const unknownStr = "Unknown"
 
+// The finalizer that holds a selectivedeployment until its workloads are released, and the deletion policies
+const finalizer = "selectivedeployment.apps.edgenet.io"
+const deletionPolicyOrphan = "Orphan"
+
+// The placement mode of the selectors that lets the pods run elsewhere, the required mode is the default
+const modePreferred = "Preferred"
+
+// The annotation that turns a selectivedeployment into a preview of the node selection
+const dryRunAnnotation = "edge-net.io/dry-run"
+
+// The count of retries before giving up on a selectivedeployment
+const maxRetries = 15
+
+// The count of nodes listed in an event at most
+const maxEventNodes = 10
+
+// The kinds whose pod template cannot be changed once they are created
+var immutableTemplateKinds = []string{"Job", "Pod"}
+
+// The labels that tell the copies of the workloads apart in the fan-out mode
+const fanOutLabel = "edge-net.io/selectivedeployment"
+const fanOutLocationLabel = "edge-net.io/selectivedeployment-location"
+
 // Dictionary of status messages
 var statusDict = map[string]string{
-	"sd-success":                   "The selective deployment smoothly created the workload(s)",
-	"deployment-creation-failure":  "Deployment %s could not be created",
-	"deployment-in-use":            "Deployment %s is already under the control of another selective deployment",
-	"daemonset-creation-failure":   "DaemonSet %s could not be created",
-	"daemonset-in-use":             "DaemonSet %s is already under the control of another selective deployment",
-	"statefulset-creation-failure": "StatefulSet %s could not be created",
-	"statefulset-in-use":           "StatefulSet %s is already under the control of another selective deployment",
-	"job-creation-failure":         "Job %s could not be created",
-	"job-in-use":                   "Job %s is already under the control of another selective deployment",
-	"cronjob-creation-failure":     "CronJob %s could not be created",
-	"cronjob-in-use":               "CronJob %s is already under the control of another selective deployment",
-	"nodes-fewer":                  "Fewer nodes issue, %d node(s) found instead of %d for %s%s",
-	"GeoJSON-err":                  "%s%s has a GeoJSON format error",
+	"sd-success":                "The selective deployment smoothly created the workload(s)",
+	"dry-run":                   "Dry run, %d node(s) matched, no workload was created or updated",
+	"workload-creation-failure": "%s %s could not be created",
+	"workload-in-use":           "%s %s is already under the control of another selective deployment",
+	"workload-invalid":          "%s %v is invalid, %s",
+	"teardown-progress":         "Teardown in progress, %d/%d workload(s) released",
+	"teardown-failure":          "%s %s could not be released, %s",
+	"workload-deleted":          "%s %s deleted",
+	"workload-orphaned":         "%s %s orphaned",
+	"group-nodes-fewer":         "Fewer nodes issue, %d node(s) found instead of %d for selector group %d",
+	"nodes-fewer":               "Fewer nodes issue, %d node(s) found instead of %d for %s%s",
+	"polygon-err":               "%s has a GeoJSON format error",
+	"radius-err":                "%s has a radius format error, lat, lon, and radius in km expected",
+	"label-err":                 "Label selector %s is invalid, %s",
+	"nearest-err":               "%s cannot be located, lat and lon or an IP address expected",
+	"schedule-err":              "Schedule is invalid, %s",
+	"schedule-closed":           "The schedule windows are closed, %d/%d workload(s) released, the next window opens at %s",
+	"schedule-over":             "The schedule windows are closed for good, %d/%d workload(s) released",
+	"reconcile-failure":         "The selective deployment could not be applied, %s",
 }
 
 // Start function is entry point of the controller
-func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
-	var err error
+func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface, dynamic dynamic.Interface) {
+	// A channel to terminate elegantly
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go Run(kubernetes, edgenet, dynamic, stopCh)
+	// A channel to observe OS signals for smooth shut down
+	sigTerm := make(chan os.Signal, 1)
+	signal.Notify(sigTerm, syscall.SIGTERM)
+	signal.Notify(sigTerm, syscall.SIGINT)
+	<-sigTerm
+}
+
+// Run sets the controller up and runs it until the stop channel is closed
+func Run(kubernetes kubernetes.Interface, edgenet versioned.Interface, dynamic dynamic.Interface, stopCh <-chan struct{}) {
 	clientset := kubernetes
 	edgenetClientset := edgenet
+	dynamicClientset := dynamic
 
 	wg := make(map[string]*sync.WaitGroup)
 	sdHandler := &SDHandler{}
@@ -110,17 +162,16 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 		edgenetClientset,
 		metav1.NamespaceAll,
 		0,
-		cache.Indexers{},
+		sdIndexers,
 	)
-	// Create a work queue which contains a key of the resource to be handled by the handler
-	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
-	var event informerevent
+	// Create a work queue per worker, the events of a resource always go to the same worker to be handled in order
+	queue := keyqueue.New("selectivedeployment", func(item interface{}) string { return item.(informerevent).key })
 	// Event handlers deal with events of resources. In here, we take into consideration of adding and updating selectivedeployments
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			// Put the resource object into a key
-			event.key, err = cache.MetaNamespaceKeyFunc(obj)
-			event.function = create
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			event := informerevent{key: key, function: create}
 			log.Infof("Add selectivedeployment: %s", event.key)
 			if err == nil {
 				// Add the key to the queue
@@ -129,8 +180,8 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			if reflect.DeepEqual(oldObj.(*apps_v1alpha.SelectiveDeployment).Status, newObj.(*apps_v1alpha.SelectiveDeployment).Status) {
-				event.key, err = cache.MetaNamespaceKeyFunc(newObj)
-				event.function = update
+				key, err := cache.MetaNamespaceKeyFunc(newObj)
+				event := informerevent{key: key, function: update}
 				log.Infof("Update selectivedeployment: %s", event.key)
 				if err == nil {
 					queue.Add(event)
@@ -140,8 +191,8 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 		DeleteFunc: func(obj interface{}) {
 			// DeletionHandlingMetaNamsespaceKeyFunc helps to check the existence of the object while it is still contained in the index.
 			// Put the resource object into a key
-			event.key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
-			event.function = delete
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			event := informerevent{key: key, function: delete}
 			log.Infof("Delete selectivedeployment: %s", event.key)
 			if err == nil {
 				queue.Add(event)
@@ -149,6 +200,36 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 		},
 	})
 
+	// getSD reads the selectivedeployment from the cache of the informer rather than the API server
+	getSD := func(namespace string, name string) (*apps_v1alpha.SelectiveDeployment, error) {
+		key := name
+		if namespace != "" {
+			key = namespace + "/" + name
+		}
+		sdRaw, exists, err := informer.GetIndexer().GetByKey(key)
+		if err != nil {
+			return nil, err
+		} else if !exists {
+			return nil, fmt.Errorf("selectivedeployment %s not found", key)
+		}
+		return sdRaw.(*apps_v1alpha.SelectiveDeployment), nil
+	}
+	// listRecoverable returns the selectivedeployments with recovery enabled that are partially running or failed
+	listRecoverable := func() []*apps_v1alpha.SelectiveDeployment {
+		sdList := []*apps_v1alpha.SelectiveDeployment{}
+		sdRaw, err := informer.GetIndexer().ByIndex(recoveryIndex, trueStr)
+		if err != nil {
+			log.Println(err.Error())
+			return sdList
+		}
+		for _, sdRow := range sdRaw {
+			sdList = append(sdList, sdRow.(*apps_v1alpha.SelectiveDeployment))
+		}
+		return sdList
+	}
+	// The indexers of the workload informers, which are created below, to find the workloads pinning a node
+	var workloadIndexerList []cache.Indexer
+
 	// The selectivedeployment resources are reconfigured according to node events in this section
 	nodeInformer := cache.NewSharedIndexInformer(
 		&cache.ListWatch{
@@ -173,31 +254,16 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 					if conditionRow.Status == trueStr {
 						key, err := cache.MetaNamespaceKeyFunc(obj)
 						if err != nil {
-							log.Println(err.Error())
-							panic(err.Error())
+							utilruntime.HandleError(err)
+							return
 						}
-						sdRaw, _ := edgenetClientset.AppsV1alpha().SelectiveDeployments("").List(context.TODO(), metav1.ListOptions{})
-						for _, sdRow := range sdRaw.Items {
-							if sdRow.Spec.Recovery {
-								if sdRow.Status.State == partial || sdRow.Status.State == failure {
-								selectorLoop:
-									for _, selectorDet := range sdRow.Spec.Selector {
-										fewerNodes := false
-										for _, message := range sdRow.Status.Message {
-											if strings.Contains(message, "Fewer nodes issue") {
-												fewerNodes = true
-											}
-										}
-										if selectorDet.Quantity == 0 || (selectorDet.Quantity != 0 && fewerNodes) {
-											event.key, err = cache.MetaNamespaceKeyFunc(sdRow.DeepCopyObject())
-											event.function = update
-											log.Infof("SD node added: %s, recovery started for: %s", key, event.key)
-											if err == nil {
-												queue.Add(event)
-											}
-											break selectorLoop
-										}
-									}
+						for _, sdRow := range listRecoverable() {
+							if awaitsNodes(sdRow) {
+								sdKey, err := cache.MetaNamespaceKeyFunc(sdRow)
+								event := informerevent{key: sdKey, function: update}
+								log.Infof("SD node added: %s, recovery started for: %s", key, event.key)
+								if err == nil {
+									queue.Add(event)
 								}
 							}
 						}
@@ -215,31 +281,16 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 				(oldObj.Spec.Unschedulable == true && newObj.Spec.Unschedulable == false) {
 				key, err := cache.MetaNamespaceKeyFunc(newObj)
 				if err != nil {
-					log.Println(err.Error())
-					panic(err.Error())
+					utilruntime.HandleError(err)
+					return
 				}
-				sdRaw, _ := edgenetClientset.AppsV1alpha().SelectiveDeployments("").List(context.TODO(), metav1.ListOptions{})
-				for _, sdRow := range sdRaw.Items {
-					if sdRow.Spec.Recovery {
-						if sdRow.Status.State == partial || sdRow.Status.State == failure {
-						selectorLoop:
-							for _, selectorDet := range sdRow.Spec.Selector {
-								fewerNodes := false
-								for _, message := range sdRow.Status.Message {
-									if strings.Contains(message, "Fewer nodes issue") {
-										fewerNodes = true
-									}
-								}
-								if selectorDet.Quantity == 0 || (selectorDet.Quantity != 0 && fewerNodes) {
-									event.key, err = cache.MetaNamespaceKeyFunc(sdRow.DeepCopyObject())
-									event.function = update
-									log.Infof("SD node updated: %s, recovery started for: %s", key, event.key)
-									if err == nil {
-										queue.Add(event)
-									}
-									break selectorLoop
-								}
-							}
+				for _, sdRow := range listRecoverable() {
+					if awaitsNodes(sdRow) {
+						sdKey, err := cache.MetaNamespaceKeyFunc(sdRow)
+						event := informerevent{key: sdKey, function: update}
+						log.Infof("SD node updated: %s, recovery started for: %s", key, event.key)
+						if err == nil {
+							queue.Add(event)
 						}
 					}
 				}
@@ -249,19 +300,20 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 				(newObj.Spec.Unschedulable == false && newReady == trueStr && updated) {
 				key, err := cache.MetaNamespaceKeyFunc(newObj.DeepCopyObject())
 				if err != nil {
-					log.Println(err.Error())
-					panic(err.Error())
+					utilruntime.HandleError(err)
+					return
 				}
-				ownerList, status := sdHandler.getByNode(newObj.GetName())
+				ownerList, _ := getByNode(workloadIndexerList, newObj.GetName())
+				ownerList, status := getGenericByNode(informer.GetIndexer(), newObj.GetName(), ownerList)
 				if status {
 					for _, ownerDet := range ownerList {
-						sdObj, err := edgenetClientset.AppsV1alpha().SelectiveDeployments(ownerDet[0]).Get(context.TODO(), ownerDet[1], metav1.GetOptions{})
+						sdObj, err := getSD(ownerDet[0], ownerDet[1])
 						if err != nil {
 							continue
 						}
 						if sdObj.Spec.Recovery {
-							event.key, err = cache.MetaNamespaceKeyFunc(sdObj.DeepCopyObject())
-							event.function = update
+							sdKey, err := cache.MetaNamespaceKeyFunc(sdObj.DeepCopyObject())
+							event := informerevent{key: sdKey, function: update}
 							log.Infof("SD node updated: %s, recovery started for: %s", key, event.key)
 							if err == nil {
 								queue.Add(event)
@@ -272,23 +324,32 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
-			nodeObj := obj.(*corev1.Node)
+			// The informer hands over a tombstone if it missed the deletion
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			nodeObj, ok := obj.(*corev1.Node)
+			if !ok {
+				utilruntime.HandleError(fmt.Errorf("unexpected object in the node deletion: %T", obj))
+				return
+			}
 			key, err := cache.MetaNamespaceKeyFunc(obj)
 			if err != nil {
-				log.Println(err.Error())
-				panic(err.Error())
+				utilruntime.HandleError(err)
+				return
 			}
-			ownerList, status := sdHandler.getByNode(nodeObj.GetName())
+			ownerList, _ := getByNode(workloadIndexerList, nodeObj.GetName())
+			ownerList, status := getGenericByNode(informer.GetIndexer(), nodeObj.GetName(), ownerList)
 			if status {
 				for _, ownerDet := range ownerList {
-					sdObj, err := edgenetClientset.AppsV1alpha().SelectiveDeployments(ownerDet[0]).Get(context.TODO(), ownerDet[1], metav1.GetOptions{})
+					sdObj, err := getSD(ownerDet[0], ownerDet[1])
 					if err != nil {
 						log.Println(err.Error())
 						continue
 					}
 					if sdObj.Spec.Recovery {
-						event.key, err = cache.MetaNamespaceKeyFunc(sdObj.DeepCopyObject())
-						event.function = update
+						sdKey, err := cache.MetaNamespaceKeyFunc(sdObj.DeepCopyObject())
+						event := informerevent{key: sdKey, function: update}
 						log.Infof("SD node deleted: %s, recovery started for: %s", key, event.key)
 						if err == nil {
 							queue.Add(event)
@@ -301,8 +362,8 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 
 	// The selectivedeployment resources are reconfigured according to workload events in this section
 	addToQueue := func(ownerSD *apps_v1alpha.SelectiveDeployment, key string, ctlType string) {
-		event.key, err = cache.MetaNamespaceKeyFunc(ownerSD.DeepCopyObject())
-		event.function = update
+		sdKey, err := cache.MetaNamespaceKeyFunc(ownerSD.DeepCopyObject())
+		event := informerevent{key: sdKey, function: update}
 		log.Infof("SD %s added: %s, recovery started for: %s", ctlType, key, event.key)
 		if err == nil {
 			queue.Add(event)
@@ -322,7 +383,7 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 				}
 			}
 			if !underControl {
-				ownerSD, err := edgenetClientset.AppsV1alpha().SelectiveDeployments(workloadObj.GetNamespace()).Get(context.TODO(), sdName, metav1.GetOptions{})
+				ownerSD, err := getSD(workloadObj.GetNamespace(), sdName)
 				if err == nil {
 					key, _ := cache.MetaNamespaceKeyFunc(workloadObj)
 					addToQueue(ownerSD, key, "Deployment")
@@ -339,7 +400,7 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 				}
 			}
 			if !underControl {
-				ownerSD, err := edgenetClientset.AppsV1alpha().SelectiveDeployments(workloadObj.GetNamespace()).Get(context.TODO(), sdName, metav1.GetOptions{})
+				ownerSD, err := getSD(workloadObj.GetNamespace(), sdName)
 				if err == nil {
 					key, _ := cache.MetaNamespaceKeyFunc(workloadObj)
 					addToQueue(ownerSD, key, "DaemonSet")
@@ -356,7 +417,7 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 				}
 			}
 			if !underControl {
-				ownerSD, err := edgenetClientset.AppsV1alpha().SelectiveDeployments(workloadObj.GetNamespace()).Get(context.TODO(), sdName, metav1.GetOptions{})
+				ownerSD, err := getSD(workloadObj.GetNamespace(), sdName)
 				if err == nil {
 					key, _ := cache.MetaNamespaceKeyFunc(workloadObj)
 					addToQueue(ownerSD, key, "StatefulSet")
@@ -373,7 +434,7 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 				}
 			}
 			if !underControl {
-				ownerSD, err := edgenetClientset.AppsV1alpha().SelectiveDeployments(workloadObj.GetNamespace()).Get(context.TODO(), sdName, metav1.GetOptions{})
+				ownerSD, err := getSD(workloadObj.GetNamespace(), sdName)
 				if err == nil {
 					key, _ := cache.MetaNamespaceKeyFunc(workloadObj)
 					addToQueue(ownerSD, key, "Job")
@@ -390,7 +451,7 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 				}
 			}
 			if !underControl {
-				ownerSD, err := edgenetClientset.AppsV1alpha().SelectiveDeployments(workloadObj.GetNamespace()).Get(context.TODO(), sdName, metav1.GetOptions{})
+				ownerSD, err := getSD(workloadObj.GetNamespace(), sdName)
 				if err == nil {
 					key, _ := cache.MetaNamespaceKeyFunc(workloadObj)
 					addToQueue(ownerSD, key, "CronJob")
@@ -404,7 +465,7 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 			ownerReferences := workloadObj.GetOwnerReferences()
 			for _, reference := range ownerReferences {
 				if reference.Kind == "SelectiveDeployment" {
-					ownerSD, err := edgenetClientset.AppsV1alpha().SelectiveDeployments(workloadObj.GetNamespace()).Get(context.TODO(), reference.Name, metav1.GetOptions{})
+					ownerSD, err := getSD(workloadObj.GetNamespace(), reference.Name)
 					if err == nil {
 						key, _ := cache.MetaNamespaceKeyFunc(workloadObj)
 						addToQueue(ownerSD, key, "Deployment")
@@ -415,7 +476,7 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 			ownerReferences := workloadObj.GetOwnerReferences()
 			for _, reference := range ownerReferences {
 				if reference.Kind == "SelectiveDeployment" {
-					ownerSD, err := edgenetClientset.AppsV1alpha().SelectiveDeployments(workloadObj.GetNamespace()).Get(context.TODO(), reference.Name, metav1.GetOptions{})
+					ownerSD, err := getSD(workloadObj.GetNamespace(), reference.Name)
 					if err == nil {
 						key, _ := cache.MetaNamespaceKeyFunc(workloadObj)
 						addToQueue(ownerSD, key, "DaemonSet")
@@ -426,7 +487,7 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 			ownerReferences := workloadObj.GetOwnerReferences()
 			for _, reference := range ownerReferences {
 				if reference.Kind == "SelectiveDeployment" {
-					ownerSD, err := edgenetClientset.AppsV1alpha().SelectiveDeployments(workloadObj.GetNamespace()).Get(context.TODO(), reference.Name, metav1.GetOptions{})
+					ownerSD, err := getSD(workloadObj.GetNamespace(), reference.Name)
 					if err == nil {
 						key, _ := cache.MetaNamespaceKeyFunc(workloadObj)
 						addToQueue(ownerSD, key, "StatefulSet")
@@ -437,7 +498,7 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 			ownerReferences := workloadObj.GetOwnerReferences()
 			for _, reference := range ownerReferences {
 				if reference.Kind == "SelectiveDeployment" {
-					ownerSD, err := edgenetClientset.AppsV1alpha().SelectiveDeployments(workloadObj.GetNamespace()).Get(context.TODO(), reference.Name, metav1.GetOptions{})
+					ownerSD, err := getSD(workloadObj.GetNamespace(), reference.Name)
 					if err == nil {
 						key, _ := cache.MetaNamespaceKeyFunc(workloadObj)
 						addToQueue(ownerSD, key, "Job")
@@ -448,7 +509,7 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 			ownerReferences := workloadObj.GetOwnerReferences()
 			for _, reference := range ownerReferences {
 				if reference.Kind == "SelectiveDeployment" {
-					ownerSD, err := edgenetClientset.AppsV1alpha().SelectiveDeployments(workloadObj.GetNamespace()).Get(context.TODO(), reference.Name, metav1.GetOptions{})
+					ownerSD, err := getSD(workloadObj.GetNamespace(), reference.Name)
 					if err == nil {
 						key, _ := cache.MetaNamespaceKeyFunc(workloadObj)
 						addToQueue(ownerSD, key, "CronJob")
@@ -457,6 +518,25 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 			}
 		}
 	}
+	// The status of the owner SD keeps track of the pods ready, so that a change in the workload status triggers an update
+	workloadUpdateFunc := func(oldObj, newObj interface{}) {
+		if reflect.DeepEqual(workloadStatus(oldObj), workloadStatus(newObj)) {
+			return
+		}
+		workloadObj, err := meta.Accessor(newObj)
+		if err != nil {
+			return
+		}
+		for _, reference := range workloadObj.GetOwnerReferences() {
+			if reference.Kind == "SelectiveDeployment" {
+				ownerSD, err := getSD(workloadObj.GetNamespace(), reference.Name)
+				if err == nil {
+					key, _ := cache.MetaNamespaceKeyFunc(newObj)
+					addToQueue(ownerSD, key, workloadStatus(newObj).Kind)
+				}
+			}
+		}
+	}
 	deploymentInformer := cache.NewSharedIndexInformer(
 		&cache.ListWatch{
 			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
@@ -468,10 +548,11 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 		},
 		&appsv1.Deployment{},
 		0,
-		cache.Indexers{},
+		workloadIndexers,
 	)
 	deploymentInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    workloadAddFunc,
+		UpdateFunc: workloadUpdateFunc,
 		DeleteFunc: workloadDeleteFunc,
 	})
 	daemonSetInformer := cache.NewSharedIndexInformer(
@@ -485,10 +566,11 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 		},
 		&appsv1.DaemonSet{},
 		0,
-		cache.Indexers{},
+		workloadIndexers,
 	)
 	daemonSetInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    workloadAddFunc,
+		UpdateFunc: workloadUpdateFunc,
 		DeleteFunc: workloadDeleteFunc,
 	})
 	statefulSetInformer := cache.NewSharedIndexInformer(
@@ -502,10 +584,11 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 		},
 		&appsv1.StatefulSet{},
 		0,
-		cache.Indexers{},
+		workloadIndexers,
 	)
 	statefulSetInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    workloadAddFunc,
+		UpdateFunc: workloadUpdateFunc,
 		DeleteFunc: workloadDeleteFunc,
 	})
 	jobInformer := cache.NewSharedIndexInformer(
@@ -519,10 +602,11 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 		},
 		&batchv1.Job{},
 		0,
-		cache.Indexers{},
+		workloadIndexers,
 	)
 	jobInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    workloadAddFunc,
+		UpdateFunc: workloadUpdateFunc,
 		DeleteFunc: workloadDeleteFunc,
 	})
 	cronJobInformer := cache.NewSharedIndexInformer(
@@ -536,12 +620,15 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 		},
 		&batchv1beta.CronJob{},
 		0,
-		cache.Indexers{},
+		workloadIndexers,
 	)
 	cronJobInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    workloadAddFunc,
+		UpdateFunc: workloadUpdateFunc,
 		DeleteFunc: workloadDeleteFunc,
 	})
+	workloadIndexerList = []cache.Indexer{deploymentInformer.GetIndexer(), daemonSetInformer.GetIndexer(), statefulSetInformer.GetIndexer(),
+		jobInformer.GetIndexer(), cronJobInformer.GetIndexer()}
 	controller := controller{
 		logger:              log.NewEntry(log.New()),
 		informer:            informer,
@@ -556,50 +643,76 @@ func Start(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
 		wg:                  wg,
 	}
 
-	// A channel to terminate elegantly
-	stopCh := make(chan struct{})
-	defer close(stopCh)
 	// Run the controller loop as a background task to start processing resources
-	go controller.run(stopCh, clientset, edgenetClientset)
-	// A channel to observe OS signals for smooth shut down
-	sigTerm := make(chan os.Signal, 1)
-	signal.Notify(sigTerm, syscall.SIGTERM)
-	signal.Notify(sigTerm, syscall.SIGINT)
-	<-sigTerm
+	go controller.run(stopCh, clientset, edgenetClientset, dynamicClientset)
+	<-stopCh
+}
+
+// awaitsNodes tells whether a node coming up may be picked by the selectivedeployment, that is when a selector takes
+// all the nodes matched or a share of them, or when a selector found fewer nodes than desired
+func awaitsNodes(sdObj *apps_v1alpha.SelectiveDeployment) bool {
+	for _, message := range sdObj.Status.Message {
+		if strings.Contains(message, "Fewer nodes issue") {
+			return true
+		}
+	}
+	for _, selectorRow := range sdObj.Spec.Selector {
+		if selectorRow.Quantity == 0 {
+			return true
+		}
+	}
+	for _, groupRow := range sdObj.Spec.SelectorGroups {
+		if groupRow.Quantity == 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // Run starts the controller loop
-func (c *controller) run(stopCh <-chan struct{}, clientset kubernetes.Interface, edgenetClientset versioned.Interface) {
+func (c *controller) run(stopCh <-chan struct{}, clientset kubernetes.Interface, edgenetClientset versioned.Interface, dynamicClientset dynamic.Interface) {
 	// A Go panic which includes logging and terminating
 	defer utilruntime.HandleCrash()
 	// Shutdown after all goroutines have done
 	defer c.queue.ShutDown()
 	c.logger.Info("run: initiating")
-	c.handler.Init(clientset, edgenetClientset)
+	c.handler.Init(clientset, edgenetClientset, dynamicClientset)
+	c.handler.SetIndexers(c.nodeInformer.GetIndexer(), map[string]cache.Indexer{
+		"Deployment":  c.deploymentInformer.GetIndexer(),
+		"DaemonSet":   c.daemonSetInformer.GetIndexer(),
+		"StatefulSet": c.statefulSetInformer.GetIndexer(),
+		"Job":         c.jobInformer.GetIndexer(),
+		"CronJob":     c.cronJobInformer.GetIndexer(),
+	})
 	// Run the informer to list and watch resources
 	go c.informer.Run(stopCh)
 	go c.nodeInformer.Run(stopCh)
 	go c.deploymentInformer.Run(stopCh)
 	go c.daemonSetInformer.Run(stopCh)
 	go c.statefulSetInformer.Run(stopCh)
+	go c.jobInformer.Run(stopCh)
+	go c.cronJobInformer.Run(stopCh)
 
 	// Synchronization to settle resources one
-	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced, c.nodeInformer.HasSynced, c.deploymentInformer.HasSynced, c.daemonSetInformer.HasSynced, c.statefulSetInformer.HasSynced) {
+	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced, c.nodeInformer.HasSynced, c.deploymentInformer.HasSynced, c.daemonSetInformer.HasSynced,
+		c.statefulSetInformer.HasSynced, c.jobInformer.HasSynced, c.cronJobInformer.HasSynced) {
 		utilruntime.HandleError(fmt.Errorf("Error syncing cache"))
 		return
 	}
 	c.logger.Info("run: cache sync complete")
-	// Operate the runWorker
-	go wait.Until(c.runWorker, time.Second, stopCh)
+	// Operate the runWorker of each worker
+	c.queue.StartWorkers(c.runWorker, stopCh)
+	// The schedules are checked every minute, which is the resolution of their cron expressions
+	go wait.Until(c.checkSchedules, time.Minute, stopCh)
 
 	<-stopCh
 }
 
 // To process new objects added to the queue
-func (c *controller) runWorker() {
+func (c *controller) runWorker(queue workqueue.RateLimitingInterface) {
 	log.Info("runWorker: starting")
 	// Run processNextItem for all the changes
-	for c.processNextItem() {
+	for c.processNextItem(queue) {
 		log.Info("runWorker: processing next item")
 	}
 
@@ -607,44 +720,78 @@ func (c *controller) runWorker() {
 }
 
 // This function deals with the queue and sends each item in it to the specified handler to be processed.
-func (c *controller) processNextItem() bool {
+func (c *controller) processNextItem(queue workqueue.RateLimitingInterface) bool {
 	log.Info("processNextItem: start")
 	// Fetch the next item of the queue
-	event, quit := c.queue.Get()
+	event, quit := queue.Get()
 	if quit {
 		return false
 	}
-	defer c.queue.Done(event)
+	defer queue.Done(event)
+	c.processEvent(queue, event)
+	return true
+}
+
+// processEvent sends the event to the handler
+func (c *controller) processEvent(queue workqueue.RateLimitingInterface, event interface{}) {
 	// Get the key string
 	keyRaw := event.(informerevent).key
 	// Use the string key to get the object from the indexer
+	start := time.Now()
 	item, exists, err := c.informer.GetIndexer().GetByKey(keyRaw)
 	if err != nil {
-		if c.queue.NumRequeues(event.(informerevent).key) < 5 {
-			c.logger.Errorf("Controller.processNextItem: Failed processing item with key %s with error %v, retrying", event.(informerevent).key, err)
-			c.queue.AddRateLimited(event.(informerevent).key)
-		} else {
-			c.logger.Errorf("Controller.processNextItem: Failed processing item with key %s with error %v, no more retries", event.(informerevent).key, err)
-			c.queue.Forget(event.(informerevent).key)
-			utilruntime.HandleError(err)
-		}
+		metrics.ObserveReconcile("selectivedeployment", "GetByKey", start, err)
+		c.handleErr(queue, err, event, nil)
+		return
 	}
 
 	if !exists {
 		if event.(informerevent).function == delete {
 			c.logger.Infof("Controller.processNextItem: object deleted detected: %s", keyRaw)
-			c.handler.ObjectDeleted(item)
+			err = c.handler.ObjectDeleted(item)
+			metrics.ObserveReconcile("selectivedeployment", "ObjectDeleted", start, err)
 		}
 	} else {
+		// The handler evaluates the schedule along with the object, so the checks of the schedule start from here
+		c.seedSchedule(keyRaw, item)
 		if event.(informerevent).function == create {
 			c.logger.Infof("Controller.processNextItem: object created detected: %s", keyRaw)
-			c.handler.ObjectCreated(item)
+			err = c.handler.ObjectCreated(item)
+			metrics.ObserveReconcile("selectivedeployment", "ObjectCreated", start, err)
 		} else if event.(informerevent).function == update {
 			c.logger.Infof("Controller.processNextItem: object updated detected: %s", keyRaw)
-			c.handler.ObjectUpdated(item)
+			err = c.handler.ObjectUpdated(item)
+			metrics.ObserveReconcile("selectivedeployment", "ObjectUpdated", start, err)
 		}
 	}
-	c.queue.Forget(event.(informerevent).key)
+	if !exists {
+		item = nil
+	}
+	c.handleErr(queue, err, event, item)
+}
 
-	return true
+// handleErr requeues the event with the rate limiter until it fails maxRetries times in a row, and then gives up on it
+// by setting the status of the selectivedeployment. A selectivedeployment being deleted is never given up on, as its
+// finalizer would hold it until the next event otherwise.
+func (c *controller) handleErr(queue workqueue.RateLimitingInterface, err error, event interface{}, item interface{}) {
+	if err == nil {
+		queue.Forget(event)
+		return
+	}
+	terminating := item != nil && item.(*apps_v1alpha.SelectiveDeployment).GetDeletionTimestamp() != nil
+	if retries := queue.NumRequeues(event); terminating {
+		c.logger.Errorf("Controller.processNextItem: Failed processing item with key %s with error %v, retry %d until the workloads are released", event.(informerevent).key, err, retries+1)
+		queue.AddRateLimited(event)
+		return
+	} else if retries < maxRetries {
+		c.logger.Errorf("Controller.processNextItem: Failed processing item with key %s with error %v, retry %d/%d", event.(informerevent).key, err, retries+1, maxRetries)
+		queue.AddRateLimited(event)
+		return
+	}
+	c.logger.Errorf("Controller.processNextItem: Failed processing item with key %s with error %v, no more retries", event.(informerevent).key, err)
+	queue.Forget(event)
+	utilruntime.HandleError(err)
+	if item != nil {
+		c.handler.ObjectFailed(item, fmt.Errorf("%d attempts failed, the last with %s", maxRetries+1, err))
+	}
 }
@@ -2,20 +2,27 @@ package selectivedeployment
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
+	"github.com/EdgeNet-project/edgenet/pkg/keyqueue"
 	"github.com/EdgeNet-project/edgenet/pkg/util"
 
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 )
 
 func TestStartController(t *testing.T) {
 	g := TestGroup{}
 	g.Init()
 	// Run the controller in a goroutine
-	go Start(g.client, g.edgenetClient)
+	go Start(g.client, g.edgenetClient, g.dynamicClient)
 	// Creating nodes
 	nodeParis := g.nodeObj
 	nodeParis.SetName("edgenet.planet-lab.eu")
@@ -173,3 +180,164 @@ func TestStartController(t *testing.T) {
 	util.Equals(t, failure, sdCopy.Status.State)
 	util.Equals(t, "0/5", sdCopy.Status.Ready)
 }
+
+// failingHandler records the objects that the controller gave up on
+type failingHandler struct {
+	SDHandler
+	failed []error
+}
+
+func (t *failingHandler) ObjectFailed(obj interface{}, err error) {
+	t.failed = append(t.failed, err)
+}
+
+func TestHandleErr(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	handler := &failingHandler{}
+	c := controller{
+		logger:  log.NewEntry(log.New()),
+		handler: handler,
+	}
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+	event := informerevent{key: g.sdObj.GetName(), function: update}
+	for i := 0; i < maxRetries; i++ {
+		c.handleErr(queue, fmt.Errorf("API server unavailable"), event, g.sdObj.DeepCopy())
+		util.Equals(t, i+1, queue.NumRequeues(event))
+		util.Equals(t, 0, len(handler.failed))
+	}
+	c.handleErr(queue, fmt.Errorf("API server unavailable"), event, g.sdObj.DeepCopy())
+	util.Equals(t, 0, queue.NumRequeues(event))
+	util.Equals(t, 1, len(handler.failed))
+
+	// The selectivedeployment being deleted keeps being retried
+	sdObj := g.sdObj.DeepCopy()
+	deletionTimestamp := metav1.Now()
+	sdObj.SetDeletionTimestamp(&deletionTimestamp)
+	for i := 0; i <= maxRetries; i++ {
+		c.handleErr(queue, fmt.Errorf("API server unavailable"), event, sdObj)
+	}
+	util.Equals(t, maxRetries+1, queue.NumRequeues(event))
+	util.Equals(t, 1, len(handler.failed))
+	c.handleErr(queue, nil, event, sdObj)
+	util.Equals(t, 0, queue.NumRequeues(event))
+	util.Equals(t, 1, len(handler.failed))
+}
+
+// orderHandler records the events that reach it and fails the first creation
+type orderHandler struct {
+	SDHandler
+	lock   sync.Mutex
+	events []string
+}
+
+func (t *orderHandler) ObjectCreated(obj interface{}) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if len(t.events) == 0 {
+		t.events = append(t.events, "created:failed")
+		return fmt.Errorf("API server unavailable")
+	}
+	t.events = append(t.events, "created")
+	return nil
+}
+
+func (t *orderHandler) ObjectUpdated(obj interface{}) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.events = append(t.events, "updated")
+	return nil
+}
+
+func (t *orderHandler) recorded() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]string{}, t.events...)
+}
+
+func TestRetryOrder(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	handler := &orderHandler{}
+	c := controller{
+		logger:   log.NewEntry(log.New()),
+		handler:  handler,
+		informer: cache.NewSharedIndexInformer(&cache.ListWatch{}, &apps_v1alpha.SelectiveDeployment{}, 0, cache.Indexers{}),
+	}
+	sdObj := g.sdObj.DeepCopy()
+	c.informer.GetIndexer().Add(sdObj)
+	key, _ := cache.MetaNamespaceKeyFunc(sdObj)
+	c.queue = keyqueue.NewWithWorkers("test-retry-order", 1, func(item interface{}) string { return item.(informerevent).key })
+	defer c.queue.ShutDown()
+	// The update comes in while the creation waits to be retried
+	c.queue.Add(informerevent{key: key, function: create})
+	c.queue.Add(informerevent{key: key, function: update})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c.queue.StartWorkers(c.runWorker, stopCh)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(handler.recorded()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	util.Equals(t, []string{"created:failed", "created", "updated"}, handler.recorded())
+}
+
+func TestConcurrentEvents(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go Run(g.client, g.edgenetClient, g.dynamicClient, stopCh)
+	nodeParis := g.nodeObj
+	nodeParis.SetName("edgenet.planet-lab.eu")
+	nodeParis.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname":  "edgenet.planet-lab.eu",
+		"edge-net.io/country-iso": "FR",
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeParis.DeepCopy(), metav1.CreateOptions{})
+
+	// Create and update the selectivedeployments at the same time to have the workers handle them concurrently
+	count := 10
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			deploymentObj := g.deploymentObj.DeepCopy()
+			deploymentObj.SetName(name)
+			sdObj := g.sdObj.DeepCopy()
+			sdObj.SetName(name)
+			sdObj.Spec.Workloads = apps_v1alpha.Workloads{Deployment: []appsv1.Deployment{*deploymentObj}}
+			sdObj.Spec.Selector = []apps_v1alpha.Selector{{Name: "Country", Value: []string{"US"}, Operator: "In", Quantity: 1}}
+			sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Create(context.TODO(), sdObj, metav1.CreateOptions{})
+			if err != nil {
+				return
+			}
+			sdCopy.Spec.Selector[0].Value = []string{"FR"}
+			g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Update(context.TODO(), sdCopy, metav1.UpdateOptions{})
+		}(fmt.Sprintf("concurrent-%d", i))
+	}
+	wg.Wait()
+
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("concurrent-%d", i)
+		var sdCopy *apps_v1alpha.SelectiveDeployment
+		var err error
+		// The last event of each selectivedeployment wins as the events of a key are handled in order
+		for attempt := 0; attempt < 50; attempt++ {
+			sdCopy, err = g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), name, metav1.GetOptions{})
+			if err == nil && sdCopy.Status.State == success {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		util.OK(t, err)
+		util.Equals(t, success, sdCopy.Status.State)
+		util.Equals(t, "1/1", sdCopy.Status.Ready)
+		deploymentCopy, err := g.client.AppsV1().Deployments("").Get(context.TODO(), name, metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, []string{nodeParis.GetName()}, deploymentCopy.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions[0].Values)
+	}
+}
@@ -18,15 +18,20 @@ package selectivedeployment
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"math"
 	"reflect"
-	"strconv"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
 	"github.com/EdgeNet-project/edgenet/pkg/generated/clientset/versioned"
+	"github.com/EdgeNet-project/edgenet/pkg/metrics"
 	"github.com/EdgeNet-project/edgenet/pkg/node"
+	"github.com/EdgeNet-project/edgenet/pkg/recorder"
 	"github.com/EdgeNet-project/edgenet/pkg/util"
 
 	log "github.com/sirupsen/logrus"
@@ -35,571 +40,1193 @@ import (
 	batchv1beta "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 )
 
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
-	Init(kubernetes kubernetes.Interface, edgenet versioned.Interface)
-	ObjectCreated(obj interface{})
-	ObjectUpdated(obj interface{})
-	ObjectDeleted(obj interface{})
+	Init(kubernetes kubernetes.Interface, edgenet versioned.Interface, dynamic dynamic.Interface)
+	SetIndexers(nodeIndexer cache.Indexer, workloadIndexers map[string]cache.Indexer)
+	ObjectCreated(obj interface{}) error
+	ObjectUpdated(obj interface{}) error
+	ObjectDeleted(obj interface{}) error
+	ObjectFailed(obj interface{}, err error)
 }
 
 // SDHandler is a implementation of Handler
 type SDHandler struct {
 	clientset        kubernetes.Interface
 	edgenetClientset versioned.Interface
+	// The generic workloads go through the dynamic client
+	dynamicClientset dynamic.Interface
+	recorder         record.EventRecorder
+	// The cache of the node informer, where the nodes are selected from, and the caches of the workload informers by kind
+	nodeIndexer      cache.Indexer
+	workloadIndexers map[string]cache.Indexer
 }
 
 // Init handles any handler initialization
-func (t *SDHandler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interface) {
+func (t *SDHandler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interface, dynamic dynamic.Interface) {
 	log.Info("SDHandler.Init")
 	t.clientset = kubernetes
 	t.edgenetClientset = edgenet
+	t.dynamicClientset = dynamic
+	t.recorder = recorder.New(kubernetes, "selectivedeployment-controller")
+	t.nodeIndexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	t.workloadIndexers = map[string]cache.Indexer{}
+}
+
+// SetIndexers hands the caches of the controller's informers over to the handler
+func (t *SDHandler) SetIndexers(nodeIndexer cache.Indexer, workloadIndexers map[string]cache.Indexer) {
+	t.nodeIndexer = nodeIndexer
+	t.workloadIndexers = workloadIndexers
 }
 
 // ObjectCreated is called when an object is created
-func (t *SDHandler) ObjectCreated(obj interface{}) {
+func (t *SDHandler) ObjectCreated(obj interface{}) error {
 	log.Info("SDHandler.ObjectCreated")
 	// Create a copy of the selectivedeployment object to make changes on it
 	sdCopy := obj.(*apps_v1alpha.SelectiveDeployment).DeepCopy()
-	t.applyCriteria(sdCopy, "create")
+	// An object that is already being deleted comes as a creation after a restart of the controller
+	if sdCopy.GetDeletionTimestamp() != nil {
+		return t.tearDown(sdCopy)
+	}
+	return t.applyCriteria(sdCopy, "create")
 }
 
 // ObjectUpdated is called when an object is updated
-func (t *SDHandler) ObjectUpdated(obj interface{}) {
+func (t *SDHandler) ObjectUpdated(obj interface{}) error {
 	log.Info("SDHandler.ObjectUpdated")
 	// Create a copy of the selectivedeployment object to make changes on it
 	sdCopy := obj.(*apps_v1alpha.SelectiveDeployment).DeepCopy()
-	t.applyCriteria(sdCopy, "update")
+	// The finalizer keeps the object until the workloads are released, the deletion timestamp indicates that it is being deleted
+	if sdCopy.GetDeletionTimestamp() != nil {
+		return t.tearDown(sdCopy)
+	}
+	return t.applyCriteria(sdCopy, "update")
 }
 
 // ObjectDeleted is called when an object is deleted
-func (t *SDHandler) ObjectDeleted(obj interface{}) {
+func (t *SDHandler) ObjectDeleted(obj interface{}) error {
 	log.Info("SDHandler.ObjectDeleted")
-	// TBD
-}
-
-// getByNode generates selectivedeployment list from the owner references of workloads which contains the node that has an event (add/update/delete)
-func (t *SDHandler) getByNode(nodeName string) ([][]string, bool) {
-	ownerList := [][]string{}
-	status := false
-
-	setList := func(ctlPodSpec corev1.PodSpec, ownerReferences []metav1.OwnerReference, namespace string) {
-		podSpec := ctlPodSpec
-		if podSpec.Affinity != nil && podSpec.Affinity.NodeAffinity != nil && podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
-		nodeSelectorLoop:
-			for _, nodeSelectorTerm := range podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
-				for _, matchExpression := range nodeSelectorTerm.MatchExpressions {
-					if matchExpression.Key == "kubernetes.io/hostname" {
-						for _, expressionNodeName := range matchExpression.Values {
-							if nodeName == expressionNodeName {
-								for _, owner := range ownerReferences {
-									if owner.Kind == "SelectiveDeployment" {
-										ownerDet := []string{namespace, owner.Name}
-										if !util.SliceContains(ownerList, ownerDet) {
-											ownerList = append(ownerList, ownerDet)
-										}
-										status = true
-									}
-								}
-								break nodeSelectorLoop
-							}
-						}
-					}
-				}
+	// Nothing to do here as the workloads have already been released before the finalizer was removed
+	return nil
+}
+
+// ObjectFailed is called when the controller gives up on an object after several failures in a row
+func (t *SDHandler) ObjectFailed(obj interface{}, err error) {
+	log.Info("SDHandler.ObjectFailed")
+	sdCopy := obj.(*apps_v1alpha.SelectiveDeployment).DeepCopy()
+	sdCopy.Status.State = failure
+	message := fmt.Sprintf(statusDict["reconcile-failure"], err)
+	recorder.ReconcileFailed(t.recorder, sdCopy, &sdCopy.Status.Message, &sdCopy.Status.Conditions, "Applied", message)
+	if _, err := t.edgenetClientset.AppsV1alpha().SelectiveDeployments(sdCopy.GetNamespace()).UpdateStatus(context.TODO(), sdCopy, metav1.UpdateOptions{}); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// applyCriteria used by ObjectCreated, ObjectUpdated, and recoverSelectiveDeployments functions, the status is left
+// untouched when it returns an error so that the next attempt starts over
+func (t *SDHandler) applyCriteria(sdCopy *apps_v1alpha.SelectiveDeployment, eventType string) (err error) {
+	// The dry run only reports the node selection, neither the workloads nor the object itself are touched
+	if sdCopy.GetAnnotations()[dryRunAnnotation] == "true" {
+		return t.preview(sdCopy)
+	}
+	// Attach the finalizer to release the workloads before the selectivedeployment goes away
+	if !util.Contains(sdCopy.GetFinalizers(), finalizer) {
+		sdCopy.SetFinalizers(append(sdCopy.GetFinalizers(), finalizer))
+		sdUpdated, err := t.edgenetClientset.AppsV1alpha().SelectiveDeployments(sdCopy.GetNamespace()).Update(context.TODO(), sdCopy, metav1.UpdateOptions{})
+		if err != nil {
+			log.Println(err.Error())
+		} else {
+			sdCopy = sdUpdated
+		}
+	}
+	oldStatus := sdCopy.Status
+	statusUpdate := func() {
+		if err == nil && !reflect.DeepEqual(oldStatus, sdCopy.Status) {
+			if _, err = t.edgenetClientset.AppsV1alpha().SelectiveDeployments(sdCopy.GetNamespace()).UpdateStatus(context.TODO(), sdCopy, metav1.UpdateOptions{}); err != nil {
+				return
 			}
+			t.recordStatus(sdCopy)
+			observeWorkloads(sdCopy)
 		}
 	}
-	deploymentRaw, err := t.clientset.AppsV1().Deployments("").List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	defer statusUpdate()
+	// Flush the status, but keep the conditions so that their transition times remain
+	sdCopy.Status = apps_v1alpha.SelectiveDeploymentStatus{Conditions: oldStatus.Conditions}
+	// The workloads are deleted while the windows of the schedule are closed, and created again once one opens
+	if open, nextOpening, err := scheduleOpen(sdCopy.Spec.Schedule, now()); err != nil {
+		sdCopy.Status.State = failure
+		sdCopy.Status.Message = []string{fmt.Sprintf(statusDict["schedule-err"], err)}
+		return nil
+	} else if !open {
+		t.closeSchedule(sdCopy, nextOpening)
+		return nil
 	}
-	for _, deploymentRow := range deploymentRaw.Items {
-		setList(deploymentRow.Spec.Template.Spec, deploymentRow.GetOwnerReferences(), deploymentRow.GetNamespace())
+
+	// The nodes are read once, the workloads and the locations of the fan-out mode select theirs out of the same list
+	nodeList := t.listNodes()
+	ownerReferences := SetAsOwnerReference(sdCopy)
+	workloads, invalidMessages := specWorkloads(sdCopy.Spec.Workloads)
+	workloadCounter := len(invalidMessages)
+	failureCounter := len(invalidMessages)
+	sdCopy.Status.Message = append(sdCopy.Status.Message, invalidMessages...)
+	// The workloads that the selectivedeployment owns out of these are pruned, such as the copies left over
+	// when the fan-out mode is turned off or the workloads it replaces when it is turned on
+	desiredWorkloads := workloads
+	if sdCopy.Spec.FanOut {
+		// Each location gets its own copies of the workloads, which are configured as if a selectivedeployment
+		// had been created for that location only
+		desiredWorkloads = []workload{}
+		for _, locationRow := range fanOutLocations(sdCopy) {
+			sdLocation := sdCopy.DeepCopy()
+			sdLocation.Status = apps_v1alpha.SelectiveDeploymentStatus{}
+			sdLocation.Spec.Selector = locationRow.selector
+			sdLocation.Spec.SelectorGroups = locationRow.groups
+			locationWorkloads := copyWorkloads(workloads, sdCopy.GetName(), locationRow.suffix, sdCopy.Spec.FanOutReplicas)
+			locationWorkloadCounter, locationFailureCounter := t.applyWorkloads(sdLocation, nodeList, locationWorkloads, ownerReferences)
+			workloadCounter += locationWorkloadCounter
+			failureCounter += locationFailureCounter
+			sdCopy.Status.Message = append(sdCopy.Status.Message, sdLocation.Status.Message...)
+			sdCopy.Status.Workloads = append(sdCopy.Status.Workloads, sdLocation.Status.Workloads...)
+			sdCopy.Status.Selectors = append(sdCopy.Status.Selectors, sdLocation.Status.Selectors...)
+			desiredWorkloads = append(desiredWorkloads, locationWorkloads...)
+		}
+	} else {
+		applyWorkloadCounter, applyFailureCounter := t.applyWorkloads(sdCopy, nodeList, workloads, ownerReferences)
+		workloadCounter += applyWorkloadCounter
+		failureCounter += applyFailureCounter
 	}
-	daemonsetRaw, err := t.clientset.AppsV1().DaemonSets("").List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	if err := t.pruneWorkloads(sdCopy, workloads, desiredWorkloads); err != nil {
+		return err
 	}
-	for _, daemonsetRow := range daemonsetRaw.Items {
-		setList(daemonsetRow.Spec.Template.Spec, daemonsetRow.GetOwnerReferences(), daemonsetRow.GetNamespace())
+
+	if failureCounter == 0 && workloadCounter != 0 {
+		sdCopy.Status.State = success
+		sdCopy.Status.Message = []string{statusDict["sd-success"]}
+	} else if workloadCounter == failureCounter {
+		sdCopy.Status.State = failure
+	} else {
+		sdCopy.Status.State = partial
 	}
-	statefulsetRaw, err := t.clientset.AppsV1().StatefulSets("").List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	sdCopy.Status.Ready = fmt.Sprintf("%d/%d", (workloadCounter - failureCounter), workloadCounter)
+	setConditions(sdCopy, workloadCounter)
+	return nil
+}
+
+// closeSchedule releases the workloads of the selectivedeployment until the next window of its schedule opens
+func (t *SDHandler) closeSchedule(sdCopy *apps_v1alpha.SelectiveDeployment, nextOpening time.Time) {
+	releasedCounter, workloadCounter := t.releaseWorkloads(sdCopy, false)
+	message := fmt.Sprintf(statusDict["schedule-over"], releasedCounter, workloadCounter)
+	if !nextOpening.IsZero() {
+		message = fmt.Sprintf(statusDict["schedule-closed"], releasedCounter, workloadCounter, nextOpening.Format(time.RFC3339))
 	}
-	for _, statefulsetRow := range statefulsetRaw.Items {
-		setList(statefulsetRow.Spec.Template.Spec, statefulsetRow.GetOwnerReferences(), statefulsetRow.GetNamespace())
+	sdCopy.Status.State = inactive
+	sdCopy.Status.Message = append([]string{message}, sdCopy.Status.Message...)
+	sdCopy.Status.Ready = fmt.Sprintf("0/%d", workloadCounter)
+	meta.SetStatusCondition(&sdCopy.Status.Conditions, metav1.Condition{
+		Type:               "Ready",
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: sdCopy.GetGeneration(),
+		Reason:             "ScheduleClosed",
+		Message:            message,
+	})
+}
+
+// preview runs the node selection of the selectivedeployment and puts the nodes matched, the selectors falling short,
+// and the node affinity that would be written into the status, without creating or updating any workload
+func (t *SDHandler) preview(sdCopy *apps_v1alpha.SelectiveDeployment) error {
+	oldStatus := sdCopy.Status
+	sdCopy.Status = apps_v1alpha.SelectiveDeploymentStatus{Conditions: oldStatus.Conditions}
+	locations := []fanOutLocation{{selector: sdCopy.Spec.Selector, groups: sdCopy.Spec.SelectorGroups}}
+	if sdCopy.Spec.FanOut {
+		locations = fanOutLocations(sdCopy)
 	}
-	jobRaw, err := t.clientset.BatchV1().Jobs("").List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	failureCounter := 0
+	nodeList := t.listNodes()
+	for _, locationRow := range locations {
+		sdLocation := sdCopy.DeepCopy()
+		sdLocation.Status = apps_v1alpha.SelectiveDeploymentStatus{}
+		sdLocation.Spec.Selector = locationRow.selector
+		sdLocation.Spec.SelectorGroups = locationRow.groups
+		nodeSelectorTerms, preferredTerms, failureCount := t.setFilter(sdLocation, nodeList, "addOrUpdate")
+		failureCounter += failureCount
+		sdCopy.Status.Message = append(sdCopy.Status.Message, sdLocation.Status.Message...)
+		sdCopy.Status.Selectors = append(sdCopy.Status.Selectors, sdLocation.Status.Selectors...)
+		sdCopy.Status.Preview = append(sdCopy.Status.Preview, apps_v1alpha.AffinityPreview{Location: locationRow.suffix, NodeSelectorTerms: nodeSelectorTerms,
+			PreferredSchedulingTerms: preferredTerms})
 	}
-	for _, jobRow := range jobRaw.Items {
-		setList(jobRow.Spec.Template.Spec, jobRow.GetOwnerReferences(), jobRow.GetNamespace())
+	sdCopy.Status.State = dryRun
+	sdCopy.Status.Message = append([]string{fmt.Sprintf(statusDict["dry-run"], len(selectedHostnames(sdCopy)))}, sdCopy.Status.Message...)
+	sdCopy.Status.Ready = "0/0"
+	scheduledCondition := metav1.Condition{
+		Type:               "Scheduled",
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sdCopy.GetGeneration(),
+		Reason:             "DryRun",
+		Message:            "Every selector found the nodes desired",
 	}
-	cronjobRaw, err := t.clientset.BatchV1beta1().CronJobs("").List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+	if failureCounter != 0 {
+		scheduledCondition.Status = metav1.ConditionFalse
+		scheduledCondition.Reason = "FewerNodes"
+		scheduledCondition.Message = fmt.Sprintf("%d selector(s) could not find the nodes desired", failureCounter)
+	}
+	meta.SetStatusCondition(&sdCopy.Status.Conditions, scheduledCondition)
+	// Nothing was applied in the dry run
+	meta.RemoveStatusCondition(&sdCopy.Status.Conditions, "Applied")
+	meta.RemoveStatusCondition(&sdCopy.Status.Conditions, "Ready")
+	if !reflect.DeepEqual(oldStatus, sdCopy.Status) {
+		if _, err := t.edgenetClientset.AppsV1alpha().SelectiveDeployments(sdCopy.GetNamespace()).UpdateStatus(context.TODO(), sdCopy, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		t.recordStatus(sdCopy)
+		observeWorkloads(sdCopy)
+	}
+	return nil
+}
+
+// recordStatus publishes the outcome of the selectivedeployment as an event, along with the nodes selected, so that
+// kubectl describe shows what happened to it. It is called once the status changes, not at each resync.
+func (t *SDHandler) recordStatus(sdCopy *apps_v1alpha.SelectiveDeployment) {
+	eventType, reason := corev1.EventTypeNormal, ""
+	switch sdCopy.Status.State {
+	case success:
+		reason = "Applied"
+	case partial:
+		eventType, reason = corev1.EventTypeWarning, "PartiallyApplied"
+	case failure:
+		eventType, reason = corev1.EventTypeWarning, "Failed"
+	case inactive:
+		reason = "ScheduleClosed"
+	case dryRun:
+		reason = "DryRun"
+	case terminating:
+		reason = "TearingDown"
+	default:
+		return
+	}
+	message := strings.Join(sdCopy.Status.Message, ", ")
+	if hostnames := selectedHostnames(sdCopy); len(hostnames) != 0 {
+		// Keep the event short with a large number of nodes, the status lists them all
+		if len(hostnames) > maxEventNodes {
+			hostnames = append(hostnames[0:maxEventNodes], fmt.Sprintf("%d more", len(hostnames)-maxEventNodes))
+		}
+		message = fmt.Sprintf("%s, node(s) selected: %s", message, strings.Join(hostnames, ", "))
+	}
+	t.recorder.Event(sdCopy, eventType, reason, message)
+}
+
+// observeWorkloads exposes the count of workloads ready and desired of the selectivedeployment, which the
+// teardown clears once the finalizer is removed
+func observeWorkloads(sdCopy *apps_v1alpha.SelectiveDeployment) {
+	var ready, desired int
+	if _, err := fmt.Sscanf(sdCopy.Status.Ready, "%d/%d", &ready, &desired); err != nil {
+		return
+	}
+	metrics.WorkloadsReady.WithLabelValues(sdCopy.GetNamespace(), sdCopy.GetName()).Set(float64(ready))
+	metrics.WorkloadsDesired.WithLabelValues(sdCopy.GetNamespace(), sdCopy.GetName()).Set(float64(desired))
+}
+
+// selectedHostnames returns the distinct hostnames of the nodes that the selectors picked
+func selectedHostnames(sdCopy *apps_v1alpha.SelectiveDeployment) []string {
+	hostnames := []string{}
+	for _, selectorRow := range sdCopy.Status.Selectors {
+		for _, nodeRow := range selectorRow.Nodes {
+			if !util.Contains(hostnames, nodeRow.Hostname) {
+				hostnames = append(hostnames, nodeRow.Hostname)
+			}
+		}
+	}
+	return hostnames
+}
+
+// setConditions summarizes the workloads and the selectors in the status into the conditions
+func setConditions(sdCopy *apps_v1alpha.SelectiveDeployment, workloadCounter int) {
+	appliedCondition := metav1.Condition{
+		Type:               "Applied",
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sdCopy.GetGeneration(),
+		Reason:             "WorkloadsApplied",
+		Message:            fmt.Sprintf("%d/%d workload(s) applied", len(sdCopy.Status.Workloads), workloadCounter),
+	}
+	if len(sdCopy.Status.Workloads) != workloadCounter {
+		appliedCondition.Status = metav1.ConditionFalse
+		appliedCondition.Reason = "WorkloadsFailed"
+	}
+	meta.SetStatusCondition(&sdCopy.Status.Conditions, appliedCondition)
+
+	scheduledCondition := metav1.Condition{
+		Type:               "Scheduled",
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sdCopy.GetGeneration(),
+		Reason:             "NodesSelected",
+		Message:            "Every selector found the nodes desired",
+	}
+	for _, selectorRow := range sdCopy.Status.Selectors {
+		if selectorRow.Message != "" {
+			scheduledCondition.Status = metav1.ConditionFalse
+			scheduledCondition.Reason = "FewerNodes"
+			scheduledCondition.Message = selectorRow.Message
+			break
+		}
+	}
+	meta.SetStatusCondition(&sdCopy.Status.Conditions, scheduledCondition)
+
+	readyCondition := metav1.Condition{
+		Type:               "Ready",
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: sdCopy.GetGeneration(),
+		Reason:             "PodsReady",
+		Message:            "The pods of every workload are ready",
+	}
+	for _, workloadRow := range sdCopy.Status.Workloads {
+		if workloadRow.ReadyReplicas < workloadRow.Replicas {
+			readyCondition.Status = metav1.ConditionFalse
+			readyCondition.Reason = "PodsNotReady"
+			readyCondition.Message = fmt.Sprintf("%s %s has %d/%d pod(s) ready", workloadRow.Kind, workloadRow.Name, workloadRow.ReadyReplicas, workloadRow.Replicas)
+			break
+		}
+	}
+	if appliedCondition.Status == metav1.ConditionFalse {
+		readyCondition.Status = metav1.ConditionFalse
+		readyCondition.Reason = "WorkloadsFailed"
+		readyCondition.Message = appliedCondition.Message
+	}
+	meta.SetStatusCondition(&sdCopy.Status.Conditions, readyCondition)
+}
+
+// workloadStatus reads the pods desired and ready from the status of the workload
+func workloadStatus(workloadRow interface{}) apps_v1alpha.WorkloadStatus {
+	var status apps_v1alpha.WorkloadStatus
+	switch workloadObj := workloadRow.(type) {
+	case *appsv1.Deployment:
+		status = apps_v1alpha.WorkloadStatus{Kind: "Deployment", Name: workloadObj.GetName(), Replicas: 1, ReadyReplicas: workloadObj.Status.ReadyReplicas}
+		if workloadObj.Spec.Replicas != nil {
+			status.Replicas = *workloadObj.Spec.Replicas
+		}
+	case *appsv1.DaemonSet:
+		status = apps_v1alpha.WorkloadStatus{Kind: "DaemonSet", Name: workloadObj.GetName(), Replicas: workloadObj.Status.DesiredNumberScheduled, ReadyReplicas: workloadObj.Status.NumberReady}
+	case *appsv1.StatefulSet:
+		status = apps_v1alpha.WorkloadStatus{Kind: "StatefulSet", Name: workloadObj.GetName(), Replicas: 1, ReadyReplicas: workloadObj.Status.ReadyReplicas}
+		if workloadObj.Spec.Replicas != nil {
+			status.Replicas = *workloadObj.Spec.Replicas
+		}
+	case *batchv1.Job:
+		status = apps_v1alpha.WorkloadStatus{Kind: "Job", Name: workloadObj.GetName(), Replicas: 1, ReadyReplicas: workloadObj.Status.Succeeded}
+		if workloadObj.Spec.Completions != nil {
+			status.Replicas = *workloadObj.Spec.Completions
+		}
+	case *batchv1beta.CronJob:
+		status = apps_v1alpha.WorkloadStatus{Kind: "CronJob", Name: workloadObj.GetName(), Replicas: int32(len(workloadObj.Status.Active)), ReadyReplicas: int32(len(workloadObj.Status.Active))}
+	case *unstructured.Unstructured:
+		// The kinds that the clientset serves are read in their typed form
+		if typedObj, err := (typedClient{kind: workloadObj.GetKind()}).fromUnstructured(workloadObj); err == nil {
+			return workloadStatus(typedObj)
+		}
+		status = genericStatus(workloadObj)
 	}
-	for _, cronjobRow := range cronjobRaw.Items {
-		setList(cronjobRow.Spec.JobTemplate.Spec.Template.Spec, cronjobRow.GetOwnerReferences(), cronjobRow.GetNamespace())
+	return status
+}
+
+// applyWorkloads creates or updates the workloads of the selectivedeployment, and returns the count of workloads and failures
+func (t *SDHandler) applyWorkloads(sdCopy *apps_v1alpha.SelectiveDeployment, nodeList []corev1.Node, workloads []workload, ownerReferences []metav1.OwnerReference) (int, int) {
+	workloadCounter := len(workloads)
+	failureCounter := 0
+	// The workloads share the node selection, so its status is reported once
+	nodeSelectorTermList, preferredTermList, filterFailures := t.setFilter(sdCopy, nodeList, "addOrUpdate")
+	for _, workloadRow := range workloads {
+		client := t.workloadClient(workloadRow, sdCopy.GetNamespace())
+		workloadObj, err := client.Get(context.TODO(), workloadRow.name(), metav1.GetOptions{})
+		if err == nil && checkOwnerReferences(sdCopy, workloadObj.GetOwnerReferences()) {
+			sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["workload-in-use"], workloadRow.kind(), workloadRow.name()))
+			failureCounter++
+			continue
+		}
+		// Configure the workload according to the SD
+		configuredWorkload, failureCount := t.configureWorkload(sdCopy, workloadRow, nodeSelectorTermList, preferredTermList, ownerReferences)
+		// A workload counts once among the failures, whatever went wrong with it
+		failed := filterFailures+failureCount != 0
+		if errors.IsNotFound(err) {
+			workloadObj, err = client.Create(context.TODO(), configuredWorkload.object, metav1.CreateOptions{})
+		} else if err == nil && util.Contains(immutableTemplateKinds, workloadRow.kind()) {
+			// The pod template of a job or a pod is immutable, so the workload in place only takes the owner
+			// references, and the node affinity applies to the pods of the workload once it is recreated
+			workloadObj.SetOwnerReferences(ownerReferences)
+			workloadObj, err = client.Update(context.TODO(), workloadObj, metav1.UpdateOptions{})
+		} else if err == nil {
+			// The update is conditional on the version read, which the custom resources require
+			configuredWorkload.object.SetResourceVersion(workloadObj.GetResourceVersion())
+			workloadObj, err = client.Update(context.TODO(), configuredWorkload.object, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["workload-creation-failure"], workloadRow.kind(), workloadRow.name()))
+			failed = true
+		} else {
+			sdCopy.Status.Workloads = append(sdCopy.Status.Workloads, workloadStatus(workloadObj))
+		}
+		if failed {
+			failureCounter++
+		}
 	}
-	return ownerList, status
+	return workloadCounter, failureCounter
 }
 
-// applyCriteria used by ObjectCreated, ObjectUpdated, and recoverSelectiveDeployments functions
-func (t *SDHandler) applyCriteria(sdCopy *apps_v1alpha.SelectiveDeployment, eventType string) {
+// tearDown releases the workloads of a selectivedeployment being deleted according to its deletion policy,
+// and then removes the finalizer to let the selectivedeployment go
+func (t *SDHandler) tearDown(sdCopy *apps_v1alpha.SelectiveDeployment) error {
+	if !util.Contains(sdCopy.GetFinalizers(), finalizer) {
+		return nil
+	}
 	oldStatus := sdCopy.Status
-	statusUpdate := func() {
-		if !reflect.DeepEqual(oldStatus, sdCopy.Status) {
-			t.edgenetClientset.AppsV1alpha().SelectiveDeployments(sdCopy.GetNamespace()).UpdateStatus(context.TODO(), sdCopy, metav1.UpdateOptions{})
+	sdCopy.Status = apps_v1alpha.SelectiveDeploymentStatus{State: terminating}
+	releasedCounter, workloadCounter := t.releaseWorkloads(sdCopy, sdCopy.Spec.DeletionPolicy == deletionPolicyOrphan)
+	sdCopy.Status.Message = append([]string{fmt.Sprintf(statusDict["teardown-progress"], releasedCounter, workloadCounter)}, sdCopy.Status.Message...)
+	sdCopy.Status.Ready = fmt.Sprintf("%d/%d", workloadCounter-releasedCounter, workloadCounter)
+	if !reflect.DeepEqual(oldStatus, sdCopy.Status) {
+		sdUpdated, err := t.edgenetClientset.AppsV1alpha().SelectiveDeployments(sdCopy.GetNamespace()).UpdateStatus(context.TODO(), sdCopy, metav1.UpdateOptions{})
+		if err != nil {
+			log.Println(err.Error())
+		} else {
+			sdCopy = sdUpdated
 		}
+		t.recordStatus(sdCopy)
+		observeWorkloads(sdCopy)
 	}
-	defer statusUpdate()
-	// Flush the status
-	sdCopy.Status = apps_v1alpha.SelectiveDeploymentStatus{}
+	// The finalizer stays until every workload is released, the event is retried with backoff for the rest
+	if releasedCounter != workloadCounter {
+		return fmt.Errorf("%d/%d workload(s) of %s/%s released", releasedCounter, workloadCounter, sdCopy.GetNamespace(), sdCopy.GetName())
+	}
+	finalizers := []string{}
+	for _, finalizerRow := range sdCopy.GetFinalizers() {
+		if finalizerRow != finalizer {
+			finalizers = append(finalizers, finalizerRow)
+		}
+	}
+	sdCopy.SetFinalizers(finalizers)
+	if _, err := t.edgenetClientset.AppsV1alpha().SelectiveDeployments(sdCopy.GetNamespace()).Update(context.TODO(), sdCopy, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	metrics.WorkloadsReady.DeleteLabelValues(sdCopy.GetNamespace(), sdCopy.GetName())
+	metrics.WorkloadsDesired.DeleteLabelValues(sdCopy.GetNamespace(), sdCopy.GetName())
+	return nil
+}
 
-	ownerReferences := SetAsOwnerReference(sdCopy)
+// releaseWorkloads deletes or orphans the workloads that the selectivedeployment owns, and returns the count of
+// workloads released along with the count of workloads
+func (t *SDHandler) releaseWorkloads(sdCopy *apps_v1alpha.SelectiveDeployment, orphan bool) (int, int) {
+	propagationPolicy := metav1.DeletePropagationBackground
+	deleteOptions := metav1.DeleteOptions{PropagationPolicy: &propagationPolicy}
+	// The workloads that cannot be decoded were never created
+	workloads, _ := specWorkloads(sdCopy.Spec.Workloads)
+	if sdCopy.Spec.FanOut {
+		locationWorkloads := []workload{}
+		for _, locationRow := range fanOutLocations(sdCopy) {
+			locationWorkloads = append(locationWorkloads, copyWorkloads(workloads, sdCopy.GetName(), locationRow.suffix, sdCopy.Spec.FanOutReplicas)...)
+		}
+		workloads = locationWorkloads
+	}
 	workloadCounter := 0
+	releasedCounter := 0
+	// A workload is released when it is deleted, orphaned, or not found, and the workloads of other owners are left untouched
+	release := func(kind string, name string, owned bool, err error) {
+		workloadCounter++
+		if err != nil && !errors.IsNotFound(err) {
+			sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["teardown-failure"], kind, name, err))
+			return
+		}
+		releasedCounter++
+		if err == nil && owned && orphan {
+			sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["workload-orphaned"], kind, name))
+		} else if err == nil && owned {
+			sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["workload-deleted"], kind, name))
+		}
+	}
+	for _, workloadRow := range workloads {
+		client := t.workloadClient(workloadRow, sdCopy.GetNamespace())
+		workloadObj, err := client.Get(context.TODO(), workloadRow.name(), metav1.GetOptions{})
+		owned := err == nil && isOwnedBy(sdCopy, workloadObj.GetOwnerReferences())
+		if owned && orphan {
+			// The pod template of a job or a pod is immutable, so only the owner reference is dropped
+			if !util.Contains(immutableTemplateKinds, workloadRow.kind()) {
+				liveWorkload := workloadRow
+				liveWorkload.object = workloadObj
+				err = liveWorkload.restoreAffinity(workloadRow)
+			}
+			if err == nil {
+				workloadObj.SetOwnerReferences(removeOwnerReference(sdCopy, workloadObj.GetOwnerReferences()))
+				_, err = client.Update(context.TODO(), workloadObj, metav1.UpdateOptions{})
+			}
+		} else if owned {
+			err = client.Delete(context.TODO(), workloadRow.name(), deleteOptions)
+		}
+		release(workloadRow.kind(), workloadRow.name(), owned, err)
+	}
+	return releasedCounter, workloadCounter
+}
+
+// configureWorkload manipulate the workload by selectivedeployments to match the desired state that users supplied
+func (t *SDHandler) configureWorkload(sdCopy *apps_v1alpha.SelectiveDeployment, workloadRow workload, nodeSelectorTermList []corev1.NodeSelectorTerm,
+	preferredTermList []corev1.PreferredSchedulingTerm, ownerReferences []metav1.OwnerReference) (workload, int) {
+	log.Info("configureWorkload: start")
+	failureCount := 0
+	// Set the new node affinity configuration for the workload and update that
+	workloadCopy := workloadRow.deepCopy()
+	if err := workloadCopy.setNodeAffinity(nodeSelectorTermList, preferredTermList); err != nil {
+		log.Printf("%s/%s/%s: %s", sdCopy.GetNamespace(), workloadRow.kind(), workloadRow.name(), err)
+		sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["workload-invalid"], workloadRow.kind(), workloadRow.name(), err))
+		failureCount++
+	}
+	workloadCopy.object.SetOwnerReferences(ownerReferences)
+	return workloadCopy, failureCount
+}
+
+// The selectors that pick the nodes by their hostnames, the label selectors are left to the scheduler
+var nodeSelectorNames = []string{"city", "state", "country", "continent", "asn", "asorg", "nat", "polygon", "radius", "nearest"}
+
+// The node labels that the selectors matching the values of the EdgeNet labels look at
+var nodeLabelKeys = map[string]string{
+	"city":      "edge-net.io/city",
+	"state":     "edge-net.io/state-iso",
+	"country":   "edge-net.io/country-iso",
+	"continent": "edge-net.io/continent",
+	"asn":       "edge-net.io/asn",
+	"asorg":     "edge-net.io/as-org",
+	"nat":       "edge-net.io/nat",
+}
+
+// setFilter generates the values in the predefined form and puts those into the node selection fields of the selectivedeployment object,
+// the nodes are picked out of the node list given
+func (t *SDHandler) setFilter(sdCopy *apps_v1alpha.SelectiveDeployment, nodes []corev1.Node, event string) ([]corev1.NodeSelectorTerm, []corev1.PreferredSchedulingTerm, int) {
+	var nodeSelectorTermList []corev1.NodeSelectorTerm
+	// The selectors in the preferred mode form preferred scheduling terms so that the pods can run elsewhere if need be
+	var preferredTermList []corev1.PreferredSchedulingTerm
 	failureCounter := 0
-	if sdCopy.Spec.Workloads.Deployment != nil {
-		workloadCounter += len(sdCopy.Spec.Workloads.Deployment)
-		for _, sdDeployment := range sdCopy.Spec.Workloads.Deployment {
-			deploymentObj, err := t.clientset.AppsV1().Deployments(sdCopy.GetNamespace()).Get(context.TODO(), sdDeployment.GetName(), metav1.GetOptions{})
-			if errors.IsNotFound(err) {
-				configuredDeployment, failureCount := t.configureWorkload(sdCopy, sdDeployment, ownerReferences)
-				failureCounter += failureCount
-				_, err = t.clientset.AppsV1().Deployments(sdCopy.GetNamespace()).Create(context.TODO(), configuredDeployment.(*appsv1.Deployment), metav1.CreateOptions{})
-				if err != nil {
-					sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["daemonset-creation-failure"], sdDeployment.GetName()))
-					failureCounter++
-				}
-			} else {
-				underControl := checkOwnerReferences(sdCopy, deploymentObj.GetOwnerReferences())
-				if !underControl {
-					// Configure the deployment according to the SD
-					configuredDeployment, failureCount := t.configureWorkload(sdCopy, sdDeployment, ownerReferences)
-					failureCounter += failureCount
-					_, err = t.clientset.AppsV1().Deployments(sdCopy.GetNamespace()).Update(context.TODO(), configuredDeployment.(*appsv1.Deployment), metav1.UpdateOptions{})
-					if err != nil {
-						sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["daemonset-creation-failure"], sdDeployment.GetName()))
-						failureCounter++
-					}
-				} else {
-					sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["deployment-in-use"], sdDeployment.GetName()))
-					failureCounter++
-				}
+	// The label selectors don't pick nodes on their own but narrow down the nodes that the other selectors pick,
+	// and they are also added to each node selector term so that the scheduler applies them as well
+	labelExpressions, nodeLabelSelector, labelFailures := labelRequirements(sdCopy, sdCopy.Spec.Selector)
+	failureCounter += labelFailures
+	// If the event type is delete then we don't need to run the part below
+	nodeList := []corev1.Node{}
+	if event != "delete" {
+		sdCopy.Status.Selectors = []apps_v1alpha.SelectorStatus{}
+		inLocalTime, err := localTimeFilter(sdCopy.Spec.Schedule, now())
+		if err != nil {
+			sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["schedule-err"], err))
+			failureCounter++
+			inLocalTime = func(*corev1.Node) bool { return true }
+		}
+		for _, nodeRow := range nodes {
+			if isNodeAvailable(nodeRow.DeepCopy()) && nodeLabelSelector.Matches(labels.Set(nodeRow.Labels)) && inLocalTime(nodeRow.DeepCopy()) {
+				nodeList = append(nodeList, nodeRow)
 			}
 		}
 	}
-	if sdCopy.Spec.Workloads.DaemonSet != nil {
-		workloadCounter += len(sdCopy.Spec.Workloads.DaemonSet)
-		for _, sdDaemonset := range sdCopy.Spec.Workloads.DaemonSet {
-			daemonsetObj, err := t.clientset.AppsV1().DaemonSets(sdCopy.GetNamespace()).Get(context.TODO(), sdDaemonset.GetName(), metav1.GetOptions{})
-			if errors.IsNotFound(err) {
-				configuredDaemonSet, failureCount := t.configureWorkload(sdCopy, sdDaemonset, ownerReferences)
-				failureCounter += failureCount
-				_, err = t.clientset.AppsV1().DaemonSets(sdCopy.GetNamespace()).Create(context.TODO(), configuredDaemonSet.(*appsv1.DaemonSet), metav1.CreateOptions{})
-				if err != nil {
-					sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["daemonset-creation-failure"], sdDaemonset.GetName()))
-					failureCounter++
-				}
-			} else {
-				underControl := checkOwnerReferences(sdCopy, daemonsetObj.GetOwnerReferences())
-				if !underControl {
-					// Configure the daemonset according to the SD
-					configuredDaemonSet, failureCount := t.configureWorkload(sdCopy, sdDaemonset, ownerReferences)
-					failureCounter += failureCount
-					_, err = t.clientset.AppsV1().DaemonSets(sdCopy.GetNamespace()).Update(context.TODO(), configuredDaemonSet.(*appsv1.DaemonSet), metav1.UpdateOptions{})
-					if err != nil {
-						sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["daemonset-creation-failure"], sdDaemonset.GetName()))
-						failureCounter++
-					}
-				} else {
-					sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["daemonset-in-use"], sdDaemonset.GetName()))
+	// Each selector forms a node selector term by itself, which means the selectors are ORed
+	for _, selectorRow := range sdCopy.Spec.Selector {
+		selectorName := strings.ToLower(selectorRow.Name)
+		if selectorName == "label" {
+			continue
+		}
+		preferred := selectorRow.Mode == modePreferred
+		var matchExpression corev1.NodeSelectorRequirement
+		matchExpression.Values = []string{}
+		// The values are the hostnames of the nodes picked, so the NotIn operator is already taken into account
+		matchExpression.Operator = corev1.NodeSelectorOpIn
+		matchExpression.Key = "kubernetes.io/hostname"
+		if !util.Contains(nodeSelectorNames, selectorName) {
+			matchExpression.Key = ""
+		} else if event != "delete" {
+			hostnames, failures := t.matchNodes(sdCopy, selectorRow, nodeList)
+			failureCounter += failures
+			count := nodeCount{selectorRow.Quantity, selectorRow.Percentage, selectorRow.MinQuantity, selectorRow.MaxQuantity}
+			if selectorName == "nearest" && !count.isSet() {
+				// The quantity defaults to a single node, the nearest one
+				count.quantity = 1
+			}
+			hostnames, required := count.pick(hostnames)
+			selectorStatus := apps_v1alpha.SelectorStatus{Name: selectorRow.Name, Value: shortenValues(selectorRow.Value), Quantity: required}
+			if len(hostnames) < required {
+				selectorStatus.Message = fewerNodesMessage(len(hostnames), required, selectorRow.Value)
+				// The shortage doesn't hold the pods back in the preferred mode
+				if !preferred {
+					sdCopy.Status.Message = append(sdCopy.Status.Message, selectorStatus.Message)
 					failureCounter++
 				}
 			}
+			matchExpression.Values = append(matchExpression.Values, hostnames...)
+			selectorStatus.Nodes = selectedNodes(hostnames, nodeList)
+			sdCopy.Status.Selectors = append(sdCopy.Status.Selectors, selectorStatus)
+		}
+
+		var nodeSelectorTerm corev1.NodeSelectorTerm
+		nodeSelectorTerm.MatchExpressions = append(nodeSelectorTerm.MatchExpressions, matchExpression)
+		nodeSelectorTerm.MatchExpressions = append(nodeSelectorTerm.MatchExpressions, labelExpressions...)
+		if preferred {
+			preferredTermList = append(preferredTermList, preferredTerm(nodeSelectorTerm, selectorRow.Weight))
+		} else {
+			nodeSelectorTermList = append(nodeSelectorTermList, nodeSelectorTerm)
 		}
 	}
-	if sdCopy.Spec.Workloads.StatefulSet != nil {
-		workloadCounter += len(sdCopy.Spec.Workloads.StatefulSet)
-		for _, sdStatefulset := range sdCopy.Spec.Workloads.StatefulSet {
-			statefulsetObj, err := t.clientset.AppsV1().StatefulSets(sdCopy.GetNamespace()).Get(context.TODO(), sdStatefulset.GetName(), metav1.GetOptions{})
-			if errors.IsNotFound(err) {
-				configuredStatefulSet, failureCount := t.configureWorkload(sdCopy, sdStatefulset, ownerReferences)
-				failureCounter += failureCount
-				_, err = t.clientset.AppsV1().StatefulSets(sdCopy.GetNamespace()).Create(context.TODO(), configuredStatefulSet.(*appsv1.StatefulSet), metav1.CreateOptions{})
-				if err != nil {
-					sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["statefulset-creation-failure"], sdStatefulset.GetName()))
-					failureCounter++
-				}
+	// The selectors in a group are ANDed, and each group forms a node selector term, which means the groups are ORed
+	for i, groupRow := range sdCopy.Spec.SelectorGroups {
+		groupLabelExpressions, groupLabelSelector, labelFailures := labelRequirements(sdCopy, groupRow.Selector)
+		failureCounter += labelFailures
+		preferred := groupRow.Mode == modePreferred
+		addTerm := func(nodeSelectorTerm corev1.NodeSelectorTerm) {
+			if preferred {
+				preferredTermList = append(preferredTermList, preferredTerm(nodeSelectorTerm, groupRow.Weight))
 			} else {
-				underControl := checkOwnerReferences(sdCopy, statefulsetObj.GetOwnerReferences())
-				if !underControl {
-					// Configure the statefulset according to the SD
-					configuredStatefulSet, failureCount := t.configureWorkload(sdCopy, sdStatefulset, ownerReferences)
-					failureCounter += failureCount
-					_, err = t.clientset.AppsV1().StatefulSets(sdCopy.GetNamespace()).Update(context.TODO(), configuredStatefulSet.(*appsv1.StatefulSet), metav1.UpdateOptions{})
-					if err != nil {
-						sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["statefulset-creation-failure"], sdStatefulset.GetName()))
-						failureCounter++
-					}
-				} else {
-					sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["statefulset-in-use"], sdStatefulset.GetName()))
-					failureCounter++
-				}
+				nodeSelectorTermList = append(nodeSelectorTermList, nodeSelectorTerm)
 			}
 		}
-	}
-	if sdCopy.Spec.Workloads.Job != nil {
-		workloadCounter += len(sdCopy.Spec.Workloads.Job)
-		for _, sdJob := range sdCopy.Spec.Workloads.Job {
-			jobObj, err := t.clientset.BatchV1().Jobs(sdCopy.GetNamespace()).Get(context.TODO(), sdJob.GetName(), metav1.GetOptions{})
-			if errors.IsNotFound(err) {
-				configuredJob, failureCount := t.configureWorkload(sdCopy, sdJob, ownerReferences)
-				failureCounter += failureCount
-				_, err = t.clientset.BatchV1().Jobs(sdCopy.GetNamespace()).Create(context.TODO(), configuredJob.(*batchv1.Job), metav1.CreateOptions{})
-				if err != nil {
-					sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["job-creation-failure"], sdJob.GetName()))
-					failureCounter++
-				}
+		var nodeSelectorTerm corev1.NodeSelectorTerm
+		nodeSelectorTerm.MatchExpressions = append(nodeSelectorTerm.MatchExpressions, labelExpressions...)
+		nodeSelectorTerm.MatchExpressions = append(nodeSelectorTerm.MatchExpressions, groupLabelExpressions...)
+		groupNodeList := []corev1.Node{}
+		for _, nodeRow := range nodeList {
+			if groupLabelSelector.Matches(labels.Set(nodeRow.Labels)) {
+				groupNodeList = append(groupNodeList, nodeRow)
+			}
+		}
+		var hostnames []string
+		count := nodeCount{groupRow.Quantity, groupRow.Percentage, groupRow.MinQuantity, groupRow.MaxQuantity}
+		intersected := false
+		for _, selectorRow := range groupRow.Selector {
+			selectorName := strings.ToLower(selectorRow.Name)
+			if !util.Contains(nodeSelectorNames, selectorName) {
+				continue
+			}
+			matched, failures := t.matchNodes(sdCopy, selectorRow, groupNodeList)
+			failureCounter += failures
+			if !intersected {
+				hostnames = matched
+				intersected = true
+			} else if selectorName == "nearest" {
+				// The order of the nearest selector prevails so that the quantity picks the closest nodes
+				hostnames = intersect(matched, hostnames)
 			} else {
-				underControl := checkOwnerReferences(sdCopy, jobObj.GetOwnerReferences())
-				if !underControl {
-					// Configure the job according to the SD
-					configuredJob, failureCount := t.configureWorkload(sdCopy, sdJob, ownerReferences)
-					failureCounter += failureCount
-					_, err = t.clientset.BatchV1().Jobs(sdCopy.GetNamespace()).Update(context.TODO(), configuredJob.(*batchv1.Job), metav1.UpdateOptions{})
-					if err != nil {
-						sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["job-creation-failure"], sdJob.GetName()))
-						failureCounter++
-					}
-				} else {
-					sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["job-in-use"], sdJob.GetName()))
-					failureCounter++
-				}
+				hostnames = intersect(hostnames, matched)
+			}
+			if selectorName == "nearest" && !count.isSet() {
+				count.quantity = 1
 			}
 		}
-	}
-	if sdCopy.Spec.Workloads.CronJob != nil {
-		workloadCounter += len(sdCopy.Spec.Workloads.CronJob)
-		for _, sdCronJob := range sdCopy.Spec.Workloads.CronJob {
-			cronjobObj, err := t.clientset.BatchV1beta1().CronJobs(sdCopy.GetNamespace()).Get(context.TODO(), sdCronJob.GetName(), metav1.GetOptions{})
-			if errors.IsNotFound(err) {
-				configuredCronJob, failureCount := t.configureWorkload(sdCopy, sdCronJob, ownerReferences)
-				failureCounter += failureCount
-				_, err = t.clientset.BatchV1beta1().CronJobs(sdCopy.GetNamespace()).Create(context.TODO(), configuredCronJob.(*batchv1beta.CronJob), metav1.CreateOptions{})
-				if err != nil {
-					sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["cronjob-creation-failure"], sdCronJob.GetName()))
-					failureCounter++
+		if !intersected {
+			// The group only has label selectors which the scheduler can apply by itself unless a quantity is desired
+			if !count.isSet() {
+				if len(nodeSelectorTerm.MatchExpressions) != 0 {
+					addTerm(nodeSelectorTerm)
 				}
-			} else {
-				underControl := checkOwnerReferences(sdCopy, cronjobObj.GetOwnerReferences())
-				if !underControl {
-					// Configure the cronjob according to the SD
-					configuredCronJob, failureCount := t.configureWorkload(sdCopy, sdCronJob, ownerReferences)
-					failureCounter += failureCount
-					_, err = t.clientset.BatchV1beta1().CronJobs(sdCopy.GetNamespace()).Update(context.TODO(), configuredCronJob.(*batchv1beta.CronJob), metav1.UpdateOptions{})
-					if err != nil {
-						sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["cronjob-creation-failure"], sdCronJob.GetName()))
-						failureCounter++
-					}
-				} else {
-					sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["cronjob-in-use"], sdCronJob.GetName()))
+				continue
+			}
+			for _, nodeRow := range groupNodeList {
+				hostnames = append(hostnames, nodeRow.Labels["kubernetes.io/hostname"])
+			}
+		}
+		if event != "delete" {
+			var required int
+			hostnames, required = count.pick(hostnames)
+			selectorStatus := apps_v1alpha.SelectorStatus{Name: fmt.Sprintf("SelectorGroup[%d]", i), Quantity: required}
+			if len(hostnames) < required {
+				selectorStatus.Message = fmt.Sprintf(statusDict["group-nodes-fewer"], len(hostnames), required, i)
+				if !preferred {
+					sdCopy.Status.Message = append(sdCopy.Status.Message, selectorStatus.Message)
 					failureCounter++
 				}
 			}
+			selectorStatus.Nodes = selectedNodes(hostnames, nodeList)
+			sdCopy.Status.Selectors = append(sdCopy.Status.Selectors, selectorStatus)
 		}
+		matchExpression := corev1.NodeSelectorRequirement{
+			Key:      "kubernetes.io/hostname",
+			Operator: corev1.NodeSelectorOpIn,
+			Values:   append([]string{}, hostnames...),
+		}
+		nodeSelectorTerm.MatchExpressions = append([]corev1.NodeSelectorRequirement{matchExpression}, nodeSelectorTerm.MatchExpressions...)
+		addTerm(nodeSelectorTerm)
 	}
-
-	if failureCounter == 0 && workloadCounter != 0 {
-		sdCopy.Status.State = success
-		sdCopy.Status.Message = []string{statusDict["sd-success"]}
-	} else if workloadCounter == failureCounter {
-		sdCopy.Status.State = failure
-	} else {
-		sdCopy.Status.State = partial
+	// Only label selectors are required, so they form a term by themselves. That keeps the label selectors
+	// mandatory when the other selectors are preferred.
+	if len(nodeSelectorTermList) == 0 && len(labelExpressions) != 0 {
+		nodeSelectorTermList = append(nodeSelectorTermList, corev1.NodeSelectorTerm{MatchExpressions: labelExpressions})
 	}
-	sdCopy.Status.Ready = fmt.Sprintf("%d/%d", (workloadCounter - failureCounter), workloadCounter)
+	return nodeSelectorTermList, preferredTermList, failureCounter
 }
 
-// configureWorkload manipulate the workload by selectivedeployments to match the desired state that users supplied
-func (t *SDHandler) configureWorkload(sdCopy *apps_v1alpha.SelectiveDeployment, workloadRow interface{}, ownerReferences []metav1.OwnerReference) (interface{}, int) {
-	log.Info("configureWorkload: start")
-	nodeSelectorTermList, failureCount := t.setFilter(sdCopy, "addOrUpdate")
-	// Set the new node affinity configuration for the workload and update that
-	nodeAffinity := &corev1.NodeAffinity{
-		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
-			NodeSelectorTerms: nodeSelectorTermList,
-		},
-	}
-	if len(nodeSelectorTermList) <= 0 {
-		affinity := &corev1.Affinity{
-			NodeAffinity: &corev1.NodeAffinity{
-				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
-					NodeSelectorTerms: nodeSelectorTermList,
-				},
-			},
-		}
-		affinity.Reset()
-	}
-	var workloadCopy interface{}
-	switch workloadObj := workloadRow.(type) {
-	case appsv1.Deployment:
-		if len(nodeSelectorTermList) <= 0 && workloadObj.Spec.Template.Spec.Affinity != nil {
-			workloadObj.Spec.Template.Spec.Affinity.Reset()
-		} else if workloadObj.Spec.Template.Spec.Affinity != nil {
-			workloadObj.Spec.Template.Spec.Affinity.NodeAffinity = nodeAffinity
-		} else {
-			workloadObj.Spec.Template.Spec.Affinity = &corev1.Affinity{
-				NodeAffinity: nodeAffinity,
-			}
+// listNodes returns the schedulable nodes, which include the EdgeNet geolabels, from the cache of the node informer.
+// They are sorted by name as the API server would list them, so that the nodes picked don't change from one event to another.
+func (t *SDHandler) listNodes() []corev1.Node {
+	nodeList := []corev1.Node{}
+	for _, nodeRaw := range t.nodeIndexer.List() {
+		if nodeObj := nodeRaw.(*corev1.Node); !nodeObj.Spec.Unschedulable {
+			nodeList = append(nodeList, *nodeObj)
 		}
-		workloadObj.ObjectMeta.OwnerReferences = ownerReferences
-		//log.Printf("%s/Deployment/%s: %s", workloadObj.GetNamespace(), workloadObj.GetName(), nodeAffinity)
-		workloadCopy = workloadObj.DeepCopy()
-		//t.clientset.AppsV1().Deployments(sdCopy.GetNamespace()).Update(workloadCopy)
-	case appsv1.DaemonSet:
-		if len(nodeSelectorTermList) <= 0 && workloadObj.Spec.Template.Spec.Affinity != nil {
-			workloadObj.Spec.Template.Spec.Affinity.Reset()
-		} else if workloadObj.Spec.Template.Spec.Affinity != nil {
-			workloadObj.Spec.Template.Spec.Affinity.NodeAffinity = nodeAffinity
-		} else {
-			workloadObj.Spec.Template.Spec.Affinity = &corev1.Affinity{
-				NodeAffinity: nodeAffinity,
-			}
-		}
-		workloadObj.ObjectMeta.OwnerReferences = ownerReferences
-		//log.Printf("%s/DaemonSet/%s: %s", workloadObj.GetNamespace(), workloadObj.GetName(), nodeAffinity)
-		workloadCopy = workloadObj.DeepCopy()
-		//t.clientset.AppsV1().DaemonSets(sdCopy.GetNamespace()).Update(workloadCopy)
-	case appsv1.StatefulSet:
-		if len(nodeSelectorTermList) <= 0 && workloadObj.Spec.Template.Spec.Affinity != nil {
-			workloadObj.Spec.Template.Spec.Affinity.Reset()
-		} else if workloadObj.Spec.Template.Spec.Affinity != nil {
-			workloadObj.Spec.Template.Spec.Affinity.NodeAffinity = nodeAffinity
-		} else {
-			workloadObj.Spec.Template.Spec.Affinity = &corev1.Affinity{
-				NodeAffinity: nodeAffinity,
-			}
+	}
+	sort.Slice(nodeList, func(i, j int) bool { return nodeList[i].GetName() < nodeList[j].GetName() })
+	return nodeList
+}
+
+// nodeCount is the count of nodes that a selector or a selector group desires, either an exact quantity,
+// or a percentage of the nodes matched bounded by a minimum and a maximum
+type nodeCount struct {
+	quantity   int
+	percentage int
+	min        int
+	max        int
+}
+
+// isSet tells whether a count is desired, otherwise all the nodes matched are picked
+func (c nodeCount) isSet() bool {
+	return c.quantity != 0 || c.percentage != 0 || c.min != 0 || c.max != 0
+}
+
+// pick returns the hostnames picked among the ones matched, and the count of nodes needed at least.
+// An exact quantity needs that many nodes, whereas a percentage or a range is met with the minimum, so
+// that more nodes are picked up to the maximum as they join the cluster.
+func (c nodeCount) pick(hostnames []string) ([]string, int) {
+	if c.quantity != 0 || !c.isSet() {
+		if c.quantity != 0 && len(hostnames) >= c.quantity {
+			return hostnames[0:c.quantity], c.quantity
 		}
-		workloadObj.ObjectMeta.OwnerReferences = ownerReferences
-		//log.Printf("%s/StatefulSet/%s: %s", workloadObj.GetNamespace(), workloadObj.GetName(), nodeAffinity)
-		workloadCopy = workloadObj.DeepCopy()
-		//t.clientset.AppsV1().StatefulSets(sdCopy.GetNamespace()).Update(workloadCopy)
-	case batchv1.Job:
-		if len(nodeSelectorTermList) <= 0 && workloadObj.Spec.Template.Spec.Affinity != nil {
-			workloadObj.Spec.Template.Spec.Affinity.Reset()
-		} else if workloadObj.Spec.Template.Spec.Affinity != nil {
-			workloadObj.Spec.Template.Spec.Affinity.NodeAffinity = nodeAffinity
-		} else {
-			workloadObj.Spec.Template.Spec.Affinity = &corev1.Affinity{
-				NodeAffinity: nodeAffinity,
-			}
+		return hostnames, c.quantity
+	}
+	target := len(hostnames)
+	required := c.min
+	if c.percentage != 0 {
+		target = int(math.Ceil(float64(len(hostnames)) * float64(c.percentage) / 100))
+		// A percentage of no node is no node, which isn't what the percentage desires
+		if required == 0 {
+			required = 1
 		}
-		workloadObj.ObjectMeta.OwnerReferences = ownerReferences
-		//log.Printf("%s/Job/%s: %s", workloadObj.GetNamespace(), workloadObj.GetName(), nodeAffinity)
-		workloadCopy = workloadObj.DeepCopy()
-		//t.clientset.BatchV1().Jobs(sdCopy.GetNamespace()).Update(workloadCopy)
-	case batchv1beta.CronJob:
-		if len(nodeSelectorTermList) <= 0 && workloadObj.Spec.JobTemplate.Spec.Template.Spec.Affinity != nil {
-			workloadObj.Spec.JobTemplate.Spec.Template.Spec.Affinity.Reset()
-		} else if workloadObj.Spec.JobTemplate.Spec.Template.Spec.Affinity != nil {
-			workloadObj.Spec.JobTemplate.Spec.Template.Spec.Affinity.NodeAffinity = nodeAffinity
-		} else {
-			workloadObj.Spec.JobTemplate.Spec.Template.Spec.Affinity = &corev1.Affinity{
-				NodeAffinity: nodeAffinity,
-			}
+		if target < c.min {
+			target = c.min
 		}
-		workloadObj.ObjectMeta.OwnerReferences = ownerReferences
-		//log.Printf("%s/CronJob/%s: %s", workloadObj.GetNamespace(), workloadObj.GetName(), nodeAffinity)
-		workloadCopy = workloadObj.DeepCopy()
-		//t.clientset.BatchV1beta1().CronJob(sdCopy.GetNamespace()).Update(workloadCopy)
 	}
-	return workloadCopy, failureCount
+	if c.max != 0 && target > c.max {
+		target = c.max
+	}
+	if target > len(hostnames) {
+		target = len(hostnames)
+	}
+	return hostnames[0:target], required
 }
 
-// setFilter generates the values in the predefined form and puts those into the node selection fields of the selectivedeployment object
-func (t *SDHandler) setFilter(sdCopy *apps_v1alpha.SelectiveDeployment, event string) ([]corev1.NodeSelectorTerm, int) {
-	var nodeSelectorTermList []corev1.NodeSelectorTerm
+// preferredTerm turns the node selector term into a preferred scheduling term, whose weight is 1 by default
+func preferredTerm(nodeSelectorTerm corev1.NodeSelectorTerm, weight int32) corev1.PreferredSchedulingTerm {
+	if weight <= 0 {
+		weight = 1
+	}
+	return corev1.PreferredSchedulingTerm{Weight: weight, Preference: nodeSelectorTerm}
+}
+
+// matchNodes returns the hostnames of the nodes that satisfy the selector in the order of preference,
+// the value order for the In operator, or the distance for the nearest selector
+func (t *SDHandler) matchNodes(sdCopy *apps_v1alpha.SelectiveDeployment, selectorRow apps_v1alpha.Selector, nodeList []corev1.Node) ([]string, int) {
+	hostnames := []string{}
 	failureCounter := 0
-	for _, selectorRow := range sdCopy.Spec.Selector {
-		var matchExpression corev1.NodeSelectorRequirement
-		matchExpression.Values = []string{}
-		matchExpression.Operator = selectorRow.Operator
-		matchExpression.Key = "kubernetes.io/hostname"
-		selectorName := strings.ToLower(selectorRow.Name)
-		// Turn the key into the predefined form which is determined at the custom resource definition of selectivedeployment
-		switch selectorName {
-		case "city", "state", "country", "continent":
-			// If the event type is delete then we don't need to run the part below
-			if event != "delete" {
-				labelKeySuffix := ""
-				if selectorName == "state" || selectorName == "country" {
-					labelKeySuffix = "-iso"
-				}
-				labelKey := strings.ToLower(fmt.Sprintf("edge-net.io/%s%s", selectorName, labelKeySuffix))
-				// This gets the node list which includes the EdgeNet geolabels
-				nodesRaw, err := t.clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{FieldSelector: "spec.unschedulable!=true"})
-				if err != nil {
-					log.Println(err.Error())
-					panic(err.Error())
+	selectorName := strings.ToLower(selectorRow.Name)
+	// Turn the key into the predefined form which is determined at the custom resource definition of selectivedeployment
+	switch selectorName {
+	case "city", "state", "country", "continent", "asn", "asorg", "nat":
+		labelKey := nodeLabelKeys[selectorName]
+		// The values may be given as they are, such as an organization with spaces, or in the form of the labels
+		matches := func(selectorValue string, labelValue string) bool {
+			return selectorValue == labelValue || (labelValue != "" && node.LabelValue(selectorValue) == labelValue)
+		}
+		if selectorRow.Operator == "In" {
+			// This loop allows us to process each value defined at the object of selectivedeployment resource
+			for _, selectorValue := range selectorRow.Value {
+				// The loop to process each node separately
+				for _, nodeRow := range nodeList {
+					if matches(selectorValue, nodeRow.Labels[labelKey]) && !util.Contains(hostnames, nodeRow.Labels["kubernetes.io/hostname"]) {
+						hostnames = append(hostnames, nodeRow.Labels["kubernetes.io/hostname"])
+					}
 				}
-				counter := 0
-				// This loop allows us to process each value defined at the object of selectivedeployment resource
-			valueLoop:
+			}
+		} else if selectorRow.Operator == "NotIn" {
+		notInLoop:
+			for _, nodeRow := range nodeList {
 				for _, selectorValue := range selectorRow.Value {
-					// The loop to process each node separately
-					for _, nodeRow := range nodesRaw.Items {
-						taintBlock := false
-						for _, taint := range nodeRow.Spec.Taints {
-							if (taint.Key == "node-role.kubernetes.io/master" && taint.Effect == noSchedule) ||
-								(taint.Key == "node.kubernetes.io/unschedulable" && taint.Effect == noSchedule) {
-								taintBlock = true
-							}
-						}
-						conditionBlock := false
-						if node.GetConditionReadyStatus(nodeRow.DeepCopy()) != trueStr {
-							conditionBlock = true
-						}
-
-						if !conditionBlock && !taintBlock {
-							if util.Contains(matchExpression.Values, nodeRow.Labels["kubernetes.io/hostname"]) {
-								continue
-							}
-							if selectorValue == nodeRow.Labels[labelKey] && selectorRow.Operator == "In" {
-								matchExpression.Values = append(matchExpression.Values, nodeRow.Labels["kubernetes.io/hostname"])
-								counter++
-							} else if selectorValue != nodeRow.Labels[labelKey] && selectorRow.Operator == "NotIn" {
-								matchExpression.Values = append(matchExpression.Values, nodeRow.Labels["kubernetes.io/hostname"])
-								counter++
-							}
-							if selectorRow.Quantity != 0 && selectorRow.Quantity == counter {
-								break valueLoop
-							}
-						}
+					if matches(selectorValue, nodeRow.Labels[labelKey]) {
+						continue notInLoop
 					}
 				}
-				if selectorRow.Quantity != 0 && selectorRow.Quantity > counter {
-					strLen := 16
-					strSuffix := "..."
-					if len(selectorRow.Value) <= strLen {
-						strLen = len(selectorRow.Value)
-						strSuffix = ""
+				hostnames = append(hostnames, nodeRow.Labels["kubernetes.io/hostname"])
+			}
+		}
+	case "polygon", "radius":
+		// If the selectivedeployment key is polygon or radius then certain calculations like geofence need to be done
+		// for being had the list of nodes that the pods will be deployed on according to the desired state.
+		type area interface {
+			Contains(lon float64, lat float64) bool
+		}
+		areas := []area{}
+		for _, selectorValue := range selectorRow.Value {
+			var areaRow area
+			var err error
+			if selectorName == "polygon" {
+				// The value can be a bare ring as well as a GeoJSON geometry, feature, or feature collection
+				areaRow, err = node.ParseGeoJSON(selectorValue)
+			} else {
+				// The value is a center and a great-circle distance in kilometers
+				areaRow, err = node.ParseCircle(selectorValue)
+			}
+			if err != nil {
+				sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict[fmt.Sprintf("%s-err", selectorName)], shortenValue(selectorValue)))
+				failureCounter++
+				continue
+			}
+			areas = append(areas, areaRow)
+		}
+		if selectorRow.Operator == "In" {
+			// This loop allows us to process each area defined at the object of selectivedeployment resource
+			for _, areaRow := range areas {
+				for _, nodeRow := range nodeList {
+					if lat, lon, ok := node.GetNodeCoordinates(nodeRow.DeepCopy()); ok && areaRow.Contains(lon, lat) &&
+						!util.Contains(hostnames, nodeRow.Labels["kubernetes.io/hostname"]) {
+						hostnames = append(hostnames, nodeRow.Labels["kubernetes.io/hostname"])
 					}
-					sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["nodes-fewer"], counter, selectorRow.Quantity, selectorRow.Value[0:strLen], strSuffix))
-					failureCounter++
 				}
 			}
-		case "polygon":
-			// If the event type is delete then we don't need to run the GeoFence functions
-			if event != "delete" {
-				// If the selectivedeployment key is polygon then certain calculations like geofence need to be done
-				// for being had the list of nodes that the pods will be deployed on according to the desired state.
-				// This gets the node list which includes the EdgeNet geolabels
-				nodesRaw, err := t.clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{FieldSelector: "spec.unschedulable!=true"})
-				if err != nil {
-					log.Println(err.Error())
-					panic(err.Error())
+		} else if selectorRow.Operator == "NotIn" {
+		nodeLoop:
+			for _, nodeRow := range nodeList {
+				lat, lon, ok := node.GetNodeCoordinates(nodeRow.DeepCopy())
+				if !ok {
+					continue
 				}
-
-				var polygon [][]float64
-				// This loop allows us to process each polygon defined at the object of selectivedeployment resource
-				counter := 0
-			polyValueLoop:
-				for _, selectorValue := range selectorRow.Value {
-					err = json.Unmarshal([]byte(selectorValue), &polygon)
-					if err != nil {
-						strLen := 16
-						strSuffix := "..."
-						if len(selectorRow.Value) <= strLen {
-							strLen = len(selectorRow.Value)
-							strSuffix = ""
-						}
-						sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["GeoJSON-err"], selectorValue[0:strLen], strSuffix))
-						failureCounter++
-						continue
-					}
-					// The loop to process each node separately
-					for _, nodeRow := range nodesRaw.Items {
-						taintBlock := false
-						for _, taint := range nodeRow.Spec.Taints {
-							if (taint.Key == "node-role.kubernetes.io/master" && taint.Effect == noSchedule) ||
-								(taint.Key == "node.kubernetes.io/unschedulable" && taint.Effect == noSchedule) {
-								taintBlock = true
-							}
-						}
-						conditionBlock := false
-						for _, conditionRow := range nodeRow.Status.Conditions {
-							if conditionType := conditionRow.Type; conditionType == "Ready" {
-								if conditionRow.Status != trueStr {
-									conditionBlock = true
-								}
-							}
-						}
-						if !conditionBlock && !taintBlock {
-							if nodeRow.Labels["edge-net.io/lon"] != "" && nodeRow.Labels["edge-net.io/lat"] != "" {
-								if util.Contains(matchExpression.Values, nodeRow.Labels["kubernetes.io/hostname"]) {
-									continue
-								}
-								// Because of alphanumeric limitations of Kubernetes on the labels we use "w", "e", "n", and "s" prefixes
-								// at the labels of latitude and longitude. Here is the place those prefixes are dropped away.
-								lonStr := nodeRow.Labels["edge-net.io/lon"]
-								lonStr = string(lonStr[1:])
-								latStr := nodeRow.Labels["edge-net.io/lat"]
-								latStr = string(latStr[1:])
-								if lon, err := strconv.ParseFloat(lonStr, 64); err == nil {
-									if lat, err := strconv.ParseFloat(latStr, 64); err == nil {
-										// boundbox is a rectangle which provides to check whether the point is inside polygon
-										// without taking all point of the polygon into consideration
-										boundbox := node.Boundbox(polygon)
-										status := node.GeoFence(boundbox, polygon, lon, lat)
-										if status && selectorRow.Operator == "In" {
-											matchExpression.Values = append(matchExpression.Values, nodeRow.Labels["kubernetes.io/hostname"])
-											counter++
-										} else if !status && selectorRow.Operator == "NotIn" {
-											matchExpression.Values = append(matchExpression.Values, nodeRow.Labels["kubernetes.io/hostname"])
-											counter++
-										}
-									}
-								}
-							}
-							if selectorRow.Quantity != 0 && selectorRow.Quantity == counter {
-								break polyValueLoop
-							}
-						}
+				for _, areaRow := range areas {
+					if areaRow.Contains(lon, lat) {
+						continue nodeLoop
 					}
 				}
-				if selectorRow.Quantity != 0 && selectorRow.Quantity > counter {
-					strLen := 16
-					strSuffix := "..."
-					if len(selectorRow.Value) <= strLen {
-						strLen = len(selectorRow.Value)
-						strSuffix = ""
-					}
-					sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["nodes-fewer"], counter, selectorRow.Quantity, selectorRow.Value[0:strLen], strSuffix))
-					failureCounter++
+				hostnames = append(hostnames, nodeRow.Labels["kubernetes.io/hostname"])
+			}
+		}
+	case "nearest":
+		// The nearest selector sorts the nodes by their distance to the reference points
+		// to pick the closest ones instead of the first ones in the list
+		// A reference point is either a pair of latitude and longitude, or an IP address located by GeoLite
+		references := [][]float64{}
+		for _, selectorValue := range selectorRow.Value {
+			lat, lon, err := node.ParseReferencePoint(selectorValue)
+			if err != nil {
+				log.Println(err.Error())
+				sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["nearest-err"], shortenValue(selectorValue)))
+				failureCounter++
+				continue
+			}
+			references = append(references, []float64{lat, lon})
+		}
+		if len(references) == 0 || selectorRow.Operator != "In" {
+			break
+		}
+		type nodeDistance struct {
+			hostname string
+			distance float64
+		}
+		candidates := []nodeDistance{}
+		for _, nodeRow := range nodeList {
+			if lat, lon, ok := node.GetNodeCoordinates(nodeRow.DeepCopy()); ok {
+				// The distance to the closest reference point counts if there are more than one
+				distance := math.Inf(1)
+				for _, reference := range references {
+					distance = math.Min(distance, node.GreatCircleDistance(reference[0], reference[1], lat, lon))
 				}
+				candidates = append(candidates, nodeDistance{hostname: nodeRow.Labels["kubernetes.io/hostname"], distance: distance})
 			}
-		default:
-			matchExpression.Key = ""
 		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].distance < candidates[j].distance
+		})
+		for _, candidate := range candidates {
+			hostnames = append(hostnames, candidate.hostname)
+		}
+	}
+	return hostnames, failureCounter
+}
 
-		var nodeSelectorTerm corev1.NodeSelectorTerm
-		nodeSelectorTerm.MatchExpressions = append(nodeSelectorTerm.MatchExpressions, matchExpression)
-		nodeSelectorTermList = append(nodeSelectorTermList, nodeSelectorTerm)
+// labelRequirements collects the label selectors among the selectors given to match the nodes with
+func labelRequirements(sdCopy *apps_v1alpha.SelectiveDeployment, selectors []apps_v1alpha.Selector) ([]corev1.NodeSelectorRequirement, labels.Selector, int) {
+	labelExpressions := []corev1.NodeSelectorRequirement{}
+	nodeLabelSelector := labels.Everything()
+	failureCounter := 0
+	for _, selectorRow := range selectors {
+		if strings.ToLower(selectorRow.Name) != "label" {
+			continue
+		}
+		requirement, err := nodeSelectorRequirementAsLabel(selectorRow)
+		if err != nil {
+			log.Println(err.Error())
+			sdCopy.Status.Message = append(sdCopy.Status.Message, fmt.Sprintf(statusDict["label-err"], selectorRow.Key, err))
+			failureCounter++
+			continue
+		}
+		nodeLabelSelector = nodeLabelSelector.Add(*requirement)
+		labelExpressions = append(labelExpressions, corev1.NodeSelectorRequirement{
+			Key:      selectorRow.Key,
+			Operator: selectorRow.Operator,
+			Values:   selectorRow.Value,
+		})
+	}
+	return labelExpressions, nodeLabelSelector, failureCounter
+}
+
+// intersect returns the elements of the first slice that the second one also contains, in the order of the first one
+func intersect(first []string, second []string) []string {
+	intersection := []string{}
+	for _, element := range first {
+		if util.Contains(second, element) {
+			intersection = append(intersection, element)
+		}
 	}
-	return nodeSelectorTermList, failureCounter
+	return intersection
+}
+
+// shortenValue cuts the long selector values such as polygons to put them into the status messages
+func shortenValue(value string) string {
+	if len(value) <= 16 {
+		return value
+	}
+	return fmt.Sprintf("%s...", value[0:16])
+}
+
+// shortenValues cuts each of the selector values to put them into the status
+func shortenValues(values []string) []string {
+	shortValues := []string{}
+	for _, value := range values {
+		shortValues = append(shortValues, shortenValue(value))
+	}
+	return shortValues
+}
+
+// selectedNodes lists the nodes picked with their geolabels
+func selectedNodes(hostnames []string, nodeList []corev1.Node) []apps_v1alpha.SelectedNode {
+	nodes := []apps_v1alpha.SelectedNode{}
+	for _, hostname := range hostnames {
+		for _, nodeRow := range nodeList {
+			if nodeRow.Labels["kubernetes.io/hostname"] == hostname {
+				nodes = append(nodes, apps_v1alpha.SelectedNode{
+					Hostname:  hostname,
+					City:      nodeRow.Labels["edge-net.io/city"],
+					State:     nodeRow.Labels["edge-net.io/state-iso"],
+					Country:   nodeRow.Labels["edge-net.io/country-iso"],
+					Continent: nodeRow.Labels["edge-net.io/continent"],
+					Lat:       nodeRow.Labels["edge-net.io/lat"],
+					Lon:       nodeRow.Labels["edge-net.io/lon"],
+				})
+				break
+			}
+		}
+	}
+	return nodes
+}
+
+// fewerNodesMessage tells that the selector found fewer nodes than the quantity desired
+func fewerNodesMessage(counter int, quantity int, values []string) string {
+	strLen := 16
+	strSuffix := "..."
+	if len(values) <= strLen {
+		strLen = len(values)
+		strSuffix = ""
+	}
+	return fmt.Sprintf(statusDict["nodes-fewer"], counter, quantity, values[0:strLen], strSuffix)
+}
+
+// nodeSelectorRequirementAsLabel converts a label selector into a label requirement to match the nodes with
+func nodeSelectorRequirementAsLabel(selectorRow apps_v1alpha.Selector) (*labels.Requirement, error) {
+	var operator selection.Operator
+	switch selectorRow.Operator {
+	case corev1.NodeSelectorOpIn:
+		operator = selection.In
+	case corev1.NodeSelectorOpNotIn:
+		operator = selection.NotIn
+	case corev1.NodeSelectorOpExists:
+		operator = selection.Exists
+	case corev1.NodeSelectorOpDoesNotExist:
+		operator = selection.DoesNotExist
+	case corev1.NodeSelectorOpGt:
+		operator = selection.GreaterThan
+	case corev1.NodeSelectorOpLt:
+		operator = selection.LessThan
+	default:
+		return nil, fmt.Errorf("%q is not a valid operator", selectorRow.Operator)
+	}
+	return labels.NewRequirement(selectorRow.Key, operator, selectorRow.Value)
+}
+
+// fanOutLocation is a place that gets its own copies of the workloads in the fan-out mode
+type fanOutLocation struct {
+	suffix   string
+	selector []apps_v1alpha.Selector
+	groups   []apps_v1alpha.SelectorGroup
+}
+
+// fanOutLocations splits the selectors into locations, each value of a selector and each selector group is a location,
+// and the label selectors apply to all of them
+func fanOutLocations(sdCopy *apps_v1alpha.SelectiveDeployment) []fanOutLocation {
+	labelSelectors := []apps_v1alpha.Selector{}
+	for _, selectorRow := range sdCopy.Spec.Selector {
+		if strings.ToLower(selectorRow.Name) == "label" {
+			labelSelectors = append(labelSelectors, selectorRow)
+		}
+	}
+	locations := []fanOutLocation{}
+	suffixes := []string{}
+	addLocation := func(suffix string, selector []apps_v1alpha.Selector, groups []apps_v1alpha.SelectorGroup) {
+		// The same value may appear in more than one selector
+		uniqueSuffix := suffix
+		for i := 1; util.Contains(suffixes, uniqueSuffix); i++ {
+			uniqueSuffix = fmt.Sprintf("%s-%d", suffix, i)
+		}
+		suffixes = append(suffixes, uniqueSuffix)
+		locations = append(locations, fanOutLocation{suffix: uniqueSuffix, selector: selector, groups: groups})
+	}
+	for _, selectorRow := range sdCopy.Spec.Selector {
+		if strings.ToLower(selectorRow.Name) == "label" {
+			continue
+		}
+		for _, selectorValue := range selectorRow.Value {
+			locationSelector := selectorRow
+			locationSelector.Value = []string{selectorValue}
+			addLocation(locationSuffix(selectorRow.Name, selectorValue), append([]apps_v1alpha.Selector{locationSelector}, labelSelectors...), nil)
+		}
+	}
+	for i, groupRow := range sdCopy.Spec.SelectorGroups {
+		addLocation(fmt.Sprintf("group-%d", i), labelSelectors, []apps_v1alpha.SelectorGroup{groupRow})
+	}
+	return locations
+}
+
+// locationSuffix turns a selector value into a suffix to name the copies of the workloads,
+// the values of areas and reference points are too long to be read, so they are hashed
+func locationSuffix(selectorName string, selectorValue string) string {
+	selectorName = strings.ToLower(selectorName)
+	if _, exists := nodeLabelKeys[selectorName]; exists {
+		suffix := strings.Trim(regexp.MustCompile("[^a-z0-9]+").ReplaceAllString(strings.ToLower(selectorValue), "-"), "-")
+		// A bare number or boolean doesn't tell much
+		if selectorName == "asn" || selectorName == "nat" {
+			suffix = fmt.Sprintf("%s-%s", selectorName, suffix)
+		}
+		if len(suffix) > 30 {
+			suffix = strings.Trim(suffix[0:30], "-")
+		}
+		if suffix != "" {
+			return suffix
+		}
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(selectorValue))
+	return fmt.Sprintf("%s-%08x", selectorName, hash.Sum32())
+}
+
+// copyWorkloads makes the copies of the workloads for a location in the fan-out mode, the copies are named with the suffix
+// of the location and labeled to be told apart, including the selectors of their pods, and a replica count other than
+// zero overrides the one of the workloads
+func copyWorkloads(workloads []workload, sdName string, suffix string, replicas int32) []workload {
+	copyName := func(name string) string {
+		if len(name)+len(suffix)+1 > 63 {
+			name = name[0 : 63-len(suffix)-1]
+		}
+		return fmt.Sprintf("%s-%s", name, suffix)
+	}
+	locationLabels := map[string]string{fanOutLabel: sdName, fanOutLocationLabel: suffix}
+	workloadsCopy := []workload{}
+	for _, workloadRow := range workloads {
+		workloadCopy := workloadRow.deepCopy()
+		workloadCopy.object.SetName(copyName(workloadRow.name()))
+		if err := workloadCopy.setLabels(locationLabels); err != nil {
+			log.Printf("%s/%s: %s", workloadRow.kind(), workloadRow.name(), err)
+		}
+		if replicas != 0 {
+			if err := workloadCopy.setReplicas(replicas); err != nil {
+				log.Printf("%s/%s: %s", workloadRow.kind(), workloadRow.name(), err)
+			}
+		}
+		workloadsCopy = append(workloadsCopy, workloadCopy)
+	}
+	return workloadsCopy
+}
+
+// pruneWorkloads deletes the workloads that the selectivedeployment owns but no longer desires, such as the copies
+// whose location no longer exists, the copies left over by the fan-out mode, or the workloads it replaced. The workloads
+// of the kinds that the clientset serves are found in the owner index of their informers, whereas the generic workloads,
+// which no informer watches, are listed through the API server for the kinds in the spec. It tries every workload and
+// returns the first error, if any, for the event to be retried.
+func (t *SDHandler) pruneWorkloads(sdCopy *apps_v1alpha.SelectiveDeployment, workloads []workload, desiredWorkloads []workload) error {
+	propagationPolicy := metav1.DeletePropagationBackground
+	deleteOptions := metav1.DeleteOptions{PropagationPolicy: &propagationPolicy}
+	desiredNames := []string{}
+	for _, workloadRow := range desiredWorkloads {
+		desiredNames = append(desiredNames, fmt.Sprintf("%s/%s", workloadRow.kind(), workloadRow.name()))
+	}
+	var pruneErr error
+	prune := func(kindRow workload, workloadObj metav1.Object) {
+		if !isOwnedBy(sdCopy, workloadObj.GetOwnerReferences()) || util.Contains(desiredNames, fmt.Sprintf("%s/%s", kindRow.kind(), workloadObj.GetName())) {
+			return
+		}
+		err := t.workloadClient(kindRow, sdCopy.GetNamespace()).Delete(context.TODO(), workloadObj.GetName(), deleteOptions)
+		if err != nil && !errors.IsNotFound(err) && pruneErr == nil {
+			pruneErr = fmt.Errorf("pruning %s/%s failed: %s", kindRow.kind(), workloadObj.GetName(), err)
+		}
+	}
+	// The workloads out of the fan-out mode have no label to tell their owner, so the owner references are checked.
+	// Every kind that the clientset serves is looked through so that the workloads of a kind removed from the spec go away as well.
+	for _, kindRow := range typedKinds {
+		indexer, exists := t.workloadIndexers[kindRow.gvk.Kind]
+		if !exists {
+			continue
+		}
+		object := &unstructured.Unstructured{}
+		object.SetGroupVersionKind(kindRow.gvk)
+		workloadRaw, err := indexer.ByIndex(ownerIndex, fmt.Sprintf("%s/%s", sdCopy.GetNamespace(), sdCopy.GetName()))
+		if err != nil {
+			return err
+		}
+		for _, workloadRow := range workloadRaw {
+			if workloadObj, err := meta.Accessor(workloadRow); err == nil {
+				prune(workload{object: object, typed: true}, workloadObj)
+			}
+		}
+	}
+	resources := []string{}
+	for _, workloadRow := range workloads {
+		if workloadRow.typed || util.Contains(resources, workloadRow.resource.String()) {
+			continue
+		}
+		resources = append(resources, workloadRow.resource.String())
+		workloadRaw, err := t.workloadClient(workloadRow, sdCopy.GetNamespace()).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			if pruneErr == nil {
+				pruneErr = fmt.Errorf("listing %s failed: %s", workloadRow.resource.Resource, err)
+			}
+			continue
+		}
+		for i := range workloadRaw.Items {
+			prune(workloadRow, &workloadRaw.Items[i])
+		}
+	}
+	return pruneErr
+}
+
+// isNodeAvailable checks whether the node is ready and free of the taints that block scheduling
+func isNodeAvailable(nodeRow *corev1.Node) bool {
+	for _, taint := range nodeRow.Spec.Taints {
+		if (taint.Key == "node-role.kubernetes.io/master" && taint.Effect == noSchedule) ||
+			(taint.Key == "node.kubernetes.io/unschedulable" && taint.Effect == noSchedule) {
+			return false
+		}
+	}
+	return node.GetConditionReadyStatus(nodeRow) == trueStr
 }
 
 // SetAsOwnerReference returns the authority as owner
@@ -613,6 +1240,27 @@ func SetAsOwnerReference(sdCopy *apps_v1alpha.SelectiveDeployment) []metav1.Owne
 	return ownerReferences
 }
 
+// isOwnedBy checks whether the selectivedeployment is among the owners of the workload
+func isOwnedBy(sdCopy *apps_v1alpha.SelectiveDeployment, ownerReferences []metav1.OwnerReference) bool {
+	for _, reference := range ownerReferences {
+		if reference.Kind == "SelectiveDeployment" && reference.Name == sdCopy.GetName() && reference.UID == sdCopy.GetUID() {
+			return true
+		}
+	}
+	return false
+}
+
+// removeOwnerReference returns the owner references of the workload without the selectivedeployment
+func removeOwnerReference(sdCopy *apps_v1alpha.SelectiveDeployment, ownerReferences []metav1.OwnerReference) []metav1.OwnerReference {
+	remainingReferences := []metav1.OwnerReference{}
+	for _, reference := range ownerReferences {
+		if !(reference.Kind == "SelectiveDeployment" && reference.UID == sdCopy.GetUID()) {
+			remainingReferences = append(remainingReferences, reference)
+		}
+	}
+	return remainingReferences
+}
+
 func checkOwnerReferences(sdCopy *apps_v1alpha.SelectiveDeployment, ownerReferences []metav1.OwnerReference) bool {
 	underControl := false
 	for _, reference := range ownerReferences {
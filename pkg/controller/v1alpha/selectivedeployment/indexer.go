@@ -0,0 +1,216 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selectivedeployment
+
+// The node and workload events need to find the selectivedeployments concerned. Instead of listing every
+// workload and every selectivedeployment in the cluster through the API server on each event, the informers
+// index their caches by the following keys when an object is added or updated:
+//
+//   - hostnameIndex maps a node name to the workloads whose node affinity pins that node,
+//   - ownerIndex maps a selectivedeployment to the workloads that it owns, which it prunes once it no longer desires them,
+//   - recoveryIndex gathers the selectivedeployments with recovery enabled which are partially running or failed,
+//     or whose selectors desire a percentage or a range of nodes,
+//   - genericIndex maps a node name to the selectivedeployments with generic workloads that selected the node,
+//     as no informer watches the generic kinds to index their node affinity.
+//
+// A lookup is then a map access on the local cache, whose cost depends on the number of objects matched rather
+// than on the number of workloads in the cluster. With thousands of workloads, a node event costs one lookup
+// per workload kind and no API round-trip; the memory used by the indexes is proportional to the hostnames
+// pinned by the affinities, which the informers already hold in their caches. Likewise, a reconcile reads the nodes
+// from the cache of the node informer once, and the workloads and the locations of the fan-out mode select theirs out of it.
+
+import (
+	"fmt"
+
+	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
+	"github.com/EdgeNet-project/edgenet/pkg/util"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+)
+
+// The names of the indexes that the informers of the controller hold
+const hostnameIndex = "hostname"
+const ownerIndex = "owner"
+const recoveryIndex = "recovery"
+const genericIndex = "generic"
+
+// workloadIndexers is used by the informers of the workload kinds
+var workloadIndexers = cache.Indexers{
+	hostnameIndex: indexByHostname,
+	ownerIndex:    indexByOwner,
+}
+
+// sdIndexers is used by the selectivedeployment informer
+var sdIndexers = cache.Indexers{
+	recoveryIndex: indexByRecovery,
+	genericIndex:  indexGenericByHostname,
+}
+
+// indexByHostname returns the hostnames in the node affinity of the workload's pod template
+func indexByHostname(obj interface{}) ([]string, error) {
+	var podSpec corev1.PodSpec
+	switch workloadObj := obj.(type) {
+	case *appsv1.Deployment:
+		podSpec = workloadObj.Spec.Template.Spec
+	case *appsv1.DaemonSet:
+		podSpec = workloadObj.Spec.Template.Spec
+	case *appsv1.StatefulSet:
+		podSpec = workloadObj.Spec.Template.Spec
+	case *batchv1.Job:
+		podSpec = workloadObj.Spec.Template.Spec
+	case *batchv1beta.CronJob:
+		podSpec = workloadObj.Spec.JobTemplate.Spec.Template.Spec
+	default:
+		return nil, fmt.Errorf("%T is not a workload kind of selectivedeployment", obj)
+	}
+	hostnames := []string{}
+	if podSpec.Affinity == nil || podSpec.Affinity.NodeAffinity == nil {
+		return hostnames, nil
+	}
+	// Both the required and the preferred terms pin nodes
+	nodeSelectorTerms := []corev1.NodeSelectorTerm{}
+	if podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		nodeSelectorTerms = append(nodeSelectorTerms, podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms...)
+	}
+	for _, preferredRow := range podSpec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		nodeSelectorTerms = append(nodeSelectorTerms, preferredRow.Preference)
+	}
+	for _, nodeSelectorTerm := range nodeSelectorTerms {
+		for _, matchExpression := range nodeSelectorTerm.MatchExpressions {
+			if matchExpression.Key == "kubernetes.io/hostname" && matchExpression.Operator == corev1.NodeSelectorOpIn {
+				for _, hostname := range matchExpression.Values {
+					if !util.Contains(hostnames, hostname) {
+						hostnames = append(hostnames, hostname)
+					}
+				}
+			}
+		}
+	}
+	return hostnames, nil
+}
+
+// indexByOwner returns the namespaced names of the selectivedeployments in the owner references of the workload
+func indexByOwner(obj interface{}) ([]string, error) {
+	workloadObj, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	owners := []string{}
+	for _, owner := range workloadObj.GetOwnerReferences() {
+		if owner.Kind == "SelectiveDeployment" {
+			owners = append(owners, fmt.Sprintf("%s/%s", workloadObj.GetNamespace(), owner.Name))
+		}
+	}
+	return owners, nil
+}
+
+// indexByRecovery puts the selectivedeployments that may take a node coming up into account under the same key
+func indexByRecovery(obj interface{}) ([]string, error) {
+	sdObj, ok := obj.(*apps_v1alpha.SelectiveDeployment)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a selectivedeployment", obj)
+	}
+	if sdObj.Spec.Recovery && (sdObj.Status.State == partial || sdObj.Status.State == failure || hasNodeRange(sdObj)) {
+		return []string{trueStr}, nil
+	}
+	return []string{}, nil
+}
+
+// indexGenericByHostname returns the hostnames of the nodes that the selectivedeployment selected if it has generic workloads
+func indexGenericByHostname(obj interface{}) ([]string, error) {
+	sdObj, ok := obj.(*apps_v1alpha.SelectiveDeployment)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a selectivedeployment", obj)
+	}
+	hostnames := []string{}
+	if len(sdObj.Spec.Workloads.Generic) == 0 {
+		return hostnames, nil
+	}
+	for _, selectorRow := range sdObj.Status.Selectors {
+		for _, nodeRow := range selectorRow.Nodes {
+			if !util.Contains(hostnames, nodeRow.Hostname) {
+				hostnames = append(hostnames, nodeRow.Hostname)
+			}
+		}
+	}
+	return hostnames, nil
+}
+
+// hasNodeRange tells whether a selector desires a percentage or a range of nodes, which may grow even though
+// the selectivedeployment is running as its minimum is met
+func hasNodeRange(sdObj *apps_v1alpha.SelectiveDeployment) bool {
+	for _, selectorRow := range sdObj.Spec.Selector {
+		if selectorRow.Percentage != 0 || selectorRow.MinQuantity != 0 || selectorRow.MaxQuantity != 0 {
+			return true
+		}
+	}
+	for _, groupRow := range sdObj.Spec.SelectorGroups {
+		if groupRow.Percentage != 0 || groupRow.MinQuantity != 0 || groupRow.MaxQuantity != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// getByNode generates selectivedeployment list from the owner references of workloads which pin the node that has an event (add/update/delete)
+func getByNode(indexers []cache.Indexer, nodeName string) ([][]string, bool) {
+	ownerList := [][]string{}
+	status := false
+	for _, indexer := range indexers {
+		workloads, err := indexer.ByIndex(hostnameIndex, nodeName)
+		if err != nil {
+			continue
+		}
+		for _, workloadRow := range workloads {
+			workloadObj, err := meta.Accessor(workloadRow)
+			if err != nil {
+				continue
+			}
+			for _, owner := range workloadObj.GetOwnerReferences() {
+				if owner.Kind == "SelectiveDeployment" {
+					ownerDet := []string{workloadObj.GetNamespace(), owner.Name}
+					if !util.SliceContains(ownerList, ownerDet) {
+						ownerList = append(ownerList, ownerDet)
+					}
+					status = true
+				}
+			}
+		}
+	}
+	return ownerList, status
+}
+
+// getGenericByNode adds the selectivedeployments with generic workloads that selected the node to the owner list
+func getGenericByNode(indexer cache.Indexer, nodeName string, ownerList [][]string) ([][]string, bool) {
+	sdRaw, err := indexer.ByIndex(genericIndex, nodeName)
+	if err != nil {
+		return ownerList, len(ownerList) != 0
+	}
+	for _, sdRow := range sdRaw {
+		sdObj := sdRow.(*apps_v1alpha.SelectiveDeployment)
+		ownerDet := []string{sdObj.GetNamespace(), sdObj.GetName()}
+		if !util.SliceContains(ownerList, ownerDet) {
+			ownerList = append(ownerList, ownerDet)
+		}
+	}
+	return ownerList, len(ownerList) != 0
+}
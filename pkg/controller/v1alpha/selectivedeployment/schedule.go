@@ -0,0 +1,141 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selectivedeployment
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
+	"github.com/EdgeNet-project/edgenet/pkg/node"
+	"github.com/EdgeNet-project/edgenet/pkg/schedule"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// now is the clock that the schedules follow, the tests replace it
+var now = time.Now
+
+// scheduleOpen tells whether a window of the schedule is open, otherwise it returns the time the next window opens,
+// which is zero if none opens again
+func scheduleOpen(sdSchedule *apps_v1alpha.Schedule, t time.Time) (bool, time.Time, error) {
+	if sdSchedule == nil || len(sdSchedule.Windows) == 0 {
+		return true, time.Time{}, nil
+	}
+	var nextOpening time.Time
+	for _, windowRow := range sdSchedule.Windows {
+		window, err := schedule.ParseWindow(windowRow.Cron, windowRow.Duration)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("window %q: %s", windowRow.Cron, err)
+		}
+		if window.IsOpen(t) {
+			return true, time.Time{}, nil
+		}
+		if next, ok := window.NextOpening(t); ok && (nextOpening.IsZero() || next.Before(nextOpening)) {
+			nextOpening = next
+		}
+	}
+	return false, nextOpening, nil
+}
+
+// localTimeFilter returns a function which keeps the nodes whose local time is within the range of the schedule,
+// the nodes without coordinates are left out as their local time is unknown
+func localTimeFilter(sdSchedule *apps_v1alpha.Schedule, t time.Time) (func(*corev1.Node) bool, error) {
+	if sdSchedule == nil || sdSchedule.LocalTime == nil {
+		return func(*corev1.Node) bool { return true }, nil
+	}
+	from, err := schedule.ParseClock(sdSchedule.LocalTime.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := schedule.ParseClock(sdSchedule.LocalTime.To)
+	if err != nil {
+		return nil, err
+	}
+	return func(nodeRow *corev1.Node) bool {
+		_, lon, ok := node.GetNodeCoordinates(nodeRow)
+		return ok && schedule.LocalClock(lon, t).Within(from, to)
+	}, nil
+}
+
+// scheduleSignature sums up the effect of the schedule at the time given, whether it is open and which nodes are
+// in its local time range, so that a change tells that the placement needs to be evaluated again
+func scheduleSignature(sdSchedule *apps_v1alpha.Schedule, nodes []interface{}, t time.Time) string {
+	open, _, err := scheduleOpen(sdSchedule, t)
+	if err != nil {
+		return "invalid"
+	}
+	inLocalTime, err := localTimeFilter(sdSchedule, t)
+	if err != nil || sdSchedule.LocalTime == nil {
+		return fmt.Sprintf("%t", open)
+	}
+	hostnames := []string{}
+	for _, nodeRaw := range nodes {
+		if nodeRow, ok := nodeRaw.(*corev1.Node); ok && inLocalTime(nodeRow) {
+			hostnames = append(hostnames, nodeRow.GetName())
+		}
+	}
+	sort.Strings(hostnames)
+	return fmt.Sprintf("%t/%s", open, strings.Join(hostnames, ","))
+}
+
+// seedSchedule takes the signature of the schedule of the selectivedeployment that the handler is about to evaluate,
+// so that the next check compares against the placement that the handler makes rather than the first check
+// taking it for granted
+func (c *controller) seedSchedule(key string, item interface{}) {
+	sdObj, ok := item.(*apps_v1alpha.SelectiveDeployment)
+	if !ok || sdObj.Spec.Schedule == nil {
+		return
+	}
+	signature := scheduleSignature(sdObj.Spec.Schedule, c.nodeInformer.GetStore().List(), now())
+	c.scheduleLock.Lock()
+	defer c.scheduleLock.Unlock()
+	if c.scheduleSignatures == nil {
+		c.scheduleSignatures = make(map[string]string)
+	}
+	c.scheduleSignatures[key] = signature
+}
+
+// checkSchedules puts the selectivedeployments whose windows opened or closed, or whose nodes entered or left
+// the local time range since they were last evaluated into the queue
+func (c *controller) checkSchedules() {
+	nodes := c.nodeInformer.GetStore().List()
+	current := now()
+	c.scheduleLock.Lock()
+	defer c.scheduleLock.Unlock()
+	signatures := make(map[string]string)
+	for _, sdRaw := range c.informer.GetStore().List() {
+		sdObj := sdRaw.(*apps_v1alpha.SelectiveDeployment)
+		if sdObj.Spec.Schedule == nil || sdObj.GetDeletionTimestamp() != nil {
+			continue
+		}
+		key, err := cache.MetaNamespaceKeyFunc(sdObj)
+		if err != nil {
+			continue
+		}
+		signatures[key] = scheduleSignature(sdObj.Spec.Schedule, nodes, current)
+		// A selectivedeployment without a signature waits in the queue for the handler, which evaluates it at its turn
+		if previous, ok := c.scheduleSignatures[key]; ok && previous != signatures[key] {
+			c.logger.Infof("Schedule of %s changed, placement evaluated again", key)
+			c.queue.Add(informerevent{key: key, function: update})
+		}
+	}
+	c.scheduleSignatures = signatures
+}
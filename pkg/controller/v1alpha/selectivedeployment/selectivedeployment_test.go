@@ -2,14 +2,20 @@ package selectivedeployment
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
 	"github.com/EdgeNet-project/edgenet/pkg/generated/clientset/versioned"
 	edgenettestclient "github.com/EdgeNet-project/edgenet/pkg/generated/clientset/versioned/fake"
+	"github.com/EdgeNet-project/edgenet/pkg/keyqueue"
 	"github.com/EdgeNet-project/edgenet/pkg/util"
 	"github.com/sirupsen/logrus"
 
@@ -17,15 +23,27 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	batchv1beta "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+	dynamictestclient "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes"
 	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 )
 
 type TestGroup struct {
 	client         kubernetes.Interface
 	edgenetClient  versioned.Interface
+	dynamicClient  dynamic.Interface
 	sdObj          apps_v1alpha.SelectiveDeployment
 	selector       apps_v1alpha.Selector
 	deploymentObj  appsv1.Deployment
@@ -35,6 +53,9 @@ type TestGroup struct {
 	cronjobObj     batchv1beta.CronJob
 	nodeObj        corev1.Node
 	handler        SDHandler
+	// The cache that the node informer would hold, which follows the nodes of the client
+	nodeIndexer      cache.Indexer
+	workloadIndexers map[string]cache.Indexer
 }
 
 func TestMain(m *testing.M) {
@@ -321,7 +342,39 @@ func (g *TestGroup) Init() {
 	g.selector = selectorObj
 	g.sdObj = sdObj
 	g.client = testclient.NewSimpleClientset()
+	g.nodeIndexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	mirror(g.client.(*testclient.Clientset), "nodes", g.nodeIndexer)
+	g.workloadIndexers = map[string]cache.Indexer{}
+	for _, kindRow := range typedKinds {
+		g.workloadIndexers[kindRow.gvk.Kind] = cache.NewIndexer(cache.MetaNamespaceKeyFunc, workloadIndexers)
+		mirror(g.client.(*testclient.Clientset), kindRow.resource, g.workloadIndexers[kindRow.gvk.Kind])
+	}
 	g.edgenetClient = edgenettestclient.NewSimpleClientset()
+	g.dynamicClient = dynamictestclient.NewSimpleDynamicClient(runtime.NewScheme())
+}
+
+// mirror keeps the indexer in line with the objects of the resource that the client serves, as an informer would
+func mirror(client *testclient.Clientset, resource string, indexer cache.Indexer) {
+	react := k8stesting.ObjectReaction(client.Tracker())
+	client.PrependReactor("*", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		handled, obj, err := react(action)
+		if err != nil {
+			return handled, obj, err
+		}
+		// A get action has a name as well, so the verb tells the actions apart
+		switch action.GetVerb() {
+		case "create", "update", "patch":
+			indexer.Add(obj)
+		case "delete":
+			deleteAction := action.(k8stesting.DeleteAction)
+			key := deleteAction.GetName()
+			if deleteAction.GetNamespace() != "" {
+				key = fmt.Sprintf("%s/%s", deleteAction.GetNamespace(), deleteAction.GetName())
+			}
+			indexer.Delete(cache.ExplicitKey(key))
+		}
+		return handled, obj, err
+	})
 }
 
 // TestHandlerInit for handler initialization
@@ -330,15 +383,18 @@ func TestHandlerInit(t *testing.T) {
 	g := TestGroup{}
 	g.Init()
 	// Initialize the handler
-	g.handler.Init(g.client, g.edgenetClient)
+	g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+	g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
 	util.Equals(t, g.client, g.handler.clientset)
 	util.Equals(t, g.edgenetClient, g.handler.edgenetClientset)
+	util.Equals(t, g.dynamicClient, g.handler.dynamicClientset)
 }
 
 func TestCreate(t *testing.T) {
 	g := TestGroup{}
 	g.Init()
-	g.handler.Init(g.client, g.edgenetClient)
+	g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+	g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
 	// Creating nodes
 	nodeParis := g.nodeObj
 	nodeParis.SetName("edgenet.planet-lab.eu")
@@ -424,6 +480,16 @@ func TestCreate(t *testing.T) {
 		util.Equals(t, statusDict["sd-success"], sdCopy.Status.Message[0])
 		util.Equals(t, "10/10", sdCopy.Status.Ready)
 	})
+	t.Run("structured status", func(t *testing.T) {
+		util.Equals(t, 10, len(sdCopy.Status.Workloads))
+		util.Equals(t, 1, len(sdCopy.Status.Selectors))
+		util.Equals(t, []apps_v1alpha.SelectedNode{{Hostname: nodeParis.GetName(), City: "Paris", State: "IDF", Country: "FR", Continent: "Europe", Lat: "n48.86", Lon: "e2.34"}},
+			sdCopy.Status.Selectors[0].Nodes)
+		util.Equals(t, metav1.ConditionTrue, meta.FindStatusCondition(sdCopy.Status.Conditions, "Applied").Status)
+		util.Equals(t, metav1.ConditionTrue, meta.FindStatusCondition(sdCopy.Status.Conditions, "Scheduled").Status)
+		// The fake clientset doesn't run any pod
+		util.Equals(t, "PodsNotReady", meta.FindStatusCondition(sdCopy.Status.Conditions, "Ready").Reason)
+	})
 	g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Create(context.TODO(), sdRepeatedObj.DeepCopy(), metav1.CreateOptions{})
 	g.handler.ObjectCreated(sdRepeatedObj.DeepCopy())
 	sdRepeatedCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdRepeatedObj.GetName(), metav1.GetOptions{})
@@ -431,6 +497,8 @@ func TestCreate(t *testing.T) {
 		util.OK(t, err)
 		util.Equals(t, failure, sdRepeatedCopy.Status.State)
 		util.Equals(t, "0/5", sdRepeatedCopy.Status.Ready)
+		util.Equals(t, 0, len(sdRepeatedCopy.Status.Workloads))
+		util.Equals(t, "WorkloadsFailed", meta.FindStatusCondition(sdRepeatedCopy.Status.Conditions, "Applied").Reason)
 	})
 	g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Create(context.TODO(), sdPartiallyRepeatedObj.DeepCopy(), metav1.CreateOptions{})
 	g.handler.ObjectCreated(sdPartiallyRepeatedObj.DeepCopy())
@@ -451,7 +519,7 @@ func TestCreate(t *testing.T) {
 		"create/daemonset":       {"DaemonSet", g.sdObj.Spec.Workloads.DaemonSet[0].GetName(), nodeParis.GetName()},
 		"configure/statefulset":  {"StatefulSet", statefulsetCreated.GetName(), nodeParis.GetName()},
 		"create/statefulset":     {"StatefulSet", g.sdObj.Spec.Workloads.StatefulSet[0].GetName(), nodeParis.GetName()},
-		"configure/job":          {"Job", jobCreated.GetName(), nodeParis.GetName()},
+		"configure/job":          {"Job", jobCreated.GetName(), ""}, // The pod template of a job in place is immutable
 		"create/job":             {"Job", g.sdObj.Spec.Workloads.Job[0].GetName(), nodeParis.GetName()},
 		"configure/cronjob":      {"CronJob", cronjobCreated.GetName(), nodeParis.GetName()},
 		"create/cronjob":         {"CronJob", g.sdObj.Spec.Workloads.CronJob[0].GetName(), nodeParis.GetName()},
@@ -513,7 +581,8 @@ func TestCreate(t *testing.T) {
 func TestUpdate(t *testing.T) {
 	g := TestGroup{}
 	g.Init()
-	g.handler.Init(g.client, g.edgenetClient)
+	g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+	g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
 	// Creating nodes
 	nodeParis := g.nodeObj
 	nodeParis.SetName("edgenet.planet-lab.eu")
@@ -644,6 +713,46 @@ func TestUpdate(t *testing.T) {
 	paris.Quantity = 1
 	paris.Name = "Polygon"
 	polygonParis := []apps_v1alpha.Selector{paris}
+	parisFeature := g.selector
+	parisFeature.Value = []string{`{"type": "FeatureCollection", "features": [{"type": "Feature", "properties": {"name": "Paris"}, "geometry": {"type": "Polygon", "coordinates": [[[2.2150567, 48.8947616], [2.2040704, 48.8084639], [2.3393396, 48.7835862], [2.4519494, 48.8416903], [2.3932412, 48.9171024], [2.2150567, 48.8947616]]]}}]}`}
+	parisFeature.Quantity = 1
+	parisFeature.Name = "Polygon"
+	polygonParisFeature := []apps_v1alpha.Selector{parisFeature}
+
+	parisRadius := g.selector
+	parisRadius.Value = []string{"48.8566, 2.3522, 50"}
+	parisRadius.Quantity = 1
+	parisRadius.Name = "Radius"
+	radiusParis := []apps_v1alpha.Selector{parisRadius}
+	usRadius := g.selector
+	usRadius.Value = []string{"36.6, -121.8, 100km", "32.8, -96.8, 100km"}
+	usRadius.Quantity = 2
+	usRadius.Name = "Radius"
+	radiusUS := []apps_v1alpha.Selector{usRadius}
+
+	washington := g.selector
+	washington.Value = []string{"38.9072, -77.0369"}
+	washington.Quantity = 2
+	washington.Name = "Nearest"
+	nearestWashington := []apps_v1alpha.Selector{washington}
+	washington.Quantity = 4
+	nearestWashingtonFewer := []apps_v1alpha.Selector{washington}
+	parisNearest := g.selector
+	parisNearest.Value = []string{"48.8566, 2.3522"}
+	parisNearest.Quantity = 1
+	parisNearest.Name = "Nearest"
+	nearestParis := []apps_v1alpha.Selector{parisNearest}
+
+	usLabel := g.selector
+	usLabel.Name = "Label"
+	usLabel.Key = "edge-net.io/country-iso"
+	usLabel.Value = []string{"US"}
+	usLabel.Quantity = 0
+	nearestParisUS := []apps_v1alpha.Selector{parisNearest, usLabel}
+	stateLabel := usLabel
+	stateLabel.Key = "edge-net.io/state-iso"
+	stateLabel.Value = []string{"CA"}
+	labelCA := []apps_v1alpha.Selector{stateLabel}
 
 	countryUScityParis := []apps_v1alpha.Selector{us, paris}
 
@@ -657,18 +766,26 @@ func TestUpdate(t *testing.T) {
 		expectedStatus string
 		expected       [][]string
 	}{
-		"city/seaside":          {citySeaside, success, [][]string{[]string{nodeSeaside.GetName()}}},
-		"polygon/paris":         {polygonParis, success, [][]string{[]string{nodeParis.GetName()}}},
-		"state/ca":              {stateCA, success, [][]string{[]string{nodeSeaside.GetName()}}},
-		"country/us":            {countryUS, success, [][]string{[]string{nodeSeaside.GetName()}}},
-		"country/us/all":        {countryUSAll, success, [][]string{[]string{nodeSeaside.GetName(), nodeRichardson.GetName()}}},
-		"country/us/out":        {countryUSOut, success, [][]string{[]string{nodeParis.GetName()}}},
-		"continent/europe":      {continentEU, success, [][]string{[]string{nodeParis.GetName()}}},
-		"country/us-eu/1":       {countryUSEU1, success, [][]string{[]string{nodeSeaside.GetName(), nodeRichardson.GetName()}}},
-		"country/us-eu/2":       {countryUSEU2, success, [][]string{[]string{nodeSeaside.GetName()}, []string{nodeParis.GetName()}}},
-		"country/us|city/paris": {countryUScityParis, success, [][]string{[]string{nodeSeaside.GetName()}, []string{nodeParis.GetName()}}},
-		"polygon/paris/fewer":   {polygonParisFewer, failure, [][]string{[]string{nodeParis.GetName()}}},
-		"country/us/fewer":      {countryUSFewer, failure, [][]string{[]string{nodeSeaside.GetName(), nodeRichardson.GetName()}}},
+		"city/seaside":           {citySeaside, success, [][]string{[]string{nodeSeaside.GetName()}}},
+		"polygon/paris":          {polygonParis, success, [][]string{[]string{nodeParis.GetName()}}},
+		"polygon/paris/geojson":  {polygonParisFeature, success, [][]string{[]string{nodeParis.GetName()}}},
+		"radius/paris":           {radiusParis, success, [][]string{[]string{nodeParis.GetName()}}},
+		"radius/us":              {radiusUS, success, [][]string{[]string{nodeSeaside.GetName(), nodeRichardson.GetName()}}},
+		"nearest/paris":          {nearestParis, success, [][]string{[]string{nodeParis.GetName()}}},
+		"nearest/washington":     {nearestWashington, success, [][]string{[]string{nodeRichardson.GetName(), nodeSeaside.GetName()}}},
+		"nearest/fewer":          {nearestWashingtonFewer, failure, [][]string{[]string{nodeRichardson.GetName(), nodeSeaside.GetName(), nodeParis.GetName()}}},
+		"nearest/paris|label/us": {nearestParisUS, success, [][]string{[]string{nodeRichardson.GetName()}}},
+		"label/ca":               {labelCA, success, [][]string{[]string{"CA"}}},
+		"state/ca":               {stateCA, success, [][]string{[]string{nodeSeaside.GetName()}}},
+		"country/us":             {countryUS, success, [][]string{[]string{nodeSeaside.GetName()}}},
+		"country/us/all":         {countryUSAll, success, [][]string{[]string{nodeSeaside.GetName(), nodeRichardson.GetName()}}},
+		"country/us/out":         {countryUSOut, success, [][]string{[]string{nodeParis.GetName()}}},
+		"continent/europe":       {continentEU, success, [][]string{[]string{nodeParis.GetName()}}},
+		"country/us-eu/1":        {countryUSEU1, success, [][]string{[]string{nodeSeaside.GetName(), nodeRichardson.GetName()}}},
+		"country/us-eu/2":        {countryUSEU2, success, [][]string{[]string{nodeSeaside.GetName()}, []string{nodeParis.GetName()}}},
+		"country/us|city/paris":  {countryUScityParis, success, [][]string{[]string{nodeSeaside.GetName()}, []string{nodeParis.GetName()}}},
+		"polygon/paris/fewer":    {polygonParisFewer, failure, [][]string{[]string{nodeParis.GetName()}}},
+		"country/us/fewer":       {countryUSFewer, failure, [][]string{[]string{nodeSeaside.GetName(), nodeRichardson.GetName()}}},
 	}
 	for k, tc := range cases {
 		t.Run(k, func(t *testing.T) {
@@ -699,13 +816,11 @@ func TestUpdate(t *testing.T) {
 					expected,
 					statefulsetCopy.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[k].MatchExpressions[0].Values)
 			}
-			jobCopy, err := g.client.BatchV1().Jobs("").Get(context.TODO(), jobCopy.GetName(), metav1.GetOptions{})
+			// The pod template of a job is immutable, so the job keeps the node affinity it was created with
+			jobUpdated, err := g.client.BatchV1().Jobs("").Get(context.TODO(), jobCopy.GetName(), metav1.GetOptions{})
 			util.OK(t, err)
-			for l, expected := range tc.expected {
-				util.Equals(t,
-					expected,
-					jobCopy.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[l].MatchExpressions[0].Values)
-			}
+			util.Equals(t, jobCopy.Spec.Template.Spec.Affinity, jobUpdated.Spec.Template.Spec.Affinity)
+			util.Equals(t, SetAsOwnerReference(sdObj), jobUpdated.GetOwnerReferences())
 			cronjobCopy, err := g.client.BatchV1beta1().CronJobs("").Get(context.TODO(), cronjobCopy.GetName(), metav1.GetOptions{})
 			util.OK(t, err)
 			for m, expected := range tc.expected {
@@ -716,6 +831,44 @@ func TestUpdate(t *testing.T) {
 		})
 	}
 
+	t.Run("selector groups", func(t *testing.T) {
+		usIn := apps_v1alpha.Selector{Name: "Country", Value: []string{"US"}, Operator: "In"}
+		frIn := apps_v1alpha.Selector{Name: "Country", Value: []string{"FR"}, Operator: "In"}
+		caNotIn := apps_v1alpha.Selector{Name: "State", Value: []string{"CA"}, Operator: "NotIn"}
+		northAmericaIn := apps_v1alpha.Selector{Name: "Continent", Value: []string{"North America"}, Operator: "In"}
+		montereyBay := apps_v1alpha.Selector{Name: "Radius", Value: []string{"36.6, -121.8, 100"}, Operator: "In"}
+		dallas := apps_v1alpha.Selector{Name: "Nearest", Value: []string{"32.8, -96.8"}, Operator: "In"}
+
+		cases := map[string]struct {
+			input          []apps_v1alpha.SelectorGroup
+			expectedStatus string
+			expected       [][]string
+		}{
+			"and":      {[]apps_v1alpha.SelectorGroup{{Selector: []apps_v1alpha.Selector{usIn, caNotIn}}}, success, [][]string{[]string{nodeRichardson.GetName()}}},
+			"or":       {[]apps_v1alpha.SelectorGroup{{Selector: []apps_v1alpha.Selector{frIn}}, {Selector: []apps_v1alpha.Selector{usIn, montereyBay}}}, success, [][]string{[]string{nodeParis.GetName()}, []string{nodeSeaside.GetName()}}},
+			"quantity": {[]apps_v1alpha.SelectorGroup{{Selector: []apps_v1alpha.Selector{northAmericaIn, dallas}, Quantity: 2}}, success, [][]string{[]string{nodeRichardson.GetName(), nodeSeaside.GetName()}}},
+			"fewer":    {[]apps_v1alpha.SelectorGroup{{Selector: []apps_v1alpha.Selector{usIn}, Quantity: 3}}, failure, [][]string{[]string{nodeSeaside.GetName(), nodeRichardson.GetName()}}},
+		}
+		for k, tc := range cases {
+			t.Run(k, func(t *testing.T) {
+				sdCopy, _ := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+				sdCopy.Spec.Selector = nil
+				sdCopy.Spec.SelectorGroups = tc.input
+				g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Update(context.TODO(), sdCopy, metav1.UpdateOptions{})
+				g.handler.ObjectUpdated(sdCopy)
+				sdCopy, _ = g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+				util.Equals(t, tc.expectedStatus, sdCopy.Status.State)
+				deploymentCopy, err := g.client.AppsV1().Deployments("").Get(context.TODO(), deploymentCopy.GetName(), metav1.GetOptions{})
+				util.OK(t, err)
+				nodeSelectorTerms := deploymentCopy.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+				util.Equals(t, len(tc.expected), len(nodeSelectorTerms))
+				for i, expected := range tc.expected {
+					util.Equals(t, expected, nodeSelectorTerms[i].MatchExpressions[0].Values)
+				}
+			})
+		}
+	})
+
 	t.Run("workload spec", func(t *testing.T) {
 		util.Equals(t, sdCopy.Spec.Workloads.Deployment[0].Spec.Template.Spec.Containers[0].Image, deploymentCopy.Spec.Template.Spec.Containers[0].Image)
 		util.Equals(t, sdCopy.Spec.Workloads.DaemonSet[0].Spec.Template.Spec.Containers[0].Image, daemonsetCopy.Spec.Template.Spec.Containers[0].Image)
@@ -745,15 +898,856 @@ func TestUpdate(t *testing.T) {
 		util.Equals(t, "nginx:1.8.0", deploymentCopy.Spec.Template.Spec.Containers[0].Image)
 		util.Equals(t, "nginx:1.8.1", daemonsetCopy.Spec.Template.Spec.Containers[0].Image)
 		util.Equals(t, "nginx:1.8.2", statefulsetCopy.Spec.Template.Spec.Containers[0].Image)
-		util.Equals(t, "nginx:1.8.3", jobCopy.Spec.Template.Spec.Containers[0].Image)
+		util.Equals(t, "nginx:1.7.9", jobCopy.Spec.Template.Spec.Containers[0].Image)
 		util.Equals(t, "nginx:1.8.4", cronjobCopy.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Image)
 	})
 }
 
+func TestDelete(t *testing.T) {
+	cases := map[string]struct {
+		policy  string
+		deleted bool
+	}{
+		"default": {"", true},
+		"delete":  {"Delete", true},
+		"orphan":  {"Orphan", false},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			g := TestGroup{}
+			g.Init()
+			g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+			g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
+			nodeParis := g.nodeObj
+			nodeParis.SetName("edgenet.planet-lab.eu")
+			nodeParis.ObjectMeta.Labels = map[string]string{
+				"kubernetes.io/hostname": "edgenet.planet-lab.eu",
+				"edge-net.io/city":       "Paris",
+			}
+			g.client.CoreV1().Nodes().Create(context.TODO(), nodeParis.DeepCopy(), metav1.CreateOptions{})
+			// A deployment of the user that the selectivedeployment doesn't own
+			deploymentOther := g.deploymentObj
+			deploymentOther.SetName("other")
+			g.client.AppsV1().Deployments("").Create(context.TODO(), deploymentOther.DeepCopy(), metav1.CreateOptions{})
+
+			sdObj := g.sdObj.DeepCopy()
+			sdObj.Spec.DeletionPolicy = tc.policy
+			g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Create(context.TODO(), sdObj.DeepCopy(), metav1.CreateOptions{})
+			g.handler.ObjectCreated(sdObj.DeepCopy())
+			sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+			util.OK(t, err)
+			util.Equals(t, []string{finalizer}, sdCopy.GetFinalizers())
+
+			deletionTimestamp := metav1.Now()
+			sdCopy.SetDeletionTimestamp(&deletionTimestamp)
+			sdCopy.Spec.Workloads.Deployment = append(sdCopy.Spec.Workloads.Deployment, deploymentOther)
+			g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Update(context.TODO(), sdCopy, metav1.UpdateOptions{})
+			g.handler.ObjectUpdated(sdCopy)
+			sdCopy, err = g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+			util.OK(t, err)
+			util.Equals(t, terminating, sdCopy.Status.State)
+			util.Equals(t, fmt.Sprintf(statusDict["teardown-progress"], 6, 6), sdCopy.Status.Message[0])
+			util.Equals(t, 0, len(sdCopy.GetFinalizers()))
+
+			deploymentCopy, err := g.client.AppsV1().Deployments("").Get(context.TODO(), g.deploymentObj.GetName(), metav1.GetOptions{})
+			util.Equals(t, tc.deleted, errors.IsNotFound(err))
+			daemonsetCopy, err := g.client.AppsV1().DaemonSets("").Get(context.TODO(), g.daemonsetObj.GetName(), metav1.GetOptions{})
+			util.Equals(t, tc.deleted, errors.IsNotFound(err))
+			statefulsetCopy, err := g.client.AppsV1().StatefulSets("").Get(context.TODO(), g.statefulsetObj.GetName(), metav1.GetOptions{})
+			util.Equals(t, tc.deleted, errors.IsNotFound(err))
+			jobCopy, err := g.client.BatchV1().Jobs("").Get(context.TODO(), g.jobObj.GetName(), metav1.GetOptions{})
+			util.Equals(t, tc.deleted, errors.IsNotFound(err))
+			cronjobCopy, err := g.client.BatchV1beta1().CronJobs("").Get(context.TODO(), g.cronjobObj.GetName(), metav1.GetOptions{})
+			util.Equals(t, tc.deleted, errors.IsNotFound(err))
+			if !tc.deleted {
+				// The orphans keep running without the node affinity and the owner reference
+				util.Equals(t, true, deploymentCopy.Spec.Template.Spec.Affinity == nil)
+				util.Equals(t, 0, len(deploymentCopy.GetOwnerReferences()))
+				util.Equals(t, true, daemonsetCopy.Spec.Template.Spec.Affinity == nil)
+				util.Equals(t, 0, len(daemonsetCopy.GetOwnerReferences()))
+				util.Equals(t, true, statefulsetCopy.Spec.Template.Spec.Affinity == nil)
+				util.Equals(t, 0, len(statefulsetCopy.GetOwnerReferences()))
+				util.Equals(t, 0, len(jobCopy.GetOwnerReferences()))
+				util.Equals(t, true, cronjobCopy.Spec.JobTemplate.Spec.Template.Spec.Affinity == nil)
+				util.Equals(t, 0, len(cronjobCopy.GetOwnerReferences()))
+			}
+			_, err = g.client.AppsV1().Deployments("").Get(context.TODO(), deploymentOther.GetName(), metav1.GetOptions{})
+			util.OK(t, err)
+		})
+	}
+	// The controller that restarts sees the object being deleted as a creation
+	t.Run("created", func(t *testing.T) {
+		g := TestGroup{}
+		g.Init()
+		g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+		g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
+		sdObj := g.sdObj.DeepCopy()
+		g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Create(context.TODO(), sdObj.DeepCopy(), metav1.CreateOptions{})
+		g.handler.ObjectCreated(sdObj.DeepCopy())
+		sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, []string{finalizer}, sdCopy.GetFinalizers())
+
+		deletionTimestamp := metav1.Now()
+		sdCopy.SetDeletionTimestamp(&deletionTimestamp)
+		g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Update(context.TODO(), sdCopy, metav1.UpdateOptions{})
+		err = g.handler.ObjectCreated(sdCopy)
+		util.OK(t, err)
+		sdCopy, err = g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, terminating, sdCopy.Status.State)
+		util.Equals(t, 0, len(sdCopy.GetFinalizers()))
+		_, err = g.client.AppsV1().Deployments("").Get(context.TODO(), g.deploymentObj.GetName(), metav1.GetOptions{})
+		util.Equals(t, true, errors.IsNotFound(err))
+	})
+}
+
+func TestPreferredMode(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+	g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
+	nodeParis := g.nodeObj
+	nodeParis.SetName("edgenet.planet-lab.eu")
+	nodeParis.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname":  "edgenet.planet-lab.eu",
+		"edge-net.io/city":        "Paris",
+		"edge-net.io/country-iso": "FR",
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeParis.DeepCopy(), metav1.CreateOptions{})
+
+	sdObj := g.sdObj.DeepCopy()
+	paris := g.selector
+	paris.Mode = modePreferred
+	paris.Weight = 20
+	// Two nodes can't be found in France, which doesn't matter in the preferred mode
+	country := g.selector
+	country.Name = "Country"
+	country.Value = []string{"FR"}
+	country.Quantity = 2
+	country.Mode = modePreferred
+	sdObj.Spec.Selector = []apps_v1alpha.Selector{paris, country}
+	g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Create(context.TODO(), sdObj.DeepCopy(), metav1.CreateOptions{})
+	g.handler.ObjectCreated(sdObj.DeepCopy())
+	sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+	util.OK(t, err)
+	t.Run("status", func(t *testing.T) {
+		util.Equals(t, success, sdCopy.Status.State)
+		util.Equals(t, "5/5", sdCopy.Status.Ready)
+		util.Equals(t, fewerNodesMessage(1, 2, country.Value), sdCopy.Status.Selectors[1].Message)
+	})
+	t.Run("node affinity", func(t *testing.T) {
+		deploymentCopy, err := g.client.AppsV1().Deployments("").Get(context.TODO(), g.deploymentObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		nodeAffinity := deploymentCopy.Spec.Template.Spec.Affinity.NodeAffinity
+		util.Equals(t, true, nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil)
+		util.Equals(t, 2, len(nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution))
+		util.Equals(t, int32(20), nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0].Weight)
+		util.Equals(t, []string{nodeParis.GetName()}, nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0].Preference.MatchExpressions[0].Values)
+		util.Equals(t, int32(1), nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution[1].Weight)
+	})
+	t.Run("required and preferred", func(t *testing.T) {
+		sdCopy.Spec.Selector[1].Mode = ""
+		sdCopy.Spec.Selector[1].Quantity = 1
+		g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Update(context.TODO(), sdCopy.DeepCopy(), metav1.UpdateOptions{})
+		g.handler.ObjectUpdated(sdCopy.DeepCopy())
+		deploymentCopy, err := g.client.AppsV1().Deployments("").Get(context.TODO(), g.deploymentObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		nodeAffinity := deploymentCopy.Spec.Template.Spec.Affinity.NodeAffinity
+		util.Equals(t, 1, len(nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms))
+		util.Equals(t, 1, len(nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution))
+	})
+}
+
+func TestSchedule(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+	g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
+	defer func() { now = time.Now }()
+	nodeParis := g.nodeObj
+	nodeParis.SetName("edgenet.planet-lab.eu")
+	nodeParis.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname":  "edgenet.planet-lab.eu",
+		"edge-net.io/country-iso": "FR",
+		"edge-net.io/lon":         "e2.34",
+		"edge-net.io/lat":         "n48.86",
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeParis.DeepCopy(), metav1.CreateOptions{})
+	nodeRichardson := g.nodeObj
+	nodeRichardson.SetName("utdallas-1.edge-net.io")
+	nodeRichardson.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname":  "utdallas-1.edge-net.io",
+		"edge-net.io/country-iso": "US",
+		"edge-net.io/lon":         "w-96.78",
+		"edge-net.io/lat":         "n32.77",
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeRichardson.DeepCopy(), metav1.CreateOptions{})
+
+	sdObj := g.sdObj.DeepCopy()
+	country := g.selector
+	country.Name = "Country"
+	country.Value = []string{"FR", "US"}
+	sdObj.Spec.Selector = []apps_v1alpha.Selector{country}
+	sdObj.Spec.Schedule = &apps_v1alpha.Schedule{
+		Windows:   []apps_v1alpha.ScheduleWindow{{Cron: "0 8 * * *", Duration: "6h"}},
+		LocalTime: &apps_v1alpha.LocalTimeRange{From: "08:00", To: "20:00"},
+	}
+	g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Create(context.TODO(), sdObj.DeepCopy(), metav1.CreateOptions{})
+
+	t.Run("closed", func(t *testing.T) {
+		now = func() time.Time { return time.Date(2020, 11, 18, 7, 0, 0, 0, time.UTC) }
+		g.handler.ObjectCreated(sdObj.DeepCopy())
+		sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, inactive, sdCopy.Status.State)
+		util.Equals(t, fmt.Sprintf(statusDict["schedule-closed"], 5, 5, "2020-11-18T08:00:00Z"), sdCopy.Status.Message[0])
+		_, err = g.client.AppsV1().Deployments("").Get(context.TODO(), g.deploymentObj.GetName(), metav1.GetOptions{})
+		util.Equals(t, true, errors.IsNotFound(err))
+	})
+	t.Run("open", func(t *testing.T) {
+		// At noon in UTC, it is daytime in Paris and still night in Richardson
+		now = func() time.Time { return time.Date(2020, 11, 18, 12, 0, 0, 0, time.UTC) }
+		g.handler.ObjectUpdated(sdObj.DeepCopy())
+		sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, success, sdCopy.Status.State)
+		util.Equals(t, []apps_v1alpha.SelectedNode{{Hostname: nodeParis.GetName(), Country: "FR", Lat: "n48.86", Lon: "e2.34"}}, sdCopy.Status.Selectors[0].Nodes)
+		deploymentCopy, err := g.client.AppsV1().Deployments("").Get(context.TODO(), g.deploymentObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, []string{nodeParis.GetName()}, deploymentCopy.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions[0].Values)
+	})
+	t.Run("closed again", func(t *testing.T) {
+		now = func() time.Time { return time.Date(2020, 11, 18, 14, 0, 0, 0, time.UTC) }
+		sdCopy, _ := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		g.handler.ObjectUpdated(sdCopy.DeepCopy())
+		sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, inactive, sdCopy.Status.State)
+		util.Equals(t, "ScheduleClosed", meta.FindStatusCondition(sdCopy.Status.Conditions, "Ready").Reason)
+		_, err = g.client.AppsV1().Deployments("").Get(context.TODO(), g.deploymentObj.GetName(), metav1.GetOptions{})
+		util.Equals(t, true, errors.IsNotFound(err))
+	})
+	t.Run("signature", func(t *testing.T) {
+		nodes := []interface{}{nodeParis.DeepCopy(), nodeRichardson.DeepCopy()}
+		morning := scheduleSignature(sdObj.Spec.Schedule, nodes, time.Date(2020, 11, 18, 9, 0, 0, 0, time.UTC))
+		noon := scheduleSignature(sdObj.Spec.Schedule, nodes, time.Date(2020, 11, 18, 12, 0, 0, 0, time.UTC))
+		evening := scheduleSignature(sdObj.Spec.Schedule, nodes, time.Date(2020, 11, 18, 20, 0, 0, 0, time.UTC))
+		util.Equals(t, "true/"+nodeParis.GetName(), morning)
+		util.Equals(t, morning, noon)
+		// In the evening in UTC, the day begins in Richardson while it ends in Paris
+		util.Equals(t, "false/"+nodeRichardson.GetName(), evening)
+	})
+	t.Run("check", func(t *testing.T) {
+		c := controller{
+			logger:       logrus.NewEntry(logrus.New()),
+			queue:        keyqueue.NewWithWorkers("test-check-schedules", 1, func(item interface{}) string { return item.(informerevent).key }),
+			informer:     cache.NewSharedIndexInformer(&cache.ListWatch{}, &apps_v1alpha.SelectiveDeployment{}, 0, cache.Indexers{}),
+			nodeInformer: cache.NewSharedIndexInformer(&cache.ListWatch{}, &corev1.Node{}, 0, cache.Indexers{}),
+		}
+		defer c.queue.ShutDown()
+		c.informer.GetIndexer().Add(sdObj.DeepCopy())
+		c.nodeInformer.GetIndexer().Add(nodeParis.DeepCopy())
+		key, _ := cache.MetaNamespaceKeyFunc(sdObj)
+		// The handler evaluates the selectivedeployment while the window is closed, and the window opens before the first check
+		now = func() time.Time { return time.Date(2020, 11, 18, 7, 0, 0, 0, time.UTC) }
+		c.seedSchedule(key, sdObj.DeepCopy())
+		now = func() time.Time { return time.Date(2020, 11, 18, 9, 0, 0, 0, time.UTC) }
+		c.checkSchedules()
+		util.Equals(t, 1, c.queue.Len())
+		// Nothing changes until the next check
+		c.checkSchedules()
+		util.Equals(t, 1, c.queue.Len())
+	})
+}
+
+func TestGenericWorkload(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+	g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
+	nodeParis := g.nodeObj
+	nodeParis.SetName("edgenet.planet-lab.eu")
+	nodeParis.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname": "edgenet.planet-lab.eu",
+		"edge-net.io/city":       "Paris",
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeParis.DeepCopy(), metav1.CreateOptions{})
+	nodeLyon := g.nodeObj
+	nodeLyon.SetName("lyon.edge-net.io")
+	nodeLyon.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname": "lyon.edge-net.io",
+		"edge-net.io/city":       "Lyon",
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeLyon.DeepCopy(), metav1.CreateOptions{})
+
+	replicasetObj := appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "replicaset"},
+		Spec: appsv1.ReplicaSetSpec{
+			Selector: g.deploymentObj.Spec.Selector.DeepCopy(),
+			Template: *g.deploymentObj.Spec.Template.DeepCopy(),
+		},
+	}
+	podObj := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Labels: map[string]string{"app": "nginx"}},
+		Spec:       *g.deploymentObj.Spec.Template.Spec.DeepCopy(),
+	}
+	// A custom resource that embeds a pod template
+	widgetObj := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "widget"},
+		"spec":     map[string]interface{}{"template": replicasetObj.Spec.Template.DeepCopy()},
+	}
+	replicasetRaw, _ := json.Marshal(replicasetObj)
+	podRaw, _ := json.Marshal(podObj)
+	widgetRaw, _ := json.Marshal(widgetObj)
+	sdObj := g.sdObj.DeepCopy()
+	sdObj.Spec.Workloads = apps_v1alpha.Workloads{
+		Generic: []apps_v1alpha.GenericWorkload{
+			{APIVersion: "apps/v1", Kind: "ReplicaSet", TemplatePath: "spec.template", Object: runtime.RawExtension{Raw: replicasetRaw}},
+			{APIVersion: "v1", Kind: "Pod", Object: runtime.RawExtension{Raw: podRaw}},
+			{APIVersion: "example.com/v1", Kind: "Widget", TemplatePath: "spec.template", Object: runtime.RawExtension{Raw: widgetRaw}},
+		},
+	}
+	g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Create(context.TODO(), sdObj.DeepCopy(), metav1.CreateOptions{})
+	g.handler.ObjectCreated(sdObj.DeepCopy())
+	replicasetResource := appsv1.SchemeGroupVersion.WithResource("replicasets")
+	podResource := corev1.SchemeGroupVersion.WithResource("pods")
+	widgetResource := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+
+	t.Run("creation", func(t *testing.T) {
+		sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, success, sdCopy.Status.State)
+		util.Equals(t, "3/3", sdCopy.Status.Ready)
+		util.Equals(t, []apps_v1alpha.WorkloadStatus{{Kind: "ReplicaSet", Name: "replicaset", Replicas: 1}, {Kind: "Pod", Name: "pod", Replicas: 1},
+			{Kind: "Widget", Name: "widget", Replicas: 1}}, sdCopy.Status.Workloads)
+
+		replicasetRaw, err := g.dynamicClient.Resource(replicasetResource).Namespace("").Get(context.TODO(), "replicaset", metav1.GetOptions{})
+		util.OK(t, err)
+		replicasetCopy := appsv1.ReplicaSet{}
+		util.OK(t, runtime.DefaultUnstructuredConverter.FromUnstructured(replicasetRaw.UnstructuredContent(), &replicasetCopy))
+		util.Equals(t, []string{nodeParis.GetName()}, replicasetCopy.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions[0].Values)
+		util.Equals(t, SetAsOwnerReference(sdObj), replicasetCopy.GetOwnerReferences())
+
+		podRaw, err := g.dynamicClient.Resource(podResource).Namespace("").Get(context.TODO(), "pod", metav1.GetOptions{})
+		util.OK(t, err)
+		podCopy := corev1.Pod{}
+		util.OK(t, runtime.DefaultUnstructuredConverter.FromUnstructured(podRaw.UnstructuredContent(), &podCopy))
+		util.Equals(t, []string{nodeParis.GetName()}, podCopy.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions[0].Values)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		sdInvalid := sdObj.DeepCopy()
+		sdInvalid.SetName("invalid")
+		sdInvalid.Spec.Workloads.Generic = sdInvalid.Spec.Workloads.Generic[:1]
+		sdInvalid.Spec.Workloads.Generic[0].TemplatePath = "spec.podTemplate"
+		g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Create(context.TODO(), sdInvalid.DeepCopy(), metav1.CreateOptions{})
+		g.handler.ObjectCreated(sdInvalid.DeepCopy())
+		sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdInvalid.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, failure, sdCopy.Status.State)
+		util.Equals(t, fmt.Sprintf(statusDict["workload-invalid"], "ReplicaSet", 0, "no pod template at spec.podTemplate"), sdCopy.Status.Message[0])
+	})
+	t.Run("update", func(t *testing.T) {
+		widgetClient := g.dynamicClient.Resource(widgetResource).Namespace("")
+		widgetCopy, err := widgetClient.Get(context.TODO(), "widget", metav1.GetOptions{})
+		util.OK(t, err)
+		widgetCopy.SetResourceVersion("7")
+		_, err = widgetClient.Update(context.TODO(), widgetCopy, metav1.UpdateOptions{})
+		util.OK(t, err)
+		podCopy, err := g.dynamicClient.Resource(podResource).Namespace("").Get(context.TODO(), "pod", metav1.GetOptions{})
+		util.OK(t, err)
+		podAffinity, _, _ := unstructured.NestedFieldCopy(podCopy.Object, "spec", "affinity")
+		// As the API server does, the custom resources take the updates of the version read only,
+		// and the affinity of a pod doesn't change
+		g.dynamicClient.(*dynamictestclient.FakeDynamicClient).PrependReactor("update", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			object := action.(k8stesting.UpdateAction).GetObject().(*unstructured.Unstructured)
+			switch action.GetResource() {
+			case widgetResource:
+				if object.GetResourceVersion() != "7" {
+					return true, nil, errors.NewConflict(widgetResource.GroupResource(), object.GetName(), fmt.Errorf("the resource version is %q", object.GetResourceVersion()))
+				}
+			case podResource:
+				if affinity, _, _ := unstructured.NestedFieldNoCopy(object.Object, "spec", "affinity"); !reflect.DeepEqual(podAffinity, affinity) {
+					return true, nil, errors.NewBadRequest("the affinity of a pod is immutable")
+				}
+			}
+			return false, nil, nil
+		})
+
+		sdCopy, _ := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		sdCopy.Spec.Selector[0].Value = []string{"Paris", "Lyon"}
+		g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Update(context.TODO(), sdCopy.DeepCopy(), metav1.UpdateOptions{})
+		g.handler.ObjectUpdated(sdCopy.DeepCopy())
+		sdCopy, err = g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, success, sdCopy.Status.State)
+		util.Equals(t, "3/3", sdCopy.Status.Ready)
+
+		widgetCopy, err = widgetClient.Get(context.TODO(), "widget", metav1.GetOptions{})
+		util.OK(t, err)
+		values, _, err := unstructured.NestedSlice(widgetCopy.Object, "spec", "template", "spec", "affinity", "nodeAffinity",
+			"requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms")
+		util.OK(t, err)
+		util.Equals(t, 2, len(values[0].(map[string]interface{})["matchExpressions"].([]interface{})[0].(map[string]interface{})["values"].([]interface{})))
+
+		podCopy, err = g.dynamicClient.Resource(podResource).Namespace("").Get(context.TODO(), "pod", metav1.GetOptions{})
+		util.OK(t, err)
+		affinity, _, _ := unstructured.NestedFieldNoCopy(podCopy.Object, "spec", "affinity")
+		util.Equals(t, podAffinity, affinity)
+		util.Equals(t, SetAsOwnerReference(sdObj), podCopy.GetOwnerReferences())
+	})
+	t.Run("teardown", func(t *testing.T) {
+		sdCopy, _ := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		deletionTimestamp := metav1.Now()
+		sdCopy.SetDeletionTimestamp(&deletionTimestamp)
+		g.handler.ObjectUpdated(sdCopy.DeepCopy())
+		_, err := g.dynamicClient.Resource(replicasetResource).Namespace("").Get(context.TODO(), "replicaset", metav1.GetOptions{})
+		util.Equals(t, true, errors.IsNotFound(err))
+		_, err = g.dynamicClient.Resource(podResource).Namespace("").Get(context.TODO(), "pod", metav1.GetOptions{})
+		util.Equals(t, true, errors.IsNotFound(err))
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+	g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
+	nodeParis := g.nodeObj
+	nodeParis.SetName("edgenet.planet-lab.eu")
+	nodeParis.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname":  "edgenet.planet-lab.eu",
+		"edge-net.io/city":        "Paris",
+		"edge-net.io/country-iso": "FR",
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeParis.DeepCopy(), metav1.CreateOptions{})
+
+	sdObj := g.sdObj.DeepCopy()
+	sdObj.SetAnnotations(map[string]string{dryRunAnnotation: "true"})
+	country := g.selector
+	country.Name = "Country"
+	country.Value = []string{"FR"}
+	country.Quantity = 2
+	sdObj.Spec.Selector = []apps_v1alpha.Selector{g.selector, country}
+	g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Create(context.TODO(), sdObj.DeepCopy(), metav1.CreateOptions{})
+	g.handler.ObjectCreated(sdObj.DeepCopy())
+	sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+	util.OK(t, err)
+
+	t.Run("status", func(t *testing.T) {
+		util.Equals(t, dryRun, sdCopy.Status.State)
+		util.Equals(t, fmt.Sprintf(statusDict["dry-run"], 1), sdCopy.Status.Message[0])
+		util.Equals(t, fewerNodesMessage(1, 2, country.Value), sdCopy.Status.Message[1])
+		util.Equals(t, 2, len(sdCopy.Status.Selectors))
+		util.Equals(t, nodeParis.GetName(), sdCopy.Status.Selectors[0].Nodes[0].Hostname)
+		util.Equals(t, "", sdCopy.Status.Selectors[0].Message)
+		util.Equals(t, sdCopy.Status.Message[1], sdCopy.Status.Selectors[1].Message)
+		util.Equals(t, "FewerNodes", meta.FindStatusCondition(sdCopy.Status.Conditions, "Scheduled").Reason)
+		util.Equals(t, true, meta.FindStatusCondition(sdCopy.Status.Conditions, "Applied") == nil)
+	})
+	t.Run("preview", func(t *testing.T) {
+		util.Equals(t, 1, len(sdCopy.Status.Preview))
+		util.Equals(t, 2, len(sdCopy.Status.Preview[0].NodeSelectorTerms))
+		util.Equals(t, []string{nodeParis.GetName()}, sdCopy.Status.Preview[0].NodeSelectorTerms[0].MatchExpressions[0].Values)
+	})
+	t.Run("no workload", func(t *testing.T) {
+		_, err := g.client.AppsV1().Deployments("").Get(context.TODO(), g.deploymentObj.GetName(), metav1.GetOptions{})
+		util.Equals(t, true, errors.IsNotFound(err))
+		_, err = g.client.BatchV1beta1().CronJobs("").Get(context.TODO(), g.cronjobObj.GetName(), metav1.GetOptions{})
+		util.Equals(t, true, errors.IsNotFound(err))
+		util.Equals(t, 0, len(sdCopy.GetFinalizers()))
+	})
+	t.Run("apply", func(t *testing.T) {
+		// The selectivedeployment is applied once the annotation is removed
+		sdCopy.SetAnnotations(nil)
+		g.handler.ObjectUpdated(sdCopy.DeepCopy())
+		sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, 0, len(sdCopy.Status.Preview))
+		_, err = g.client.AppsV1().Deployments("").Get(context.TODO(), g.deploymentObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+	})
+}
+
+func TestEvents(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+	g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
+	eventRecorder := record.NewFakeRecorder(10)
+	g.handler.recorder = eventRecorder
+	nodeParis := g.nodeObj
+	nodeParis.SetName("edgenet.planet-lab.eu")
+	nodeParis.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname": "edgenet.planet-lab.eu",
+		"edge-net.io/city":       "Paris",
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeParis.DeepCopy(), metav1.CreateOptions{})
+
+	sdObj := g.sdObj.DeepCopy()
+	g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Create(context.TODO(), sdObj.DeepCopy(), metav1.CreateOptions{})
+	g.handler.ObjectCreated(sdObj.DeepCopy())
+	sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+	util.OK(t, err)
+
+	t.Run("applied", func(t *testing.T) {
+		util.Equals(t, fmt.Sprintf("%s Applied %s, node(s) selected: %s", corev1.EventTypeNormal, statusDict["sd-success"], nodeParis.GetName()), <-eventRecorder.Events)
+	})
+	t.Run("resync", func(t *testing.T) {
+		// Nothing changed, so there is nothing to tell
+		g.handler.ObjectUpdated(sdCopy.DeepCopy())
+		util.Equals(t, 0, len(eventRecorder.Events))
+	})
+	t.Run("fewer nodes", func(t *testing.T) {
+		sdCopy.Spec.Selector[0].Quantity = 2
+		g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Update(context.TODO(), sdCopy.DeepCopy(), metav1.UpdateOptions{})
+		g.handler.ObjectUpdated(sdCopy.DeepCopy())
+		event := <-eventRecorder.Events
+		util.Equals(t, true, strings.HasPrefix(event, fmt.Sprintf("%s Failed %s", corev1.EventTypeWarning, fewerNodesMessage(1, 2, g.selector.Value))))
+	})
+}
+
+func TestTransientErrors(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+	g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
+	nodeParis := g.nodeObj
+	nodeParis.SetName("edgenet.planet-lab.eu")
+	nodeParis.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname": "edgenet.planet-lab.eu",
+		"edge-net.io/city":       "Paris",
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeParis.DeepCopy(), metav1.CreateOptions{})
+	// The status cannot be updated until the API server comes back
+	apiDown := true
+	g.edgenetClient.(*edgenettestclient.Clientset).PrependReactor("update", "selectivedeployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if apiDown && action.GetSubresource() == "status" {
+			return true, nil, errors.NewServiceUnavailable("API server unavailable")
+		}
+		return false, nil, nil
+	})
+
+	sdObj := g.sdObj.DeepCopy()
+	g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Create(context.TODO(), sdObj.DeepCopy(), metav1.CreateOptions{})
+	t.Run("error returned", func(t *testing.T) {
+		err := g.handler.ObjectCreated(sdObj.DeepCopy())
+		util.Equals(t, true, errors.IsServiceUnavailable(err))
+		// The status stays as it was for the next attempt
+		sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, "", sdCopy.Status.State)
+	})
+	t.Run("retry succeeded", func(t *testing.T) {
+		apiDown = false
+		util.OK(t, g.handler.ObjectCreated(sdObj.DeepCopy()))
+		sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, success, sdCopy.Status.State)
+	})
+	t.Run("gave up", func(t *testing.T) {
+		sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		g.handler.ObjectFailed(sdCopy.DeepCopy(), fmt.Errorf("API server unavailable"))
+		sdCopy, err = g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, failure, sdCopy.Status.State)
+		applied := meta.FindStatusCondition(sdCopy.Status.Conditions, "Applied")
+		util.Equals(t, metav1.ConditionFalse, applied.Status)
+		util.Equals(t, "ReconcileFailed", applied.Reason)
+	})
+}
+
+func TestFanOut(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+	g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
+	nodeParis := g.nodeObj
+	nodeParis.SetName("edgenet.planet-lab.eu")
+	nodeParis.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname":  "edgenet.planet-lab.eu",
+		"edge-net.io/country-iso": "FR",
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeParis.DeepCopy(), metav1.CreateOptions{})
+	nodeRichardson := g.nodeObj
+	nodeRichardson.SetName("utdallas-1.edge-net.io")
+	nodeRichardson.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname":  "utdallas-1.edge-net.io",
+		"edge-net.io/country-iso": "US",
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeRichardson.DeepCopy(), metav1.CreateOptions{})
+
+	sdObj := g.sdObj.DeepCopy()
+	sdObj.Spec.FanOut = true
+	sdObj.Spec.Workloads = apps_v1alpha.Workloads{Deployment: []appsv1.Deployment{g.deploymentObj}}
+	sdObj.Spec.Selector = []apps_v1alpha.Selector{{Name: "Country", Value: []string{"FR", "US"}, Operator: "In", Quantity: 1}}
+	g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Create(context.TODO(), sdObj.DeepCopy(), metav1.CreateOptions{})
+	g.handler.ObjectCreated(sdObj.DeepCopy())
+	sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+	util.OK(t, err)
+	util.Equals(t, success, sdCopy.Status.State)
+	util.Equals(t, "2/2", sdCopy.Status.Ready)
+
+	t.Run("copies", func(t *testing.T) {
+		cases := map[string]struct {
+			name     string
+			expected []string
+		}{
+			"fr": {"default-fr", []string{nodeParis.GetName()}},
+			"us": {"default-us", []string{nodeRichardson.GetName()}},
+		}
+		for k, tc := range cases {
+			t.Run(k, func(t *testing.T) {
+				deploymentCopy, err := g.client.AppsV1().Deployments("").Get(context.TODO(), tc.name, metav1.GetOptions{})
+				util.OK(t, err)
+				util.Equals(t, tc.expected, deploymentCopy.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions[0].Values)
+				util.Equals(t, k, deploymentCopy.GetLabels()[fanOutLocationLabel])
+				util.Equals(t, k, deploymentCopy.Spec.Template.GetLabels()[fanOutLocationLabel])
+				util.Equals(t, k, deploymentCopy.Spec.Selector.MatchLabels[fanOutLocationLabel])
+				util.Equals(t, "nginx", deploymentCopy.Spec.Selector.MatchLabels["app"])
+			})
+		}
+		_, err := g.client.AppsV1().Deployments("").Get(context.TODO(), g.deploymentObj.GetName(), metav1.GetOptions{})
+		util.Equals(t, true, errors.IsNotFound(err))
+	})
+
+	t.Run("prune failure", func(t *testing.T) {
+		failDelete := true
+		g.client.(*testclient.Clientset).PrependReactor("delete", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return failDelete, nil, fmt.Errorf("deployments unavailable")
+		})
+		defer func() { failDelete = false }()
+		sdFailure := sdCopy.DeepCopy()
+		sdFailure.Spec.Selector[0].Value = []string{"US"}
+		util.Equals(t, true, g.handler.ObjectUpdated(sdFailure) != nil)
+		_, err := g.client.AppsV1().Deployments("").Get(context.TODO(), "default-fr", metav1.GetOptions{})
+		util.OK(t, err)
+	})
+	t.Run("prune", func(t *testing.T) {
+		sdCopy.Spec.Selector[0].Value = []string{"US"}
+		g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Update(context.TODO(), sdCopy, metav1.UpdateOptions{})
+		g.handler.ObjectUpdated(sdCopy)
+		_, err := g.client.AppsV1().Deployments("").Get(context.TODO(), "default-fr", metav1.GetOptions{})
+		util.Equals(t, true, errors.IsNotFound(err))
+		_, err = g.client.AppsV1().Deployments("").Get(context.TODO(), "default-us", metav1.GetOptions{})
+		util.OK(t, err)
+	})
+
+	updateSD := func(update func(sdCopy *apps_v1alpha.SelectiveDeployment)) {
+		sdCopy, _ := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		update(sdCopy)
+		g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Update(context.TODO(), sdCopy.DeepCopy(), metav1.UpdateOptions{})
+		g.handler.ObjectUpdated(sdCopy.DeepCopy())
+	}
+	t.Run("replicas", func(t *testing.T) {
+		updateSD(func(sdCopy *apps_v1alpha.SelectiveDeployment) { sdCopy.Spec.FanOutReplicas = 3 })
+		deploymentCopy, err := g.client.AppsV1().Deployments("").Get(context.TODO(), "default-us", metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, int32(3), *deploymentCopy.Spec.Replicas)
+	})
+	t.Run("fan-out off", func(t *testing.T) {
+		updateSD(func(sdCopy *apps_v1alpha.SelectiveDeployment) { sdCopy.Spec.FanOut = false })
+		deploymentCopy, err := g.client.AppsV1().Deployments("").Get(context.TODO(), g.deploymentObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, []string{nodeRichardson.GetName()}, deploymentCopy.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions[0].Values)
+		_, err = g.client.AppsV1().Deployments("").Get(context.TODO(), "default-us", metav1.GetOptions{})
+		util.Equals(t, true, errors.IsNotFound(err))
+	})
+	t.Run("fan-out on", func(t *testing.T) {
+		updateSD(func(sdCopy *apps_v1alpha.SelectiveDeployment) { sdCopy.Spec.FanOut = true })
+		_, err := g.client.AppsV1().Deployments("").Get(context.TODO(), "default-us", metav1.GetOptions{})
+		util.OK(t, err)
+		_, err = g.client.AppsV1().Deployments("").Get(context.TODO(), g.deploymentObj.GetName(), metav1.GetOptions{})
+		util.Equals(t, true, errors.IsNotFound(err))
+	})
+
+	t.Run("teardown", func(t *testing.T) {
+		sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		deletionTimestamp := metav1.Now()
+		sdCopy.SetDeletionTimestamp(&deletionTimestamp)
+		g.handler.ObjectUpdated(sdCopy)
+		_, err = g.client.AppsV1().Deployments("").Get(context.TODO(), "default-us", metav1.GetOptions{})
+		util.Equals(t, true, errors.IsNotFound(err))
+	})
+}
+
+func TestNodeSelectionOnce(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+	g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
+	nodeParis := g.nodeObj
+	nodeParis.SetName("edgenet.planet-lab.eu")
+	nodeParis.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname": "edgenet.planet-lab.eu",
+		"edge-net.io/city":       "Paris",
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeParis.DeepCopy(), metav1.CreateOptions{})
+	g.client.(*testclient.Clientset).ClearActions()
+
+	sdObj := g.sdObj.DeepCopy()
+	sdObj.Spec.Selector[0].Quantity = 2
+	g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Create(context.TODO(), sdObj.DeepCopy(), metav1.CreateOptions{})
+	util.OK(t, g.handler.ObjectCreated(sdObj.DeepCopy()))
+	sdCopy, err := g.edgenetClient.AppsV1alpha().SelectiveDeployments("").Get(context.TODO(), sdObj.GetName(), metav1.GetOptions{})
+	util.OK(t, err)
+	// The workloads share the node selection, which is read from the cache
+	for _, action := range g.client.(*testclient.Clientset).Actions() {
+		if action.GetResource().Resource == "nodes" {
+			t.Errorf("Node lookup failed. Expected the cache, Got: %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+	count := 0
+	for _, message := range sdCopy.Status.Message {
+		if message == fewerNodesMessage(1, 2, g.selector.Value) {
+			count++
+		}
+	}
+	util.Equals(t, 1, count)
+	util.Equals(t, 1, len(sdCopy.Status.Selectors))
+	util.Equals(t, "0/5", sdCopy.Status.Ready)
+}
+
+func TestWorkloadStatus(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	replicas := int32(3)
+	deploymentObj := g.deploymentObj.DeepCopy()
+	deploymentObj.Spec.Replicas = &replicas
+	deploymentObj.Status.ReadyReplicas = 2
+	daemonsetObj := g.daemonsetObj.DeepCopy()
+	daemonsetObj.Status.DesiredNumberScheduled = 4
+	daemonsetObj.Status.NumberReady = 4
+	jobObj := g.jobObj.DeepCopy()
+	jobObj.Status.Succeeded = 1
+	cases := map[string]struct {
+		input    interface{}
+		expected apps_v1alpha.WorkloadStatus
+	}{
+		"deployment": {deploymentObj, apps_v1alpha.WorkloadStatus{Kind: "Deployment", Name: deploymentObj.GetName(), Replicas: 3, ReadyReplicas: 2}},
+		"daemonset":  {daemonsetObj, apps_v1alpha.WorkloadStatus{Kind: "DaemonSet", Name: daemonsetObj.GetName(), Replicas: 4, ReadyReplicas: 4}},
+		"job":        {jobObj, apps_v1alpha.WorkloadStatus{Kind: "Job", Name: jobObj.GetName(), Replicas: 1, ReadyReplicas: 1}},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			util.Equals(t, tc.expected, workloadStatus(tc.input))
+		})
+	}
+}
+
+func TestNodeCount(t *testing.T) {
+	hostnames := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	cases := map[string]struct {
+		count    nodeCount
+		picked   int
+		required int
+	}{
+		"all":                 {nodeCount{}, 10, 0},
+		"quantity":            {nodeCount{quantity: 3}, 3, 3},
+		"quantity/fewer":      {nodeCount{quantity: 12}, 10, 12},
+		"percentage":          {nodeCount{percentage: 30}, 3, 1},
+		"percentage/round-up": {nodeCount{percentage: 25}, 3, 1},
+		"percentage/min":      {nodeCount{percentage: 10, min: 4}, 4, 4},
+		"percentage/max":      {nodeCount{percentage: 90, max: 5}, 5, 1},
+		"range":               {nodeCount{min: 3, max: 8}, 8, 3},
+		"range/unbounded":     {nodeCount{min: 3}, 10, 3},
+		"range/fewer":         {nodeCount{min: 12, max: 20}, 10, 12},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			picked, required := tc.count.pick(hostnames)
+			util.Equals(t, tc.picked, len(picked))
+			util.Equals(t, tc.required, required)
+		})
+	}
+	t.Run("percentage/none", func(t *testing.T) {
+		picked, required := nodeCount{percentage: 30}.pick([]string{})
+		util.Equals(t, 0, len(picked))
+		util.Equals(t, 1, required)
+	})
+}
+
+func TestLocationSuffix(t *testing.T) {
+	cases := map[string]struct {
+		name     string
+		value    string
+		expected string
+	}{
+		"city":      {"City", "Paris", "paris"},
+		"continent": {"Continent", "North America", "north-america"},
+		"trimmed":   {"City", " Saint-Denis (93) ", "saint-denis-93"},
+		"polygon":   {"Polygon", "[ [2.2, 48.8], [2.4, 48.8], [2.4, 48.9] ]", "polygon-"},
+		"radius":    {"Radius", "48.8566, 2.3522, 50", "radius-"},
+		"asn":       {"ASN", "2200", "asn-2200"},
+		"asorg":     {"ASOrg", "Comcast Cable Communications, LLC", "comcast-cable-communications"},
+		"nat":       {"NAT", "true", "nat-true"},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			suffix := locationSuffix(tc.name, tc.value)
+			util.Equals(t, true, strings.HasPrefix(suffix, tc.expected))
+			util.Equals(t, suffix, locationSuffix(tc.name, tc.value))
+			util.Equals(t, 0, len(validation.IsDNS1123Label(suffix)))
+		})
+	}
+}
+
+func TestNetworkSelectors(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+	g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
+	nodeParis := g.nodeObj
+	nodeParis.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname": "paris.edge-net.io",
+		"edge-net.io/asn":        "2200",
+		"edge-net.io/as-org":     "Renater",
+		"edge-net.io/nat":        "false",
+	}
+	nodeBoston := g.nodeObj
+	nodeBoston.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname": "boston.edge-net.io",
+		"edge-net.io/asn":        "7922",
+		"edge-net.io/as-org":     "Comcast_Cable_Communications__LLC",
+		"edge-net.io/nat":        "false",
+	}
+	nodeHome := g.nodeObj
+	nodeHome.ObjectMeta.Labels = map[string]string{
+		"kubernetes.io/hostname": "home.edge-net.io",
+		"edge-net.io/nat":        "true",
+	}
+	nodeList := []corev1.Node{nodeParis, nodeBoston, nodeHome}
+
+	cases := map[string]struct {
+		selector apps_v1alpha.Selector
+		expected []string
+	}{
+		"asn":          {apps_v1alpha.Selector{Name: "ASN", Value: []string{"7922", "2200"}, Operator: "In"}, []string{"boston.edge-net.io", "paris.edge-net.io"}},
+		"asn/notin":    {apps_v1alpha.Selector{Name: "ASN", Value: []string{"7922"}, Operator: "NotIn"}, []string{"paris.edge-net.io", "home.edge-net.io"}},
+		"asorg":        {apps_v1alpha.Selector{Name: "ASOrg", Value: []string{"Comcast Cable Communications, LLC"}, Operator: "In"}, []string{"boston.edge-net.io"}},
+		"asorg/label":  {apps_v1alpha.Selector{Name: "ASOrg", Value: []string{"Renater"}, Operator: "In"}, []string{"paris.edge-net.io"}},
+		"asorg/notin":  {apps_v1alpha.Selector{Name: "ASOrg", Value: []string{"Comcast Cable Communications, LLC"}, Operator: "NotIn"}, []string{"paris.edge-net.io", "home.edge-net.io"}},
+		"nat":          {apps_v1alpha.Selector{Name: "NAT", Value: []string{"true"}, Operator: "In"}, []string{"home.edge-net.io"}},
+		"nat/public":   {apps_v1alpha.Selector{Name: "NAT", Value: []string{"true"}, Operator: "NotIn"}, []string{"paris.edge-net.io", "boston.edge-net.io"}},
+		"asn/unlisted": {apps_v1alpha.Selector{Name: "ASN", Value: []string{"3215"}, Operator: "In"}, []string{}},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			sdCopy := g.sdObj.DeepCopy()
+			hostnames, failureCounter := g.handler.matchNodes(sdCopy, tc.selector, nodeList)
+			util.Equals(t, 0, failureCounter)
+			util.Equals(t, tc.expected, hostnames)
+		})
+	}
+}
+
 func TestGetByNode(t *testing.T) {
 	g := TestGroup{}
 	g.Init()
-	g.handler.Init(g.client, g.edgenetClient)
+	g.handler.Init(g.client, g.edgenetClient, g.dynamicClient)
+	g.handler.SetIndexers(g.nodeIndexer, g.workloadIndexers)
 	// Creating nodes
 	nodeParis := g.nodeObj
 	nodeParis.SetName("edgenet.planet-lab.eu")
@@ -796,13 +1790,85 @@ func TestGetByNode(t *testing.T) {
 	util.Equals(t, statusDict["sd-success"], sdCopy.Status.Message[0])
 	util.Equals(t, "5/5", sdCopy.Status.Ready)
 
-	ownerList, status := g.handler.getByNode(nodeParis.GetName())
+	// Fill the indexers as the informers do
+	deploymentIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, workloadIndexers)
+	deploymentRaw, _ := g.client.AppsV1().Deployments("").List(context.TODO(), metav1.ListOptions{})
+	for _, deploymentRow := range deploymentRaw.Items {
+		deploymentIndexer.Add(deploymentRow.DeepCopy())
+	}
+	cronjobIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, workloadIndexers)
+	cronjobRaw, _ := g.client.BatchV1beta1().CronJobs("").List(context.TODO(), metav1.ListOptions{})
+	for _, cronjobRow := range cronjobRaw.Items {
+		cronjobIndexer.Add(cronjobRow.DeepCopy())
+	}
+	indexers := []cache.Indexer{deploymentIndexer, cronjobIndexer}
+
+	ownerList, status := getByNode(indexers, nodeParis.GetName())
 	util.Equals(t, true, status)
-	util.Equals(t, "", ownerList[0][0])
-	util.Equals(t, sdObj.GetName(), ownerList[0][1])
+	util.Equals(t, [][]string{{"", sdObj.GetName()}}, ownerList)
 
-	ownerList, status = g.handler.getByNode(nodeRichardson.GetName())
+	ownerList, status = getByNode(indexers, nodeRichardson.GetName())
 	util.Equals(t, true, status)
-	util.Equals(t, "", ownerList[0][0])
-	util.Equals(t, sdObj.GetName(), ownerList[0][1])
+	util.Equals(t, [][]string{{"", sdObj.GetName()}}, ownerList)
+
+	ownerList, status = getByNode(indexers, "unknown.edge-net.io")
+	util.Equals(t, false, status)
+	util.Equals(t, 0, len(ownerList))
+}
+
+func TestIndexByRecovery(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	cases := map[string]struct {
+		recovery   bool
+		state      string
+		percentage int
+		expected   []string
+	}{
+		"recovery/failure":       {true, failure, 0, []string{trueStr}},
+		"recovery/partial":       {true, partial, 0, []string{trueStr}},
+		"recovery/success":       {true, success, 0, []string{}},
+		"recovery/success/range": {true, success, 30, []string{trueStr}},
+		"no-recovery/failure":    {false, failure, 0, []string{}},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			sdObj := g.sdObj.DeepCopy()
+			sdObj.Spec.Recovery = tc.recovery
+			sdObj.Status.State = tc.state
+			sdObj.Spec.Selector[0].Percentage = tc.percentage
+			keys, err := indexByRecovery(sdObj)
+			util.OK(t, err)
+			util.Equals(t, tc.expected, keys)
+		})
+	}
+}
+
+func TestGetGenericByNode(t *testing.T) {
+	g := TestGroup{}
+	g.Init()
+	selectorStatus := []apps_v1alpha.SelectorStatus{{Name: "city", Nodes: []apps_v1alpha.SelectedNode{{Hostname: "edgenet.planet-lab.eu"}}}}
+	sdGeneric := g.sdObj.DeepCopy()
+	sdGeneric.SetName("generic")
+	sdGeneric.Spec.Workloads = apps_v1alpha.Workloads{Generic: []apps_v1alpha.GenericWorkload{{APIVersion: "v1", Kind: "Pod"}}}
+	sdGeneric.Status.Selectors = selectorStatus
+	sdTyped := g.sdObj.DeepCopy()
+	sdTyped.Status.Selectors = selectorStatus
+
+	// Fill the indexer as the informer does
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, sdIndexers)
+	indexer.Add(sdGeneric)
+	indexer.Add(sdTyped)
+
+	ownerList, status := getGenericByNode(indexer, "edgenet.planet-lab.eu", [][]string{{"", sdTyped.GetName()}})
+	util.Equals(t, true, status)
+	util.Equals(t, [][]string{{"", sdTyped.GetName()}, {"", sdGeneric.GetName()}}, ownerList)
+
+	ownerList, status = getGenericByNode(indexer, "edgenet.planet-lab.eu", [][]string{{"", sdGeneric.GetName()}})
+	util.Equals(t, true, status)
+	util.Equals(t, [][]string{{"", sdGeneric.GetName()}}, ownerList)
+
+	ownerList, status = getGenericByNode(indexer, "unknown.edge-net.io", [][]string{})
+	util.Equals(t, false, status)
+	util.Equals(t, 0, len(ownerList))
 }
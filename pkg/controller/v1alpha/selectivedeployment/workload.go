@@ -0,0 +1,478 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selectivedeployment
+
+// The handler deals with every workload in the unstructured form, whatever its kind, so that the node affinity,
+// the owner references, and the labels of the fan-out copies are written in the same way at the path of the pod
+// template. The kinds that the clientset serves keep going through it, which the informers of the controller
+// watch, and the other kinds, such as replicasets, pods, or custom resources embedding a pod template, go through
+// the dynamic client.
+//
+// No informer watches the generic kinds, as the controller can't tell them in advance. A generic workload that
+// is deleted or changed by hand is therefore put back, and its status refreshed, only at the next reconciliation
+// of its selectivedeployment. The node events still reach the selectivedeployments with generic workloads through
+// the nodes that their status lists.
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/kubernetes"
+)
+
+// workloadKind is a kind of workload that the clientset serves, along with the path to the pod template in its objects
+type workloadKind struct {
+	gvk          schema.GroupVersionKind
+	resource     string
+	templatePath []string
+	// The pods are picked by a label selector, which takes the labels of the fan-out copies as well
+	hasSelector bool
+	// The replica count can be set for the fan-out copies
+	hasReplicas bool
+}
+
+var typedKinds = []workloadKind{
+	{appsv1.SchemeGroupVersion.WithKind("Deployment"), "deployments", []string{"spec", "template"}, true, true},
+	{appsv1.SchemeGroupVersion.WithKind("DaemonSet"), "daemonsets", []string{"spec", "template"}, true, false},
+	{appsv1.SchemeGroupVersion.WithKind("StatefulSet"), "statefulsets", []string{"spec", "template"}, true, true},
+	// The selector of a job is generated by Kubernetes
+	{batchv1.SchemeGroupVersion.WithKind("Job"), "jobs", []string{"spec", "template"}, false, false},
+	{batchv1beta.SchemeGroupVersion.WithKind("CronJob"), "cronjobs", []string{"spec", "jobTemplate", "spec", "template"}, false, false},
+}
+
+// typedKind returns the kind that the clientset serves under the name given
+func typedKind(kind string) (workloadKind, bool) {
+	for _, kindRow := range typedKinds {
+		if kindRow.gvk.Kind == kind {
+			return kindRow, true
+		}
+	}
+	return workloadKind{}, false
+}
+
+// workload is a workload of the selectivedeployment in the unstructured form
+type workload struct {
+	object   *unstructured.Unstructured
+	resource schema.GroupVersionResource
+	// The path to the pod template, which is the object itself for a pod
+	templatePath []string
+	hasSelector  bool
+	hasReplicas  bool
+	// The kinds that the clientset serves are typed, the others go through the dynamic client
+	typed bool
+}
+
+func (w workload) kind() string {
+	return w.object.GetKind()
+}
+
+func (w workload) name() string {
+	return w.object.GetName()
+}
+
+// deepCopy returns a copy of the workload whose object can be changed
+func (w workload) deepCopy() workload {
+	w.object = w.object.DeepCopy()
+	w.templatePath = append([]string{}, w.templatePath...)
+	return w
+}
+
+// affinityPath is the path to the affinity of the pods
+func (w workload) affinityPath() []string {
+	return append(append([]string{}, w.templatePath...), "spec", "affinity")
+}
+
+// specWorkloads gathers the workloads in the spec of the selectivedeployment, and the messages about the generic
+// workloads that cannot be decoded
+func specWorkloads(workloads apps_v1alpha.Workloads) ([]workload, []string) {
+	workloadList := []workload{}
+	messages := []string{}
+	addTyped := func(kind string, i int, obj interface{}) {
+		workloadObj, err := typedWorkload(kind, obj)
+		if err != nil {
+			messages = append(messages, fmt.Sprintf(statusDict["workload-invalid"], kind, i, err))
+			return
+		}
+		workloadList = append(workloadList, workloadObj)
+	}
+	for i := range workloads.Deployment {
+		addTyped("Deployment", i, &workloads.Deployment[i])
+	}
+	for i := range workloads.DaemonSet {
+		addTyped("DaemonSet", i, &workloads.DaemonSet[i])
+	}
+	for i := range workloads.StatefulSet {
+		addTyped("StatefulSet", i, &workloads.StatefulSet[i])
+	}
+	for i := range workloads.Job {
+		addTyped("Job", i, &workloads.Job[i])
+	}
+	for i := range workloads.CronJob {
+		addTyped("CronJob", i, &workloads.CronJob[i])
+	}
+	for i, genericRow := range workloads.Generic {
+		workloadObj, err := genericWorkload(genericRow)
+		if err != nil {
+			messages = append(messages, fmt.Sprintf(statusDict["workload-invalid"], genericRow.Kind, i, err))
+			continue
+		}
+		workloadList = append(workloadList, workloadObj)
+	}
+	return workloadList, messages
+}
+
+// typedWorkload converts a workload of a kind that the clientset serves into the unstructured form
+func typedWorkload(kind string, obj interface{}) (workload, error) {
+	kindRow, _ := typedKind(kind)
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return workload{}, err
+	}
+	object := &unstructured.Unstructured{Object: content}
+	object.SetGroupVersionKind(kindRow.gvk)
+	return workload{
+		object:       object,
+		resource:     kindRow.gvk.GroupVersion().WithResource(kindRow.resource),
+		templatePath: kindRow.templatePath,
+		hasSelector:  kindRow.hasSelector,
+		hasReplicas:  kindRow.hasReplicas,
+		typed:        true,
+	}, nil
+}
+
+// genericWorkload decodes the object of a generic workload, whose resource is guessed from the kind unless it is given
+func genericWorkload(genericRow apps_v1alpha.GenericWorkload) (workload, error) {
+	if len(genericRow.Object.Raw) == 0 {
+		return workload{}, fmt.Errorf("the object is empty")
+	}
+	content := map[string]interface{}{}
+	// The numbers are decoded into integers where possible as the unstructured objects expect
+	if err := utiljson.Unmarshal(genericRow.Object.Raw, &content); err != nil {
+		return workload{}, err
+	}
+	object := &unstructured.Unstructured{Object: content}
+	gvk := schema.FromAPIVersionAndKind(genericRow.APIVersion, genericRow.Kind)
+	object.SetGroupVersionKind(gvk)
+	if object.GetName() == "" {
+		return workload{}, fmt.Errorf("the object has no name")
+	}
+	resource, _ := meta.UnsafeGuessKindToResource(gvk)
+	if genericRow.Resource != "" {
+		resource = gvk.GroupVersion().WithResource(genericRow.Resource)
+	}
+	templatePath := []string{}
+	if genericRow.TemplatePath != "" {
+		templatePath = strings.Split(genericRow.TemplatePath, ".")
+		if _, found, err := unstructured.NestedMap(content, templatePath...); !found || err != nil {
+			return workload{}, fmt.Errorf("no pod template at %s", genericRow.TemplatePath)
+		}
+	}
+	_, hasSelector, _ := unstructured.NestedMap(content, "spec", "selector")
+	_, hasReplicas, _ := unstructured.NestedInt64(content, "spec", "replicas")
+	return workload{object: object, resource: resource, templatePath: templatePath, hasSelector: hasSelector, hasReplicas: hasReplicas}, nil
+}
+
+// setNodeAffinity writes the node affinity made of the terms into the pod template, or resets the affinity if there is no term
+func (w workload) setNodeAffinity(nodeSelectorTerms []corev1.NodeSelectorTerm, preferredTerms []corev1.PreferredSchedulingTerm) error {
+	affinityPath := w.affinityPath()
+	if len(nodeSelectorTerms) == 0 && len(preferredTerms) == 0 {
+		if _, found, _ := unstructured.NestedFieldNoCopy(w.object.Object, affinityPath...); found {
+			return unstructured.SetNestedMap(w.object.Object, map[string]interface{}{}, affinityPath...)
+		}
+		return nil
+	}
+	nodeAffinity := &corev1.NodeAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: preferredTerms,
+	}
+	if len(nodeSelectorTerms) > 0 {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
+			NodeSelectorTerms: nodeSelectorTerms,
+		}
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(nodeAffinity)
+	if err != nil {
+		return err
+	}
+	return unstructured.SetNestedField(w.object.Object, content, append(affinityPath, "nodeAffinity")...)
+}
+
+// restoreAffinity puts the affinity of the workload in the spec back, which drops the node affinity injected
+func (w workload) restoreAffinity(specWorkload workload) error {
+	affinity, found, err := unstructured.NestedFieldCopy(specWorkload.object.Object, specWorkload.affinityPath()...)
+	if err != nil {
+		return err
+	} else if !found {
+		unstructured.RemoveNestedField(w.object.Object, w.affinityPath()...)
+		return nil
+	}
+	return unstructured.SetNestedField(w.object.Object, affinity, w.affinityPath()...)
+}
+
+// setLabels adds the labels given to the workload and to its pod template, and to its selector if it has one
+func (w workload) setLabels(additions map[string]string) error {
+	addLabels := func(labels map[string]string) map[string]string {
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		for key, value := range additions {
+			labels[key] = value
+		}
+		return labels
+	}
+	w.object.SetLabels(addLabels(w.object.GetLabels()))
+	if len(w.templatePath) != 0 {
+		labelsPath := append(append([]string{}, w.templatePath...), "metadata", "labels")
+		labels, _, err := unstructured.NestedStringMap(w.object.Object, labelsPath...)
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedStringMap(w.object.Object, addLabels(labels), labelsPath...); err != nil {
+			return err
+		}
+	}
+	if w.hasSelector {
+		labels, _, err := unstructured.NestedStringMap(w.object.Object, "spec", "selector", "matchLabels")
+		if err != nil {
+			return err
+		}
+		return unstructured.SetNestedStringMap(w.object.Object, addLabels(labels), "spec", "selector", "matchLabels")
+	}
+	return nil
+}
+
+// setReplicas sets the replica count of the workload if its kind has one
+func (w workload) setReplicas(replicas int32) error {
+	if !w.hasReplicas {
+		return nil
+	}
+	return unstructured.SetNestedField(w.object.Object, int64(replicas), "spec", "replicas")
+}
+
+// workloadInterface is the part of the dynamic client that the handler uses, so that the typed workloads
+// can go through the clientset in the same way
+type workloadInterface interface {
+	Get(ctx context.Context, name string, options metav1.GetOptions, subresources ...string) (*unstructured.Unstructured, error)
+	Create(ctx context.Context, obj *unstructured.Unstructured, options metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error)
+	Update(ctx context.Context, obj *unstructured.Unstructured, options metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error)
+	Delete(ctx context.Context, name string, options metav1.DeleteOptions, subresources ...string) error
+	List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error)
+}
+
+// workloadClient returns the client of the workload kind in the namespace given
+func (t *SDHandler) workloadClient(workloadRow workload, namespace string) workloadInterface {
+	if workloadRow.typed {
+		return typedClient{clientset: t.clientset, namespace: namespace, kind: workloadRow.kind()}
+	}
+	return t.dynamicClientset.Resource(workloadRow.resource).Namespace(namespace)
+}
+
+// typedClient converts the unstructured objects to call the clientset
+type typedClient struct {
+	clientset kubernetes.Interface
+	namespace string
+	kind      string
+}
+
+// Get returns the workload in the unstructured form
+func (c typedClient) Get(ctx context.Context, name string, options metav1.GetOptions, _ ...string) (*unstructured.Unstructured, error) {
+	var obj runtime.Object
+	var err error
+	switch c.kind {
+	case "Deployment":
+		obj, err = c.clientset.AppsV1().Deployments(c.namespace).Get(ctx, name, options)
+	case "DaemonSet":
+		obj, err = c.clientset.AppsV1().DaemonSets(c.namespace).Get(ctx, name, options)
+	case "StatefulSet":
+		obj, err = c.clientset.AppsV1().StatefulSets(c.namespace).Get(ctx, name, options)
+	case "Job":
+		obj, err = c.clientset.BatchV1().Jobs(c.namespace).Get(ctx, name, options)
+	case "CronJob":
+		obj, err = c.clientset.BatchV1beta1().CronJobs(c.namespace).Get(ctx, name, options)
+	default:
+		return nil, fmt.Errorf("%s is not served by the clientset", c.kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.toUnstructured(obj)
+}
+
+// Create creates the workload through the clientset
+func (c typedClient) Create(ctx context.Context, object *unstructured.Unstructured, options metav1.CreateOptions, _ ...string) (*unstructured.Unstructured, error) {
+	obj, err := c.fromUnstructured(object)
+	if err != nil {
+		return nil, err
+	}
+	switch workloadObj := obj.(type) {
+	case *appsv1.Deployment:
+		obj, err = c.clientset.AppsV1().Deployments(c.namespace).Create(ctx, workloadObj, options)
+	case *appsv1.DaemonSet:
+		obj, err = c.clientset.AppsV1().DaemonSets(c.namespace).Create(ctx, workloadObj, options)
+	case *appsv1.StatefulSet:
+		obj, err = c.clientset.AppsV1().StatefulSets(c.namespace).Create(ctx, workloadObj, options)
+	case *batchv1.Job:
+		obj, err = c.clientset.BatchV1().Jobs(c.namespace).Create(ctx, workloadObj, options)
+	case *batchv1beta.CronJob:
+		obj, err = c.clientset.BatchV1beta1().CronJobs(c.namespace).Create(ctx, workloadObj, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.toUnstructured(obj)
+}
+
+// Update updates the workload through the clientset
+func (c typedClient) Update(ctx context.Context, object *unstructured.Unstructured, options metav1.UpdateOptions, _ ...string) (*unstructured.Unstructured, error) {
+	obj, err := c.fromUnstructured(object)
+	if err != nil {
+		return nil, err
+	}
+	switch workloadObj := obj.(type) {
+	case *appsv1.Deployment:
+		obj, err = c.clientset.AppsV1().Deployments(c.namespace).Update(ctx, workloadObj, options)
+	case *appsv1.DaemonSet:
+		obj, err = c.clientset.AppsV1().DaemonSets(c.namespace).Update(ctx, workloadObj, options)
+	case *appsv1.StatefulSet:
+		obj, err = c.clientset.AppsV1().StatefulSets(c.namespace).Update(ctx, workloadObj, options)
+	case *batchv1.Job:
+		obj, err = c.clientset.BatchV1().Jobs(c.namespace).Update(ctx, workloadObj, options)
+	case *batchv1beta.CronJob:
+		obj, err = c.clientset.BatchV1beta1().CronJobs(c.namespace).Update(ctx, workloadObj, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.toUnstructured(obj)
+}
+
+// Delete deletes the workload through the clientset
+func (c typedClient) Delete(ctx context.Context, name string, options metav1.DeleteOptions, _ ...string) error {
+	switch c.kind {
+	case "Deployment":
+		return c.clientset.AppsV1().Deployments(c.namespace).Delete(ctx, name, options)
+	case "DaemonSet":
+		return c.clientset.AppsV1().DaemonSets(c.namespace).Delete(ctx, name, options)
+	case "StatefulSet":
+		return c.clientset.AppsV1().StatefulSets(c.namespace).Delete(ctx, name, options)
+	case "Job":
+		return c.clientset.BatchV1().Jobs(c.namespace).Delete(ctx, name, options)
+	case "CronJob":
+		return c.clientset.BatchV1beta1().CronJobs(c.namespace).Delete(ctx, name, options)
+	}
+	return fmt.Errorf("%s is not served by the clientset", c.kind)
+}
+
+// List lists the workloads of the kind through the clientset
+func (c typedClient) List(ctx context.Context, options metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	var obj runtime.Object
+	var err error
+	switch c.kind {
+	case "Deployment":
+		obj, err = c.clientset.AppsV1().Deployments(c.namespace).List(ctx, options)
+	case "DaemonSet":
+		obj, err = c.clientset.AppsV1().DaemonSets(c.namespace).List(ctx, options)
+	case "StatefulSet":
+		obj, err = c.clientset.AppsV1().StatefulSets(c.namespace).List(ctx, options)
+	case "Job":
+		obj, err = c.clientset.BatchV1().Jobs(c.namespace).List(ctx, options)
+	case "CronJob":
+		obj, err = c.clientset.BatchV1beta1().CronJobs(c.namespace).List(ctx, options)
+	default:
+		return nil, fmt.Errorf("%s is not served by the clientset", c.kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(obj)
+	if err != nil {
+		return nil, err
+	}
+	list := &unstructured.UnstructuredList{}
+	for _, item := range items {
+		object, err := c.toUnstructured(item)
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, *object)
+	}
+	return list, nil
+}
+
+func (c typedClient) toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	object := &unstructured.Unstructured{Object: content}
+	kindRow, _ := typedKind(c.kind)
+	object.SetGroupVersionKind(kindRow.gvk)
+	return object, nil
+}
+
+func (c typedClient) fromUnstructured(object *unstructured.Unstructured) (runtime.Object, error) {
+	var obj runtime.Object
+	switch c.kind {
+	case "Deployment":
+		obj = &appsv1.Deployment{}
+	case "DaemonSet":
+		obj = &appsv1.DaemonSet{}
+	case "StatefulSet":
+		obj = &appsv1.StatefulSet{}
+	case "Job":
+		obj = &batchv1.Job{}
+	case "CronJob":
+		obj = &batchv1beta.CronJob{}
+	default:
+		return nil, fmt.Errorf("%s is not served by the clientset", c.kind)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.UnstructuredContent(), obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// genericStatus reads the pods desired and ready of a workload whose kind is unknown, from the replicas in its spec and
+// its status, or from the phase for a pod
+func genericStatus(object *unstructured.Unstructured) apps_v1alpha.WorkloadStatus {
+	status := apps_v1alpha.WorkloadStatus{Kind: object.GetKind(), Name: object.GetName(), Replicas: 1}
+	if object.GetKind() == "Pod" {
+		if phase, _, _ := unstructured.NestedString(object.Object, "status", "phase"); phase == string(corev1.PodRunning) || phase == string(corev1.PodSucceeded) {
+			status.ReadyReplicas = 1
+		}
+		return status
+	}
+	if replicas, found, err := unstructured.NestedInt64(object.Object, "spec", "replicas"); found && err == nil {
+		status.Replicas = int32(replicas)
+	}
+	if readyReplicas, found, err := unstructured.NestedInt64(object.Object, "status", "readyReplicas"); found && err == nil {
+		status.ReadyReplicas = int32(readyReplicas)
+	}
+	return status
+}
@@ -29,20 +29,24 @@ import (
 	"github.com/EdgeNet-project/edgenet/pkg/mailer"
 	ns "github.com/EdgeNet-project/edgenet/pkg/namespace"
 	"github.com/EdgeNet-project/edgenet/pkg/permission"
+	"github.com/EdgeNet-project/edgenet/pkg/recorder"
 
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
 	Init(kubernetes kubernetes.Interface, edgenet versioned.Interface)
-	ObjectCreated(obj interface{})
-	ObjectUpdated(obj, updated interface{})
-	ObjectDeleted(obj interface{})
+	ObjectCreated(obj interface{}) error
+	ObjectUpdated(obj, updated interface{}) error
+	ObjectDeleted(obj interface{}) error
+	ObjectFailed(obj interface{}, err error)
 }
 
 // Handler implementation
@@ -52,6 +56,7 @@ type Handler struct {
 	lowResourceQuota  *corev1.ResourceQuota
 	medResourceQuota  *corev1.ResourceQuota
 	highResourceQuota *corev1.ResourceQuota
+	recorder          record.EventRecorder
 }
 
 // Init handles any handler initialization
@@ -59,6 +64,7 @@ func (t *Handler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interf
 	log.Info("SliceHandler.Init")
 	t.clientset = kubernetes
 	t.edgenetClientset = edgenet
+	t.recorder = recorder.New(kubernetes, "slice-controller")
 
 	t.lowResourceQuota = &corev1.ResourceQuota{}
 	t.lowResourceQuota.Name = "slice-low-quota"
@@ -90,14 +96,20 @@ func (t *Handler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interf
 	permission.Clientset = t.clientset
 }
 
-// ObjectCreated is called when an object is created
-func (t *Handler) ObjectCreated(obj interface{}) {
+// ObjectCreated is called when an object is created, the event is retried if it returns an error
+func (t *Handler) ObjectCreated(obj interface{}) error {
 	log.Info("SliceHandler.ObjectCreated")
 	// Create a copy of the slice object to make changes on it
 	sliceCopy := obj.(*apps_v1alpha.Slice).DeepCopy()
 	// Find the authority from the namespace in which the object is
-	sliceOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), sliceCopy.GetNamespace(), metav1.GetOptions{})
-	sliceOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), sliceOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	sliceOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(context.TODO(), sliceCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	sliceOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), sliceOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	sliceChildNamespaceStr := fmt.Sprintf("%s-slice-%s", sliceCopy.GetNamespace(), sliceCopy.GetName())
 	// The section below checks whether the slice belongs to a team or directly to a authority. After then, set the value as enabled
 	// if the authority and the team (if it is an owner) enabled.
@@ -105,8 +117,11 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 	if sliceOwnerNamespace.Labels["owner"] == "team" {
 		sliceOwnerEnabled = sliceOwnerAuthority.Spec.Enabled
 		if sliceOwnerEnabled {
-			sliceOwnerTeam, _ := t.edgenetClientset.AppsV1alpha().Teams(fmt.Sprintf("authority-%s", sliceOwnerNamespace.Labels["authority-name"])).
+			sliceOwnerTeam, err := t.edgenetClientset.AppsV1alpha().Teams(fmt.Sprintf("authority-%s", sliceOwnerNamespace.Labels["authority-name"])).
 				Get(context.TODO(), sliceOwnerNamespace.Labels["owner-name"], metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
 			sliceOwnerEnabled = sliceOwnerTeam.Spec.Enabled
 		}
 	} else {
@@ -136,33 +151,45 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 					ownerReferences := t.getOwnerReferences(sliceCopy, sliceChildNamespaceCreated)
 					sliceCopy.ObjectMeta.OwnerReferences = ownerReferences
 					t.edgenetClientset.AppsV1alpha().Slices(sliceCopy.GetNamespace()).Update(context.TODO(), sliceCopy, metav1.UpdateOptions{})
+					t.recorder.Eventf(sliceCopy, corev1.EventTypeNormal, "Created", "Slice namespace %s created with the %s profile", sliceChildNamespaceCreated.GetName(), sliceCopy.Spec.Profile)
 				} else {
 					t.runUserInteractions(sliceCopy, sliceChildNamespaceCreated.GetName(), sliceOwnerNamespace.Labels["authority-name"],
 						sliceOwnerNamespace.Labels["owner"], sliceOwnerNamespace.Labels["owner-name"], "slice-crash", true)
-					t.edgenetClientset.AppsV1alpha().Slices(sliceCopy.GetNamespace()).Delete(context.TODO(), sliceCopy.GetName(), metav1.DeleteOptions{})
-					return
+					t.recorder.Eventf(sliceCopy, corev1.EventTypeWarning, "NamespaceFailed", "Slice namespace %s couldn't be created, the slice is removed: %s", sliceChildNamespaceStr, err)
+					return t.delete(sliceCopy)
 				}
 			} else if !resourcesAvailability {
 				log.Printf("Total resource quota exceeded for %s, %s couldn't be generated", sliceOwnerNamespace.Labels["authority-name"], sliceCopy.GetName())
 				t.runUserInteractions(sliceCopy, sliceChildNamespaceStr, sliceOwnerNamespace.Labels["authority-name"], sliceOwnerNamespace.Labels["owner"], sliceOwnerNamespace.Labels["owner-name"], "slice-total-quota-exceeded", false)
-				t.edgenetClientset.AppsV1alpha().Slices(sliceCopy.GetNamespace()).Delete(context.TODO(), sliceCopy.GetName(), metav1.DeleteOptions{})
+				t.recorder.Eventf(sliceCopy, corev1.EventTypeWarning, "QuotaExceeded", "Total resource quota of %s exceeded, the slice is removed", sliceOwnerNamespace.Labels["authority-name"])
+				return t.delete(sliceCopy)
 			}
 		}
 		// Run timeout goroutine
 		go t.runTimeout(sliceCopy)
 	} else {
-		t.edgenetClientset.AppsV1alpha().Slices(sliceCopy.GetNamespace()).Delete(context.TODO(), sliceCopy.GetName(), metav1.DeleteOptions{})
+		if err := t.delete(sliceCopy); err != nil {
+			return err
+		}
+		t.recorder.Event(sliceCopy, corev1.EventTypeWarning, "OwnerDisabled", "Authority or team that owns the slice disabled, the slice is removed")
 	}
+	return nil
 }
 
-// ObjectUpdated is called when an object is updated
-func (t *Handler) ObjectUpdated(obj, updated interface{}) {
+// ObjectUpdated is called when an object is updated, the event is retried if it returns an error
+func (t *Handler) ObjectUpdated(obj, updated interface{}) error {
 	log.Info("SliceHandler.ObjectUpdated")
 	// Create a copy of the slice object to make changes on it
 	sliceCopy := obj.(*apps_v1alpha.Slice).DeepCopy()
 	// Find the authority from the namespace in which the object is
-	sliceOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), sliceCopy.GetNamespace(), metav1.GetOptions{})
-	sliceOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), sliceOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	sliceOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(context.TODO(), sliceCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	sliceOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), sliceOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	sliceChildNamespaceStr := fmt.Sprintf("%s-slice-%s", sliceCopy.GetNamespace(), sliceCopy.GetName())
 	fieldUpdated := updated.(fields)
 	// The section below checks whether the slice belongs to a team or directly to a authority. After then, set the value as enabled
@@ -171,8 +198,11 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 	if sliceOwnerNamespace.Labels["owner"] == "team" {
 		sliceOwnerEnabled = sliceOwnerAuthority.Spec.Enabled
 		if sliceOwnerEnabled {
-			sliceOwnerTeam, _ := t.edgenetClientset.AppsV1alpha().Teams(fmt.Sprintf("authority-%s", sliceOwnerNamespace.Labels["authority-name"])).
+			sliceOwnerTeam, err := t.edgenetClientset.AppsV1alpha().Teams(fmt.Sprintf("authority-%s", sliceOwnerNamespace.Labels["authority-name"])).
 				Get(context.TODO(), sliceOwnerNamespace.Labels["owner-name"], metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
 			sliceOwnerEnabled = sliceOwnerTeam.Spec.Enabled
 		}
 	} else {
@@ -182,7 +212,9 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 	if sliceOwnerEnabled {
 		// If the users who participate in the slice have changed
 		if fieldUpdated.users.status { // Delete all existing role bindings in the slice (child) namespace
-			t.clientset.RbacV1().RoleBindings(sliceChildNamespaceStr).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{})
+			if err := t.clientset.RbacV1().RoleBindings(sliceChildNamespaceStr).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{}); err != nil {
+				return err
+			}
 			// Create role bindings in the slice namespace from scratch
 			t.runUserInteractions(sliceCopy, sliceChildNamespaceStr, sliceOwnerNamespace.Labels["authority-name"],
 				sliceOwnerNamespace.Labels["owner"], sliceOwnerNamespace.Labels["owner-name"], "slice-creation", false)
@@ -201,6 +233,7 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 					t.sendEmail(addedUser.Username, addedUser.Authority, sliceOwnerNamespace.Labels["authority-name"], sliceCopy.GetNamespace(), sliceCopy.GetName(), sliceChildNamespaceStr, "slice-creation")
 				}
 			}
+			t.recorder.Eventf(sliceCopy, corev1.EventTypeNormal, "UsersUpdated", "Role bindings regenerated, %d user(s) added and %d user(s) removed", len(addedUserList), len(deletedUserList))
 		}
 		// If the slice renewed or its profile updated
 		if sliceCopy.Spec.Renew || fieldUpdated.profile.status {
@@ -212,6 +245,7 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 				if err == nil {
 					sliceCopy = sliceCopyUpdate
 				}
+				t.recorder.Event(sliceCopy, corev1.EventTypeNormal, "Renewed", "Slice renewed")
 			}
 			if fieldUpdated.profile.status {
 				resourcesAvailability := t.checkResourcesAvailabilityForSlice(sliceCopy, sliceOwnerNamespace.Labels["authority-name"])
@@ -222,19 +256,47 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 						sliceCopy = sliceCopyUpdate
 						t.runUserInteractions(sliceCopy, sliceChildNamespaceStr, sliceOwnerNamespace.Labels["authority-name"], sliceOwnerNamespace.Labels["owner"], sliceOwnerNamespace.Labels["owner-name"], "slice-lack-of-quota", false)
 					}
+					t.recorder.Eventf(sliceCopy, corev1.EventTypeWarning, "QuotaExceeded", "Total resource quota of %s doesn't allow the profile change, the profile is reverted to %s",
+						sliceOwnerNamespace.Labels["authority-name"], fieldUpdated.profile.old)
 				}
 			}
 			t.setConstrainsByProfile(sliceChildNamespaceStr, sliceCopy)
 		}
 	} else {
-		t.edgenetClientset.AppsV1alpha().Slices(sliceCopy.GetNamespace()).Delete(context.TODO(), sliceCopy.GetName(), metav1.DeleteOptions{})
+		if err := t.delete(sliceCopy); err != nil {
+			return err
+		}
+		t.recorder.Event(sliceCopy, corev1.EventTypeWarning, "OwnerDisabled", "Authority or team that owns the slice disabled, the slice is removed")
 	}
+	return nil
 }
 
 // ObjectDeleted is called when an object is deleted
-func (t *Handler) ObjectDeleted(obj interface{}) {
+func (t *Handler) ObjectDeleted(obj interface{}) error {
 	log.Info("SliceHandler.ObjectDeleted")
 	// Mail notification, TBD
+	return nil
+}
+
+// ObjectFailed is called when the controller gives up on an object after its retries
+func (t *Handler) ObjectFailed(obj interface{}, err error) {
+	log.Info("SliceHandler.ObjectFailed")
+	sliceCopy := obj.(*apps_v1alpha.Slice).DeepCopy()
+	sliceCopy.Status.State = failure
+	message := fmt.Sprintf(statusDict["reconcile-failure"], err)
+	recorder.ReconcileFailed(t.recorder, sliceCopy, &sliceCopy.Status.Message, &sliceCopy.Status.Conditions, "Reconciled", message)
+	if _, err := t.edgenetClientset.AppsV1alpha().Slices(sliceCopy.GetNamespace()).UpdateStatus(context.TODO(), sliceCopy, metav1.UpdateOptions{}); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// delete removes the slice, which may be gone already
+func (t *Handler) delete(sliceCopy *apps_v1alpha.Slice) error {
+	err := t.edgenetClientset.AppsV1alpha().Slices(sliceCopy.GetNamespace()).Delete(context.TODO(), sliceCopy.GetName(), metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
 }
 
 // getOwnerReferences returns the users and the child namespace as owners
@@ -421,6 +483,7 @@ timeoutLoop:
 			break timeoutOptions
 		case <-timeout:
 			t.edgenetClientset.AppsV1alpha().Slices(sliceCopy.GetNamespace()).Delete(context.TODO(), sliceCopy.GetName(), metav1.DeleteOptions{})
+			t.recorder.Event(sliceCopy, corev1.EventTypeNormal, "Expired", "Slice expired, it is removed")
 			break timeoutOptions
 		case <-terminated:
 			watchSlice.Stop()
@@ -27,20 +27,24 @@ import (
 	"github.com/EdgeNet-project/edgenet/pkg/mailer"
 	ns "github.com/EdgeNet-project/edgenet/pkg/namespace"
 	"github.com/EdgeNet-project/edgenet/pkg/permission"
+	"github.com/EdgeNet-project/edgenet/pkg/recorder"
 
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
 	Init(kubernetes kubernetes.Interface, edgenet versioned.Interface)
-	ObjectCreated(obj interface{})
-	ObjectUpdated(obj, updated interface{})
-	ObjectDeleted(obj, deleted interface{})
+	ObjectCreated(obj interface{}) error
+	ObjectUpdated(obj, updated interface{}) error
+	ObjectDeleted(obj, deleted interface{}) error
+	ObjectFailed(obj interface{}, err error)
 }
 
 // Handler implementation
@@ -48,6 +52,7 @@ type Handler struct {
 	clientset        kubernetes.Interface
 	edgenetClientset versioned.Interface
 	resourceQuota    *corev1.ResourceQuota
+	recorder         record.EventRecorder
 }
 
 // Init handles any handler initialization
@@ -55,6 +60,7 @@ func (t *Handler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interf
 	log.Info("TeamHandler.Init")
 	t.clientset = kubernetes
 	t.edgenetClientset = edgenet
+	t.recorder = recorder.New(kubernetes, "team-controller")
 	t.resourceQuota = &corev1.ResourceQuota{}
 	t.resourceQuota.Name = "team-quota"
 	t.resourceQuota.Spec = corev1.ResourceQuotaSpec{
@@ -80,14 +86,20 @@ func (t *Handler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interf
 	permission.Clientset = t.clientset
 }
 
-// ObjectCreated is called when an object is created
-func (t *Handler) ObjectCreated(obj interface{}) {
+// ObjectCreated is called when an object is created, the event is retried if it returns an error
+func (t *Handler) ObjectCreated(obj interface{}) error {
 	log.Info("TeamHandler.ObjectCreated")
 	// Create a copy of the team object to make changes on it
 	teamCopy := obj.(*apps_v1alpha.Team).DeepCopy()
 	// Find the authority from the namespace in which the object is
-	teamOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), teamCopy.GetNamespace(), metav1.GetOptions{})
-	teamOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), teamOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	teamOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(context.TODO(), teamCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	teamOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), teamOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	// Check if the authority is active
 	if teamOwnerAuthority.Spec.Enabled && teamCopy.Spec.Enabled {
 		// If the service restarts, it creates all objects again
@@ -103,8 +115,8 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 			if err != nil {
 				t.runUserInteractions(teamCopy, teamChildNamespaceCreated.GetName(), teamOwnerNamespace.Labels["authority-name"],
 					teamOwnerNamespace.Labels["owner"], teamOwnerNamespace.Labels["owner-name"], "team-crash", true)
-				t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).Delete(context.TODO(), teamCopy.GetName(), metav1.DeleteOptions{})
-				return
+				t.recorder.Eventf(teamCopy, corev1.EventTypeWarning, "NamespaceFailed", "Team namespace %s couldn't be created, the team is removed: %s", teamChildNamespace.GetName(), err)
+				return t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).Delete(context.TODO(), teamCopy.GetName(), metav1.DeleteOptions{})
 			}
 			// Delete all existing role bindings in the team (child) namespace
 			t.clientset.RbacV1().RoleBindings(teamChildNamespaceCreated.GetName()).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{})
@@ -112,21 +124,34 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 			t.runUserInteractions(teamCopy, teamChildNamespaceCreated.GetName(), teamOwnerNamespace.Labels["authority-name"], teamOwnerNamespace.Labels["owner"], teamOwnerNamespace.Labels["owner-name"], "team-creation", true)
 			ownerReferences := t.getOwnerReferences(teamCopy, teamChildNamespaceCreated)
 			teamCopy.ObjectMeta.OwnerReferences = ownerReferences
-			t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).Update(context.TODO(), teamCopy, metav1.UpdateOptions{})
+			if _, err := t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).Update(context.TODO(), teamCopy, metav1.UpdateOptions{}); err != nil {
+				return err
+			}
+			t.recorder.Eventf(teamCopy, corev1.EventTypeNormal, "Created", "Team namespace %s created", teamChildNamespaceCreated.GetName())
 		}
 	} else if !teamOwnerAuthority.Spec.Enabled {
-		t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).Delete(context.TODO(), teamCopy.GetName(), metav1.DeleteOptions{})
+		if err := t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).Delete(context.TODO(), teamCopy.GetName(), metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+		t.recorder.Event(teamCopy, corev1.EventTypeWarning, "AuthorityDisabled", "Authority disabled, the team is removed")
 	}
+	return nil
 }
 
-// ObjectUpdated is called when an object is updated
-func (t *Handler) ObjectUpdated(obj, updated interface{}) {
+// ObjectUpdated is called when an object is updated, the event is retried if it returns an error
+func (t *Handler) ObjectUpdated(obj, updated interface{}) error {
 	log.Info("TeamHandler.ObjectUpdated")
 	// Create a copy of the team object to make changes on it
 	teamCopy := obj.(*apps_v1alpha.Team).DeepCopy()
 	// Find the authority from the namespace in which the object is
-	teamOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), teamCopy.GetNamespace(), metav1.GetOptions{})
-	teamOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), teamOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	teamOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(context.TODO(), teamCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	teamOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), teamOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	teamChildNamespaceStr := fmt.Sprintf("%s-team-%s", teamCopy.GetNamespace(), teamCopy.GetName())
 	fieldUpdated := updated.(fields)
 	// Check if the authority and team are active
@@ -151,20 +176,32 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 					t.sendEmail(addedUser.Username, addedUser.Authority, teamOwnerNamespace.Labels["authority-name"], teamCopy.GetNamespace(), teamCopy.GetName(), teamChildNamespaceStr, "team-creation")
 				}
 			}
+			t.recorder.Eventf(teamCopy, corev1.EventTypeNormal, "UsersUpdated", "Role bindings regenerated, %d user(s) added and %d user(s) removed", len(addedUserList), len(deletedUserList))
 		}
 	} else if teamOwnerAuthority.Spec.Enabled && !teamCopy.Spec.Enabled {
-		t.edgenetClientset.AppsV1alpha().Slices(teamChildNamespaceStr).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{})
-		t.clientset.RbacV1().RoleBindings(teamChildNamespaceStr).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{})
+		if err := t.edgenetClientset.AppsV1alpha().Slices(teamChildNamespaceStr).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{}); err != nil {
+			return err
+		}
+		if err := t.clientset.RbacV1().RoleBindings(teamChildNamespaceStr).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{}); err != nil {
+			return err
+		}
+		t.recorder.Event(teamCopy, corev1.EventTypeNormal, "Disabled", "Team disabled, its slices and role bindings are deleted")
 	} else if !teamOwnerAuthority.Spec.Enabled {
-		t.edgenetClientset.AppsV1alpha().Teams(teamChildNamespaceStr).Delete(context.TODO(), teamCopy.GetName(), metav1.DeleteOptions{})
+		if err := t.edgenetClientset.AppsV1alpha().Teams(teamChildNamespaceStr).Delete(context.TODO(), teamCopy.GetName(), metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		t.recorder.Event(teamCopy, corev1.EventTypeWarning, "AuthorityDisabled", "Authority disabled, the team is removed")
 	}
+	return nil
 }
 
-// ObjectDeleted is called when an object is deleted
-func (t *Handler) ObjectDeleted(obj, deleted interface{}) {
+// ObjectDeleted is called when an object is deleted, the event is retried if it returns an error
+func (t *Handler) ObjectDeleted(obj, deleted interface{}) error {
 	log.Info("TeamHandler.ObjectDeleted")
 	fieldDeleted := deleted.(fields)
-	t.clientset.CoreV1().Namespaces().Delete(context.TODO(), fieldDeleted.object.childNamespace, metav1.DeleteOptions{})
+	if err := t.clientset.CoreV1().Namespaces().Delete(context.TODO(), fieldDeleted.object.childNamespace, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
 	// If there are users who participate in the team and team is enabled
 	if fieldDeleted.users.status && fieldDeleted.enabled {
 		teamOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), fieldDeleted.object.ownerNamespace, metav1.GetOptions{})
@@ -176,6 +213,19 @@ func (t *Handler) ObjectDeleted(obj, deleted interface{}) {
 			}
 		}
 	}
+	return nil
+}
+
+// ObjectFailed is called when the controller gives up on an object after its retries
+func (t *Handler) ObjectFailed(obj interface{}, err error) {
+	log.Info("TeamHandler.ObjectFailed")
+	teamCopy := obj.(*apps_v1alpha.Team).DeepCopy()
+	teamCopy.Status.State = failure
+	message := fmt.Sprintf(statusDict["reconcile-failure"], err)
+	recorder.ReconcileFailed(t.recorder, teamCopy, &teamCopy.Status.Message, &teamCopy.Status.Conditions, "Reconciled", message)
+	if _, err := t.edgenetClientset.AppsV1alpha().Teams(teamCopy.GetNamespace()).UpdateStatus(context.TODO(), teamCopy, metav1.UpdateOptions{}); err != nil {
+		log.Println(err.Error())
+	}
 }
 
 // runUserInteractions creates user role bindings according to the roles
@@ -25,6 +25,8 @@ import (
 	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
 	"github.com/EdgeNet-project/edgenet/pkg/generated/clientset/versioned"
 	"github.com/EdgeNet-project/edgenet/pkg/mailer"
+	"github.com/EdgeNet-project/edgenet/pkg/metrics"
+	"github.com/EdgeNet-project/edgenet/pkg/recorder"
 
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
@@ -32,14 +34,16 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
 	Init(kubernetes kubernetes.Interface, edgenet versioned.Interface)
-	ObjectCreated(obj interface{})
-	ObjectUpdated(obj, updated interface{})
-	ObjectDeleted(obj interface{})
+	ObjectCreated(obj interface{}) error
+	ObjectUpdated(obj, updated interface{}) error
+	ObjectDeleted(obj interface{}) error
+	ObjectFailed(obj interface{}, err error)
 }
 
 // Handler implementation
@@ -47,6 +51,7 @@ type Handler struct {
 	clientset        kubernetes.Interface
 	edgenetClientset versioned.Interface
 	resourceQuota    *corev1.ResourceQuota
+	recorder         record.EventRecorder
 }
 
 // Init handles any handler initialization
@@ -54,17 +59,22 @@ func (t *Handler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interf
 	log.Info("TotalResourceQuotaHandler.Init")
 	t.clientset = kubernetes
 	t.edgenetClientset = edgenet
+	t.recorder = recorder.New(kubernetes, "totalresourcequota-controller")
 }
 
-// ObjectCreated is called when an object is created
-func (t *Handler) ObjectCreated(obj interface{}) {
+// ObjectCreated is called when an object is created, the event is retried if it returns an error
+func (t *Handler) ObjectCreated(obj interface{}) error {
 	log.Info("TotalResourceQuotaHandler.ObjectCreated")
 	// Create a copy of the TRQ object to make changes on it
 	TRQCopy := obj.(*apps_v1alpha.TotalResourceQuota).DeepCopy()
 	// Find the authority from the namespace in which the object is
 	authority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), TRQCopy.GetName(), metav1.GetOptions{})
 	if errors.IsNotFound(err) {
-		t.edgenetClientset.AppsV1alpha().TotalResourceQuotas().Delete(context.TODO(), authority.GetName(), metav1.DeleteOptions{})
+		if err := t.edgenetClientset.AppsV1alpha().TotalResourceQuotas().Delete(context.TODO(), TRQCopy.GetName(), metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	} else if err != nil {
+		return err
 	} else {
 		// Check if the authority is active
 		if authority.Spec.Enabled && TRQCopy.Spec.Enabled {
@@ -78,6 +88,7 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 			} else {
 				log.Infof("Couldn't update the status of total resource quota in %s: %s", TRQCopy.GetName(), err)
 			}
+			t.recorder.Event(TRQCopy, corev1.EventTypeNormal, "Created", statusDict["TRQ-created"])
 			// Check the total resource consumption in authority
 			TRQCopy, _ = t.ResourceConsumptionControl(TRQCopy, 0, 0)
 			// If they reached the limit, remove some slices randomly
@@ -94,17 +105,22 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 			t.prohibitResourceConsumption(TRQCopy, authority)
 		}
 	}
+	return nil
 }
 
-// ObjectUpdated is called when an object is updated
-func (t *Handler) ObjectUpdated(obj, updated interface{}) {
+// ObjectUpdated is called when an object is updated, the event is retried if it returns an error
+func (t *Handler) ObjectUpdated(obj, updated interface{}) error {
 	log.Info("TotalResourceQuotaHandler.ObjectUpdated")
 	// Create a copy of the TRQ object to make changes on it
 	TRQCopy := obj.(*apps_v1alpha.TotalResourceQuota).DeepCopy()
 	// Find the authority from the namespace in which the object is
 	authority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), TRQCopy.GetName(), metav1.GetOptions{})
 	if errors.IsNotFound(err) {
-		t.edgenetClientset.AppsV1alpha().TotalResourceQuotas().Delete(context.TODO(), authority.GetName(), metav1.DeleteOptions{})
+		if err := t.edgenetClientset.AppsV1alpha().TotalResourceQuotas().Delete(context.TODO(), TRQCopy.GetName(), metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	} else if err != nil {
+		return err
 	} else {
 		fieldUpdated := updated.(fields)
 		// Check if the authority is active
@@ -126,12 +142,26 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 			t.prohibitResourceConsumption(TRQCopy, authority)
 		}
 	}
+	return nil
 }
 
 // ObjectDeleted is called when an object is deleted
-func (t *Handler) ObjectDeleted(obj interface{}) {
+func (t *Handler) ObjectDeleted(obj interface{}) error {
 	log.Info("TotalResourceQuotaHandler.ObjectDeleted")
 	// Delete or disable slices added by authority, TBD.
+	return nil
+}
+
+// ObjectFailed is called when the controller gives up on an object after its retries
+func (t *Handler) ObjectFailed(obj interface{}, err error) {
+	log.Info("TotalResourceQuotaHandler.ObjectFailed")
+	TRQCopy := obj.(*apps_v1alpha.TotalResourceQuota).DeepCopy()
+	// The state tells whether the quota is applied or pulled off, so only the message and the condition record the failure
+	message := fmt.Sprintf(statusDict["reconcile-failure"], err)
+	recorder.ReconcileFailed(t.recorder, TRQCopy, &TRQCopy.Status.Message, &TRQCopy.Status.Conditions, "Reconciled", message)
+	if _, err := t.edgenetClientset.AppsV1alpha().TotalResourceQuotas().UpdateStatus(context.TODO(), TRQCopy, metav1.UpdateOptions{}); err != nil {
+		log.Println(err.Error())
+	}
 }
 
 // Create generates a total resource quota with the name provided
@@ -172,6 +202,7 @@ func (t *Handler) sendEmail(username, name, email, userAuthority, sliceAuthority
 // prohibitResourceConsumption deletes all slices in authority
 func (t *Handler) prohibitResourceConsumption(TRQCopy *apps_v1alpha.TotalResourceQuota, authority *apps_v1alpha.Authority) {
 	// Delete all slices of authority
+	t.recorder.Event(TRQCopy, corev1.EventTypeWarning, "Disabled", "Authority or total resource quota disabled, all slices of the authority are deleted")
 	err := t.edgenetClientset.AppsV1alpha().Slices(fmt.Sprintf("authority-%s", TRQCopy.GetName())).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{})
 	if err != nil {
 		log.Printf("Slice deletion failed in authority %s", TRQCopy.GetName())
@@ -284,6 +315,7 @@ func (t *Handler) calculateTotalQuota(TRQCopy *apps_v1alpha.TotalResourceQuota)
 			log.Infof("Couldn't update total resource quota in %s: %s", TRQCopy.GetName(), err)
 			TRQCopy.Status.State = failure
 			TRQCopy.Status.Message = []string{statusDict["TRQ-appliedFail"]}
+			t.recorder.Eventf(TRQCopy, corev1.EventTypeWarning, "ApplyFailed", "%s: %s", statusDict["TRQ-appliedFail"], err)
 		}
 	}
 	return TRQCopy, CPUQuota, memoryQuota
@@ -348,6 +380,10 @@ func (t *Handler) checkResourceBalance(TRQCopy *apps_v1alpha.TotalResourceQuota,
 	TRQCopy.Status.Exceeded = quotaExceeded
 	TRQCopy.Status.Used.CPU = percentage(consumedCPU, CPUQuota)
 	TRQCopy.Status.Used.Memory = percentage(consumedMemory, memoryQuota)
+	metrics.AuthorityQuota.WithLabelValues(TRQCopy.GetName(), "cpu").Set(float64(CPUQuota))
+	metrics.AuthorityQuota.WithLabelValues(TRQCopy.GetName(), "memory").Set(float64(memoryQuota))
+	metrics.AuthorityUsage.WithLabelValues(TRQCopy.GetName(), "cpu").Set(float64(consumedCPU))
+	metrics.AuthorityUsage.WithLabelValues(TRQCopy.GetName(), "memory").Set(float64(consumedMemory))
 	// Check if there is an update
 	if !reflect.DeepEqual(oldTRQCopy, TRQCopy) {
 		// If there is a resource request causing the quota to be exceeded, skip this section.
@@ -407,6 +443,8 @@ func (t *Handler) balanceResourceConsumption(TRQCopy *apps_v1alpha.TotalResource
 	err := t.edgenetClientset.AppsV1alpha().Slices(oldestSlice.GetNamespace()).Delete(context.TODO(), oldestSlice.GetName(), metav1.DeleteOptions{})
 	sliceChildNamespaceStr := fmt.Sprintf("%s-slice-%s", oldestSlice.GetNamespace(), oldestSlice.GetName())
 	if err == nil {
+		t.recorder.Eventf(TRQCopy, corev1.EventTypeWarning, "SliceDeleted", "Total resource quota exceeded, the oldest slice %s in %s is deleted", oldestSlice.GetName(), oldestSlice.GetNamespace())
+		t.recorder.Eventf(&oldestSlice, corev1.EventTypeWarning, "QuotaExceeded", "Total resource quota of %s exceeded, the slice is deleted as the oldest one", TRQCopy.GetName())
 		for _, sliceUser := range oldestSlice.Spec.Users {
 			user, err := t.edgenetClientset.AppsV1alpha().Users(fmt.Sprintf("authority-%s", sliceUser.Authority)).Get(context.TODO(), sliceUser.Username, metav1.GetOptions{})
 			if err == nil && user.Spec.Active && user.Status.AUP {
@@ -416,6 +454,7 @@ func (t *Handler) balanceResourceConsumption(TRQCopy *apps_v1alpha.TotalResource
 		}
 	} else {
 		log.Printf("Slice %s deletion failed in %s", oldestSlice.GetName(), oldestSlice.GetNamespace())
+		t.recorder.Eventf(TRQCopy, corev1.EventTypeWarning, "SliceDeletionFailed", "Total resource quota exceeded, the oldest slice %s in %s couldn't be deleted: %s", oldestSlice.GetName(), oldestSlice.GetNamespace(), err)
 		t.sendEmail("", "", "", "", TRQCopy.GetName(), oldestSlice.GetNamespace(), oldestSlice.GetName(), sliceChildNamespaceStr, "slice-deletion-failed")
 	}
 	// Check out the balance again
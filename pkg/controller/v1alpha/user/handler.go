@@ -26,27 +26,32 @@ import (
 	"github.com/EdgeNet-project/edgenet/pkg/generated/clientset/versioned"
 	"github.com/EdgeNet-project/edgenet/pkg/mailer"
 	"github.com/EdgeNet-project/edgenet/pkg/permission"
+	"github.com/EdgeNet-project/edgenet/pkg/recorder"
 	"github.com/EdgeNet-project/edgenet/pkg/registration"
 
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
 	Init(kubernetes kubernetes.Interface, edgenet versioned.Interface)
-	ObjectCreated(obj interface{})
-	ObjectUpdated(obj, updated interface{})
-	ObjectDeleted(obj interface{})
+	ObjectCreated(obj interface{}) error
+	ObjectUpdated(obj, updated interface{}) error
+	ObjectDeleted(obj interface{}) error
+	ObjectFailed(obj interface{}, err error)
 }
 
 // Handler implementation
 type Handler struct {
 	clientset        kubernetes.Interface
 	edgenetClientset versioned.Interface
+	recorder         record.EventRecorder
 }
 
 // Init handles any handler initialization
@@ -54,17 +59,21 @@ func (t *Handler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interf
 	log.Info("UserHandler.Init")
 	t.clientset = kubernetes
 	t.edgenetClientset = edgenet
+	t.recorder = recorder.New(kubernetes, "user-controller")
 	permission.Clientset = t.clientset
 	registration.Clientset = t.clientset
 }
 
-// ObjectCreated is called when an object is created
-func (t *Handler) ObjectCreated(obj interface{}) {
+// ObjectCreated is called when an object is created, the event is retried if it returns an error
+func (t *Handler) ObjectCreated(obj interface{}) error {
 	log.Info("UserHandler.ObjectCreated")
 	// Create a copy of the user object to make changes on it
 	userCopy := obj.(*apps_v1alpha.User).DeepCopy()
 	// Find the authority from the namespace in which the object is
-	userOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), userCopy.GetNamespace(), metav1.GetOptions{})
+	userOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(context.TODO(), userCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	// Check if the email address is already taken
 	emailExists, message := t.checkDuplicateObject(userCopy, userOwnerNamespace.Labels["authority-name"])
 
@@ -77,10 +86,14 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 		userCopy.Status.State = failure
 		userCopy.Status.Message = []string{message}
 		t.edgenetClientset.AppsV1alpha().Users(userCopy.GetNamespace()).UpdateStatus(context.TODO(), userCopy, metav1.UpdateOptions{})
-		return
+		t.recorder.Event(userCopy, corev1.EventTypeWarning, "Duplicate", message)
+		return nil
 	}
 
-	userOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), userOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	userOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), userOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 
 	_, serviceAccountErr := t.clientset.CoreV1().ServiceAccounts(userCopy.GetNamespace()).Get(context.TODO(), userCopy.GetName(), metav1.GetOptions{})
 	if !errors.IsNotFound(serviceAccountErr) {
@@ -123,37 +136,53 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 				log.Println(err.Error())
 				userCopy.Status.State = failure
 				userCopy.Status.Message = []string{fmt.Sprintf(statusDict["cert-fail"], userCopy.GetName())}
+				t.recorder.Eventf(userCopy, corev1.EventTypeWarning, "CertFailed", "%s: %s", userCopy.Status.Message[0], err)
 				t.sendEmail(userCopy, userOwnerNamespace.Labels["authority-name"], "user-cert-failure")
-				return
+				return nil
 			}
 			err = registration.MakeConfig(userOwnerNamespace.Labels["authority-name"], userCopy.GetName(), userCopy.Spec.Email, crt, key)
 			if err != nil {
 				log.Println(err.Error())
 				userCopy.Status.State = failure
 				userCopy.Status.Message = []string{fmt.Sprintf(statusDict["kubeconfig-fail"], userCopy.GetName())}
+				t.recorder.Eventf(userCopy, corev1.EventTypeWarning, "KubeconfigFailed", "%s: %s", userCopy.Status.Message[0], err)
 				t.sendEmail(userCopy, userOwnerNamespace.Labels["authority-name"], "user-kubeconfig-failure")
 			}
 			userCopy.Status.State = success
 			userCopy.Status.Message = []string{statusDict["cert-ok"]}
+			t.recorder.Eventf(userCopy, corev1.EventTypeNormal, "Registered", "%s, the user is registered as %s", statusDict["cert-ok"], userCopy.Status.Type)
 			t.sendEmail(userCopy, userOwnerNamespace.Labels["authority-name"], "user-registration-successful")
 
-			slicesRaw, _ := t.edgenetClientset.AppsV1alpha().Slices(userCopy.GetNamespace()).List(context.TODO(), metav1.ListOptions{})
-			teamsRaw, _ := t.edgenetClientset.AppsV1alpha().Teams(userCopy.GetNamespace()).List(context.TODO(), metav1.ListOptions{})
+			slicesRaw, err := t.edgenetClientset.AppsV1alpha().Slices(userCopy.GetNamespace()).List(context.TODO(), metav1.ListOptions{})
+			if err != nil {
+				return err
+			}
+			teamsRaw, err := t.edgenetClientset.AppsV1alpha().Teams(userCopy.GetNamespace()).List(context.TODO(), metav1.ListOptions{})
+			if err != nil {
+				return err
+			}
 			t.createRoleBindings(userCopy, slicesRaw, teamsRaw, userOwnerAuthority.GetName())
 			permission.CreateAUPRoleBinding(userCopy, userOwnerReferences)
 		}
 	} else if userOwnerAuthority.Spec.Enabled == false && userCopy.Spec.Active == true {
-		defer t.edgenetClientset.AppsV1alpha().Users(userCopy.GetNamespace()).Update(context.TODO(), userCopy, metav1.UpdateOptions{})
 		userCopy.Spec.Active = false
+		if _, err := t.edgenetClientset.AppsV1alpha().Users(userCopy.GetNamespace()).Update(context.TODO(), userCopy, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		t.recorder.Event(userCopy, corev1.EventTypeWarning, "AuthorityDisabled", "Authority disabled, the user is deactivated")
 	}
+	return nil
 }
 
-// ObjectUpdated is called when an object is updated
-func (t *Handler) ObjectUpdated(obj, updated interface{}) {
+// ObjectUpdated is called when an object is updated, the event is retried if it returns an error
+func (t *Handler) ObjectUpdated(obj, updated interface{}) error {
 	log.Info("UserHandler.ObjectUpdated")
 	// Create a copy of the user object to make changes on it
 	userCopy := obj.(*apps_v1alpha.User).DeepCopy()
-	userOwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), userCopy.GetNamespace(), metav1.GetOptions{})
+	userOwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(context.TODO(), userCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	// Check if the email address is already taken
 	emailExists, message := t.checkDuplicateObject(userCopy, userOwnerNamespace.Labels["authority-name"])
 	if emailExists {
@@ -165,13 +194,20 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 		userCopy.Status.State = failure
 		userCopy.Status.Message = []string{message}
 		t.edgenetClientset.AppsV1alpha().Users(userCopy.GetNamespace()).UpdateStatus(context.TODO(), userCopy, metav1.UpdateOptions{})
-		return
+		t.recorder.Event(userCopy, corev1.EventTypeWarning, "Duplicate", message)
+		return nil
+	}
+	userOwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), userOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err != nil {
+		return err
 	}
-	userOwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), userOwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
 	fieldUpdated := updated.(fields)
 	// Security check to prevent any kind of manipulation on the AUP
 	if fieldUpdated.aup {
-		userAUP, _ := t.edgenetClientset.AppsV1alpha().AcceptableUsePolicies(userCopy.GetNamespace()).Get(context.TODO(), userCopy.GetName(), metav1.GetOptions{})
+		userAUP, err := t.edgenetClientset.AppsV1alpha().AcceptableUsePolicies(userCopy.GetNamespace()).Get(context.TODO(), userCopy.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
 		if userAUP.Spec.Accepted != userCopy.Status.AUP {
 			userCopy.Status.AUP = userAUP.Spec.Accepted
 			userCopyUpdated, err := t.edgenetClientset.AppsV1alpha().Users(userCopy.GetNamespace()).UpdateStatus(context.TODO(), userCopy, metav1.UpdateOptions{})
@@ -197,9 +233,11 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 				// Update the status as successful
 				userCopy.Status.State = success
 				userCopy.Status.Message = []string{statusDict["email-ok"]}
+				t.recorder.Event(userCopy, corev1.EventTypeNormal, "VerificationSent", "Email address changed, the user is deactivated until it gets verified")
 			} else {
 				userCopy.Status.State = failure
 				userCopy.Status.Message = []string{statusDict["email-fail"]}
+				t.recorder.Event(userCopy, corev1.EventTypeWarning, "VerificationFailed", statusDict["email-fail"])
 			}
 
 			userCopyUpdated, err = t.edgenetClientset.AppsV1alpha().Users(userCopy.GetNamespace()).UpdateStatus(context.TODO(), userCopy, metav1.UpdateOptions{})
@@ -212,8 +250,14 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 		if userCopy.Spec.Active && userCopy.Status.AUP {
 			// To manipulate role bindings according to the changes
 			if fieldUpdated.active || fieldUpdated.aup || fieldUpdated.role {
-				slicesRaw, _ := t.edgenetClientset.AppsV1alpha().Slices(userCopy.GetNamespace()).List(context.TODO(), metav1.ListOptions{})
-				teamsRaw, _ := t.edgenetClientset.AppsV1alpha().Teams(userCopy.GetNamespace()).List(context.TODO(), metav1.ListOptions{})
+				slicesRaw, err := t.edgenetClientset.AppsV1alpha().Slices(userCopy.GetNamespace()).List(context.TODO(), metav1.ListOptions{})
+				if err != nil {
+					return err
+				}
+				teamsRaw, err := t.edgenetClientset.AppsV1alpha().Teams(userCopy.GetNamespace()).List(context.TODO(), metav1.ListOptions{})
+				if err != nil {
+					return err
+				}
 				if fieldUpdated.role {
 					t.deleteRoleBindings(userCopy, slicesRaw, teamsRaw)
 				}
@@ -221,13 +265,21 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 				if fieldUpdated.active {
 					permission.CreateAUPRoleBinding(userCopy, userOwnerReferences)
 				}
+				t.recorder.Event(userCopy, corev1.EventTypeNormal, "RoleBindingsCreated", "User active with the acceptable use policy accepted, role bindings created")
 			}
 		} else if !userCopy.Spec.Active || !userCopy.Status.AUP {
 			// To manipulate role bindings according to the changes
 			if (userCopy.Spec.Active == false && fieldUpdated.active) || (userCopy.Status.AUP == false && fieldUpdated.aup) {
-				slicesRaw, _ := t.edgenetClientset.AppsV1alpha().Slices(userCopy.GetNamespace()).List(context.TODO(), metav1.ListOptions{})
-				teamsRaw, _ := t.edgenetClientset.AppsV1alpha().Teams(userCopy.GetNamespace()).List(context.TODO(), metav1.ListOptions{})
+				slicesRaw, err := t.edgenetClientset.AppsV1alpha().Slices(userCopy.GetNamespace()).List(context.TODO(), metav1.ListOptions{})
+				if err != nil {
+					return err
+				}
+				teamsRaw, err := t.edgenetClientset.AppsV1alpha().Teams(userCopy.GetNamespace()).List(context.TODO(), metav1.ListOptions{})
+				if err != nil {
+					return err
+				}
 				t.deleteRoleBindings(userCopy, slicesRaw, teamsRaw)
+				t.recorder.Event(userCopy, corev1.EventTypeNormal, "RoleBindingsDeleted", "User inactive or acceptable use policy not accepted, role bindings deleted")
 			}
 			// To create AUP role binding for the user
 			if userCopy.Spec.Active && fieldUpdated.active {
@@ -235,15 +287,32 @@ func (t *Handler) ObjectUpdated(obj, updated interface{}) {
 			}
 		}
 	} else if userOwnerAuthority.Spec.Enabled == false && userCopy.Spec.Active == true {
-		defer t.edgenetClientset.AppsV1alpha().Users(userCopy.GetNamespace()).Update(context.TODO(), userCopy, metav1.UpdateOptions{})
 		userCopy.Spec.Active = false
+		if _, err := t.edgenetClientset.AppsV1alpha().Users(userCopy.GetNamespace()).Update(context.TODO(), userCopy, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		t.recorder.Event(userCopy, corev1.EventTypeWarning, "AuthorityDisabled", "Authority disabled, the user is deactivated")
 	}
+	return nil
 }
 
 // ObjectDeleted is called when an object is deleted
-func (t *Handler) ObjectDeleted(obj interface{}) {
+func (t *Handler) ObjectDeleted(obj interface{}) error {
 	log.Info("UserHandler.ObjectDeleted")
 	// Mail notification, TBD
+	return nil
+}
+
+// ObjectFailed is called when the controller gives up on an object after its retries
+func (t *Handler) ObjectFailed(obj interface{}, err error) {
+	log.Info("UserHandler.ObjectFailed")
+	userCopy := obj.(*apps_v1alpha.User).DeepCopy()
+	userCopy.Status.State = failure
+	message := fmt.Sprintf(statusDict["reconcile-failure"], err)
+	recorder.ReconcileFailed(t.recorder, userCopy, &userCopy.Status.Message, &userCopy.Status.Conditions, "Reconciled", message)
+	if _, err := t.edgenetClientset.AppsV1alpha().Users(userCopy.GetNamespace()).UpdateStatus(context.TODO(), userCopy, metav1.UpdateOptions{}); err != nil {
+		log.Println(err.Error())
+	}
 }
 
 // Create function is for being used by other resources to create an authority
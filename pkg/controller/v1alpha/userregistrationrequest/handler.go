@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
@@ -27,25 +28,30 @@ import (
 	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/user"
 	"github.com/EdgeNet-project/edgenet/pkg/generated/clientset/versioned"
 	"github.com/EdgeNet-project/edgenet/pkg/mailer"
+	"github.com/EdgeNet-project/edgenet/pkg/recorder"
 
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 // HandlerInterface interface contains the methods that are required
 type HandlerInterface interface {
 	Init(kubernetes kubernetes.Interface, edgenet versioned.Interface)
-	ObjectCreated(obj interface{})
-	ObjectUpdated(obj interface{})
-	ObjectDeleted(obj interface{})
+	ObjectCreated(obj interface{}) error
+	ObjectUpdated(obj interface{}) error
+	ObjectDeleted(obj interface{}) error
+	ObjectFailed(obj interface{}, err error)
 }
 
 // Handler implementation
 type Handler struct {
 	clientset        kubernetes.Interface
 	edgenetClientset versioned.Interface
+	recorder         record.EventRecorder
 }
 
 // Init handles any handler initialization
@@ -53,30 +59,40 @@ func (t *Handler) Init(kubernetes kubernetes.Interface, edgenet versioned.Interf
 	log.Info("URRHandler.Init")
 	t.clientset = kubernetes
 	t.edgenetClientset = edgenet
+	t.recorder = recorder.New(kubernetes, "userregistrationrequest-controller")
 }
 
-// ObjectCreated is called when an object is created
-func (t *Handler) ObjectCreated(obj interface{}) {
+// ObjectCreated is called when an object is created, the event is retried if it returns an error
+func (t *Handler) ObjectCreated(obj interface{}) error {
 	log.Info("URRHandler.ObjectCreated")
 	// Create a copy of the user registration request object to make changes on it
 	URRCopy := obj.(*apps_v1alpha.UserRegistrationRequest).DeepCopy()
 	// Find the authority from the namespace in which the object is
-	URROwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), URRCopy.GetNamespace(), metav1.GetOptions{})
+	URROwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(context.TODO(), URRCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	// Check if the email address is already taken
 	exists, message := t.checkDuplicateObject(URRCopy, URROwnerNamespace.Labels["authority-name"])
 	if exists {
 		URRCopy.Status.State = failure
 		URRCopy.Status.Message = message
-		// Run timeout goroutine
-		go t.runApprovalTimeout(URRCopy)
+		t.recorder.Event(URRCopy, corev1.EventTypeWarning, "Duplicate", strings.Join(message, ", "))
 		// Set the approval timeout which is 24 hours
 		URRCopy.Status.Expires = &metav1.Time{
 			Time: time.Now().Add(24 * time.Hour),
 		}
-		t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRCopy.GetNamespace()).UpdateStatus(context.TODO(), URRCopy, metav1.UpdateOptions{})
-		return
+		if _, err := t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRCopy.GetNamespace()).UpdateStatus(context.TODO(), URRCopy, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		// Run timeout goroutine once the expiry date is recorded so that a retry doesn't run it twice
+		go t.runApprovalTimeout(URRCopy)
+		return nil
+	}
+	URROwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), URROwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err != nil {
+		return err
 	}
-	URROwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), URROwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
 	// Check if the authority is active
 	if URROwnerAuthority.Spec.Enabled {
 		if URRCopy.Spec.Approved {
@@ -84,11 +100,13 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 			userHandler.Init(t.clientset, t.edgenetClientset)
 			created := !userHandler.Create(URRCopy)
 			if created {
-				return
+				t.recorder.Event(URRCopy, corev1.EventTypeNormal, "Approved", "User registration request approved, the user is created")
+				return nil
 			}
 			t.sendEmail(URRCopy, URROwnerNamespace.Labels["authority-name"], "user-creation-failure")
 			URRCopy.Status.State = failure
 			URRCopy.Status.Message = []string{statusDict["user-failed"]}
+			t.recorder.Event(URRCopy, corev1.EventTypeWarning, "UserFailed", statusDict["user-failed"])
 			URRCopyUpdated, err := t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRCopy.GetNamespace()).UpdateStatus(context.TODO(), URRCopy, metav1.UpdateOptions{})
 			if err == nil {
 				URRCopy = URRCopyUpdated
@@ -97,10 +115,6 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 		// If the service restarts, it creates all objects again
 		// Because of that, this section covers a variety of possibilities
 		if URRCopy.Status.Expires == nil {
-			// Run timeout goroutine
-			go t.runApprovalTimeout(URRCopy)
-			defer t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRCopy.GetNamespace()).UpdateStatus(context.TODO(), URRCopy, metav1.UpdateOptions{})
-
 			// Set the approval timeout which is 72 hours
 			URRCopy.Status.Expires = &metav1.Time{
 				Time: time.Now().Add(72 * time.Hour),
@@ -112,26 +126,41 @@ func (t *Handler) ObjectCreated(obj interface{}) {
 				// Update the status as successful
 				URRCopy.Status.State = success
 				URRCopy.Status.Message = []string{statusDict["email-ok"]}
+				t.recorder.Event(URRCopy, corev1.EventTypeNormal, "VerificationSent", statusDict["email-ok"])
 			} else {
 				URRCopy.Status.State = issue
 				URRCopy.Status.Message = []string{statusDict["email-fail"]}
+				t.recorder.Event(URRCopy, corev1.EventTypeWarning, "VerificationFailed", statusDict["email-fail"])
+			}
+			if _, err := t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRCopy.GetNamespace()).UpdateStatus(context.TODO(), URRCopy, metav1.UpdateOptions{}); err != nil {
+				return err
 			}
-		} else {
-			go t.runApprovalTimeout(URRCopy)
 		}
+		// Run timeout goroutine once the expiry date is recorded so that a retry doesn't run it twice
+		go t.runApprovalTimeout(URRCopy)
 	} else {
-		t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRCopy.GetNamespace()).Delete(context.TODO(), URRCopy.GetName(), metav1.DeleteOptions{})
+		if err := t.delete(URRCopy); err != nil {
+			return err
+		}
+		t.recorder.Event(URRCopy, corev1.EventTypeWarning, "AuthorityDisabled", "Authority disabled, the user registration request is removed")
 	}
+	return nil
 }
 
-// ObjectUpdated is called when an object is updated
-func (t *Handler) ObjectUpdated(obj interface{}) {
+// ObjectUpdated is called when an object is updated, the event is retried if it returns an error
+func (t *Handler) ObjectUpdated(obj interface{}) error {
 	log.Info("URRHandler.ObjectUpdated")
 	// Create a copy of the user registration request object to make changes on it
 	URRCopy := obj.(*apps_v1alpha.UserRegistrationRequest).DeepCopy()
 	changeStatus := false
-	URROwnerNamespace, _ := t.clientset.CoreV1().Namespaces().Get(context.TODO(), URRCopy.GetNamespace(), metav1.GetOptions{})
-	URROwnerAuthority, _ := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), URROwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	URROwnerNamespace, err := t.clientset.CoreV1().Namespaces().Get(context.TODO(), URRCopy.GetNamespace(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	URROwnerAuthority, err := t.edgenetClientset.AppsV1alpha().Authorities().Get(context.TODO(), URROwnerNamespace.Labels["authority-name"], metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
 	if URROwnerAuthority.Spec.Enabled {
 		// Check again if the email address is already taken
 		exists, message := t.checkDuplicateObject(URRCopy, URROwnerNamespace.Labels["authority-name"])
@@ -145,6 +174,9 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 					t.sendEmail(URRCopy, URROwnerNamespace.Labels["authority-name"], "user-creation-failure")
 					URRCopy.Status.State = failure
 					URRCopy.Status.Message = []string{statusDict["user-failed"]}
+					t.recorder.Event(URRCopy, corev1.EventTypeWarning, "UserFailed", statusDict["user-failed"])
+				} else {
+					t.recorder.Event(URRCopy, corev1.EventTypeNormal, "Approved", "User registration request approved, the user is created")
 				}
 			} else if !URRCopy.Spec.Approved && URRCopy.Status.State == failure {
 				emailVerificationHandler := emailverification.Handler{}
@@ -154,9 +186,11 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 					// Update the status as successful
 					URRCopy.Status.State = success
 					URRCopy.Status.Message = []string{statusDict["email-ok"]}
+					t.recorder.Event(URRCopy, corev1.EventTypeNormal, "VerificationSent", statusDict["email-ok"])
 				} else {
 					URRCopy.Status.State = issue
 					URRCopy.Status.Message = []string{statusDict["email-fail"]}
+					t.recorder.Event(URRCopy, corev1.EventTypeWarning, "VerificationFailed", statusDict["email-fail"])
 				}
 				changeStatus = true
 			}
@@ -164,19 +198,49 @@ func (t *Handler) ObjectUpdated(obj interface{}) {
 			URRCopy.Status.State = failure
 			URRCopy.Status.Message = message
 			changeStatus = true
+			t.recorder.Event(URRCopy, corev1.EventTypeWarning, "Duplicate", strings.Join(message, ", "))
 		}
 		if changeStatus {
-			t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRCopy.GetNamespace()).UpdateStatus(context.TODO(), URRCopy, metav1.UpdateOptions{})
+			// The request is removed once the user is created
+			if _, err := t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRCopy.GetNamespace()).UpdateStatus(context.TODO(), URRCopy, metav1.UpdateOptions{}); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
 		}
 	} else {
-		t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRCopy.GetNamespace()).Delete(context.TODO(), URRCopy.GetName(), metav1.DeleteOptions{})
+		if err := t.delete(URRCopy); err != nil {
+			return err
+		}
+		t.recorder.Event(URRCopy, corev1.EventTypeWarning, "AuthorityDisabled", "Authority disabled, the user registration request is removed")
 	}
+	return nil
 }
 
 // ObjectDeleted is called when an object is deleted
-func (t *Handler) ObjectDeleted(obj interface{}) {
+func (t *Handler) ObjectDeleted(obj interface{}) error {
 	log.Info("URRHandler.ObjectDeleted")
 	// Mail notification, TBD
+	return nil
+}
+
+// ObjectFailed is called when the controller gives up on an object after its retries
+func (t *Handler) ObjectFailed(obj interface{}, err error) {
+	log.Info("URRHandler.ObjectFailed")
+	URRCopy := obj.(*apps_v1alpha.UserRegistrationRequest).DeepCopy()
+	URRCopy.Status.State = failure
+	message := fmt.Sprintf(statusDict["reconcile-failure"], err)
+	recorder.ReconcileFailed(t.recorder, URRCopy, &URRCopy.Status.Message, &URRCopy.Status.Conditions, "Reconciled", message)
+	if _, err := t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRCopy.GetNamespace()).UpdateStatus(context.TODO(), URRCopy, metav1.UpdateOptions{}); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// delete removes the user registration request, which may be gone already
+func (t *Handler) delete(URRCopy *apps_v1alpha.UserRegistrationRequest) error {
+	err := t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRCopy.GetNamespace()).Delete(context.TODO(), URRCopy.GetName(), metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
 }
 
 // sendEmail to send notification to participants
@@ -259,6 +323,7 @@ timeoutLoop:
 		case <-timeout:
 			watchURR.Stop()
 			t.edgenetClientset.AppsV1alpha().UserRegistrationRequests(URRCopy.GetNamespace()).Delete(context.TODO(), URRCopy.GetName(), metav1.DeleteOptions{})
+			t.recorder.Event(URRCopy, corev1.EventTypeNormal, "Expired", "User registration request not approved in time, it is removed")
 			closeChannels()
 			break timeoutLoop
 		case <-terminated:
@@ -0,0 +1,265 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllermanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EdgeNet-project/edgenet/pkg/controller/v1/nodelabeler"
+	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/acceptableusepolicy"
+	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/authority"
+	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/authorityrequest"
+	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/emailverification"
+	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/nodecontribution"
+	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/selectivedeployment"
+	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/slice"
+	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/team"
+	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/totalresourcequota"
+	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/user"
+	"github.com/EdgeNet-project/edgenet/pkg/controller/v1alpha/userregistrationrequest"
+	"github.com/EdgeNet-project/edgenet/pkg/generated/clientset/versioned"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// The durations of the lease, a standby replica takes over within leaseDuration once the leader is gone
+const leaseDuration = 15 * time.Second
+const renewDeadline = 10 * time.Second
+const retryPeriod = 2 * time.Second
+
+// Clients holds the clientsets that the controllers consume
+type Clients struct {
+	Kubernetes kubernetes.Interface
+	EdgeNet    versioned.Interface
+	Dynamic    dynamic.Interface
+}
+
+// The controllers that the manager can run, each runs until the stop channel is closed
+var controllers = map[string]func(clients Clients, stopCh <-chan struct{}){
+	"acceptableusepolicy": func(c Clients, stopCh <-chan struct{}) { acceptableusepolicy.Run(c.Kubernetes, c.EdgeNet, stopCh) },
+	"authority":           func(c Clients, stopCh <-chan struct{}) { authority.Run(c.Kubernetes, c.EdgeNet, stopCh) },
+	"authorityrequest":    func(c Clients, stopCh <-chan struct{}) { authorityrequest.Run(c.Kubernetes, c.EdgeNet, stopCh) },
+	"emailverification":   func(c Clients, stopCh <-chan struct{}) { emailverification.Run(c.Kubernetes, c.EdgeNet, stopCh) },
+	"nodecontribution":    func(c Clients, stopCh <-chan struct{}) { nodecontribution.Run(c.Kubernetes, c.EdgeNet, stopCh) },
+	"nodelabeler":         func(c Clients, stopCh <-chan struct{}) { nodelabeler.Run(c.Kubernetes, stopCh) },
+	"selectivedeployment": func(c Clients, stopCh <-chan struct{}) {
+		selectivedeployment.Run(c.Kubernetes, c.EdgeNet, c.Dynamic, stopCh)
+	},
+	"slice":                   func(c Clients, stopCh <-chan struct{}) { slice.Run(c.Kubernetes, c.EdgeNet, stopCh) },
+	"team":                    func(c Clients, stopCh <-chan struct{}) { team.Run(c.Kubernetes, c.EdgeNet, stopCh) },
+	"totalresourcequota":      func(c Clients, stopCh <-chan struct{}) { totalresourcequota.Run(c.Kubernetes, c.EdgeNet, stopCh) },
+	"user":                    func(c Clients, stopCh <-chan struct{}) { user.Run(c.Kubernetes, c.EdgeNet, stopCh) },
+	"userregistrationrequest": func(c Clients, stopCh <-chan struct{}) { userregistrationrequest.Run(c.Kubernetes, c.EdgeNet, stopCh) },
+}
+
+// Options holds the settings of the manager
+type Options struct {
+	// Controllers is a comma-separated list of the controllers to run, * stands for all of them and
+	// a name prefixed with - turns that controller off, as in *,-nodecontribution
+	Controllers string
+	// LeaderElect runs the controllers only while this replica holds the lease
+	LeaderElect bool
+	// LeaseNamespace and LeaseName locate the lease of the leader election
+	LeaseNamespace string
+	LeaseName      string
+	// HealthAddress is the address that serves the liveness and readiness probes
+	HealthAddress string
+}
+
+// Names returns the names of the controllers that the manager can run
+func Names() []string {
+	names := []string{}
+	for name := range controllers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseControllers returns the names of the controllers enabled by the list given
+func ParseControllers(list string) ([]string, error) {
+	enabled := make(map[string]bool)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+			continue
+		case item == "*":
+			for name := range controllers {
+				if _, exists := enabled[name]; !exists {
+					enabled[name] = true
+				}
+			}
+		case strings.HasPrefix(item, "-"):
+			if _, exists := controllers[item[1:]]; !exists {
+				return nil, fmt.Errorf("unknown controller %s, expected one of %s", item[1:], strings.Join(Names(), ", "))
+			}
+			enabled[item[1:]] = false
+		default:
+			if _, exists := controllers[item]; !exists {
+				return nil, fmt.Errorf("unknown controller %s, expected one of %s", item, strings.Join(Names(), ", "))
+			}
+			enabled[item] = true
+		}
+	}
+	names := []string{}
+	for name, status := range enabled {
+		if status {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no controller enabled")
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Run starts the controllers given and blocks until the context is done, with the leader election
+// on, the controllers run only while this replica leads so that two replicas never act twice
+func Run(ctx context.Context, clients Clients, names []string, options Options) error {
+	health := &healthChecker{}
+	electionChecker := leaderelection.NewLeaderHealthzAdaptor(renewDeadline)
+	serveHealth(options.HealthAddress, health, electionChecker)
+
+	runControllers := func(ctx context.Context) {
+		var wg sync.WaitGroup
+		for _, name := range names {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				log.Infof("Starting the %s controller", name)
+				controllers[name](clients, ctx.Done())
+			}(name)
+		}
+		health.setLeading(true)
+		wg.Wait()
+	}
+
+	if !options.LeaderElect {
+		health.setReady()
+		runControllers(ctx)
+		return nil
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	// The unique suffix tells the replicas apart when they share a hostname
+	identity := fmt.Sprintf("%s_%s", hostname, uuid.NewUUID())
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{Namespace: options.LeaseNamespace, Name: options.LeaseName},
+		Client:    clients.Kubernetes.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		WatchDog:        electionChecker,
+		Name:            options.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: runControllers,
+			OnStoppedLeading: func() {
+				// The handlers keep state in memory, the standby replicas start from scratch instead
+				if ctx.Err() == nil {
+					log.Fatalf("%s lost the lease %s/%s", identity, options.LeaseNamespace, options.LeaseName)
+				}
+				log.Infof("%s released the lease %s/%s", identity, options.LeaseNamespace, options.LeaseName)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					log.Infof("%s leads, %s stands by", leader, identity)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	health.setReady()
+	elector.Run(ctx)
+	return nil
+}
+
+// healthChecker tells whether the manager is ready, a standby replica is ready as soon as it takes part in the election
+type healthChecker struct {
+	sync.RWMutex
+	ready   bool
+	leading bool
+}
+
+func (h *healthChecker) setReady() {
+	h.Lock()
+	defer h.Unlock()
+	h.ready = true
+}
+
+func (h *healthChecker) setLeading(leading bool) {
+	h.Lock()
+	defer h.Unlock()
+	h.leading = leading
+}
+
+// serveHealth exposes the liveness probe at /healthz and the readiness probe at /readyz in the background
+func serveHealth(address string, health *healthChecker, electionChecker *leaderelection.HealthzAdaptor) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		// The leader fails the check once it couldn't renew the lease in time
+		if err := electionChecker.Check(r); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		health.RLock()
+		defer health.RUnlock()
+		if !health.ready {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		if health.leading {
+			w.Write([]byte("ok, leading"))
+		} else {
+			w.Write([]byte("ok, standing by"))
+		}
+	})
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			log.Errorf("Health server at %s stopped: %s", address, err)
+		}
+	}()
+}
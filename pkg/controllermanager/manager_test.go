@@ -0,0 +1,48 @@
+package controllermanager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseControllers(t *testing.T) {
+	cases := []struct {
+		list     string
+		expected []string
+		err      bool
+	}{
+		{"*", Names(), false},
+		{"slice,team", []string{"slice", "team"}, false},
+		{" team , slice ", []string{"slice", "team"}, false},
+		{"*,-nodecontribution,-nodelabeler", nil, false},
+		{"-slice,*", nil, false},
+		{"slice,unknown", nil, true},
+		{"*,-unknown", nil, true},
+		{"-slice", nil, true},
+		{"", nil, true},
+	}
+	for _, tc := range cases {
+		names, err := ParseControllers(tc.list)
+		if tc.err {
+			if err == nil {
+				t.Errorf("Parse %q failed. Expected an error, Got: %v", tc.list, names)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse %q failed. Unexpected error: %v", tc.list, err)
+			continue
+		}
+		if tc.expected != nil && !reflect.DeepEqual(names, tc.expected) {
+			t.Errorf("Parse %q failed. Expected: %v, Got: %v", tc.list, tc.expected, names)
+		}
+		for _, name := range names {
+			if tc.list == "*,-nodecontribution,-nodelabeler" && (name == "nodecontribution" || name == "nodelabeler") {
+				t.Errorf("Parse %q failed. %s should be turned off", tc.list, name)
+			}
+			if tc.list == "-slice,*" && name == "slice" {
+				t.Errorf("Parse %q failed. slice should stay turned off", tc.list)
+			}
+		}
+	}
+}
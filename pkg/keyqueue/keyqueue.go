@@ -0,0 +1,200 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyqueue
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// The number of workers of each controller, the binaries that parse the flags let the operators tune it
+var workers = flag.Int("workers", 2, "number of workers that process the events of each controller")
+
+// KeyFunc returns the key of the object that an item of the queue concerns
+type KeyFunc func(item interface{}) string
+
+// Queue spreads the items over a rate limited queue per worker by their keys. Thus, the items of an object
+// are processed one at a time and in the order they came in while the items of distinct objects are processed concurrently.
+// A worker requeues a failed item with AddRateLimited and drops it with Forget, the shard holds the later items of
+// its object back in between so that they can't overtake it, while the items of the other objects go on. The rate limiter
+// doubles the delay of an item from 5ms up to 1000s, so fifteen retries span about three minutes.
+type Queue struct {
+	shards  []*shard
+	keyFunc KeyFunc
+}
+
+// shard is the queue of a worker
+type shard struct {
+	workqueue.RateLimitingInterface
+	keyFunc KeyFunc
+
+	// lock guards the items that wait for a retry, by their keys, and the items of these objects that came in meanwhile
+	lock     sync.Mutex
+	retrying map[string]interface{}
+	held     map[string][]interface{}
+}
+
+// Workers returns the number of workers set by the workers flag
+func Workers() int {
+	if *workers < 1 {
+		return 1
+	}
+	return *workers
+}
+
+// New creates a queue with as many shards as the workers flag sets
+func New(name string, keyFunc KeyFunc) *Queue {
+	return NewWithWorkers(name, Workers(), keyFunc)
+}
+
+// NewWithWorkers creates a queue with the number of shards given, each shard is named after the queue and
+// its index so that the shards don't overwrite the gauges of each other in the workqueue metrics
+func NewWithWorkers(name string, workers int, keyFunc KeyFunc) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	q := &Queue{keyFunc: keyFunc}
+	for i := 0; i < workers; i++ {
+		q.shards = append(q.shards, &shard{
+			RateLimitingInterface: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), fmt.Sprintf("%s-%d", name, i)),
+			keyFunc:               keyFunc,
+			retrying:              make(map[string]interface{}),
+			held:                  make(map[string][]interface{}),
+		})
+	}
+	return q
+}
+
+// Add puts the item into the shard of its key
+func (q *Queue) Add(item interface{}) {
+	q.shard(q.keyFunc(item)).Add(item)
+}
+
+// Len returns the number of items waiting in all the shards
+func (q *Queue) Len() int {
+	length := 0
+	for _, shard := range q.shards {
+		length += shard.Len()
+	}
+	return length
+}
+
+// ShutDown shuts all the shards down, the workers return once they drain
+func (q *Queue) ShutDown() {
+	for _, shard := range q.shards {
+		shard.ShutDown()
+	}
+}
+
+// StartWorkers runs a worker per shard until the stop channel is closed, a worker processes the items
+// of its shard as long as it returns true and restarts a second later otherwise
+func (q *Queue) StartWorkers(worker func(queue workqueue.RateLimitingInterface), stopCh <-chan struct{}) {
+	for _, shard := range q.shards {
+		shard := shard
+		go wait.Until(func() { worker(shard) }, time.Second, stopCh)
+	}
+}
+
+func (q *Queue) shard(key string) *shard {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return q.shards[hash.Sum32()%uint32(len(q.shards))]
+}
+
+// Add holds the item back if an earlier item of its object waits for a retry
+func (s *shard) Add(item interface{}) {
+	key := s.keyFunc(item)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, exists := s.retrying[key]; exists {
+		s.hold(key, item)
+		return
+	}
+	s.RateLimitingInterface.Add(item)
+}
+
+// AddRateLimited requeues the item once the rate limiter allows it, the later items of its object wait for it
+func (s *shard) AddRateLimited(item interface{}) {
+	s.lock.Lock()
+	s.retrying[s.keyFunc(item)] = item
+	s.lock.Unlock()
+	s.RateLimitingInterface.AddRateLimited(item)
+}
+
+// Get returns the next item, the items that were already queued when an earlier item of their object failed are held back
+// until it is done
+func (s *shard) Get() (interface{}, bool) {
+	for {
+		item, quit := s.RateLimitingInterface.Get()
+		if quit {
+			return item, quit
+		}
+		key := s.keyFunc(item)
+		s.lock.Lock()
+		if retry, exists := s.retrying[key]; exists && retry != item {
+			s.hold(key, item)
+			s.lock.Unlock()
+			s.RateLimitingInterface.Done(item)
+			continue
+		}
+		s.lock.Unlock()
+		return item, false
+	}
+}
+
+// Forget stops the retries of the item, and queues the items of its object that were held back in the order they came in
+func (s *shard) Forget(item interface{}) {
+	s.RateLimitingInterface.Forget(item)
+	key := s.keyFunc(item)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if retry, exists := s.retrying[key]; !exists || retry != item {
+		return
+	}
+	delete(s.retrying, key)
+	for _, held := range s.held[key] {
+		s.RateLimitingInterface.Add(held)
+	}
+	delete(s.held, key)
+}
+
+// hold keeps the item back once, as the queue doesn't hold the same item twice either
+func (s *shard) hold(key string, item interface{}) {
+	for _, held := range s.held[key] {
+		if held == item {
+			return
+		}
+	}
+	s.held[key] = append(s.held[key], item)
+}
+
+// Len returns the number of items waiting, including the ones held back
+func (s *shard) Len() int {
+	s.lock.Lock()
+	length := 0
+	for _, items := range s.held {
+		length += len(items)
+	}
+	s.lock.Unlock()
+	return length + s.RateLimitingInterface.Len()
+}
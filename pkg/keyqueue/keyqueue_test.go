@@ -0,0 +1,167 @@
+package keyqueue
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EdgeNet-project/edgenet/pkg/util"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+type testEvent struct {
+	key string
+	seq int
+}
+
+func testKey(item interface{}) string {
+	return item.(testEvent).key
+}
+
+func TestShard(t *testing.T) {
+	q := NewWithWorkers("test-shard", 4, testKey)
+	defer q.ShutDown()
+	util.Equals(t, 4, len(q.shards))
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("default/sd-%d", i)
+		util.Equals(t, q.shard(key), q.shard(key))
+	}
+
+	single := NewWithWorkers("test-single", 0, testKey)
+	defer single.ShutDown()
+	util.Equals(t, 1, len(single.shards))
+}
+
+func TestConcurrentEvents(t *testing.T) {
+	keys := 8
+	events := 50
+	q := NewWithWorkers("test-concurrent", 4, testKey)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	var lock sync.Mutex
+	processed := make(map[string][]int)
+	var inFlight, maxInFlight int32
+	var wg sync.WaitGroup
+	wg.Add(keys * events)
+	q.StartWorkers(func(queue workqueue.RateLimitingInterface) {
+		for {
+			item, quit := queue.Get()
+			if quit {
+				return
+			}
+			current := atomic.AddInt32(&inFlight, 1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+					break
+				}
+			}
+			time.Sleep(100 * time.Microsecond)
+			event := item.(testEvent)
+			lock.Lock()
+			processed[event.key] = append(processed[event.key], event.seq)
+			lock.Unlock()
+			atomic.AddInt32(&inFlight, -1)
+			queue.Forget(item)
+			queue.Done(item)
+			wg.Done()
+		}
+	}, stopCh)
+
+	// The informers add the events of distinct objects at the same time
+	var adders sync.WaitGroup
+	for i := 0; i < keys; i++ {
+		adders.Add(1)
+		go func(key string) {
+			defer adders.Done()
+			for seq := 0; seq < events; seq++ {
+				q.Add(testEvent{key: key, seq: seq})
+			}
+		}(fmt.Sprintf("default/sd-%d", i))
+	}
+	adders.Wait()
+	wg.Wait()
+
+	util.Equals(t, keys, len(processed))
+	for key, seqs := range processed {
+		util.Equals(t, events, len(seqs))
+		for i, seq := range seqs {
+			if seq != i {
+				t.Fatalf("Order of %s failed. Expected: %d, Got: %d", key, i, seq)
+			}
+		}
+	}
+	if maxInFlight < 2 {
+		t.Errorf("Concurrency failed. Expected at least 2 events in flight, Got: %d", maxInFlight)
+	}
+	util.Equals(t, 0, q.Len())
+}
+
+func TestShutDown(t *testing.T) {
+	q := NewWithWorkers("test-shutdown", 3, testKey)
+	q.Add(testEvent{key: "default/first"})
+	q.Add(testEvent{key: "default/second"})
+	util.Equals(t, 2, q.Len())
+	q.ShutDown()
+	for _, shard := range q.shards {
+		util.Equals(t, true, shard.ShuttingDown())
+	}
+}
+
+func TestRetry(t *testing.T) {
+	q := NewWithWorkers("test-retry", 1, testKey)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	defer q.ShutDown()
+
+	var lock sync.Mutex
+	var processed []string
+	done := make(chan struct{})
+	q.StartWorkers(func(queue workqueue.RateLimitingInterface) {
+		for {
+			item, quit := queue.Get()
+			if quit {
+				return
+			}
+			event := item.(testEvent)
+			lock.Lock()
+			// The first event of the first object fails twice
+			if event.key == "default/first" && event.seq == 0 && queue.NumRequeues(item) < 2 {
+				processed = append(processed, fmt.Sprintf("%s:%d:failed", event.key, event.seq))
+				if queue.NumRequeues(item) == 0 {
+					// An event of the object comes in while the failed one waits for its retry
+					q.Add(testEvent{key: "default/first", seq: 2})
+				}
+				lock.Unlock()
+				queue.AddRateLimited(item)
+				queue.Done(item)
+				continue
+			}
+			processed = append(processed, fmt.Sprintf("%s:%d", event.key, event.seq))
+			if len(processed) == 6 {
+				close(done)
+			}
+			lock.Unlock()
+			queue.Forget(item)
+			queue.Done(item)
+		}
+	}, stopCh)
+	q.Add(testEvent{key: "default/first", seq: 0})
+	q.Add(testEvent{key: "default/first", seq: 1})
+	q.Add(testEvent{key: "default/second", seq: 0})
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Retry failed. Expected the events to be processed")
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	// The other object goes on while the failed event waits, whereas the events of its own object wait for it
+	util.Equals(t, []string{"default/first:0:failed", "default/second:0", "default/first:0:failed", "default/first:0", "default/first:1", "default/first:2"}, processed)
+	util.Equals(t, 0, q.Len())
+}
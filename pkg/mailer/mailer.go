@@ -28,6 +28,7 @@ import (
 	"net/smtp"
 	"os"
 
+	"github.com/EdgeNet-project/edgenet/pkg/metrics"
 	"github.com/EdgeNet-project/edgenet/pkg/util"
 
 	yaml "gopkg.in/yaml.v2"
@@ -101,6 +102,15 @@ func (s *smtpServer) address() string {
 
 // Send function consumed by the custom resources to send emails
 func Send(subject string, contentData interface{}) error {
+	err := send(subject, contentData)
+	if err != nil {
+		metrics.MailFailures.WithLabelValues(subject).Inc()
+	}
+	return err
+}
+
+// send prepares the email of the subject and delivers it through the SMTP server
+func send(subject string, contentData interface{}) error {
 	// The code below inits the SMTP configuration for sending emails
 	if flag.Lookup("dir") != nil {
 		dir = flag.Lookup("dir").Value.(flag.Getter).Get().(string)
@@ -0,0 +1,120 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// The address that the controllers listen on to expose their metrics
+const defaultAddress = ":8080"
+
+const namespace = "edgenet"
+
+var (
+	// Reconciles counts the events that the handlers processed, per handler method
+	Reconciles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_total",
+		Help:      "Count of the events processed by the controllers, per handler method",
+	}, []string{"controller", "method"})
+	// ReconcileErrors counts the events that couldn't be processed, per handler method
+	ReconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_errors_total",
+		Help:      "Count of the events that the controllers failed to process, per handler method",
+	}, []string{"controller", "method"})
+	// ReconcileDuration observes how long the handler methods take
+	ReconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Time taken by the handler methods to process an event",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"controller", "method"})
+	// MailFailures counts the emails that couldn't be sent, per subject
+	MailFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_send_failures_total",
+		Help:      "Count of the notification emails that couldn't be sent, per subject",
+	}, []string{"subject"})
+	// NodeProcedures counts the outcomes of the installation and recovery procedures of the contributed nodes
+	NodeProcedures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "node_procedures_total",
+		Help:      "Count of the installation and recovery procedures run over SSH on the contributed nodes, per outcome",
+	}, []string{"procedure", "outcome"})
+	// AuthorityQuota holds the total resource quota of each authority
+	AuthorityQuota = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "authority_resource_quota",
+		Help:      "Total resource quota of the authority, cpu in cores and memory in bytes",
+	}, []string{"authority", "resource"})
+	// AuthorityUsage holds the resources that the slices of each authority consume
+	AuthorityUsage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "authority_resource_usage",
+		Help:      "Resources consumed by the slices of the authority, cpu in cores and memory in bytes",
+	}, []string{"authority", "resource"})
+	// WorkloadsReady holds the count of workloads ready of each selectivedeployment
+	WorkloadsReady = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "selectivedeployment_workloads_ready",
+		Help:      "Count of the workloads of the selectivedeployment that are ready",
+	}, []string{"namespace", "name"})
+	// WorkloadsDesired holds the count of workloads desired of each selectivedeployment
+	WorkloadsDesired = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "selectivedeployment_workloads_desired",
+		Help:      "Count of the workloads that the selectivedeployment desires",
+	}, []string{"namespace", "name"})
+)
+
+func init() {
+	prometheus.MustRegister(Reconciles, ReconcileErrors, ReconcileDuration, MailFailures, NodeProcedures,
+		AuthorityQuota, AuthorityUsage, WorkloadsReady, WorkloadsDesired)
+}
+
+// ObserveReconcile records an event processed by a handler method, along with the time it took and its error if any
+func ObserveReconcile(controller, method string, start time.Time, err error) {
+	Reconciles.WithLabelValues(controller, method).Inc()
+	ReconcileDuration.WithLabelValues(controller, method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		ReconcileErrors.WithLabelValues(controller, method).Inc()
+	}
+}
+
+// Serve exposes the metrics at /metrics in the background, the address comes from the METRICS_ADDRESS
+// environment variable and defaults to :8080
+func Serve() {
+	address := os.Getenv("METRICS_ADDRESS")
+	if address == "" {
+		address = defaultAddress
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			log.Errorf("Metrics server at %s stopped: %s", address, err)
+		}
+	}()
+}
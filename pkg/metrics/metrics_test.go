@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/EdgeNet-project/edgenet/pkg/keyqueue"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestObserveReconcile(t *testing.T) {
+	ObserveReconcile("test", "ObjectCreated", time.Now(), nil)
+	ObserveReconcile("test", "ObjectCreated", time.Now(), errors.New("failure"))
+
+	if count := testutil.ToFloat64(Reconciles.WithLabelValues("test", "ObjectCreated")); count != 2 {
+		t.Errorf("Reconcile count failed. Expected: 2, Got: %v", count)
+	}
+	if count := testutil.ToFloat64(ReconcileErrors.WithLabelValues("test", "ObjectCreated")); count != 1 {
+		t.Errorf("Reconcile error count failed. Expected: 1, Got: %v", count)
+	}
+}
+
+func TestQueueMetrics(t *testing.T) {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "test")
+	defer queue.ShutDown()
+	queue.Add("first")
+	queue.Add("second")
+
+	if depth := testutil.ToFloat64(queueDepth.WithLabelValues("test")); depth != 2 {
+		t.Errorf("Queue depth failed. Expected: 2, Got: %v", depth)
+	}
+	if adds := testutil.ToFloat64(queueAdds.WithLabelValues("test")); adds != 2 {
+		t.Errorf("Queue adds failed. Expected: 2, Got: %v", adds)
+	}
+	item, _ := queue.Get()
+	queue.Done(item)
+	if depth := testutil.ToFloat64(queueDepth.WithLabelValues("test")); depth != 1 {
+		t.Errorf("Queue depth failed. Expected: 1, Got: %v", depth)
+	}
+}
+
+func TestShardedQueueMetrics(t *testing.T) {
+	queue := keyqueue.NewWithWorkers("test-sharded", 2, func(item interface{}) string { return item.(string) })
+	defer queue.ShutDown()
+	for i := 0; i < 10; i++ {
+		queue.Add(fmt.Sprintf("default/object-%d", i))
+	}
+
+	var total float64
+	for i := 0; i < 2; i++ {
+		depth := testutil.ToFloat64(queueDepth.WithLabelValues(fmt.Sprintf("test-sharded-%d", i)))
+		if depth == 0 {
+			t.Errorf("Shard %d depth failed. Expected: more than 0, Got: %v", i, depth)
+		}
+		total += depth
+	}
+	if total != 10 {
+		t.Errorf("Sharded queue depth failed. Expected: 10, Got: %v", total)
+	}
+}
@@ -59,7 +59,7 @@ func GetNamespace(name string) (*corev1.Namespace, error) {
 		return nil, err
 	} else if err != nil {
 		log.Println(err.Error())
-		panic(err.Error())
+		return nil, err
 	}
 	return namespace, nil
 }
@@ -0,0 +1,194 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The default classes of the nodes by their number of CPUs and their memory in GiB, from a Raspberry Pi to a server
+const (
+	DefaultCPUClasses    = "small=2,medium=8,large"
+	DefaultMemoryClasses = "small=2,medium=8,large"
+)
+
+// The prefix of the labels that tell the extended resources of a node, such as edge-net.io/resource-nvidia.com_gpu
+const resourceLabelPrefix = "edge-net.io/resource-"
+
+// Bucket is a class of nodes whose quantity is at most the maximum, a zero maximum leaves the class unbounded
+type Bucket struct {
+	Name string
+	Max  float64
+}
+
+// Buckets are the classes of a quantity in increasing order
+type Buckets []Bucket
+
+// ParseBuckets decodes the classes given in the form of "small=2,medium=8,large", where each class
+// takes the quantities up to its maximum, and the last one may have no maximum to take the rest
+func ParseBuckets(value string) (Buckets, error) {
+	buckets := Buckets{}
+	fields := strings.Split(value, ",")
+	for i, field := range fields {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if name == "" || LabelValue(name) != name {
+			return nil, fmt.Errorf("%q is not a valid class name", name)
+		}
+		bucket := Bucket{Name: name}
+		if len(parts) == 2 {
+			max, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+			if err != nil || max <= 0 {
+				return nil, fmt.Errorf("class %s has an invalid maximum %q", name, parts[1])
+			}
+			if len(buckets) > 0 && max <= buckets[len(buckets)-1].Max {
+				return nil, fmt.Errorf("class %s has a maximum lower than the previous class", name)
+			}
+			bucket.Max = max
+		} else if i != len(fields)-1 {
+			return nil, fmt.Errorf("class %s has no maximum but isn't the last one", name)
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// Class returns the name of the class that the quantity falls in, or an empty string if it exceeds all the classes
+func (b Buckets) Class(quantity float64) string {
+	for _, bucket := range b {
+		if bucket.Max == 0 || quantity <= bucket.Max {
+			return bucket.Name
+		}
+	}
+	return ""
+}
+
+// The classes in use, which the cpu-classes and memory-classes flags set up
+var cpuBuckets, memoryBuckets Buckets
+var bucketsOnce sync.Once
+
+// getCapabilityBuckets returns the classes of the CPUs and the memory, the default ones take over invalid flags
+func getCapabilityBuckets() (Buckets, Buckets) {
+	bucketsOnce.Do(func() {
+		parse := func(name string, defaultValue string) Buckets {
+			value := lookupFlag(name)
+			if value == "" {
+				value = defaultValue
+			}
+			buckets, err := ParseBuckets(value)
+			if err != nil {
+				log.Printf("Flag %s is invalid, the default classes are used: %s", name, err)
+				buckets, _ = ParseBuckets(defaultValue)
+			}
+			return buckets
+		}
+		cpuBuckets = parse("cpu-classes", DefaultCPUClasses)
+		memoryBuckets = parse("memory-classes", DefaultMemoryClasses)
+	})
+	return cpuBuckets, memoryBuckets
+}
+
+// isExtendedResource tells whether the resource is advertised by a device plugin or an operator,
+// that is a resource with a domain other than the one of Kubernetes
+func isExtendedResource(name corev1.ResourceName) bool {
+	resource := string(name)
+	if !strings.Contains(resource, "/") || strings.HasPrefix(resource, "requests.") {
+		return false
+	}
+	domain := strings.SplitN(resource, "/", 2)[0]
+	return domain != "kubernetes.io" && !strings.HasSuffix(domain, ".kubernetes.io")
+}
+
+// resourceLabel returns the label that tells the node has the extended resource
+func resourceLabel(name corev1.ResourceName) string {
+	value := LabelValue(strings.Replace(string(name), "/", "_", -1))
+	// The name of the label, after edge-net.io/, can't exceed 63 characters
+	if max := 63 - len("resource-"); len(value) > max {
+		value = strings.TrimRight(value[:max], "-_.")
+	}
+	return resourceLabelPrefix + value
+}
+
+// capabilityLabels derives the labels of the hardware and the software of the node from its status,
+// the labels that the node can't be given are nil so that a merge patch removes them
+func capabilityLabels(obj *corev1.Node, cpu Buckets, memory Buckets) map[string]interface{} {
+	info := obj.Status.NodeInfo
+	labels := map[string]interface{}{
+		"edge-net.io/arch":            nil,
+		"edge-net.io/cpu-class":       nil,
+		"edge-net.io/memory-class":    nil,
+		"edge-net.io/kubelet-version": nil,
+		"edge-net.io/os-image":        nil,
+	}
+	if value := LabelValue(info.Architecture); value != "" {
+		labels["edge-net.io/arch"] = value
+	}
+	if value := LabelValue(info.KubeletVersion); value != "" {
+		labels["edge-net.io/kubelet-version"] = value
+	}
+	if value := LabelValue(info.OSImage); value != "" {
+		labels["edge-net.io/os-image"] = value
+	}
+	if quantity, exists := obj.Status.Capacity[corev1.ResourceCPU]; exists && !quantity.IsZero() {
+		if class := cpu.Class(float64(quantity.MilliValue()) / 1000); class != "" {
+			labels["edge-net.io/cpu-class"] = class
+		}
+	}
+	if quantity, exists := obj.Status.Capacity[corev1.ResourceMemory]; exists && !quantity.IsZero() {
+		if class := memory.Class(float64(quantity.Value()) / (1 << 30)); class != "" {
+			labels["edge-net.io/memory-class"] = class
+		}
+	}
+	// The extended resources that the node no longer has lose their labels
+	for key := range obj.GetLabels() {
+		if strings.HasPrefix(key, resourceLabelPrefix) {
+			labels[key] = nil
+		}
+	}
+	for name, quantity := range obj.Status.Capacity {
+		if isExtendedResource(name) && !quantity.IsZero() {
+			labels[resourceLabel(name)] = "true"
+		}
+	}
+	return labels
+}
+
+// CapabilitiesOutdated tells whether the capability labels of the node don't match its status any more
+func CapabilitiesOutdated(obj *corev1.Node) bool {
+	cpu, memory := getCapabilityBuckets()
+	for key, value := range capabilityLabels(obj, cpu, memory) {
+		current, exists := obj.GetLabels()[key]
+		if value == nil && exists || value != nil && (!exists || current != value.(string)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCapabilities labels the node with its architecture, the classes of its CPUs and its memory, the versions
+// of its kubelet and its operating system, and its extended resources, the classes follow the cpu-classes and
+// memory-classes flags
+func SetCapabilities(obj *corev1.Node) error {
+	cpu, memory := getCapabilityBuckets()
+	return mergeNodeLabels(obj.GetName(), capabilityLabels(obj, cpu, memory))
+}
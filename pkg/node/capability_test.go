@@ -0,0 +1,127 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	"github.com/EdgeNet-project/edgenet/pkg/util"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseBuckets(t *testing.T) {
+	cases := map[string]struct {
+		input    string
+		expected Buckets
+		valid    bool
+	}{
+		"default":   {DefaultCPUClasses, Buckets{{"small", 2}, {"medium", 8}, {"large", 0}}, true},
+		"bounded":   {"pi=1, sbc=4.5", Buckets{{"pi", 1}, {"sbc", 4.5}}, true},
+		"single":    {"any", Buckets{{"any", 0}}, true},
+		"unbounded": {"small,large=8", nil, false},
+		"order":     {"small=8,large=2", nil, false},
+		"maximum":   {"small=two,large", nil, false},
+		"negative":  {"small=-1,large", nil, false},
+		"name":      {"small class=2,large", nil, false},
+		"empty":     {"", nil, false},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			buckets, err := ParseBuckets(tc.input)
+			util.Equals(t, tc.valid, err == nil)
+			if tc.valid {
+				util.Equals(t, tc.expected, buckets)
+			}
+		})
+	}
+}
+
+func TestBucketsClass(t *testing.T) {
+	buckets, err := ParseBuckets("small=2,medium=8,large")
+	util.OK(t, err)
+	util.Equals(t, "small", buckets.Class(0.5))
+	util.Equals(t, "small", buckets.Class(2))
+	util.Equals(t, "medium", buckets.Class(2.5))
+	util.Equals(t, "large", buckets.Class(64))
+	bounded, err := ParseBuckets("small=2,medium=8")
+	util.OK(t, err)
+	util.Equals(t, "", bounded.Class(16))
+}
+
+func TestCapabilities(t *testing.T) {
+	g := testGroup{}
+	g.Init()
+	nodeObj := g.nodeObj
+	nodeObj.ObjectMeta = metav1.ObjectMeta{
+		Name: "pi.edge-net.io",
+		Labels: map[string]string{
+			"kubernetes.io/hostname":                  "pi.edge-net.io",
+			"edge-net.io/resource-example.com_camera": "true",
+		},
+	}
+	nodeObj.Status.Capacity = corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("4"),
+		corev1.ResourceMemory: resource.MustParse("3884Mi"),
+		corev1.ResourcePods:   resource.MustParse("110"),
+		"hugepages-2Mi":       resource.MustParse("0"),
+		"nvidia.com/gpu":      resource.MustParse("1"),
+		"example.com/tpu":     resource.MustParse("0"),
+	}
+	nodeObj.Status.NodeInfo = corev1.NodeSystemInfo{
+		Architecture:   "arm64",
+		KubeletVersion: "v1.19.2+k3s1",
+		OSImage:        "Ubuntu 20.04.1 LTS",
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeObj.DeepCopy(), metav1.CreateOptions{})
+	util.Equals(t, true, CapabilitiesOutdated(nodeObj.DeepCopy()))
+
+	err := SetCapabilities(nodeObj.DeepCopy())
+	util.OK(t, err)
+	node, err := g.client.CoreV1().Nodes().Get(context.TODO(), nodeObj.GetName(), metav1.GetOptions{})
+	util.OK(t, err)
+	expected := map[string]string{
+		"kubernetes.io/hostname":              "pi.edge-net.io",
+		"edge-net.io/arch":                    "arm64",
+		"edge-net.io/cpu-class":               "medium",
+		"edge-net.io/memory-class":            "medium",
+		"edge-net.io/kubelet-version":         "v1.19.2_k3s1",
+		"edge-net.io/os-image":                "Ubuntu_20.04.1_LTS",
+		"edge-net.io/resource-nvidia.com_gpu": "true",
+	}
+	util.Equals(t, expected, node.GetLabels())
+	util.Equals(t, false, CapabilitiesOutdated(node))
+
+	// An upgrade of the node changes its labels
+	node.Status.NodeInfo.KubeletVersion = "v1.20.0"
+	delete(node.Status.Capacity, "nvidia.com/gpu")
+	util.Equals(t, true, CapabilitiesOutdated(node))
+	err = SetCapabilities(node)
+	util.OK(t, err)
+	node, err = g.client.CoreV1().Nodes().Get(context.TODO(), nodeObj.GetName(), metav1.GetOptions{})
+	util.OK(t, err)
+	util.Equals(t, "v1.20.0", node.GetLabels()["edge-net.io/kubelet-version"])
+	_, exists := node.GetLabels()["edge-net.io/resource-nvidia.com_gpu"]
+	util.Equals(t, false, exists)
+}
+
+func TestIsExtendedResource(t *testing.T) {
+	cases := map[corev1.ResourceName]bool{
+		corev1.ResourceCPU:              false,
+		corev1.ResourceEphemeralStorage: false,
+		"hugepages-1Gi":                 false,
+		"kubernetes.io/batch-cpu":       false,
+		"node.kubernetes.io/something":  false,
+		"requests.nvidia.com/gpu":       false,
+		"nvidia.com/gpu":                true,
+		"devices.kubevirt.io/kvm":       true,
+		"squat.ai/video":                true,
+	}
+	for name, expected := range cases {
+		util.Equals(t, expected, isExtendedResource(name))
+	}
+	util.Equals(t, "edge-net.io/resource-nvidia.com_gpu", resourceLabel("nvidia.com/gpu"))
+	long := resourceLabel("example.com/a-very-long-name-of-an-extended-resource-that-goes-beyond-the-limit")
+	util.Equals(t, len("edge-net.io/")+63, len(long))
+}
@@ -0,0 +1,325 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This code includes GeoLite2 data created by MaxMind, available from
+// https://www.maxmind.com.
+
+package node
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	geoip2 "github.com/oschwald/geoip2-golang"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// maxMindDatabase looks the IP addresses up in a MaxMind City database such as GeoLite2 City
+type maxMindDatabase struct {
+	reader *geoip2.Reader
+}
+
+// NewMaxMindLocator opens the MaxMind City database at the path given
+func NewMaxMindLocator(path string) (*FileLocator, error) {
+	return newFileLocator(path, func(path string) (database, error) {
+		reader, err := geoip2.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return maxMindDatabase{reader: reader}, nil
+	})
+}
+
+func (m maxMindDatabase) Locate(ip net.IP) (Location, error) {
+	record, err := m.reader.City(ip)
+	if err != nil {
+		return Location{}, err
+	}
+	// Zero value typically means there isn't any result meaningful
+	if record.Location.Longitude == 0 && record.Location.Latitude == 0 {
+		return Location{}, ErrLocationNotFound
+	}
+	location := Location{
+		Continent: record.Continent.Names["en"],
+		Country:   record.Country.IsoCode,
+		State:     record.Country.IsoCode,
+		City:      record.City.Names["en"],
+		Latitude:  record.Location.Latitude,
+		Longitude: record.Location.Longitude,
+		Source:    SourceMaxMind,
+		Accuracy:  int(record.Location.AccuracyRadius),
+	}
+	if len(record.Subdivisions) > 0 {
+		location.State = record.Subdivisions[0].IsoCode
+	}
+	return location, nil
+}
+
+func (m maxMindDatabase) Close() error {
+	return m.reader.Close()
+}
+
+// maxMindASNDatabase looks the autonomous systems of the IP addresses up in a MaxMind ASN database such as GeoLite2 ASN
+type maxMindASNDatabase struct {
+	reader *geoip2.Reader
+}
+
+// NewMaxMindASNLocator opens the MaxMind ASN database at the path given
+func NewMaxMindASNLocator(path string) (*FileLocator, error) {
+	return newFileLocator(path, func(path string) (database, error) {
+		reader, err := geoip2.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return maxMindASNDatabase{reader: reader}, nil
+	})
+}
+
+func (m maxMindASNDatabase) Network(ip net.IP) (Network, error) {
+	record, err := m.reader.ASN(ip)
+	if err != nil {
+		return Network{}, err
+	}
+	if record.AutonomousSystemNumber == 0 {
+		return Network{}, ErrNetworkNotFound
+	}
+	return Network{ASN: record.AutonomousSystemNumber, Organization: record.AutonomousSystemOrganization}, nil
+}
+
+func (m maxMindASNDatabase) Close() error {
+	return m.reader.Close()
+}
+
+// ip2LocationRange is a row of an IP2Location database, the IP addresses are in their 16-byte form
+type ip2LocationRange struct {
+	from     net.IP
+	to       net.IP
+	location Location
+}
+
+// ip2LocationDatabase holds the ranges of an IP2Location database sorted by their first address
+type ip2LocationDatabase []ip2LocationRange
+
+// NewIP2LocationLocator loads the IP2Location database at the path given, in the CSV format of the
+// DB5 to DB11 downloads whose columns start with ip_from, ip_to, country_code, country_name, region_name,
+// city_name, latitude, and longitude. Both the IPv4 and the IPv6 editions work. These databases have no continent.
+func NewIP2LocationLocator(path string) (*FileLocator, error) {
+	return newFileLocator(path, loadIP2Location)
+}
+
+func loadIP2Location(path string) (database, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	db := ip2LocationDatabase{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		if len(record) < 8 {
+			return nil, fmt.Errorf("%s: line %d has %d columns, expected at least 8", path, line, len(record))
+		}
+		from, fromErr := ip2LocationNumber(record[0])
+		to, toErr := ip2LocationNumber(record[1])
+		if fromErr != nil || toErr != nil {
+			// The first line may name the columns
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%s: line %d has no valid range", path, line)
+		}
+		// The ranges without country are the reserved ones
+		if record[2] == "-" || record[2] == "" {
+			continue
+		}
+		lat, err := strconv.ParseFloat(record[6], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d has an invalid latitude %q", path, line, record[6])
+		}
+		lon, err := strconv.ParseFloat(record[7], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d has an invalid longitude %q", path, line, record[7])
+		}
+		db = append(db, ip2LocationRange{from: from, to: to, location: Location{
+			Country:   record[2],
+			State:     record[4],
+			City:      record[5],
+			Latitude:  lat,
+			Longitude: lon,
+			Source:    SourceIP2Location,
+		}})
+	}
+	sort.Slice(db, func(i, j int) bool { return bytes.Compare(db[i].from, db[j].from) < 0 })
+	return db, nil
+}
+
+// ip2LocationNumber turns the decimal form of an IP address used by IP2Location into the 16-byte form,
+// the IPv4 edition counts from zero while the IPv6 one maps the IPv4 addresses to ::ffff:0:0/96
+func ip2LocationNumber(value string) (net.IP, error) {
+	number, ok := new(big.Int).SetString(strings.TrimSpace(value), 10)
+	if !ok || number.Sign() < 0 || number.BitLen() > 128 {
+		return nil, fmt.Errorf("%q is not an IP number", value)
+	}
+	if number.BitLen() <= 32 {
+		v := number.Uint64()
+		return net.IPv4(byte(v>>24), byte(v>>16), byte(v>>8), byte(v)), nil
+	}
+	ip := make(net.IP, net.IPv6len)
+	number.FillBytes(ip)
+	return ip, nil
+}
+
+func (db ip2LocationDatabase) Locate(ip net.IP) (Location, error) {
+	ip = ip.To16()
+	if ip == nil {
+		return Location{}, ErrLocationNotFound
+	}
+	// Find the last range that starts before the IP address
+	i := sort.Search(len(db), func(i int) bool { return bytes.Compare(db[i].from, ip) > 0 })
+	if i == 0 || bytes.Compare(ip, db[i-1].to) > 0 {
+		return Location{}, ErrLocationNotFound
+	}
+	location := db[i-1].location
+	if location.Latitude == 0 && location.Longitude == 0 {
+		return Location{}, ErrLocationNotFound
+	}
+	return location, nil
+}
+
+func (db ip2LocationDatabase) Close() error {
+	return nil
+}
+
+// subnet maps a subnet known by the operators to its location, the YAML files list them with these keys
+type subnet struct {
+	Subnet    string  `yaml:"subnet"`
+	Continent string  `yaml:"continent"`
+	Country   string  `yaml:"country-iso"`
+	State     string  `yaml:"state-iso"`
+	City      string  `yaml:"city"`
+	Latitude  float64 `yaml:"lat"`
+	Longitude float64 `yaml:"lon"`
+	Accuracy  int     `yaml:"accuracy"`
+	network   *net.IPNet
+}
+
+// subnetDatabase holds the subnets from the most specific to the least one
+type subnetDatabase []subnet
+
+// NewSubnetLocator loads the static mapping of subnets at the path given. A file ending in .yaml or .yml
+// lists the subnets with the keys subnet, continent, country-iso, state-iso, city, lat, lon, and optionally accuracy
+// in kilometres, and any other file is a CSV file with these columns in this order. The most specific subnet
+// that contains the IP address wins.
+func NewSubnetLocator(path string) (*FileLocator, error) {
+	return newFileLocator(path, loadSubnets)
+}
+
+func loadSubnets(path string) (database, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var subnets []subnet
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(content, &subnets); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	default:
+		reader := csv.NewReader(bytes.NewReader(content))
+		reader.Comment = '#'
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		for i, record := range records {
+			if len(record) != 7 && len(record) != 8 {
+				return nil, fmt.Errorf("%s: %s has %d columns, expected 7 or 8", path, record[0], len(record))
+			}
+			lat, latErr := strconv.ParseFloat(record[5], 64)
+			lon, lonErr := strconv.ParseFloat(record[6], 64)
+			if latErr != nil || lonErr != nil {
+				// The first line may name the columns
+				if i == 0 {
+					continue
+				}
+				return nil, fmt.Errorf("%s: %s has invalid coordinates", path, record[0])
+			}
+			accuracy := 0
+			if len(record) == 8 {
+				if accuracy, err = strconv.Atoi(record[7]); err != nil {
+					return nil, fmt.Errorf("%s: %s has an invalid accuracy %q", path, record[0], record[7])
+				}
+			}
+			subnets = append(subnets, subnet{Subnet: record[0], Continent: record[1], Country: record[2],
+				State: record[3], City: record[4], Latitude: lat, Longitude: lon, Accuracy: accuracy})
+		}
+	}
+	for i := range subnets {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(subnets[i].Subnet))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		subnets[i].network = network
+	}
+	sort.SliceStable(subnets, func(i, j int) bool {
+		iOnes, _ := subnets[i].network.Mask.Size()
+		jOnes, _ := subnets[j].network.Mask.Size()
+		return iOnes > jOnes
+	})
+	return subnetDatabase(subnets), nil
+}
+
+func (db subnetDatabase) Locate(ip net.IP) (Location, error) {
+	for _, row := range db {
+		if row.network.Contains(ip) {
+			return Location{
+				Continent: row.Continent,
+				Country:   row.Country,
+				State:     row.State,
+				City:      row.City,
+				Latitude:  row.Latitude,
+				Longitude: row.Longitude,
+				Source:    SourceSubnets,
+				Accuracy:  row.Accuracy,
+			}, nil
+		}
+	}
+	return Location{}, ErrLocationNotFound
+}
+
+func (db subnetDatabase) Close() error {
+	return nil
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Polygon consists of an exterior ring followed by the rings of its holes,
+// each ring is a list of [lon, lat] points
+type Polygon [][][]float64
+
+// MultiPolygon gathers the polygons decoded from a GeoJSON geometry, feature, or feature collection
+type MultiPolygon []Polygon
+
+// geoJSONObject covers the members of the GeoJSON object types that can describe an area
+type geoJSONObject struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    *geoJSONObject  `json:"geometry"`
+	Features    []geoJSONObject `json:"features"`
+	Geometries  []geoJSONObject `json:"geometries"`
+}
+
+// ParseGeoJSON decodes the polygon selector values. The value is either a single ring in the form of
+// [[lon, lat], ...], or a GeoJSON Polygon, MultiPolygon, GeometryCollection, Feature, or FeatureCollection.
+// Rings crossing the antimeridian are unwrapped so that their longitudes become continuous.
+func ParseGeoJSON(value string) (MultiPolygon, error) {
+	value = strings.TrimSpace(value)
+	var multiPolygon MultiPolygon
+	if strings.HasPrefix(value, "[") {
+		// The legacy format of EdgeNet which is a bare exterior ring
+		var ring [][]float64
+		if err := json.Unmarshal([]byte(value), &ring); err != nil {
+			return nil, err
+		}
+		multiPolygon = MultiPolygon{Polygon{ring}}
+	} else {
+		var object geoJSONObject
+		if err := json.Unmarshal([]byte(value), &object); err != nil {
+			return nil, err
+		}
+		var err error
+		if multiPolygon, err = object.polygons(); err != nil {
+			return nil, err
+		}
+	}
+	if len(multiPolygon) == 0 {
+		return nil, fmt.Errorf("no polygon found")
+	}
+	for i, polygon := range multiPolygon {
+		if len(polygon) == 0 {
+			return nil, fmt.Errorf("polygon %d has no ring", i)
+		}
+		for j, ring := range polygon {
+			if err := checkRing(ring); err != nil {
+				return nil, fmt.Errorf("ring %d of polygon %d: %s", j, i, err)
+			}
+			polygon[j] = unwrapRing(ring)
+		}
+	}
+	return multiPolygon, nil
+}
+
+// polygons walks through the GeoJSON object to collect the polygons that it contains
+func (o geoJSONObject) polygons() (MultiPolygon, error) {
+	switch o.Type {
+	case "Polygon":
+		var polygon Polygon
+		if err := json.Unmarshal(o.Coordinates, &polygon); err != nil {
+			return nil, err
+		}
+		return MultiPolygon{polygon}, nil
+	case "MultiPolygon":
+		var multiPolygon MultiPolygon
+		if err := json.Unmarshal(o.Coordinates, &multiPolygon); err != nil {
+			return nil, err
+		}
+		return multiPolygon, nil
+	case "Feature":
+		if o.Geometry == nil {
+			return nil, fmt.Errorf("feature has no geometry")
+		}
+		return o.Geometry.polygons()
+	case "FeatureCollection":
+		return collectPolygons(o.Features)
+	case "GeometryCollection":
+		return collectPolygons(o.Geometries)
+	}
+	return nil, fmt.Errorf("unsupported GeoJSON type %q", o.Type)
+}
+
+func collectPolygons(objects []geoJSONObject) (MultiPolygon, error) {
+	multiPolygon := MultiPolygon{}
+	for _, object := range objects {
+		polygons, err := object.polygons()
+		if err != nil {
+			return nil, err
+		}
+		multiPolygon = append(multiPolygon, polygons...)
+	}
+	return multiPolygon, nil
+}
+
+// checkRing verifies that the ring has enough points and that they are valid coordinates
+func checkRing(ring [][]float64) error {
+	if len(ring) < 3 {
+		return fmt.Errorf("a ring needs at least 3 points, %d given", len(ring))
+	}
+	for _, point := range ring {
+		// A third position, the altitude, is allowed by GeoJSON and ignored
+		if len(point) < 2 {
+			return fmt.Errorf("each point must be a [lon, lat] pair")
+		}
+		if point[0] < -360 || point[0] > 360 || point[1] < -90 || point[1] > 90 {
+			return fmt.Errorf("point [%g, %g] is out of the lon/lat range", point[0], point[1])
+		}
+	}
+	return nil
+}
+
+// unwrapRing shifts the longitudes by 360 degrees where an edge jumps across the antimeridian.
+// For example, [[170, 10], [-170, 10], ...] becomes [[170, 10], [190, 10], ...].
+func unwrapRing(ring [][]float64) [][]float64 {
+	unwrapped := make([][]float64, len(ring))
+	offset := 0.0
+	for i, point := range ring {
+		lon := point[0]
+		if i > 0 {
+			previous := ring[i-1][0]
+			if lon-previous > 180 {
+				offset -= 360
+			} else if previous-lon > 180 {
+				offset += 360
+			}
+		}
+		unwrapped[i] = []float64{lon + offset, point[1]}
+	}
+	return unwrapped
+}
+
+// Contains determines whether the point is inside at least one of the polygons
+func (m MultiPolygon) Contains(lon float64, lat float64) bool {
+	for _, polygon := range m {
+		if polygon.Contains(lon, lat) {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains determines whether the point is inside the exterior ring and outside the holes of the polygon
+func (p Polygon) Contains(lon float64, lat float64) bool {
+	if len(p) == 0 {
+		return false
+	}
+	// The longitude is also tested one turn around the globe in both directions,
+	// as the rings crossing the antimeridian may have been unwrapped beyond 180 degrees
+	insideRing := func(ring [][]float64) bool {
+		boundbox := Boundbox(ring)
+		for _, shift := range []float64{0, 360, -360} {
+			if GeoFence(boundbox, ring, lon+shift, lat) {
+				return true
+			}
+		}
+		return false
+	}
+	if !insideRing(p[0]) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if insideRing(hole) {
+			return false
+		}
+	}
+	return true
+}
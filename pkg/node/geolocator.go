@@ -0,0 +1,322 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrLocationNotFound tells that a geolocator knows nothing meaningful about an IP address
+var ErrLocationNotFound = errors.New("location not found")
+
+// The sources of the locations, the edge-net.io/location-source label of the nodes tells which one located them
+const (
+	SourceManual      = "manual"
+	SourceSubnets     = "subnets"
+	SourceMaxMind     = "maxmind"
+	SourceIP2Location = "ip2location"
+)
+
+// Location is what a geolocator finds out about an IP address, the country is an ISO 3166 code and
+// the state is the ISO code of the subdivision when the database provides it, or its name otherwise.
+// Accuracy is the radius in kilometres of the area that the location stands for, zero when unknown.
+type Location struct {
+	Continent string
+	Country   string
+	State     string
+	City      string
+	Latitude  float64
+	Longitude float64
+	Source    string
+	Accuracy  int
+}
+
+// ErrNetworkNotFound tells that a database knows no autonomous system for an IP address
+var ErrNetworkNotFound = errors.New("network not found")
+
+// Network is the autonomous system that announces an IP address, along with the organization that runs it
+type Network struct {
+	ASN          uint
+	Organization string
+}
+
+// NetworkResolver finds the autonomous systems of IP addresses
+type NetworkResolver interface {
+	// Network returns ErrNetworkNotFound when the IP address is unknown to the resolver
+	Network(ip net.IP) (Network, error)
+}
+
+// GeoLocator finds the location of IP addresses
+type GeoLocator interface {
+	// Locate returns ErrLocationNotFound when the IP address is unknown to the geolocator
+	Locate(ip net.IP) (Location, error)
+}
+
+// ChainLocator asks the geolocators in turn and returns the first location found
+type ChainLocator []GeoLocator
+
+// Locate falls back on the next geolocator when one doesn't know the IP address or fails
+func (c ChainLocator) Locate(ip net.IP) (Location, error) {
+	var errs []error
+	for _, locator := range c {
+		location, err := locator.Locate(ip)
+		if err == nil {
+			return location, nil
+		} else if err != ErrLocationNotFound {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return Location{}, fmt.Errorf("%s couldn't be located: %v", ip, errs)
+	}
+	return Location{}, ErrLocationNotFound
+}
+
+// database is a geolocation database loaded in memory or opened, which is closed once a newer copy replaces it,
+// it is either a GeoLocator or a NetworkResolver
+type database interface {
+	Close() error
+}
+
+// How often a FileLocator checks whether its file has changed
+const reloadInterval = time.Minute
+
+// FileLocator serves the lookups from a database file, it opens the file once and
+// loads it again when the file changes so that a refreshed database is picked up without a restart
+type FileLocator struct {
+	path     string
+	open     func(path string) (database, error)
+	interval time.Duration
+
+	// lock guards the database, which the reload swaps while the lookups go on
+	lock    sync.RWMutex
+	current database
+
+	// reloadLock guards the state of the file as of the last load
+	reloadLock sync.Mutex
+	checked    time.Time
+	modTime    time.Time
+	size       int64
+}
+
+func newFileLocator(path string, open func(path string) (database, error)) (*FileLocator, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	current, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &FileLocator{
+		path:     path,
+		open:     open,
+		interval: reloadInterval,
+		current:  current,
+		checked:  time.Now(),
+		modTime:  info.ModTime(),
+		size:     info.Size(),
+	}
+	return f, nil
+}
+
+// Locate looks the IP address up in the latest copy of the database
+func (f *FileLocator) Locate(ip net.IP) (Location, error) {
+	f.reload()
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	locator, ok := f.current.(GeoLocator)
+	if !ok {
+		return Location{}, ErrLocationNotFound
+	}
+	return locator.Locate(ip)
+}
+
+// Network looks the autonomous system of the IP address up in the latest copy of the database
+func (f *FileLocator) Network(ip net.IP) (Network, error) {
+	f.reload()
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	resolver, ok := f.current.(NetworkResolver)
+	if !ok {
+		return Network{}, ErrNetworkNotFound
+	}
+	return resolver.Network(ip)
+}
+
+// Close closes the database
+func (f *FileLocator) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.current.Close()
+}
+
+// reload opens the file again if it has changed since the last load, the lookups keep
+// using the current copy when the new one can't be opened, for example, while it is being written
+func (f *FileLocator) reload() {
+	f.reloadLock.Lock()
+	defer f.reloadLock.Unlock()
+	if time.Since(f.checked) < f.interval {
+		return
+	}
+	f.checked = time.Now()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		log.Printf("Geolocation database %s: %s", f.path, err)
+		return
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return
+	}
+	updated, err := f.open(f.path)
+	if err != nil {
+		log.Printf("Geolocation database %s couldn't be reloaded: %s", f.path, err)
+		return
+	}
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	f.lock.Lock()
+	previous := f.current
+	f.current = updated
+	f.lock.Unlock()
+	previous.Close()
+	log.Printf("Geolocation database %s reloaded", f.path)
+}
+
+// The geolocator in use, which the flags set up unless SetGeoLocator replaces it
+var geoLocator GeoLocator
+var geoLocatorLock sync.Mutex
+
+// SetGeoLocator replaces the geolocator that locates the nodes and the reference points of the selectors
+func SetGeoLocator(locator GeoLocator) {
+	geoLocatorLock.Lock()
+	defer geoLocatorLock.Unlock()
+	geoLocator = locator
+	geoSkipped = nil
+	geoChecked = time.Time{}
+}
+
+// The databases of the chain that are already open, by path, so that getGeoLocator only retries the missing ones
+var geoDatabases = map[string]*FileLocator{}
+
+// The errors of the databases that the chain misses, and when getGeoLocator last tried to open them,
+// it tries again once the interval has passed, as FileLocator does with the changes of its file
+var geoSkipped []error
+var geoChecked time.Time
+var geoRetryInterval = reloadInterval
+
+// getGeoLocator returns the geolocator in use, or chains the databases given by the geo-subnets-path,
+// geolite-path, and ip2location-path flags in that order. The subnets come first as the operators know them best.
+// A chain that misses some of its databases serves the lookups meanwhile, and the missing ones join it once they
+// open at one of the retries.
+func getGeoLocator() (GeoLocator, error) {
+	geoLocatorLock.Lock()
+	defer geoLocatorLock.Unlock()
+	if (geoLocator != nil && len(geoSkipped) == 0) || time.Since(geoChecked) < geoRetryInterval {
+		if geoLocator == nil {
+			return nil, fmt.Errorf("no geolocation database available: %v", geoSkipped)
+		}
+		return geoLocator, nil
+	}
+	geoChecked = time.Now()
+	pathGeoLite := lookupFlag("geolite-path")
+	if pathGeoLite == "" {
+		pathGeoLite = "../../assets/database/GeoLite2-City/GeoLite2-City.mmdb"
+	}
+	databases := []struct {
+		path string
+		open func(path string) (*FileLocator, error)
+	}{
+		{lookupFlag("geo-subnets-path"), NewSubnetLocator},
+		{pathGeoLite, NewMaxMindLocator},
+		{lookupFlag("ip2location-path"), NewIP2LocationLocator},
+	}
+	var chain ChainLocator
+	var errs []error
+	for _, database := range databases {
+		if database.path == "" {
+			continue
+		}
+		locator, open := geoDatabases[database.path]
+		if !open {
+			var err error
+			if locator, err = database.open(database.path); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			geoDatabases[database.path] = locator
+		}
+		chain = append(chain, locator)
+	}
+	for _, err := range errs {
+		log.Printf("Geolocation database skipped: %s", err)
+	}
+	geoSkipped = errs
+	// Try again after the interval, the databases may not be in place yet
+	if len(chain) == 0 {
+		geoLocator = nil
+		return nil, fmt.Errorf("no geolocation database available: %v", errs)
+	}
+	geoLocator = chain
+	return geoLocator, nil
+}
+
+// The resolver of autonomous systems in use, which the geolite-asn-path flag sets up unless SetNetworkResolver replaces it
+var networkResolver NetworkResolver
+var networkResolverLock sync.Mutex
+
+// SetNetworkResolver replaces the resolver that finds the autonomous systems of the nodes
+func SetNetworkResolver(resolver NetworkResolver) {
+	networkResolverLock.Lock()
+	defer networkResolverLock.Unlock()
+	networkResolver = resolver
+}
+
+// getNetworkResolver returns the resolver in use, or opens the MaxMind ASN database given by the geolite-asn-path flag
+func getNetworkResolver() (NetworkResolver, error) {
+	networkResolverLock.Lock()
+	defer networkResolverLock.Unlock()
+	if networkResolver != nil {
+		return networkResolver, nil
+	}
+	path := lookupFlag("geolite-asn-path")
+	if path == "" {
+		path = "../../assets/database/GeoLite2-ASN/GeoLite2-ASN.mmdb"
+	}
+	// Try again at the next lookup, the database may not be in place yet
+	resolver, err := NewMaxMindASNLocator(path)
+	if err != nil {
+		return nil, err
+	}
+	networkResolver = resolver
+	return networkResolver, nil
+}
+
+// lookupFlag returns the value of the flag if the binary defines it
+func lookupFlag(name string) string {
+	if flag.Lookup(name) != nil {
+		return flag.Lookup(name).Value.(flag.Getter).Get().(string)
+	}
+	return ""
+}
@@ -0,0 +1,266 @@
+package node
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EdgeNet-project/edgenet/pkg/util"
+)
+
+// writeDatabase writes the content to a file in the directory, and sets its modification time
+// in the past so that a later write counts as a change
+func writeDatabase(t *testing.T, dir string, name string, content string, modTime time.Time) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	util.OK(t, err)
+	util.OK(t, os.Chtimes(path, modTime, modTime))
+	return path
+}
+
+type staticLocator map[string]Location
+
+func (s staticLocator) Locate(ip net.IP) (Location, error) {
+	if location, ok := s[ip.String()]; ok {
+		return location, nil
+	}
+	return Location{}, ErrLocationNotFound
+}
+
+type failingLocator struct{}
+
+func (failingLocator) Locate(ip net.IP) (Location, error) {
+	return Location{}, fmt.Errorf("database unavailable")
+}
+
+func TestSubnetLocator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geolocator")
+	util.OK(t, err)
+	defer os.RemoveAll(dir)
+	lip6 := Location{Continent: "Europe", Country: "FR", State: "IDF", City: "Paris", Latitude: 48.8467, Longitude: 2.3574, Source: SourceSubnets}
+	campus := Location{Continent: "Europe", Country: "FR", State: "IDF", City: "Paris", Latitude: 48.8462, Longitude: 2.3544, Source: SourceSubnets}
+
+	csvPath := writeDatabase(t, dir, "subnets.csv", `# subnet, continent, country-iso, state-iso, city, lat, lon
+subnet,continent,country-iso,state-iso,city,lat,lon
+132.227.0.0/16, Europe, FR, IDF, Paris, 48.8462, 2.3544
+132.227.123.0/24, Europe, FR, IDF, Paris, 48.8467, 2.3574
+2001:660:3302::/48, Europe, FR, IDF, Paris, 48.8467, 2.3574
+`, time.Now())
+	yamlPath := writeDatabase(t, dir, "subnets.yaml", `- subnet: 132.227.0.0/16
+  continent: Europe
+  country-iso: FR
+  state-iso: IDF
+  city: Paris
+  lat: 48.8462
+  lon: 2.3544
+- subnet: 132.227.123.0/24
+  continent: Europe
+  country-iso: FR
+  state-iso: IDF
+  city: Paris
+  lat: 48.8467
+  lon: 2.3574
+- subnet: 2001:660:3302::/48
+  continent: Europe
+  country-iso: FR
+  state-iso: IDF
+  city: Paris
+  lat: 48.8467
+  lon: 2.3574
+`, time.Now())
+
+	for _, path := range []string{csvPath, yamlPath} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			locator, err := NewSubnetLocator(path)
+			util.OK(t, err)
+			defer locator.Close()
+			cases := map[string]struct {
+				ip       string
+				expected Location
+				err      error
+			}{
+				"specific": {"132.227.123.200", lip6, nil},
+				"broad":    {"132.227.1.1", campus, nil},
+				"ipv6":     {"2001:660:3302:1::1", lip6, nil},
+				"unknown":  {"206.196.180.220", Location{}, ErrLocationNotFound},
+			}
+			for k, tc := range cases {
+				t.Run(k, func(t *testing.T) {
+					location, err := locator.Locate(net.ParseIP(tc.ip))
+					util.Equals(t, tc.err, err)
+					util.Equals(t, tc.expected, location)
+				})
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		path := writeDatabase(t, dir, "invalid.csv", "132.227.0.0/33,Europe,FR,IDF,Paris,48.8462,2.3544\n", time.Now())
+		_, err := NewSubnetLocator(path)
+		util.Equals(t, true, err != nil)
+	})
+}
+
+func TestIP2LocationLocator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geolocator")
+	util.OK(t, err)
+	defer os.RemoveAll(dir)
+	// 132.227.0.0 is 2229469184, 206.196.180.0 is 3468997632, and ::ffff:132.227.0.0 is 281472911212544
+	ipv4Path := writeDatabase(t, dir, "IP2LOCATION-LITE-DB5.CSV", `"0","16777215","-","-","-","-","0.000000","0.000000"
+"2229469184","2229534719","FR","France","Ile-de-France","Paris","48.853410","2.348800"
+"3468997632","3468997887","US","United States of America","Maryland","College Park","38.980670","-76.936919"
+`, time.Now())
+	ipv6Path := writeDatabase(t, dir, "IP2LOCATION-LITE-DB5.IPV6.CSV", `"0","281470681743359","-","-","-","-","0.000000","0.000000"
+"281472911212544","281472911278079","FR","France","Ile-de-France","Paris","48.853410","2.348800"
+"42540617478123219392477136852340441088","42540617478124428318296751481515147263","FR","France","Ile-de-France","Paris","48.853410","2.348800"
+`, time.Now())
+	paris := Location{Country: "FR", State: "Ile-de-France", City: "Paris", Latitude: 48.85341, Longitude: 2.3488, Source: SourceIP2Location}
+	collegePark := Location{Country: "US", State: "Maryland", City: "College Park", Latitude: 38.98067, Longitude: -76.936919, Source: SourceIP2Location}
+
+	cases := map[string]struct {
+		path     string
+		ip       string
+		expected Location
+		err      error
+	}{
+		"ipv4/fr":       {ipv4Path, "132.227.123.200", paris, nil},
+		"ipv4/us":       {ipv4Path, "206.196.180.220", collegePark, nil},
+		"ipv4/reserved": {ipv4Path, "0.0.0.1", Location{}, ErrLocationNotFound},
+		"ipv4/unknown":  {ipv4Path, "8.8.8.8", Location{}, ErrLocationNotFound},
+		"ipv6/mapped":   {ipv6Path, "132.227.123.200", paris, nil},
+		"ipv6/fr":       {ipv6Path, "2001:660:3302:1::1", paris, nil},
+		"ipv6/unknown":  {ipv6Path, "2001:db8::1", Location{}, ErrLocationNotFound},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			locator, err := NewIP2LocationLocator(tc.path)
+			util.OK(t, err)
+			defer locator.Close()
+			location, err := locator.Locate(net.ParseIP(tc.ip))
+			util.Equals(t, tc.err, err)
+			util.Equals(t, tc.expected, location)
+		})
+	}
+}
+
+func TestChainLocator(t *testing.T) {
+	paris := Location{Country: "FR", City: "Paris", Latitude: 48.8467, Longitude: 2.3574}
+	richardson := Location{Country: "US", City: "Richardson", Latitude: 32.9483, Longitude: -96.7299}
+	subnets := staticLocator{"132.227.123.200": paris}
+	database := staticLocator{"132.227.123.200": richardson, "206.196.180.220": richardson}
+
+	chain := ChainLocator{subnets, failingLocator{}, database}
+	location, err := chain.Locate(net.ParseIP("132.227.123.200"))
+	util.OK(t, err)
+	util.Equals(t, paris, location)
+	location, err = chain.Locate(net.ParseIP("206.196.180.220"))
+	util.OK(t, err)
+	util.Equals(t, richardson, location)
+	// The failure stands out when no geolocator finds the IP address
+	_, err = chain.Locate(net.ParseIP("8.8.8.8"))
+	util.Equals(t, true, err != nil && err != ErrLocationNotFound)
+	_, err = ChainLocator{subnets, database}.Locate(net.ParseIP("8.8.8.8"))
+	util.Equals(t, ErrLocationNotFound, err)
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geolocator")
+	util.OK(t, err)
+	defer os.RemoveAll(dir)
+	path := writeDatabase(t, dir, "subnets.csv", "132.227.0.0/16,Europe,FR,IDF,Paris,48.8462,2.3544\n", time.Now().Add(-time.Hour))
+	locator, err := NewSubnetLocator(path)
+	util.OK(t, err)
+	defer locator.Close()
+	ip := net.ParseIP("132.227.123.200")
+	location, err := locator.Locate(ip)
+	util.OK(t, err)
+	util.Equals(t, "Paris", location.City)
+
+	// The change waits for the next check
+	writeDatabase(t, dir, "subnets.csv", "132.227.0.0/16,Europe,FR,ARA,Lyon,45.7640,4.8357\n", time.Now())
+	location, err = locator.Locate(ip)
+	util.OK(t, err)
+	util.Equals(t, "Paris", location.City)
+	locator.interval = 0
+	location, err = locator.Locate(ip)
+	util.OK(t, err)
+	util.Equals(t, "Lyon", location.City)
+
+	// A broken copy leaves the current one in place
+	writeDatabase(t, dir, "subnets.csv", "132.227.0.0/16,Europe\n", time.Now().Add(time.Hour))
+	location, err = locator.Locate(ip)
+	util.OK(t, err)
+	util.Equals(t, "Lyon", location.City)
+}
+
+func TestGetGeoLocator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geolocator")
+	util.OK(t, err)
+	defer os.RemoveAll(dir)
+	subnetsPath := writeDatabase(t, dir, "subnets.csv", "132.227.0.0/16,Europe,FR,IDF,Paris,48.8462,2.3544\n", time.Now())
+	ip2LocationPath := filepath.Join(dir, "IP2LOCATION-LITE-DB5.CSV")
+	flags := map[string]string{
+		"geo-subnets-path": subnetsPath,
+		"geolite-path":     filepath.Join(dir, "GeoLite2-City.mmdb"),
+		"ip2location-path": ip2LocationPath,
+	}
+	for name, value := range flags {
+		if flag.Lookup(name) == nil {
+			flag.String(name, "", "")
+		}
+		util.OK(t, flag.Set(name, value))
+		defer flag.Set(name, "")
+	}
+	SetGeoLocator(nil)
+	defer SetGeoLocator(nil)
+	defer func() {
+		for _, path := range []string{subnetsPath, ip2LocationPath} {
+			if locator, open := geoDatabases[path]; open {
+				locator.Close()
+				delete(geoDatabases, path)
+			}
+		}
+	}()
+
+	// The chain goes on with the subnets while the other databases are missing, and looks for them again after the interval
+	locator, err := getGeoLocator()
+	util.OK(t, err)
+	util.Equals(t, ChainLocator{geoDatabases[subnetsPath]}, locator)
+	util.Equals(t, locator, geoLocator)
+
+	writeDatabase(t, dir, "IP2LOCATION-LITE-DB5.CSV", `"3468997632","3468997887","US","United States of America","Maryland","College Park","38.980670","-76.936919"
+`, time.Now())
+	locator, err = getGeoLocator()
+	util.OK(t, err)
+	util.Equals(t, ChainLocator{geoDatabases[subnetsPath]}, locator)
+
+	defer func(interval time.Duration) { geoRetryInterval = interval }(geoRetryInterval)
+	geoRetryInterval = 0
+	locator, err = getGeoLocator()
+	util.OK(t, err)
+	util.Equals(t, ChainLocator{geoDatabases[subnetsPath], geoDatabases[ip2LocationPath]}, locator)
+	util.Equals(t, locator, geoLocator)
+	location, err := locator.Locate(net.ParseIP("206.196.180.220"))
+	util.OK(t, err)
+	util.Equals(t, "College Park", location.City)
+}
+
+func TestLabelValue(t *testing.T) {
+	cases := map[string]string{
+		"College Park":               "College_Park",
+		"Zürich":                     "Z_rich",
+		"Provence-Alpes-Côte d'Azur": "Provence-Alpes-C_te_d_Azur",
+		" Paris ":                    "Paris",
+		"North America":              "North_America",
+		"":                           "",
+		"Llanfairpwllgwyngyllgogerychwyrndrobwllllantysiliogogogoch Wales": "Llanfairpwllgwyngyllgogerychwyrndrobwllllantysiliogogogoch_Wale",
+	}
+	for input, expected := range cases {
+		util.Equals(t, expected, LabelValue(input))
+	}
+}
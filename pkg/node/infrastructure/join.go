@@ -164,11 +164,11 @@ func SetHostname(client *namecheap.Client, hostRecord namecheap.DomainDNSHost) (
 	if exist {
 		for i, v := range hostList.Hosts {
 			if v.Name == hostRecord.Name || v.Address == hostRecord.Address {
+				log.Printf("UPDATE existing host: %s - %s \n Hostname  and ip address changed to: %s - %s", v.Name, v.Address, hostRecord.Name, hostRecord.Address)
 				hostList.Hosts[i] = hostRecord
 				break
 			}
 		}
-		log.Printf("UPDATE existing host: %s - %s \n Hostname  and ip address changed to: %s - %s", v.Name, v.Address, hostRecord.Name, hostRecord.Address)
 
 	} else {
 		//in case the record is new, it is appended to the list of existing records
@@ -22,19 +22,20 @@ package node
 import (
 	"context"
 	"encoding/json"
-	"flag"
 	"fmt"
 	"log"
 	"math"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
+	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
 	"github.com/EdgeNet-project/edgenet/pkg/bootstrap"
 	"github.com/EdgeNet-project/edgenet/pkg/node/infrastructure"
+	"github.com/EdgeNet-project/edgenet/pkg/remoteip"
 
 	namecheap "github.com/billputer/go-namecheap"
-	geoip2 "github.com/oschwald/geoip2-golang"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -102,6 +103,77 @@ func Boundbox(points [][]float64) []float64 {
 	return bounding
 }
 
+// earthRadius is the mean radius of the Earth in kilometers
+const earthRadius = 6371.0088
+
+// Circle is an area on the Earth described by a center and a radius in kilometers
+type Circle struct {
+	Lat    float64
+	Lon    float64
+	Radius float64
+}
+
+// ParseCircle decodes the radius selector values in the form of "lat, lon, radius" where radius is in kilometers
+func ParseCircle(value string) (Circle, error) {
+	fields := strings.Split(value, ",")
+	if len(fields) != 3 {
+		return Circle{}, fmt.Errorf("%q must be in the form of \"lat, lon, radius\"", value)
+	}
+	var numbers [3]float64
+	for i, field := range fields {
+		number, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(field), "km")), 64)
+		if err != nil {
+			return Circle{}, fmt.Errorf("%q is not a number", strings.TrimSpace(field))
+		}
+		numbers[i] = number
+	}
+	circle := Circle{Lat: numbers[0], Lon: numbers[1], Radius: numbers[2]}
+	if circle.Lat < -90 || circle.Lat > 90 || circle.Lon < -180 || circle.Lon > 180 {
+		return Circle{}, fmt.Errorf("center [%g, %g] is out of the lat/lon range", circle.Lat, circle.Lon)
+	}
+	if circle.Radius <= 0 {
+		return Circle{}, fmt.Errorf("radius must be greater than 0")
+	}
+	return circle, nil
+}
+
+// Contains determines whether the point is within the radius of the center
+func (c Circle) Contains(lon float64, lat float64) bool {
+	return GreatCircleDistance(c.Lat, c.Lon, lat, lon) <= c.Radius
+}
+
+// GreatCircleDistance calculates the distance in kilometers between two points by the haversine formula
+func GreatCircleDistance(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	toRadians := func(degree float64) float64 {
+		return degree * math.Pi / 180
+	}
+	deltaLat := toRadians(lat2 - lat1)
+	deltaLon := toRadians(lon2 - lon1)
+	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(deltaLon/2)*math.Sin(deltaLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// GetNodeCoordinates returns the latitude and longitude that the nodelabeler attached to the node
+func GetNodeCoordinates(obj *corev1.Node) (float64, float64, bool) {
+	latStr := obj.Labels["edge-net.io/lat"]
+	lonStr := obj.Labels["edge-net.io/lon"]
+	if len(latStr) < 2 || len(lonStr) < 2 {
+		return 0, 0, false
+	}
+	// Because of alphanumeric limitations of Kubernetes on the labels we use "w", "e", "n", and "s" prefixes
+	// at the labels of latitude and longitude. Here is the place those prefixes are dropped away.
+	lat, err := strconv.ParseFloat(latStr[1:], 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	lon, err := strconv.ParseFloat(lonStr[1:], 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
 // GetKubeletVersion looks at the head node to decide which version of Kubernetes to install
 func GetKubeletVersion() string {
 	nodeRaw, err := Clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{LabelSelector: "node-role.kubernetes.io/master"})
@@ -149,7 +221,7 @@ func SetNodeScheduling(nodeName string, unschedulable bool) error {
 }
 
 // setNodeLabels uses client-go to patch nodes by processing a labels map
-func setNodeLabels(hostname string, labels map[string]string) bool {
+func setNodeLabels(hostname string, labels map[string]string) error {
 	// Create a patch slice and initialize it to the label size
 	nodePatchArr := make([]patchStringValue, len(labels))
 	nodePatch := patchStringValue{}
@@ -166,77 +238,238 @@ func setNodeLabels(hostname string, labels map[string]string) bool {
 	// Patch the nodes with the arguments:
 	// hostname, patch type, and patch data
 	_, err := Clientset.CoreV1().Nodes().Patch(context.TODO(), hostname, types.JSONPatchType, nodesJSON, metav1.PatchOptions{})
+	return err
+}
+
+// GetCoordinatesByIP returns the latitude and longitude of the IP address according to the geolocator
+func GetCoordinatesByIP(ipStr string) (float64, float64, error) {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return 0, 0, fmt.Errorf("%q is not an IP address", ipStr)
+	}
+	locator, err := getGeoLocator()
 	if err != nil {
-		log.Println(err.Error())
-		panic(err.Error())
+		return 0, 0, err
+	}
+	location, err := locator.Locate(ip)
+	if err == ErrLocationNotFound {
+		return 0, 0, fmt.Errorf("no location found for %s", ipStr)
+	} else if err != nil {
+		return 0, 0, err
+	}
+	return location.Latitude, location.Longitude, nil
+}
+
+// ParseReferencePoint decodes the nearest selector values, which are either in the form of "lat, lon"
+// or an IP address to be located by the GeoLite database
+func ParseReferencePoint(value string) (float64, float64, error) {
+	value = strings.TrimSpace(value)
+	if net.ParseIP(value) != nil {
+		return GetCoordinatesByIP(value)
+	}
+	fields := strings.Split(value, ",")
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("%q must be either an IP address or in the form of \"lat, lon\"", value)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%q is not a number", strings.TrimSpace(fields[0]))
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%q is not a number", strings.TrimSpace(fields[1]))
+	}
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return 0, 0, fmt.Errorf("point [%g, %g] is out of the lat/lon range", lat, lon)
 	}
-	return true
+	return lat, lon, nil
 }
 
-// GetGeolocationByIP return geolabels by taking advantage of GeoLite database
-func GetGeolocationByIP(hostname string, ipStr string) bool {
+// LocationAnnotation holds the location of a node given by its contributor as a NodeLocation in JSON,
+// the nodelabeler prefers it over the geolocation of the IP addresses
+const LocationAnnotation = "edge-net.io/location"
+
+// GetGeolocationByIP return geolabels by taking advantage of the geolocator, the result is false when
+// the geolocator has no meaningful location for the IP address, and the error is set when the lookup or the patch fails
+func GetGeolocationByIP(hostname string, ipStr string) (bool, error) {
 	// Parse IP address
 	ip := net.ParseIP(ipStr)
-	var pathDB string
-	if flag.Lookup("geolite-path") != nil {
-		pathDB = flag.Lookup("geolite-path").Value.(flag.Getter).Get().(string)
-	}
-	if pathDB == "" {
-		pathDB = "../../assets/database/GeoLite2-City/GeoLite2-City.mmdb"
+	if ip == nil {
+		return false, fmt.Errorf("%q is not an IP address", ipStr)
 	}
-	// Open GeoLite database
-	db, err := geoip2.Open(pathDB)
+	locator, err := getGeoLocator()
 	if err != nil {
-		log.Fatal(err)
-		return false
+		return false, err
 	}
-	// Close the database as a final job
-	defer db.Close()
 	// Get the geolocation information by IP
-	record, err := db.City(ip)
+	location, err := locator.Locate(ip)
+	if err == ErrLocationNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	// Attach geolabels to the node
+	if err := SetGeolocation(hostname, location); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetManualLocation returns the location in the location annotation of the node, the result is false
+// when the node has no such annotation, and the error is set when the annotation is invalid
+func GetManualLocation(obj *corev1.Node) (Location, bool, error) {
+	value, exists := obj.GetAnnotations()[LocationAnnotation]
+	if !exists {
+		return Location{}, false, nil
+	}
+	var manual apps_v1alpha.NodeLocation
+	if err := json.Unmarshal([]byte(value), &manual); err != nil {
+		return Location{}, true, fmt.Errorf("%s annotation is not a location: %s", LocationAnnotation, err)
+	}
+	if manual.Latitude < -90 || manual.Latitude > 90 || manual.Longitude < -180 || manual.Longitude > 180 {
+		return Location{}, true, fmt.Errorf("point [%g, %g] is out of the lat/lon range", manual.Latitude, manual.Longitude)
+	}
+	if manual.Latitude == 0 && manual.Longitude == 0 {
+		return Location{}, true, fmt.Errorf("%s annotation has no coordinates", LocationAnnotation)
+	}
+	if manual.Country == "" {
+		return Location{}, true, fmt.Errorf("%s annotation has no country", LocationAnnotation)
+	}
+	if manual.Accuracy < 0 {
+		return Location{}, true, fmt.Errorf("accuracy %d is negative", manual.Accuracy)
+	}
+	location := Location{
+		Continent: manual.Continent,
+		Country:   manual.Country,
+		State:     manual.State,
+		City:      manual.City,
+		Latitude:  manual.Latitude,
+		Longitude: manual.Longitude,
+		Source:    SourceManual,
+		Accuracy:  manual.Accuracy,
+	}
+	return location, true, nil
+}
+
+// SetLocationAnnotation puts the location given by the contributor on the node for the nodelabeler to pick it up
+func SetLocationAnnotation(nodeName string, location apps_v1alpha.NodeLocation) error {
+	value, err := json.Marshal(location)
 	if err != nil {
-		log.Fatal(err)
-		return false
+		return err
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{LocationAnnotation: string(value)},
+		},
 	}
+	patchJSON, _ := json.Marshal(patch)
+	_, err = Clientset.CoreV1().Nodes().Patch(context.TODO(), nodeName, types.MergePatchType, patchJSON, metav1.PatchOptions{})
+	return err
+}
 
-	// Patch for being compatible with Kubernetes alphanumeric characters limitations
-	continent := strings.Replace(record.Continent.Names["en"], " ", "_", -1)
-	country := record.Country.IsoCode
-	state := record.Country.IsoCode
-	city := strings.Replace(record.City.Names["en"], " ", "_", -1)
+// SetGeolocation attaches the geolabels of the location to the node, along with the source of the location
+// and its accuracy in kilometres, which is unknown for the databases that don't tell it. The region and
+// the zone labels of Kubernetes follow the geolabels, see Topology for the mapping, and they are removed
+// when the location has no region any more.
+func SetGeolocation(hostname string, location Location) error {
+	// Some databases have no continent, which the country tells
+	if location.Continent == "" {
+		location.Continent = continentOf(location.Country)
+	}
 	var lon string
 	var lat string
-	if record.Location.Longitude >= 0 {
-		lon = fmt.Sprintf("e%.6f", record.Location.Longitude)
+	if location.Longitude >= 0 {
+		lon = fmt.Sprintf("e%.6f", location.Longitude)
 	} else {
-		lon = fmt.Sprintf("w%.6f", record.Location.Longitude)
+		lon = fmt.Sprintf("w%.6f", location.Longitude)
 	}
-	if record.Location.Latitude >= 0 {
-		lat = fmt.Sprintf("n%.6f", record.Location.Latitude)
+	if location.Latitude >= 0 {
+		lat = fmt.Sprintf("n%.6f", location.Latitude)
 	} else {
-		lat = fmt.Sprintf("s%.6f", record.Location.Latitude)
+		lat = fmt.Sprintf("s%.6f", location.Latitude)
 	}
-	if len(record.Subdivisions) > 0 {
-		state = record.Subdivisions[0].IsoCode
+	accuracy := "unknown"
+	if location.Accuracy > 0 {
+		accuracy = strconv.Itoa(location.Accuracy)
 	}
 
 	// Create label map to attach to the node
 	geoLabels := map[string]string{
-		"edge-net.io~1continent":   continent,
-		"edge-net.io~1country-iso": country,
-		"edge-net.io~1state-iso":   state,
-		"edge-net.io~1city":        city,
-		"edge-net.io~1lon":         lon,
-		"edge-net.io~1lat":         lat,
+		"edge-net.io~1continent":            LabelValue(location.Continent),
+		"edge-net.io~1country-iso":          LabelValue(location.Country),
+		"edge-net.io~1state-iso":            LabelValue(location.State),
+		"edge-net.io~1city":                 LabelValue(location.City),
+		"edge-net.io~1lon":                  lon,
+		"edge-net.io~1lat":                  lat,
+		"edge-net.io~1location-source":      location.Source,
+		"edge-net.io~1location-accuracy-km": accuracy,
+	}
+	region, zone := Topology(location)
+	if region != "" {
+		geoLabels[strings.Replace(RegionLabel, "/", "~1", 1)] = region
+		geoLabels[strings.Replace(ZoneLabel, "/", "~1", 1)] = zone
+	}
+	if err := setNodeLabels(hostname, geoLabels); err != nil || region != "" {
+		return err
 	}
+	// A JSON patch fails to remove a label that doesn't exist, whereas a merge patch doesn't
+	return mergeNodeLabels(hostname, map[string]interface{}{RegionLabel: nil, ZoneLabel: nil})
+}
 
-	// Attach geolabels to the node
-	result := setNodeLabels(hostname, geoLabels)
-	// If the result is different than the expected, return false
-	// The expected result is having a different longitude and latitude than zero
-	// Zero value typically means there isn't any result meaningful
-	if record.Location.Longitude == 0 && record.Location.Latitude == 0 {
-		return false
+// SetNetwork attaches the network labels to the node. The edge-net.io/nat label tells whether the node has no public
+// IP address, which means that it reaches the internet through a NAT, and the edge-net.io/asn and edge-net.io/as-org
+// labels tell the autonomous system of its public IP address. They are removed when the address has no known
+// autonomous system any more, and left as they are while the ASN database is unavailable.
+func SetNetwork(hostname string, internalIP string, externalIP string) error {
+	var public net.IP
+	for _, address := range []string{externalIP, internalIP} {
+		if ip := net.ParseIP(address); ip != nil && ip.IsGlobalUnicast() && !remoteip.IsPrivate(ip) {
+			public = ip
+			break
+		}
+	}
+	networkLabels := map[string]interface{}{"edge-net.io/nat": strconv.FormatBool(public == nil)}
+	if public == nil {
+		networkLabels["edge-net.io/asn"] = nil
+		networkLabels["edge-net.io/as-org"] = nil
+	} else if resolver, err := getNetworkResolver(); err != nil {
+		log.Printf("Autonomous system of %s skipped: %s", hostname, err)
+	} else if network, err := resolver.Network(public); err == nil {
+		networkLabels["edge-net.io/asn"] = strconv.FormatUint(uint64(network.ASN), 10)
+		networkLabels["edge-net.io/as-org"] = LabelValue(network.Organization)
+	} else if err == ErrNetworkNotFound {
+		networkLabels["edge-net.io/asn"] = nil
+		networkLabels["edge-net.io/as-org"] = nil
+	} else {
+		return err
+	}
+	return mergeNodeLabels(hostname, networkLabels)
+}
+
+// mergeNodeLabels patches the labels of the node with a merge patch, which removes the labels whose values are nil
+func mergeNodeLabels(hostname string, labels map[string]interface{}) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": labels,
+		},
+	}
+	patchJSON, _ := json.Marshal(patch)
+	_, err := Clientset.CoreV1().Nodes().Patch(context.TODO(), hostname, types.MergePatchType, patchJSON, metav1.PatchOptions{})
+	return err
+}
+
+// LabelValue patches the names for being compatible with Kubernetes alphanumeric characters limitations,
+// the spaces and the other characters that a label value can't hold become underscores
+func LabelValue(name string) string {
+	value := []rune(name)
+	for i, r := range value {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			value[i] = '_'
+		}
+	}
+	result := strings.Trim(string(value), "-_.")
+	if len(result) > 63 {
+		result = strings.TrimRight(result[:63], "-_.")
 	}
 	return result
 }
@@ -343,7 +576,7 @@ func getNodeByHostname(hostname string) (string, error) {
 		return "error", err
 	} else if err != nil {
 		log.Println(err.Error())
-		panic(err.Error())
+		return "error", err
 	} else {
 		return "true", nil
 	}
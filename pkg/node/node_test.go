@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
+	"net"
 	"os"
 	"reflect"
 	"testing"
 
+	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
 	"github.com/EdgeNet-project/edgenet/pkg/util"
 	"github.com/sirupsen/logrus"
 
@@ -190,6 +193,133 @@ func TestGeofence(t *testing.T) {
 	}
 }
 
+func TestParseGeoJSON(t *testing.T) {
+	cases := map[string]struct {
+		input    string
+		polygons int
+		err      bool
+	}{
+		"ring":               {"[ [2.2150567, 48.8947616], [2.2040704, 48.8084639], [2.3393396, 48.7835862] ]", 1, false},
+		"polygon":            {`{"type": "Polygon", "coordinates": [[[0, 0], [10, 0], [10, 10], [0, 10], [0, 0]], [[4, 4], [6, 4], [6, 6], [4, 6], [4, 4]]]}`, 1, false},
+		"multipolygon":       {`{"type": "MultiPolygon", "coordinates": [[[[0, 0], [1, 0], [1, 1], [0, 0]]], [[[5, 5], [6, 5], [6, 6], [5, 5]]]]}`, 2, false},
+		"feature":            {`{"type": "Feature", "properties": {"name": "square"}, "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}}`, 1, false},
+		"featurecollection":  {`{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}}, {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[5, 5], [6, 5], [6, 6], [5, 5]]]}}]}`, 2, false},
+		"point":              {`{"type": "Point", "coordinates": [0, 0]}`, 0, true},
+		"feature/nogeometry": {`{"type": "Feature", "properties": {}}`, 0, true},
+		"ring/short":         {"[ [0, 0], [1, 1] ]", 0, true},
+		"ring/latitude":      {"[ [0, 0], [1, 91], [1, 0] ]", 0, true},
+		"malformed":          {"[ [0, 0], [1, 1 ]", 0, true},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			polygons, err := ParseGeoJSON(tc.input)
+			util.Equals(t, tc.err, err != nil)
+			util.Equals(t, tc.polygons, len(polygons))
+		})
+	}
+}
+
+func TestMultiPolygonContains(t *testing.T) {
+	square := `{"type": "Polygon", "coordinates": [[[0, 0], [10, 0], [10, 10], [0, 10], [0, 0]], [[4, 4], [6, 4], [6, 6], [4, 6], [4, 4]]]}`
+	islands := `{"type": "MultiPolygon", "coordinates": [[[[0, 0], [1, 0], [1, 1], [0, 1], [0, 0]]], [[[5, 5], [6, 5], [6, 6], [5, 6], [5, 5]]]]}`
+	fiji := `{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[176, -20], [-178, -20], [-178, -15], [176, -15], [176, -20]]]}}`
+	cases := map[string]struct {
+		input    string
+		point    []float64
+		expected bool
+	}{
+		"polygon/inside":       {square, []float64{2, 2}, true},
+		"polygon/hole":         {square, []float64{5, 5}, false},
+		"polygon/outside":      {square, []float64{12, 2}, false},
+		"multipolygon/first":   {islands, []float64{0.5, 0.5}, true},
+		"multipolygon/second":  {islands, []float64{5.5, 5.5}, true},
+		"multipolygon/between": {islands, []float64{3, 3}, false},
+		"antimeridian/east":    {fiji, []float64{178.4, -18.1}, true},
+		"antimeridian/west":    {fiji, []float64{-179.5, -16.5}, true},
+		"antimeridian/outside": {fiji, []float64{0, -18}, false},
+		"antimeridian/beyond":  {fiji, []float64{-170, -18}, false},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			polygons, err := ParseGeoJSON(tc.input)
+			util.OK(t, err)
+			util.Equals(t, tc.expected, polygons.Contains(tc.point[0], tc.point[1]))
+		})
+	}
+}
+
+func TestParseCircle(t *testing.T) {
+	cases := map[string]struct {
+		input    string
+		expected Circle
+		err      bool
+	}{
+		"plain":           {"48.8566, 2.3522, 50", Circle{Lat: 48.8566, Lon: 2.3522, Radius: 50}, false},
+		"unit":            {"48.8566,2.3522,50km", Circle{Lat: 48.8566, Lon: 2.3522, Radius: 50}, false},
+		"missing":         {"48.8566, 2.3522", Circle{}, true},
+		"nan":             {"48.8566, east, 50", Circle{}, true},
+		"latitude":        {"98.8566, 2.3522, 50", Circle{}, true},
+		"radius/zero":     {"48.8566, 2.3522, 0", Circle{}, true},
+		"radius/negative": {"48.8566, 2.3522, -50", Circle{}, true},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			circle, err := ParseCircle(tc.input)
+			util.Equals(t, tc.err, err != nil)
+			util.Equals(t, tc.expected, circle)
+		})
+	}
+}
+
+func TestCircleContains(t *testing.T) {
+	paris := Circle{Lat: 48.8566, Lon: 2.3522, Radius: 50}
+	fiji := Circle{Lat: -17.8, Lon: 179.9, Radius: 100}
+	cases := map[string]struct {
+		circle   Circle
+		point    []float64
+		expected bool
+	}{
+		"paris/center":        {paris, []float64{2.3522, 48.8566}, true},
+		"paris/versailles":    {paris, []float64{2.1301, 48.8049}, true},
+		"paris/london":        {paris, []float64{-0.1276, 51.5072}, false},
+		"antimeridian/inside": {fiji, []float64{-179.9, -17.8}, true},
+		"antimeridian/beyond": {fiji, []float64{-177, -17.8}, false},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			util.Equals(t, tc.expected, tc.circle.Contains(tc.point[0], tc.point[1]))
+		})
+	}
+}
+
+func TestGreatCircleDistance(t *testing.T) {
+	// Paris to London is about 344 km, and a quarter of the equator is about 10008 km
+	util.Equals(t, 344.0, math.Round(GreatCircleDistance(48.8566, 2.3522, 51.5072, -0.1276)))
+	util.Equals(t, 10008.0, math.Round(GreatCircleDistance(0, 0, 0, 90)))
+	util.Equals(t, 0.0, GreatCircleDistance(48.8566, 2.3522, 48.8566, 2.3522))
+}
+
+func TestParseReferencePoint(t *testing.T) {
+	cases := map[string]struct {
+		input    string
+		expected []float64
+		err      bool
+	}{
+		"coordinates": {"48.8566, 2.3522", []float64{48.8566, 2.3522}, false},
+		"compact":     {"-33.8688,151.2093", []float64{-33.8688, 151.2093}, false},
+		"missing":     {"48.8566", []float64{0, 0}, true},
+		"nan":         {"north, 2.3522", []float64{0, 0}, true},
+		"longitude":   {"48.8566, 182.3522", []float64{0, 0}, true},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			lat, lon, err := ParseReferencePoint(tc.input)
+			util.Equals(t, tc.err, err != nil)
+			util.Equals(t, tc.expected, []float64{lat, lon})
+		})
+	}
+}
+
 func TestGetList(t *testing.T) {
 	g := testGroup{}
 	g.Init()
@@ -574,7 +704,7 @@ func TestGeolocationByIP(t *testing.T) {
 			internalIP, externalIP := GetNodeIPAddresses(tc.Node.DeepCopy())
 			result := false
 			if externalIP != "" {
-				result = GetGeolocationByIP(tc.Node.GetName(), externalIP)
+				result, _ = GetGeolocationByIP(tc.Node.GetName(), externalIP)
 			}
 			if internalIP != "" && result == false {
 				GetGeolocationByIP(tc.Node.GetName(), internalIP)
@@ -593,6 +723,148 @@ func TestGeolocationByIP(t *testing.T) {
 	}
 }
 
+func TestManualLocation(t *testing.T) {
+	g := testGroup{}
+	g.Init()
+	// Prepare cases
+	nodeObj := g.nodeObj
+	nodeObj.ObjectMeta = metav1.ObjectMeta{
+		Name: "manual.edge-net.io",
+		Labels: map[string]string{
+			"kubernetes.io/hostname": "manual.edge-net.io",
+		},
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeObj.DeepCopy(), metav1.CreateOptions{})
+
+	paris := apps_v1alpha.NodeLocation{Latitude: 48.8467, Longitude: 2.3574, Continent: "Europe", Country: "FR", State: "IDF", City: "Paris", Accuracy: 1}
+	err := SetLocationAnnotation(nodeObj.GetName(), paris)
+	util.OK(t, err)
+	node, err := g.client.CoreV1().Nodes().Get(context.TODO(), nodeObj.GetName(), metav1.GetOptions{})
+	util.OK(t, err)
+	location, exists, err := GetManualLocation(node)
+	util.OK(t, err)
+	util.Equals(t, true, exists)
+	util.Equals(t, Location{Continent: "Europe", Country: "FR", State: "IDF", City: "Paris", Latitude: 48.8467, Longitude: 2.3574, Source: SourceManual, Accuracy: 1}, location)
+
+	t.Run("labels", func(t *testing.T) {
+		err := SetGeolocation(nodeObj.GetName(), location)
+		util.OK(t, err)
+		node, err := g.client.CoreV1().Nodes().Get(context.TODO(), nodeObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		expected := map[string]string{
+			"kubernetes.io/hostname":           "manual.edge-net.io",
+			"edge-net.io/continent":            "Europe",
+			"edge-net.io/state-iso":            "IDF",
+			"edge-net.io/country-iso":          "FR",
+			"edge-net.io/city":                 "Paris",
+			"edge-net.io/lat":                  "n48.846700",
+			"edge-net.io/lon":                  "e2.357400",
+			"edge-net.io/location-source":      "manual",
+			"edge-net.io/location-accuracy-km": "1",
+			"topology.kubernetes.io/region":    "europe-fr",
+			"topology.kubernetes.io/zone":      "europe-fr-paris",
+		}
+		util.Equals(t, expected, node.GetLabels())
+
+		location.Accuracy = 0
+		location.Source = SourceIP2Location
+		err = SetGeolocation(nodeObj.GetName(), location)
+		util.OK(t, err)
+		node, err = g.client.CoreV1().Nodes().Get(context.TODO(), nodeObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		util.Equals(t, "ip2location", node.GetLabels()["edge-net.io/location-source"])
+		util.Equals(t, "unknown", node.GetLabels()["edge-net.io/location-accuracy-km"])
+
+		// The topology labels go along with the region
+		err = SetGeolocation(nodeObj.GetName(), Location{City: "Paris", Source: SourceIP2Location})
+		util.OK(t, err)
+		node, err = g.client.CoreV1().Nodes().Get(context.TODO(), nodeObj.GetName(), metav1.GetOptions{})
+		util.OK(t, err)
+		_, regionExists := node.GetLabels()[RegionLabel]
+		_, zoneExists := node.GetLabels()[ZoneLabel]
+		util.Equals(t, false, regionExists)
+		util.Equals(t, false, zoneExists)
+		util.Equals(t, "Paris", node.GetLabels()["edge-net.io/city"])
+
+		err = SetGeolocation(nodeObj.GetName(), Location{City: "Paris", Source: SourceIP2Location})
+		util.OK(t, err)
+	})
+
+	cases := map[string]struct {
+		annotations map[string]string
+		exists      bool
+		valid       bool
+	}{
+		"none":        {nil, false, true},
+		"malformed":   {map[string]string{LocationAnnotation: "Paris"}, true, false},
+		"range":       {map[string]string{LocationAnnotation: `{"lat":95,"lon":2.3574,"country":"FR"}`}, true, false},
+		"zero":        {map[string]string{LocationAnnotation: `{"lat":0,"lon":0,"country":"FR"}`}, true, false},
+		"country":     {map[string]string{LocationAnnotation: `{"lat":48.8467,"lon":2.3574}`}, true, false},
+		"accuracy":    {map[string]string{LocationAnnotation: `{"lat":48.8467,"lon":2.3574,"country":"FR","accuracy":-1}`}, true, false},
+		"coordinates": {map[string]string{LocationAnnotation: `{"lat":38.9896,"lon":-76.9457,"country":"US"}`}, true, true},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			node := nodeObj.DeepCopy()
+			node.SetAnnotations(tc.annotations)
+			_, exists, err := GetManualLocation(node)
+			util.Equals(t, tc.exists, exists)
+			util.Equals(t, tc.valid, err == nil)
+		})
+	}
+}
+
+type staticResolver map[string]Network
+
+func (s staticResolver) Network(ip net.IP) (Network, error) {
+	if network, ok := s[ip.String()]; ok {
+		return network, nil
+	}
+	return Network{}, ErrNetworkNotFound
+}
+
+func TestNetwork(t *testing.T) {
+	g := testGroup{}
+	g.Init()
+	SetNetworkResolver(staticResolver{
+		"132.227.123.51":  Network{ASN: 2200, Organization: "Renater"},
+		"206.196.180.220": Network{ASN: 27, Organization: "University of Maryland"},
+	})
+	defer SetNetworkResolver(nil)
+	nodeObj := g.nodeObj
+	nodeObj.ObjectMeta = metav1.ObjectMeta{
+		Name: "network.edge-net.io",
+		Labels: map[string]string{
+			"kubernetes.io/hostname": "network.edge-net.io",
+		},
+	}
+	g.client.CoreV1().Nodes().Create(context.TODO(), nodeObj.DeepCopy(), metav1.CreateOptions{})
+
+	// The cases run in order as the labels of a case may remain from the previous one
+	cases := []struct {
+		name       string
+		internalIP string
+		externalIP string
+		expected   map[string]string
+	}{
+		{"external", "10.0.0.12", "206.196.180.220", map[string]string{"edge-net.io/asn": "27", "edge-net.io/as-org": "University_of_Maryland", "edge-net.io/nat": "false"}},
+		{"internal", "132.227.123.51", "", map[string]string{"edge-net.io/asn": "2200", "edge-net.io/as-org": "Renater", "edge-net.io/nat": "false"}},
+		{"private", "192.168.1.20", "", map[string]string{"edge-net.io/nat": "true"}},
+		{"shared", "100.64.10.3", "", map[string]string{"edge-net.io/nat": "true"}},
+		{"unknown", "192.168.1.20", "8.8.8.8", map[string]string{"edge-net.io/nat": "false"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := SetNetwork(nodeObj.GetName(), tc.internalIP, tc.externalIP)
+			util.OK(t, err)
+			node, err := g.client.CoreV1().Nodes().Get(context.TODO(), nodeObj.GetName(), metav1.GetOptions{})
+			util.OK(t, err)
+			tc.expected["kubernetes.io/hostname"] = "network.edge-net.io"
+			util.Equals(t, tc.expected, node.GetLabels())
+		})
+	}
+}
+
 func TestSetOwnerReferences(t *testing.T) {
 	g := testGroup{}
 	g.Init()
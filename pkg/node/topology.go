@@ -0,0 +1,98 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The well-known labels that Kubernetes features such as the topology spread constraints and
+// the topology aware routing look at
+const (
+	RegionLabel = "topology.kubernetes.io/region"
+	ZoneLabel   = "topology.kubernetes.io/zone"
+)
+
+// The countries of each continent by their ISO 3166 codes, the continents are named as in the MaxMind databases
+var continentCountries = map[string]string{
+	"Africa": "AO BF BI BJ BW CD CF CG CI CM CV DJ DZ EG EH ER ET GA GH GM GN GQ GW KE KM LR LS LY MA MG ML MR MU MW MZ " +
+		"NA NE NG RE RW SC SD SH SL SN SO SS ST SZ TD TG TN TZ UG YT ZA ZM ZW",
+	"Antarctica": "AQ BV GS HM TF",
+	"Asia": "AE AF AM AZ BD BH BN BT CC CN CX GE HK ID IL IN IO IQ IR JO JP KG KH KP KR KW KZ LA LB LK MM MN MO MV MY " +
+		"NP OM PH PK PS QA SA SG SY TH TJ TM TR TW UZ VN YE",
+	"Europe": "AD AL AT AX BA BE BG BY CH CY CZ DE DK EE ES FI FO FR GB GG GI GR HR HU IE IM IS IT JE LI LT LU LV MC MD " +
+		"ME MK MT NL NO PL PT RO RS RU SE SI SJ SK SM UA VA XK",
+	"North America": "AG AI AW BB BL BM BQ BS BZ CA CR CU CW DM DO GD GL GP GT HN HT JM KN KY LC MF MQ MS MX NI PA PM PR " +
+		"SV SX TC TT US VC VG VI",
+	"Oceania":       "AS AU CK FJ FM GU KI MH MP NC NF NR NU NZ PF PG PN PW SB TK TL TO TV UM VU WF WS",
+	"South America": "AR BO BR CL CO EC FK GF GY PE PY SR UY VE",
+}
+
+// continentOf returns the continent of the country, or an empty string if the country is unknown
+func continentOf(country string) string {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if len(country) != 2 {
+		return ""
+	}
+	for continent, countries := range continentCountries {
+		for _, code := range strings.Fields(countries) {
+			if code == country {
+				return continent
+			}
+		}
+	}
+	return ""
+}
+
+// Topology returns the region and the zone of the location. The region joins the continent and the country,
+// such as europe-fr, and the zone adds the city, or the state when the city is unknown, such as europe-fr-paris.
+// The region is empty when the location has no country.
+func Topology(location Location) (string, string) {
+	continent := location.Continent
+	if continent == "" {
+		continent = continentOf(location.Country)
+	}
+	country := topologyName(location.Country)
+	if country == "" {
+		return "", ""
+	}
+	region := country
+	if continent != "" {
+		region = topologyName(continent + "-" + country)
+	}
+	place := location.City
+	if topologyName(place) == "" {
+		place = location.State
+	}
+	zone := region
+	if topologyName(place) != "" {
+		zone = topologyName(region + "-" + place)
+	}
+	return region, zone
+}
+
+// topologyName turns the name into the lower case form of the topology labels, the characters
+// other than letters and digits become dashes
+func topologyName(name string) string {
+	name = regexp.MustCompile("[^a-z0-9]+").ReplaceAllString(strings.ToLower(name), "-")
+	name = strings.Trim(name, "-")
+	if len(name) > 63 {
+		name = strings.Trim(name[0:63], "-")
+	}
+	return name
+}
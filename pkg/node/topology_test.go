@@ -0,0 +1,59 @@
+package node
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/EdgeNet-project/edgenet/pkg/util"
+)
+
+func TestContinentOf(t *testing.T) {
+	cases := map[string]string{
+		"FR": "Europe",
+		"us": "North America",
+		"BR": "South America",
+		"JP": "Asia",
+		"NZ": "Oceania",
+		"ZA": "Africa",
+		"AQ": "Antarctica",
+		"ZZ": "",
+		"":   "",
+	}
+	for input, expected := range cases {
+		util.Equals(t, expected, continentOf(input))
+	}
+	// A country belongs to a single continent
+	seen := map[string]string{}
+	for continent, countries := range continentCountries {
+		for _, code := range strings.Fields(countries) {
+			if previous, exists := seen[code]; exists {
+				t.Errorf("%s is in both %s and %s", code, previous, continent)
+			}
+			seen[code] = continent
+		}
+	}
+}
+
+func TestTopology(t *testing.T) {
+	cases := map[string]struct {
+		location Location
+		region   string
+		zone     string
+	}{
+		"city":      {Location{Continent: "Europe", Country: "FR", State: "IDF", City: "Paris"}, "europe-fr", "europe-fr-paris"},
+		"spaces":    {Location{Continent: "North America", Country: "US", State: "MD", City: "College Park"}, "north-america-us", "north-america-us-college-park"},
+		"accents":   {Location{Continent: "Europe", Country: "CH", State: "ZH", City: "Zürich"}, "europe-ch", "europe-ch-z-rich"},
+		"continent": {Location{Country: "US", State: "Maryland", City: "College Park"}, "north-america-us", "north-america-us-college-park"},
+		"state":     {Location{Continent: "Europe", Country: "FR", State: "IDF"}, "europe-fr", "europe-fr-idf"},
+		"country":   {Location{Country: "FR"}, "europe-fr", "europe-fr"},
+		"unknown":   {Location{Country: "ZZ", City: "Nowhere"}, "zz", "zz-nowhere"},
+		"none":      {Location{City: "Paris"}, "", ""},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			region, zone := Topology(tc.location)
+			util.Equals(t, tc.region, region)
+			util.Equals(t, tc.zone, zone)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package recorder
+
+import (
+	"context"
+	"sync"
+
+	edgenetscheme "github.com/EdgeNet-project/edgenet/pkg/generated/clientset/versioned/scheme"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+)
+
+// Scheme holds the kinds of both Kubernetes and EdgeNet so that the events can refer to the objects of either
+var Scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(Scheme))
+	utilruntime.Must(edgenetscheme.AddToScheme(Scheme))
+}
+
+// Handlers initialize other handlers on the fly, so a single broadcaster per clientset
+// is shared among the recorders rather than starting new goroutines at each call
+var broadcasters = struct {
+	sync.Mutex
+	list map[kubernetes.Interface]record.EventBroadcaster
+}{list: make(map[kubernetes.Interface]record.EventBroadcaster)}
+
+// New returns an event recorder which publishes the events of the component through the clientset, so that
+// kubectl describe shows what the controller did to an object and why
+func New(clientset kubernetes.Interface, component string) record.EventRecorder {
+	broadcasters.Lock()
+	defer broadcasters.Unlock()
+	eventBroadcaster, exists := broadcasters.list[clientset]
+	if !exists {
+		eventBroadcaster = record.NewBroadcaster()
+		eventBroadcaster.StartLogging(log.Infof)
+		eventBroadcaster.StartRecordingToSink(&eventSink{clientset: clientset})
+		broadcasters.list[clientset] = eventBroadcaster
+	}
+	return eventBroadcaster.NewRecorder(Scheme, corev1.EventSource{Component: component})
+}
+
+// eventSink writes each event into the namespace of the event itself
+type eventSink struct {
+	clientset kubernetes.Interface
+}
+
+// Create creates the event
+func (s *eventSink) Create(event *corev1.Event) (*corev1.Event, error) {
+	return s.clientset.CoreV1().Events(event.GetNamespace()).Create(context.TODO(), event, metav1.CreateOptions{})
+}
+
+// Update updates the event, which is the case when the same event repeats
+func (s *eventSink) Update(event *corev1.Event) (*corev1.Event, error) {
+	return s.clientset.CoreV1().Events(event.GetNamespace()).Update(context.TODO(), event, metav1.UpdateOptions{})
+}
+
+// Patch patches the event to increase its count
+func (s *eventSink) Patch(event *corev1.Event, data []byte) (*corev1.Event, error) {
+	return s.clientset.CoreV1().Events(event.GetNamespace()).Patch(context.TODO(), event.GetName(), types.StrategicMergePatchType, data, metav1.PatchOptions{})
+}
+
+// ReasonReconcileFailed is the reason of the condition and of the event that tell that a controller gave up on an object
+const ReasonReconcileFailed = "ReconcileFailed"
+
+// ReconcileFailed records that the controller gave up on the object once the retries of an event ran out. The message
+// goes first in the messages of the status, the condition of the type given turns false, which is Reconciled for most
+// of the resources and Applied for the selectivedeployments, and a warning event tells the same. The caller sets
+// the state if the failure changes it, and writes the status back.
+func ReconcileFailed(eventRecorder record.EventRecorder, object runtime.Object, messages *[]string, conditions *[]metav1.Condition, conditionType string, message string) {
+	*messages = append([]string{message}, *messages...)
+	condition := metav1.Condition{
+		Type:    conditionType,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonReconcileFailed,
+		Message: message,
+	}
+	if objectMeta, err := meta.Accessor(object); err == nil {
+		condition.ObservedGeneration = objectMeta.GetGeneration()
+	}
+	meta.SetStatusCondition(conditions, condition)
+	eventRecorder.Event(object, corev1.EventTypeWarning, ReasonReconcileFailed, message)
+}
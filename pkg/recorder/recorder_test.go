@@ -0,0 +1,70 @@
+package recorder
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apps_v1alpha "github.com/EdgeNet-project/edgenet/pkg/apis/apps/v1alpha"
+	"github.com/EdgeNet-project/edgenet/pkg/util"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/reference"
+)
+
+func TestNew(t *testing.T) {
+	client := testclient.NewSimpleClientset()
+	eventRecorder := New(client, "test")
+	sdObj := &apps_v1alpha.SelectiveDeployment{ObjectMeta: metav1.ObjectMeta{Name: "sd", Namespace: "default", UID: "sd"}}
+	eventRecorder.Event(sdObj, corev1.EventTypeNormal, "Test", "An event about a selectivedeployment")
+	var events *corev1.EventList
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		var err error
+		events, err = client.CoreV1().Events("default").List(context.TODO(), metav1.ListOptions{})
+		return err == nil && len(events.Items) == 1, err
+	})
+	util.OK(t, err)
+	util.Equals(t, "SelectiveDeployment", events.Items[0].InvolvedObject.Kind)
+	util.Equals(t, "sd", events.Items[0].InvolvedObject.Name)
+	util.Equals(t, "Test", events.Items[0].Reason)
+	util.Equals(t, "test", events.Items[0].Source.Component)
+}
+
+func TestScheme(t *testing.T) {
+	// The objects in the caches of the informers carry no type meta, so their kinds come from the scheme
+	cases := map[string]struct {
+		object     runtime.Object
+		kind       string
+		apiVersion string
+	}{
+		"edgenet":    {&apps_v1alpha.SelectiveDeployment{ObjectMeta: metav1.ObjectMeta{Name: "sd", Namespace: "default"}}, "SelectiveDeployment", "apps.edgenet.io/v1alpha"},
+		"kubernetes": {&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}, "Node", "v1"},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			ref, err := reference.GetReference(Scheme, tc.object)
+			util.OK(t, err)
+			util.Equals(t, tc.kind, ref.Kind)
+			util.Equals(t, tc.apiVersion, ref.APIVersion)
+		})
+	}
+}
+
+func TestReconcileFailed(t *testing.T) {
+	eventRecorder := record.NewFakeRecorder(1)
+	sdObj := &apps_v1alpha.SelectiveDeployment{ObjectMeta: metav1.ObjectMeta{Name: "sd", Namespace: "default", Generation: 2}}
+	sdObj.Status.Message = []string{"Workloads created"}
+	ReconcileFailed(eventRecorder, sdObj, &sdObj.Status.Message, &sdObj.Status.Conditions, "Applied", "Reconciliation failed")
+	util.Equals(t, []string{"Reconciliation failed", "Workloads created"}, sdObj.Status.Message)
+	condition := meta.FindStatusCondition(sdObj.Status.Conditions, "Applied")
+	util.Equals(t, metav1.ConditionFalse, condition.Status)
+	util.Equals(t, ReasonReconcileFailed, condition.Reason)
+	util.Equals(t, int64(2), condition.ObservedGeneration)
+	util.Equals(t, "Warning ReconcileFailed Reconciliation failed", <-eventRecorder.Events)
+}
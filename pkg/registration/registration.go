@@ -286,7 +286,7 @@ func CreateConfig(serviceAccount *corev1.ServiceAccount) string {
 		return fmt.Sprintf("Error getting secret %s: %v", serviceAccount.GetName(), statusError.ErrStatus)
 	} else if err != nil {
 		log.Println(err.Error())
-		panic(err.Error())
+		return fmt.Sprintf("Error getting secret %s: %v", serviceAccount.GetName(), err)
 	}
 	// Define the cluster and server by taking advantage of the current config file
 	/*cluster, server, _, err := util.GetClusterServerOfCurrentContext()
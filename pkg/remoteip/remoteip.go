@@ -67,6 +67,19 @@ func isPrivateSubnet(ipAddress net.IP) bool {
 	return false
 }
 
+// IsPrivate tells whether the IP address belongs to a private or a shared address space, which the
+// hosts reach the internet from through a NAT, the IPv6 unique local addresses included
+func IsPrivate(ipAddress net.IP) bool {
+	if ipAddress = ipAddress.To16(); ipAddress == nil {
+		return false
+	}
+	if ipAddress.IsLoopback() || ipAddress.IsLinkLocalUnicast() || isPrivateSubnet(ipAddress) {
+		return true
+	}
+	// Unique local addresses, fc00::/7
+	return ipAddress.To4() == nil && len(ipAddress) == net.IPv6len && ipAddress[0]&0xfe == 0xfc
+}
+
 func getIPAdress(r *http.Request) string {
 	for _, h := range []string{"X-Forwarded-For", "X-Real-Ip"} {
 		addresses := strings.Split(r.Header.Get(h), ",")
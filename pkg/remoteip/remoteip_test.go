@@ -55,6 +55,27 @@ func TestIsPrivateSubnet(t *testing.T) {
 	}
 }
 
+func TestIsPrivate(t *testing.T) {
+	cases := []struct {
+		input    net.IP
+		expected bool
+	}{
+		{net.ParseIP("10.0.0.54"), true},
+		{net.ParseIP("10.0.0.54").To4(), true},
+		{net.ParseIP("127.0.0.1"), true},
+		{net.ParseIP("169.254.10.1"), true},
+		{net.ParseIP("fd12:3456:789a::1"), true},
+		{net.ParseIP("fe80::1"), true},
+		{net.ParseIP("132.227.123.51"), false},
+		{net.ParseIP("2001:660:3302::1"), false},
+		{nil, false},
+	}
+	for _, tc := range cases {
+		output := IsPrivate(tc.input)
+		util.Equals(t, tc.expected, output)
+	}
+}
+
 func TestGetIPAdress(t *testing.T) {
 	cases := []struct {
 		input    string
@@ -0,0 +1,227 @@
+/*
+Copyright 2020 Sorbonne Université
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schedule
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxWindowDuration bounds the duration of a window so that looking for the window open at a time stays cheap
+const MaxWindowDuration = 7 * 24 * time.Hour
+
+// Cron is a cron expression of five fields, minute, hour, day of month, month, and day of week, evaluated in UTC
+type Cron struct {
+	minute     uint64
+	hour       uint64
+	dayOfMonth uint64
+	month      uint64
+	dayOfWeek  uint64
+	// As in cron, a day matches either of the day fields when both of them are restricted
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+// cronField is the range of values a field of a cron expression takes
+type cronField struct {
+	name string
+	min  int
+	max  int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// ParseCron decodes a cron expression such as "0 8 * * 1-5" or "*/30 * * * *". The fields support the lists,
+// the ranges, and the steps, whereas the names of months and days are not supported.
+func ParseCron(expression string) (Cron, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return Cron{}, fmt.Errorf("a cron expression has %d fields, %d given", len(cronFields), len(fields))
+	}
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		if bits[i], err = parseCronField(field, cronFields[i]); err != nil {
+			return Cron{}, err
+		}
+	}
+	// Sunday is both 0 and 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return Cron{
+		minute:        bits[0],
+		hour:          bits[1],
+		dayOfMonth:    bits[2],
+		month:         bits[3],
+		dayOfWeek:     bits[4],
+		anyDayOfMonth: fields[2] == "*",
+		anyDayOfWeek:  fields[4] == "*",
+	}, nil
+}
+
+// parseCronField sets a bit for each value that the field matches
+func parseCronField(field string, limits cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if slash := strings.Index(part, "/"); slash != -1 {
+			var err error
+			if step, err = strconv.Atoi(part[slash+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("%s step %q is invalid", limits.name, part[slash+1:])
+			}
+			part = part[:slash]
+		}
+		start, end := limits.min, limits.max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("%s value %q is invalid", limits.name, bounds[0])
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("%s value %q is invalid", limits.name, bounds[1])
+				}
+			} else if step != 1 {
+				// A step after a single value runs to the end of the field
+				end = limits.max
+			}
+		}
+		if start < limits.min || end > limits.max || start > end {
+			return 0, fmt.Errorf("%s range %d-%d is out of %d-%d", limits.name, start, end, limits.min, limits.max)
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+// Matches tells whether the minute of the time given matches the expression
+func (c Cron) Matches(t time.Time) bool {
+	t = t.UTC()
+	return c.month&(1<<uint(t.Month())) != 0 && c.matchesDay(t) &&
+		c.hour&(1<<uint(t.Hour())) != 0 && c.minute&(1<<uint(t.Minute())) != 0
+}
+
+func (c Cron) matchesDay(t time.Time) bool {
+	dayOfMonth := c.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := c.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if c.anyDayOfMonth || c.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+// Next returns the first minute strictly after the time given that matches the expression,
+// the months, the days, and the hours that don't match are skipped at once
+func (c Cron) Next(t time.Time) (time.Time, bool) {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	// Some expressions never match, such as the 31st of February, which takes a few years to tell
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// Window opens at the times matching the cron expression and closes after the duration
+type Window struct {
+	Cron     Cron
+	Duration time.Duration
+}
+
+// ParseWindow decodes the cron expression and the duration of a window
+func ParseWindow(expression string, duration string) (Window, error) {
+	cron, err := ParseCron(expression)
+	if err != nil {
+		return Window{}, err
+	}
+	length, err := time.ParseDuration(duration)
+	if err != nil {
+		return Window{}, err
+	}
+	if length <= 0 || length > MaxWindowDuration {
+		return Window{}, fmt.Errorf("duration must be greater than 0 and at most %s", MaxWindowDuration)
+	}
+	return Window{Cron: cron, Duration: length}, nil
+}
+
+// IsOpen tells whether the window opened within the duration before the time given
+func (w Window) IsOpen(t time.Time) bool {
+	start, ok := w.Cron.Next(t.Add(-w.Duration))
+	return ok && !start.After(t)
+}
+
+// NextOpening returns the time the window opens after the time given
+func (w Window) NextOpening(t time.Time) (time.Time, bool) {
+	return w.Cron.Next(t)
+}
+
+// Clock is a time of day in minutes after midnight
+type Clock int
+
+// ParseClock decodes a time of day in the form of HH:MM
+func ParseClock(value string) (Clock, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not in the form of HH:MM", value)
+	}
+	return Clock(parsed.Hour()*60 + parsed.Minute()), nil
+}
+
+// LocalClock returns the mean solar time at the longitude given, which shifts by an hour every 15 degrees
+func LocalClock(lon float64, t time.Time) Clock {
+	t = t.UTC()
+	minutes := float64(t.Hour()*60+t.Minute()) + lon*4
+	return Clock(int(math.Floor(minutes)+24*60) % (24 * 60))
+}
+
+// Within tells whether the clock is between from, included, and to, excluded. The range goes past midnight when to comes before from.
+func (c Clock) Within(from Clock, to Clock) bool {
+	if from <= to {
+		return from <= c && c < to
+	}
+	return c >= from || c < to
+}
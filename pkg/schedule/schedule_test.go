@@ -0,0 +1,136 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EdgeNet-project/edgenet/pkg/util"
+)
+
+func TestParseCron(t *testing.T) {
+	cases := map[string]struct {
+		expression string
+		valid      bool
+	}{
+		"every minute":  {"* * * * *", true},
+		"weekdays":      {"0 8 * * 1-5", true},
+		"steps":         {"*/15 0-12/2 * * *", true},
+		"lists":         {"0,30 6,18 1,15 * *", true},
+		"sunday as 7":   {"0 0 * * 7", true},
+		"fields":        {"0 8 * *", false},
+		"out of range":  {"60 * * * *", false},
+		"inverted":      {"0 12-6 * * *", false},
+		"zero step":     {"*/0 * * * *", false},
+		"month name":    {"0 0 1 jan *", false},
+		"negative step": {"*/-5 * * * *", false},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			_, err := ParseCron(tc.expression)
+			util.Equals(t, tc.valid, err == nil)
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2020, 11, 18, 10, 30, 0, 0, time.UTC)
+	cases := map[string]struct {
+		expression string
+		expected   time.Time
+	}{
+		"every minute":    {"* * * * *", time.Date(2020, 11, 18, 10, 31, 0, 0, time.UTC)},
+		"same day":        {"0 12 * * *", time.Date(2020, 11, 18, 12, 0, 0, 0, time.UTC)},
+		"next day":        {"0 8 * * *", time.Date(2020, 11, 19, 8, 0, 0, 0, time.UTC)},
+		"weekend":         {"0 8 * * 6,0", time.Date(2020, 11, 21, 8, 0, 0, 0, time.UTC)},
+		"sunday as 7":     {"0 8 * * 7", time.Date(2020, 11, 22, 8, 0, 0, 0, time.UTC)},
+		"next year":       {"0 0 1 1 *", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		"day of month or": {"0 0 1 * 5", time.Date(2020, 11, 20, 0, 0, 0, 0, time.UTC)},
+		"leap day":        {"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			cron, err := ParseCron(tc.expression)
+			util.OK(t, err)
+			next, ok := cron.Next(now)
+			util.Equals(t, true, ok)
+			util.Equals(t, tc.expected, next)
+			util.Equals(t, true, cron.Matches(next))
+		})
+	}
+	t.Run("never", func(t *testing.T) {
+		cron, err := ParseCron("0 0 31 2 *")
+		util.OK(t, err)
+		_, ok := cron.Next(now)
+		util.Equals(t, false, ok)
+	})
+}
+
+func TestWindow(t *testing.T) {
+	window, err := ParseWindow("0 8 * * 1-5", "2h")
+	util.OK(t, err)
+	cases := map[string]struct {
+		time     time.Time
+		expected bool
+	}{
+		"opening":      {time.Date(2020, 11, 18, 8, 0, 0, 0, time.UTC), true},
+		"open":         {time.Date(2020, 11, 18, 9, 59, 0, 0, time.UTC), true},
+		"closing":      {time.Date(2020, 11, 18, 10, 0, 0, 0, time.UTC), false},
+		"before":       {time.Date(2020, 11, 18, 7, 59, 0, 0, time.UTC), false},
+		"weekend":      {time.Date(2020, 11, 21, 9, 0, 0, 0, time.UTC), false},
+		"other offset": {time.Date(2020, 11, 18, 10, 0, 0, 0, time.FixedZone("CET", 3600)), true},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			util.Equals(t, tc.expected, window.IsOpen(tc.time))
+		})
+	}
+	t.Run("next opening", func(t *testing.T) {
+		next, ok := window.NextOpening(time.Date(2020, 11, 20, 9, 0, 0, 0, time.UTC))
+		util.Equals(t, true, ok)
+		util.Equals(t, time.Date(2020, 11, 23, 8, 0, 0, 0, time.UTC), next)
+	})
+	t.Run("duration", func(t *testing.T) {
+		_, err := ParseWindow("0 8 * * *", "0s")
+		util.Equals(t, true, err != nil)
+		_, err = ParseWindow("0 8 * * *", "200h")
+		util.Equals(t, true, err != nil)
+		_, err = ParseWindow("0 8 * * *", "two hours")
+		util.Equals(t, true, err != nil)
+	})
+}
+
+func TestClock(t *testing.T) {
+	from, err := ParseClock("08:00")
+	util.OK(t, err)
+	to, err := ParseClock("20:00")
+	util.OK(t, err)
+	_, err = ParseClock("8h")
+	util.Equals(t, true, err != nil)
+	noon := time.Date(2020, 11, 18, 12, 0, 0, 0, time.UTC)
+	cases := map[string]struct {
+		lon      float64
+		expected Clock
+		daytime  bool
+	}{
+		"greenwich": {0, 12 * 60, true},
+		"paris":     {2.35, 12*60 + 9, true},
+		"dallas":    {-96.78, 5*60 + 32, false},
+		"tokyo":     {139.69, 21*60 + 18, false},
+		"dateline":  {-180, 0, false},
+	}
+	for k, tc := range cases {
+		t.Run(k, func(t *testing.T) {
+			clock := LocalClock(tc.lon, noon)
+			util.Equals(t, tc.expected, clock)
+			util.Equals(t, tc.daytime, clock.Within(from, to))
+		})
+	}
+	t.Run("past midnight", func(t *testing.T) {
+		night, _ := ParseClock("22:00")
+		morning, _ := ParseClock("06:00")
+		util.Equals(t, true, Clock(23*60).Within(night, morning))
+		util.Equals(t, true, Clock(5*60).Within(night, morning))
+		util.Equals(t, false, Clock(12*60).Within(night, morning))
+	})
+}